@@ -0,0 +1,82 @@
+// Command ebl2wav-gui converts E-MU banks from a page opened in the browser, picking
+// folders by browsing or drag and drop, for users who don't use the command line.
+// The page is only served on the loopback interface.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/gui"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:0", "Address to listen on, a free port by default")
+	noBrowser := flag.Bool("no-browser", false, "Don't open the page in the browser, only print its address")
+	debug := flag.Bool("d", false, "Debug mode")
+	flag.Parse()
+
+	token, err := newToken()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	app, err := gui.NewApp(gui.Options{
+		Debug:     *debug,
+		Token:     token,
+		UploadDir: filepath.Join(os.TempDir(), "ebl2wav-gui"),
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	url := fmt.Sprintf("http://%s/?token=%s", listener.Addr(), token)
+	fmt.Printf("ebl2wav is running at %s\nPress Ctrl+C to quit.\n", url)
+	if !*noBrowser {
+		if err := openBrowser(url); err != nil {
+			fmt.Printf("Couldn't open the browser (%v), open the address above instead.\n", err)
+		}
+	}
+
+	if err := http.Serve(listener, app); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newToken returns a random token authenticating the page
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// openBrowser opens url in the default browser
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/analysis"
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// analyzeOptions holds the flags of the analyze subcommand
+type analyzeOptions struct {
+	jsonOutput  bool
+	csvPath     string
+	threshold   float64
+	correlation float64
+	minFiles    int
+	debug       bool
+}
+
+func (o *analyzeOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("analyze")
+	fs.BoolVar(&o.jsonOutput, "json", false, "Print the report as JSON")
+	fs.StringVar(&o.csvPath, "csv", "", "Also write the header values of every file to this CSV file")
+	fs.Float64Var(&o.threshold, "threshold", 0.95, "Share of the files a relation must hold for to be reported (0-1)")
+	fs.Float64Var(&o.correlation, "correlation", 0.99, "Minimum correlation coefficient reported between values (0-1)")
+	fs.IntVar(&o.minFiles, "min-files", 2, "Files a group (mono, stereo, variant) needs to be analyzed")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runAnalyze reports the distributions and relations of the header fields across
+// EBL files: ebl2wav analyze [options] <file.ebl|bank.exb|dir>...
+func runAnalyze(args []string) {
+	var opts analyzeOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if opts.threshold <= 0 || opts.threshold > 1 || opts.correlation <= 0 || opts.correlation > 1 {
+		fmt.Println("Error: -threshold and -correlation must be between 0 and 1")
+		os.Exit(1)
+	}
+
+	var files []string
+	for _, arg := range fs.Args() {
+		found, err := findEBLFiles(arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, found...)
+	}
+
+	parser := ebl.NewParser(opts.debug, false)
+	parser.SetHeadersOnly(true)
+	corpus := analysis.NewCorpus()
+	for _, file := range files {
+		eblFile, err := parser.ReadFile(file, "")
+		if err != nil {
+			corpus.AddFailure(file, err)
+			continue
+		}
+		corpus.Add(file, eblFile)
+	}
+	if corpus.Len() == 0 {
+		fmt.Println("No EBL files could be parsed.")
+		os.Exit(exitNothingFound)
+	}
+
+	if opts.csvPath != "" {
+		file, err := os.Create(opts.csvPath)
+		if err != nil {
+			fmt.Printf("Error creating CSV file: %v\n", err)
+			os.Exit(1)
+		}
+		err = corpus.WriteCSV(file)
+		file.Close()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	report := corpus.Analyze(analysis.Options{
+		Threshold:   opts.threshold,
+		Correlation: opts.correlation,
+		MinFiles:    opts.minFiles,
+	})
+
+	if opts.jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	printAnalysis(report)
+}
+
+// printAnalysis prints an analysis report
+func printAnalysis(report *analysis.Report) {
+	fmt.Printf("Analyzed %d EBL files", report.Files)
+	if len(report.Failures) > 0 {
+		fmt.Printf(" (%d could not be parsed)", len(report.Failures))
+	}
+	fmt.Println()
+
+	var scopes []string
+	for scope, n := range report.Scopes {
+		if scope != analysis.ScopeAll {
+			scopes = append(scopes, fmt.Sprintf("%s: %d", scope, n))
+		}
+	}
+	sort.Strings(scopes)
+	fmt.Printf("Groups: %s\n\n", strings.Join(scopes, ", "))
+
+	for _, field := range report.Fields {
+		fmt.Println(field.Name)
+		fmt.Printf("  Range:      %d..%d (%d distinct)\n", field.Min, field.Max, field.Distinct)
+
+		var common []string
+		for _, vc := range field.Common {
+			common = append(common, fmt.Sprintf("%d (%.1f%%)", vc.Value, 100*float64(vc.Count)/float64(report.Files)))
+		}
+		fmt.Printf("  Common:     %s\n", strings.Join(common, ", "))
+
+		for _, rel := range field.Relations {
+			fmt.Printf("  Relation:   %-40s %5.1f%% of %d %s files\n", rel.Expr, 100*rel.Share, rel.Files, rel.Scope)
+		}
+		for _, corr := range field.Correlations {
+			fmt.Printf("  Correlates: %-40s r=%.4f\n", corr.With, corr.R)
+		}
+		if len(field.Relations) == 0 && len(field.Correlations) == 0 {
+			fmt.Println("  No relation found")
+		}
+		fmt.Println()
+	}
+
+	var failed []string
+	for path := range report.Failures {
+		failed = append(failed, path)
+	}
+	sort.Strings(failed)
+	for _, path := range failed {
+		fmt.Printf("Failed: %s: %s\n", path, report.Failures[path])
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/catalog"
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/dspreset"
+	"github.com/mattetti/e-mu-soundbanks/internal/inventory"
+	"github.com/mattetti/e-mu-soundbanks/internal/keymap"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// bankArchive receives the converted files of a bank with -zip or -tar. Files are
+// written straight into the archive as they are encoded, nothing is staged on disk.
+type bankArchive struct {
+	sink      sink.Sink
+	dir       string // Folder of the bank in the archive, "." for its root
+	name      string // Bank name
+	outputDir string
+
+	// With -zip
+	zip     *sink.Zip
+	zipFile *atomicfile.File
+	zipPath string
+}
+
+// openArchive returns the archive the bank named name is converted into, nil without
+// -zip and -tar. Zip archives are written to <outputDir>/<name>.zip, banks go into a
+// <name>/ folder of the -tar stream.
+func openArchive(outputDir, name string) (*bankArchive, error) {
+	switch {
+	case zipMode:
+		zipPath := filepath.Join(outputDir, name+".zip")
+		// Written under a temporary name until complete
+		file, err := atomicfile.Create(zipPath)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zip file: %w", err)
+		}
+		zip := sink.NewZip(file)
+		return &bankArchive{sink: zip, dir: ".", name: name, outputDir: outputDir, zip: zip, zipFile: file, zipPath: zipPath}, nil
+	case tarStream != nil:
+		return &bankArchive{sink: tarStream, dir: name, name: name, outputDir: outputDir}, nil
+	}
+	return nil, nil
+}
+
+// destination returns the sink the converter writes to, nil without archive
+func (a *bankArchive) destination() sink.Sink {
+	if a == nil {
+		return nil
+	}
+	return a.sink
+}
+
+// write writes the file of the bank named name into the archive
+func (a *bankArchive) write(name string, encode func(w io.Writer) error) error {
+	w, err := a.sink.Create(path.Join(filepath.ToSlash(a.dir), name))
+	if err != nil {
+		return err
+	}
+	if err := encode(w); err != nil {
+		if aborter, ok := w.(sink.Aborter); ok {
+			aborter.Abort()
+		}
+		return err
+	}
+	return w.Close()
+}
+
+// finish writes the files describing the bank into the archive, from the manifest of
+// the converted samples: DecentSampler preset, catalog and README as requested. The
+// samples are then recorded in the -db database and the -zip archive is completed.
+func (a *bankArchive) finish(conv *converter.Converter, out io.Writer) {
+	m := conv.Manifest(a.dir)
+	rootFiles := []string{manifest.Filename}
+
+	if dsPreset {
+		presetName := a.name + ".dspreset"
+		exporter := dspreset.NewExporter(debugMode)
+		exporter.SetOutput(out)
+		var samples []keymap.Sample
+		for _, sample := range m.Samples {
+			if ext := path.Ext(sample.Output); ext == ".wav" || ext == ".flac" {
+				s := keymap.Sample{Path: sample.Output, RootKey: -1}
+				if sample.RootKey != nil {
+					s.RootKey = *sample.RootKey
+				}
+				samples = append(samples, s)
+			}
+		}
+
+		err := fmt.Errorf("no samples found in %s", a.name)
+		if len(samples) > 0 {
+			err = a.write(presetName, func(w io.Writer) error {
+				return exporter.Encode(w, a.name, samples)
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error exporting DecentSampler preset: %v\n", err)
+		} else {
+			rootFiles = append(rootFiles, presetName)
+		}
+	}
+
+	if catalogFmt != "" {
+		err := a.write(catalog.Filename(catalogFmt), func(w io.Writer) error {
+			return catalog.Encode(w, catalogFmt, m)
+		})
+		if err != nil {
+			fmt.Fprintf(out, "Error exporting catalog: %v\n", err)
+		} else {
+			rootFiles = append(rootFiles, catalog.Filename(catalogFmt))
+		}
+	}
+
+	if readmeMode {
+		inv := inventory.New(m, a.name, rootFiles)
+		err := a.write(inventory.MarkdownFilename, func(w io.Writer) error {
+			_, err := io.WriteString(w, inv.Markdown())
+			return err
+		})
+		if err == nil {
+			err = a.write(inventory.HTMLFilename, inv.HTML)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error writing inventory: %v\n", err)
+		}
+	}
+
+	if a.zip == nil {
+		checkTar()
+		logf(out, "Archived %s\n", a.name)
+		return
+	}
+
+	err := a.zip.Close()
+	if closeErr := a.zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		a.zipFile.Abort()
+		fmt.Fprintf(out, "Error packaging %s: %v\n", a.name, err)
+		return
+	}
+	if sampleDB != nil {
+		addToDatabase(m, a.outputDir, a.name, a.zipPath, out)
+	}
+	logf(out, "Packaged %s\n", a.zipPath)
+}
+
+// discard drops the archive of a bank which couldn't be converted
+func (a *bankArchive) discard() {
+	if a == nil {
+		return
+	}
+	if a.zip != nil {
+		a.zipFile.Abort()
+		return
+	}
+	checkTar()
+}
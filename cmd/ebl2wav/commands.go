@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command describes a subcommand
+type command struct {
+	Name    string
+	Args    string // Arguments shown in the usage line
+	Summary string
+	Flags   func() *flag.FlagSet // Returns the flags of the command, used for help and completion
+	Run     func(args []string)
+}
+
+// commands lists the subcommands, set in init as some of them print the usage
+var commands []command
+
+func init() {
+	commands = []command{
+		{"convert", "[options] <file.ebl|bank.exb|dir>", "Convert samples, a bank or a directory of banks",
+			func() *flag.FlagSet { return flag.CommandLine }, runConvert},
+		{"inspect", "[options] <file.ebl|bank.exb|dir>...", "Print the header details of EBL files",
+			func() *flag.FlagSet { return new(inspectOptions).flags() }, runInspect},
+		{"stat", "[options] <file.ebl|bank.exb|dir>...", "Print the details of EBL files one per line, for shell pipelines",
+			func() *flag.FlagSet { return new(statOptions).flags() }, runStat},
+		{"play", "[options] <file.ebl|bank.exb|dir>...", "Play EBL files through the default audio device",
+			func() *flag.FlagSet { return new(playOptions).flags() }, runPlay},
+		{"analyze", "[options] <file.ebl|bank.exb|dir>...", "Report how the header fields are distributed and related across EBL files",
+			func() *flag.FlagSet { return new(analyzeOptions).flags() }, runAnalyze},
+		{"presets", "[options] <dir>...", "Write DecentSampler presets for converted samples",
+			func() *flag.FlagSet { return new(presetsOptions).flags() }, runPresets},
+		{"verify", "[options] [dir]...", "Audit converted libraries against their manifests",
+			func() *flag.FlagSet { return new(verifyOptions).flags() }, runVerify},
+		{"diff", "[options] <bank.exb|dir> <bank.exb|dir>", "Compare two banks, or a bank and a converted output directory",
+			func() *flag.FlagSet { return new(diffOptions).flags() }, runDiff},
+		{"pack", "[options] <dir>...", "Move converted directories into zip archives",
+			func() *flag.FlagSet { return new(packOptions).flags() }, runPack},
+		{"serve", "[options]", "Start the HTTP server",
+			func() *flag.FlagSet { return new(serveOptions).flags() }, runServe},
+		{"rpc", "[options]", "Start the JSON-RPC service",
+			func() *flag.FlagSet { return new(rpcOptions).flags() }, runRPC},
+		{"completion", "<bash|zsh|fish|powershell>", "Print a shell completion script",
+			func() *flag.FlagSet { return newFlagSet("completion") }, runCompletion},
+	}
+}
+
+// findCommand returns the subcommand with the given name, nil if there is none
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// newFlagSet creates the flag set of a subcommand, printing its usage on -h
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		if cmd := findCommand(name); cmd != nil {
+			fmt.Printf("Usage: ebl2wav %s %s\n\n%s.\n", cmd.Name, cmd.Args, cmd.Summary)
+		}
+		if len(commandFlags(fs)) > 0 {
+			fmt.Println("\nOptions:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseFlags parses the flags of a subcommand, exiting on -h or a usage error
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		exitParseError(err)
+	}
+}
+
+// exitParseError exits after a flag set failed to parse, having printed the error and
+// its usage: successfully for -h, with exitUsage otherwise
+func exitParseError(err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		exit(exitOK)
+	}
+	exit(exitUsage)
+}
+
+// commandFlags returns the flags of a flag set in lexical order
+func commandFlags(fs *flag.FlagSet) []*flag.Flag {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+// isBoolFlag reports whether a flag is a switch which doesn't take a value
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// helpFlag describes a flag in the -help-json output
+type helpFlag struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // bool, string, int...
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// helpCommand describes a subcommand in the -help-json output
+type helpCommand struct {
+	Name    string     `json:"name"`
+	Usage   string     `json:"usage"`
+	Summary string     `json:"summary"`
+	Flags   []helpFlag `json:"flags"`
+}
+
+// helpOutput is the -help-json output, describing the CLI for wrappers and GUIs
+type helpOutput struct {
+	Name           string        `json:"name"`
+	Version        string        `json:"version"`
+	DefaultCommand string        `json:"defaultCommand"` // Command run when the arguments don't start with a command name
+	Commands       []helpCommand `json:"commands"`
+}
+
+// printHelpJSON prints the commands and their flags as JSON
+func printHelpJSON() {
+	help := helpOutput{
+		Name:           "ebl2wav",
+		Version:        VERSION,
+		DefaultCommand: "convert",
+	}
+	for _, cmd := range commands {
+		hc := helpCommand{
+			Name:    cmd.Name,
+			Usage:   fmt.Sprintf("ebl2wav %s %s", cmd.Name, cmd.Args),
+			Summary: cmd.Summary,
+			Flags:   []helpFlag{},
+		}
+		for _, f := range commandFlags(cmd.Flags()) {
+			flagType := "string"
+			if getter, ok := f.Value.(flag.Getter); ok {
+				flagType = fmt.Sprintf("%T", getter.Get())
+			}
+			hc.Flags = append(hc.Flags, helpFlag{
+				Name:    f.Name,
+				Type:    flagType,
+				Default: f.DefValue,
+				Usage:   f.Usage,
+			})
+		}
+		help.Commands = append(help.Commands, hc)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(help); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// shells lists the shells completion scripts are generated for
+var shells = []string{"bash", "zsh", "fish", "powershell"}
+
+// runCompletion prints a shell completion script: ebl2wav completion <shell>
+func runCompletion(args []string) {
+	fs := newFlagSet("completion")
+	parseFlags(fs, args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	switch fs.Arg(0) {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		writeZshCompletion(os.Stdout)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	case "powershell":
+		writePowerShellCompletion(os.Stdout)
+	default:
+		fmt.Printf("Error: unknown shell %q, use one of %s\n", fs.Arg(0), strings.Join(shells, ", "))
+		os.Exit(1)
+	}
+}
+
+// commandNames returns the names of the subcommands
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.Name
+	}
+	return names
+}
+
+// writeBashCompletion writes the bash completion script. Flag values and inputs are
+// completed as file names by bash itself.
+func writeBashCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# bash completion for ebl2wav, generated by \"ebl2wav completion bash\"")
+	fmt.Fprintln(w, "# Load it with: source <(ebl2wav completion bash)")
+	fmt.Fprintln(w, "_ebl2wav() {")
+	fmt.Fprintln(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\"")
+	fmt.Fprintln(w, "    local prev=\"${COMP_WORDS[COMP_CWORD-1]}\"")
+	fmt.Fprintf(w, "    local commands=\"%s\"\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w, "    local command=convert")
+	fmt.Fprintln(w, "    if [[ $COMP_CWORD -gt 1 && \" $commands \" == *\" ${COMP_WORDS[1]} \"* ]]; then")
+	fmt.Fprintln(w, "        command=\"${COMP_WORDS[1]}\"")
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    local flags values")
+	fmt.Fprintln(w, "    case \"$command\" in")
+	for _, cmd := range commands {
+		var flags, values []string
+		for _, f := range commandFlags(cmd.Flags()) {
+			flags = append(flags, "-"+f.Name)
+			if !isBoolFlag(f) {
+				values = append(values, "-"+f.Name)
+			}
+		}
+		fmt.Fprintf(w, "        %s) flags=\"%s\" values=\"%s\" ;;\n", cmd.Name, strings.Join(flags, " "), strings.Join(values, " "))
+	}
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    if [[ \" $values \" == *\" $prev \"* ]]; then")
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    elif [[ $cur == -* ]]; then")
+	fmt.Fprintln(w, "        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))")
+	fmt.Fprintln(w, "    elif [[ $COMP_CWORD -eq 1 ]]; then")
+	fmt.Fprintln(w, "        COMPREPLY=($(compgen -W \"$commands\" -- \"$cur\"))")
+	fmt.Fprintln(w, "    elif [[ $command == completion ]]; then")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(shells, " "))
+	fmt.Fprintln(w, "    fi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o default -F _ebl2wav ebl2wav")
+}
+
+// writeZshCompletion writes the zsh completion script
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, "#compdef ebl2wav")
+	fmt.Fprintln(w, "# zsh completion for ebl2wav, generated by \"ebl2wav completion zsh\"")
+	fmt.Fprintln(w, "# Save it as _ebl2wav in a directory of your $fpath")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "_ebl2wav() {")
+	fmt.Fprintln(w, "  local -a commands names")
+	fmt.Fprintln(w, "  commands=(")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    %s\n", zshQuote(cmd.Name+":"+strings.ReplaceAll(cmd.Summary, ":", `\:`)))
+	}
+	fmt.Fprintln(w, "  )")
+	fmt.Fprintf(w, "  names=(%s)\n", strings.Join(commandNames(), " "))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  local command=convert")
+	fmt.Fprintln(w, "  if (( CURRENT > 2 && ${names[(Ie)$words[2]]} )); then")
+	fmt.Fprintln(w, "    command=$words[2]")
+	fmt.Fprintln(w, "    shift words")
+	fmt.Fprintln(w, "    (( CURRENT-- ))")
+	fmt.Fprintln(w, "  elif (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then")
+	fmt.Fprintln(w, "    _describe -t commands 'command' commands")
+	fmt.Fprintln(w, "    _files")
+	fmt.Fprintln(w, "    return")
+	fmt.Fprintln(w, "  fi")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "  case $command in")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "    %s)\n", cmd.Name)
+		fmt.Fprintln(w, "      _arguments -S \\")
+		for _, f := range commandFlags(cmd.Flags()) {
+			spec := "-" + f.Name + "[" + zshEscape(f.Usage) + "]"
+			if !isBoolFlag(f) {
+				name, _ := flag.UnquoteUsage(f)
+				spec += ":" + name + ":_files"
+			}
+			fmt.Fprintf(w, "        %s \\\n", zshQuote(spec))
+		}
+		if cmd.Name == "completion" {
+			fmt.Fprintf(w, "        '1:shell:(%s)'\n", strings.Join(shells, " "))
+		} else {
+			fmt.Fprintln(w, "        '*:file:_files'")
+		}
+		fmt.Fprintln(w, "      ;;")
+	}
+	fmt.Fprintln(w, "  esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "if [ \"$funcstack[1]\" = \"_ebl2wav\" ]; then")
+	fmt.Fprintln(w, "  _ebl2wav \"$@\"")
+	fmt.Fprintln(w, "else")
+	fmt.Fprintln(w, "  compdef _ebl2wav ebl2wav")
+	fmt.Fprintln(w, "fi")
+}
+
+// zshEscape escapes the characters _arguments gives a meaning to in descriptions
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// zshQuote single quotes a string for zsh
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeFishCompletion writes the fish completion script
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for ebl2wav, generated by \"ebl2wav completion fish\"")
+	fmt.Fprintln(w, "# Save it as ~/.config/fish/completions/ebl2wav.fish")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c ebl2wav -n __fish_use_subcommand -a %s -d %s\n", cmd.Name, fishQuote(cmd.Summary))
+	}
+
+	var others []string
+	for _, name := range commandNames() {
+		if name != "convert" {
+			others = append(others, name)
+		}
+	}
+	for _, cmd := range commands {
+		// Flags without a command are convert flags
+		condition := "__fish_seen_subcommand_from " + cmd.Name
+		if cmd.Name == "convert" {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		for _, f := range commandFlags(cmd.Flags()) {
+			line := fmt.Sprintf("complete -c ebl2wav -n %s -o %s -d %s", fishQuote(condition), f.Name, fishQuote(f.Usage))
+			if !isBoolFlag(f) {
+				line += " -r"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	fmt.Fprintf(w, "complete -c ebl2wav -n '__fish_seen_subcommand_from completion' -f -a '%s'\n", strings.Join(shells, " "))
+}
+
+// fishQuote single quotes a string for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+// writePowerShellCompletion writes the PowerShell completion script. Nothing is
+// returned for inputs, so PowerShell completes file names.
+func writePowerShellCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# PowerShell completion for ebl2wav, generated by \"ebl2wav completion powershell\"")
+	fmt.Fprintln(w, "# Load it with: ebl2wav completion powershell | Out-String | Invoke-Expression")
+	fmt.Fprintln(w, "Register-ArgumentCompleter -Native -CommandName ebl2wav -ScriptBlock {")
+	fmt.Fprintln(w, "    param($wordToComplete, $commandAst, $cursorPosition)")
+	fmt.Fprintln(w, "    $commands = [ordered]@{")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s = %s\n", psQuote(cmd.Name), psQuote(cmd.Summary))
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    $flags = @{")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s = [ordered]@{\n", psQuote(cmd.Name))
+		for _, f := range commandFlags(cmd.Flags()) {
+			fmt.Fprintf(w, "            %s = %s\n", psQuote("-"+f.Name), psQuote(f.Usage))
+		}
+		fmt.Fprintln(w, "        }")
+	}
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintf(w, "    $shells = @(%s)\n", strings.Join(psQuoteAll(shells), ", "))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })")
+	fmt.Fprintln(w, "    $command = ''")
+	fmt.Fprintln(w, "    if ($words.Count -gt 0 -and $commands.Contains($words[0]) -and ($words.Count -gt 1 -or $wordToComplete -eq '')) {")
+	fmt.Fprintln(w, "        $command = $words[0]")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "    if ($command -eq '' -and $words.Count -le 1 -and -not $wordToComplete.StartsWith('-')) {")
+	fmt.Fprintln(w, "        $commands.GetEnumerator() | Where-Object { $_.Key -like \"$wordToComplete*\" } | ForEach-Object {")
+	fmt.Fprintln(w, "            [System.Management.Automation.CompletionResult]::new($_.Key, $_.Key, 'ParameterValue', $_.Value)")
+	fmt.Fprintln(w, "        }")
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    if ($command -eq 'completion') {")
+	fmt.Fprintln(w, "        $shells | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {")
+	fmt.Fprintln(w, "            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)")
+	fmt.Fprintln(w, "        }")
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    if (-not $wordToComplete.StartsWith('-')) {")
+	fmt.Fprintln(w, "        return")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    if ($command -eq '') {")
+	fmt.Fprintln(w, "        $command = 'convert'")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    $flags[$command].GetEnumerator() | Where-Object { $_.Key -like \"$wordToComplete*\" } | ForEach-Object {")
+	fmt.Fprintln(w, "        [System.Management.Automation.CompletionResult]::new($_.Key, $_.Key, 'ParameterName', $_.Value)")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "}")
+}
+
+// psQuote single quotes a string for PowerShell
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// psQuoteAll single quotes strings for PowerShell
+func psQuoteAll(values []string) []string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = psQuote(v)
+	}
+	return quoted
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/textnorm"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// duplicateBank is an EXB file found to be a copy of a bank listed before it
+type duplicateBank struct {
+	path     string
+	original string
+	reason   string
+}
+
+// findDuplicateBanks returns the EXB files copying a bank listed before them, as
+// collections often hold several rips of the same CD. Banks are copies when their EXB
+// files have the same content, or the same name compared regardless of case, accents
+// and punctuation ("Café Strings" and "CAFE_STRINGS"). Remote banks are only compared
+// by name.
+func findDuplicateBanks(exbFiles []string) []duplicateBank {
+	var duplicates []duplicateBank
+	byName := make(map[string]string)
+	byHash := make(map[string]string)
+	for _, exbFile := range exbFiles {
+		name := textnorm.Fold(strings.TrimSuffix(filepath.Base(exbFile), filepath.Ext(exbFile)))
+		hash := ""
+		if !sink.IsURL(exbFile) {
+			hash, _ = manifest.Checksum(exbFile)
+		}
+
+		switch {
+		case hash != "" && byHash[hash] != "":
+			duplicates = append(duplicates, duplicateBank{exbFile, byHash[hash], "same content as"})
+		case byName[name] != "":
+			duplicates = append(duplicates, duplicateBank{exbFile, byName[name], "same name as"})
+		default:
+			byName[name] = exbFile
+			if hash != "" {
+				byHash[hash] = exbFile
+			}
+		}
+	}
+	return duplicates
+}
+
+// removeDuplicateBanks reports the duplicates among exbFiles and returns the EXB files
+// to convert, without the duplicates when skip is set
+func removeDuplicateBanks(exbFiles []string, skip bool, out io.Writer) []string {
+	duplicates := findDuplicateBanks(exbFiles)
+	if len(duplicates) == 0 {
+		return exbFiles
+	}
+
+	skipped := make(map[string]bool)
+	for _, dup := range duplicates {
+		if skip {
+			fmt.Fprintf(out, "DUPLICATE BANK SKIPPED: %s (%s %s)\n", dup.path, dup.reason, dup.original)
+			skipped[dup.path] = true
+		} else {
+			fmt.Fprintf(out, "DUPLICATE BANK: %s (%s %s)\n", dup.path, dup.reason, dup.original)
+		}
+	}
+	if !skip {
+		fmt.Fprintf(out, "Found %d duplicate banks, converting them anyway (use -skip-duplicates to skip them).\n", len(duplicates))
+		return exbFiles
+	}
+
+	kept := make([]string, 0, len(exbFiles)-len(skipped))
+	for _, exbFile := range exbFiles {
+		if !skipped[exbFile] {
+			kept = append(kept, exbFile)
+		}
+	}
+	fmt.Fprintf(out, "Skipped %d duplicate banks.\n", len(skipped))
+	return kept
+}
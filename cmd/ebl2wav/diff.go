@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/bankdiff"
+)
+
+// diffOptions holds the flags of the diff subcommand
+type diffOptions struct {
+	bank       string
+	jsonOutput bool
+	debug      bool
+}
+
+func (o *diffOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("diff")
+	fs.StringVar(&o.bank, "bank", "", "Only compare the samples of this bank in output directories holding several")
+	fs.BoolVar(&o.jsonOutput, "json", false, "Print the report as JSON")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runDiff compares two banks or a bank and an output directory: ebl2wav diff [options] <a> <b>
+func runDiff(args []string) {
+	var opts diffOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	loader := bankdiff.NewLoader(opts.debug, opts.bank)
+	var sides [2]*bankdiff.Side
+	for i, arg := range fs.Args() {
+		side, err := loader.Load(arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		sides[i] = side
+	}
+	report := bankdiff.Compare(sides[0], sides[1])
+
+	if opts.jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(data))
+	} else {
+		printDiff(report)
+	}
+
+	// Like diff(1): 1 when the sides differ, 2 on errors
+	if !report.Equal() {
+		os.Exit(1)
+	}
+}
+
+// printDiff prints a diff report
+func printDiff(report *bankdiff.Report) {
+	fmt.Printf("--- %s\n+++ %s\n", report.A, report.B)
+	for _, key := range report.Removed {
+		fmt.Printf("- %s\n", key)
+	}
+	for _, key := range report.Added {
+		fmt.Printf("+ %s\n", key)
+	}
+	for _, change := range report.Changed {
+		name := ""
+		if change.Name != "" {
+			name = fmt.Sprintf(" (%s)", change.Name)
+		}
+		fmt.Printf("~ %s%s: %s\n", change.Key, name, strings.Join(change.Details, ", "))
+	}
+
+	fmt.Printf("%d unchanged, %d changed, %d added, %d removed samples\n",
+		report.Unchanged, len(report.Changed), len(report.Added), len(report.Removed))
+	switch report.References {
+	case bankdiff.ReferencesSame:
+		fmt.Println("Sample references: the EXB files reference the same samples")
+	case bankdiff.ReferencesDifferent:
+		fmt.Printf("Sample references: %d added, %d removed\n", len(report.AddedReferences), len(report.RemovedReferences))
+		for _, key := range report.RemovedReferences {
+			fmt.Printf("- %s\n", key)
+		}
+		for _, key := range report.AddedReferences {
+			fmt.Printf("+ %s\n", key)
+		}
+	default:
+		fmt.Println("Sample references: not compared, only EXB files referencing samples record them")
+	}
+	fmt.Println("Presets: not compared, preset diffing is unsupported")
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+)
+
+// inspection describes a parsed EBL file
+type inspection struct {
+	Path       string   `json:"path"`
+	Name       string   `json:"name,omitempty"`
+	Comment    string   `json:"comment,omitempty"`
+	SampleRate int      `json:"sampleRate,omitempty"`
+	Channels   int      `json:"channels,omitempty"`
+	Frames     int      `json:"frames,omitempty"`
+	Duration   float64  `json:"duration,omitempty"`
+	RootKey    string   `json:"rootKey,omitempty"` // Note name, e.g. "C3"
+	Variant    string   `json:"variant,omitempty"`
+	Size       int64    `json:"size,omitempty"`
+	Regions    []string `json:"regions,omitempty"` // Regions marked in the header, in frames, e.g. "1000-21000"
+	Chunks     []string `json:"chunks,omitempty"`  // IDs of the chunks found after the audio
+	Issues     []string `json:"issues,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"` // Irregularities the parser worked around, failing -strict conversions
+	Error      string   `json:"error,omitempty"`
+}
+
+// inspectOptions holds the flags of the inspect subcommand
+type inspectOptions struct {
+	jsonOutput bool
+	debug      bool
+}
+
+func (o *inspectOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("inspect")
+	fs.BoolVar(&o.jsonOutput, "json", false, "Print the details as JSON")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runInspect prints the header details of EBL files: ebl2wav inspect [options] <file.ebl|bank.exb|dir>...
+func runInspect(args []string) {
+	var opts inspectOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var files []string
+	for _, arg := range fs.Args() {
+		found, err := findEBLFiles(arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, found...)
+	}
+
+	parser := ebl.NewParser(opts.debug, false)
+	parser.SetHeadersOnly(true)
+	var inspections []inspection
+	failed := false
+	for _, file := range files {
+		info := inspect(parser, file)
+		failed = failed || info.Error != ""
+		inspections = append(inspections, info)
+	}
+
+	if opts.jsonOutput {
+		data, err := json.MarshalIndent(inspections, "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, info := range inspections {
+			printInspection(info)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// findEBLFiles returns the EBL files of an argument of inspect: an .ebl file, the
+// SamplePool of an .exb bank or a directory searched recursively
+func findEBLFiles(arg string) ([]string, error) {
+	if strings.ToLower(filepath.Ext(arg)) == ".exb" {
+		samplePool, err := exb.FindSamplePool(arg)
+		if err != nil {
+			return nil, err
+		}
+		arg = samplePool
+	}
+
+	info, err := os.Stat(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{arg}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".ebl" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning directory: %w", err)
+	}
+	return files, nil
+}
+
+// inspect parses an EBL file
+func inspect(parser *ebl.Parser, path string) inspection {
+	eblFile, err := parser.ReadFile(path, "")
+	if err != nil {
+		return inspection{Path: path, Error: err.Error()}
+	}
+
+	info := inspection{
+		Path:       path,
+		Name:       eblFile.Name(),
+		Comment:    eblFile.HeaderData.CommentStr,
+		SampleRate: eblFile.HeaderData.SampleRate,
+		Channels:   eblFile.Channels(),
+		Frames:     eblFile.Frames(),
+		Duration:   eblFile.Duration(),
+		RootKey:    ebl.NoteName(eblFile.RootKey),
+		Variant:    eblFile.Version.String(),
+		Size:       eblFile.Size,
+		Issues:     eblFile.Verify(),
+		Warnings:   eblFile.Warnings,
+	}
+	for _, region := range eblFile.Regions() {
+		info.Regions = append(info.Regions, fmt.Sprintf("%d-%d", region.Start, region.End))
+	}
+	for _, chunk := range eblFile.ExtraChunks {
+		info.Chunks = append(info.Chunks, chunk.ID)
+	}
+	return info
+}
+
+// printInspection prints the details of an EBL file
+func printInspection(info inspection) {
+	fmt.Println(info.Path)
+	if info.Error != "" {
+		fmt.Printf("  Error:    %s\n\n", info.Error)
+		return
+	}
+
+	channels := "stereo"
+	if info.Channels == 1 {
+		channels = "mono"
+	}
+	rootKey := info.RootKey
+	if rootKey == "" {
+		rootKey = "unknown"
+	}
+
+	fmt.Printf("  Name:     %s\n", info.Name)
+	if info.Comment != "" {
+		fmt.Printf("  Comment:  %s\n", info.Comment)
+	}
+	fmt.Printf("  Format:   %d Hz, %s, 16-bit\n", info.SampleRate, channels)
+	fmt.Printf("  Length:   %d frames (%.3fs)\n", info.Frames, info.Duration)
+	fmt.Printf("  Root key: %s\n", rootKey)
+	fmt.Printf("  Variant:  %s\n", info.Variant)
+	fmt.Printf("  Size:     %d bytes\n", info.Size)
+	if len(info.Regions) > 0 {
+		fmt.Printf("  Regions:  %s\n", strings.Join(info.Regions, ", "))
+	}
+	if len(info.Chunks) > 0 {
+		fmt.Printf("  Chunks:   %s\n", strings.Join(info.Chunks, ", "))
+	}
+	for _, issue := range info.Issues {
+		fmt.Printf("  Issue:    %s\n", issue)
+	}
+	for _, warning := range info.Warnings {
+		fmt.Printf("  Warning:  %s\n", warning)
+	}
+	fmt.Println()
+}
@@ -1,27 +1,128 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/audit"
+	"github.com/mattetti/e-mu-soundbanks/internal/catalog"
+	"github.com/mattetti/e-mu-soundbanks/internal/category"
 	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/dspreset"
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
 	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/fswalk"
+	"github.com/mattetti/e-mu-soundbanks/internal/i18n"
+	"github.com/mattetti/e-mu-soundbanks/internal/inventory"
+	"github.com/mattetti/e-mu-soundbanks/internal/longpath"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/preview"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+	"github.com/mattetti/e-mu-soundbanks/internal/slices"
+	"github.com/mattetti/e-mu-soundbanks/internal/sqlite"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+	"github.com/mattetti/e-mu-soundbanks/internal/waveform"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
 )
 
 var (
-	inputPath  string
-	outputPath string
-	exbPath    string
-	exbDirPath string
-	debugMode  bool
-	errorSave  bool
-	flacMode   bool
-	version    bool
+	inputPath   string
+	outputPath  string
+	exbPath     string
+	exbDirPath  string
+	debugMode   bool
+	errorSave   bool
+	flacMode    bool
+	flacLevel   int
+	flacThreads int
+	flacArgs    string
+	ffmpegBin   string
+	outFormat   string
+	sliceMode   bool
+	byCategory  bool
+	layerDirs   bool
+	rulesPath   string
+	progressFmt string
+	dsPreset    bool
+	readmeMode  bool
+	compareRef  string
+	mergeMode   bool
+	statsPath   string
+	zipMode     bool
+	bankJobs    int
+	fileJobs    int
+	onConflict  string
+	maxNameLen  int
+	keepUnicode bool
+	keepNames   bool
+	language    string
+	folderNames bool
+	normalize   string
+	peakLevel   float64
+	ditherMode  string
+	previews    bool
+	previewFmt  string
+	previewLen  float64
+	waveFmt     string
+	waveSize    string
+	waveColor   string
+	waveBg      string
+	verifyMode  bool
+	strictMode  bool
+	anomalies   bool
+	detectPitch bool
+	forceRate   int
+	minDuration float64
+	maxDuration float64
+	minRate     int
+	channelsOf  int
+	skipDupes   bool
+	postCmd     string
+	followLinks bool
+	checkPool   bool
+	skipSpace   bool
+	maxOpen     int
+	maxRate     string
+	stereoMode  bool
+	checksums   bool
+	catalogFmt  string
+	dbPath      string
+	tuiMode     bool
+	quietMode   bool
+	verbose     bool
+	veryVerbose bool
+	version     bool
+
+	// waveOptions holds the image size and colors set with -waveform-size, -waveform-color
+	// and -waveform-background
+	waveOptions = waveform.DefaultOptions()
+
+	// outputLevel is the converter output level set with -q, -v and -vv
+	outputLevel = converter.LevelNormal
+
+	// messages receives the messages of conversion runs: stdout, or stderr once
+	// stdout carries the -progress json events or the -tar stream
+	messages io.Writer = os.Stdout
+
+	// runStats aggregates statistics across every converter used during the run
+	runStats = converter.NewStats()
+	statsMu  sync.Mutex
+
+	// sampleDB receives the conversion results when -db is set
+	sampleDB *sqlite.Database
+
+	// categoryRules sort the samples into folders when -by-category is set
+	categoryRules *category.Rules
 )
 
 func init() {
@@ -32,234 +133,864 @@ func init() {
 	flag.BoolVar(&debugMode, "d", false, "Debug mode")
 	flag.BoolVar(&errorSave, "e", false, "Save files with errors to output/errors/")
 	flag.BoolVar(&flacMode, "flac", false, "Convert output to FLAC format (requires ffmpeg)")
+	flag.IntVar(&flacLevel, "flac-level", flac.DefaultCompressionLevel, "FLAC compression level, from 0 (fastest) to 12 (smallest files)")
+	flag.IntVar(&flacThreads, "flac-threads", 0, "Threads used by each ffmpeg FLAC encoder, 0 for ffmpeg's default")
+	flag.StringVar(&flacArgs, "flac-args", "", "Extra ffmpeg arguments for the FLAC encoder, separated by spaces (e.g. \"-lpc_type cholesky\")")
+	flag.StringVar(&outFormat, "format", wav.FormatWAV, "Output format: wav, or raw for headerless 16-bit PCM with a .json file describing it")
+	flag.StringVar(&ffmpegBin, "ffmpeg", "", "Path of the ffmpeg binary used by -flac and -previews (also set by EBL2WAV_FFMPEG or the config file, searched for by default)")
+	flag.BoolVar(&previews, "previews", false, "Also render a short, faded, low-bitrate preview of each sample into previews/ (requires ffmpeg)")
+	flag.StringVar(&previewFmt, "preview-format", preview.FormatMP3, "Format of the -previews: mp3 or ogg")
+	flag.Float64Var(&previewLen, "preview-length", 5, "Maximum length of the -previews in seconds")
+	flag.StringVar(&waveFmt, "waveform", "", "Also write a waveform image next to each sample: png or svg")
+	flag.StringVar(&waveSize, "waveform-size", "800x200", "Size of the -waveform images in pixels, as WIDTHxHEIGHT")
+	flag.StringVar(&waveColor, "waveform-color", "#2b6cb0", "Color of the -waveform, as #rrggbb or #rrggbbaa")
+	flag.StringVar(&waveBg, "waveform-background", "#ffffff", "Background color of the -waveform images, as #rrggbb, #rrggbbaa or transparent")
+	flag.BoolVar(&sliceMode, "slices", false, "Also cut samples with regions, such as drum loops, into one file per slice with a slice map")
+	flag.BoolVar(&byCategory, "by-category", false, "Sort samples into a folder per category (Drums, Loops, Pads...) found from their names and comments, instead of mirroring the SamplePool folders")
+	flag.BoolVar(&layerDirs, "layers", false, "Sort samples whose names give a velocity (v64, vel_100, pp...ff) or round robin (RR2) into vel_064/ and rr2/ subfolders, the layout sampler auto-mappers expect")
+	flag.StringVar(&rulesPath, "category-rules", "", "JSON file of the keyword rules used by -by-category, replacing the built-in rules")
+	flag.BoolVar(&dsPreset, "dspreset", false, "Write a DecentSampler .dspreset mapping the converted samples")
+	flag.StringVar(&compareRef, "compare-ref", "", "Compare the converted files with previously validated outputs in this directory, laid out like the output directory, reporting every difference")
+	flag.BoolVar(&readmeMode, "readme", false, "Write a README.md and README.html inventory of each converted bank: sample counts, duration, folders and files")
+	flag.BoolVar(&mergeMode, "merge", false, "With -exbdir, convert every bank into one library: a Samples folder storing shared samples once, and an SFZ and DecentSampler preset per bank")
+	flag.StringVar(&statsPath, "stats", "", "Write the run statistics summary as JSON to this file")
+	flag.BoolVar(&zipMode, "zip", false, "Package each converted bank into a single zip archive")
+	flag.BoolVar(&followLinks, "follow-symlinks", false, "Follow symbolic links and junctions to directories when scanning for .ebl and .exb files, each directory being scanned once")
+	flag.BoolVar(&checkPool, "check-pool", false, "Report the samples referenced by EXB files that are missing from their SamplePool, and the EBL files no reference points to")
+	flag.IntVar(&maxOpen, "max-open-files", 0, "Maximum number of files converted at once across all banks, 0 for no limit (4 by default when the input or output is on a network share)")
+	flag.StringVar(&maxRate, "max-throughput", "", "Maximum bytes read and written per second, such as 20MB, for network shares and NAS devices (no limit by default)")
+	flag.BoolVar(&skipSpace, "skip-space-check", false, "Convert even when the output directory seems too small for the converted files")
+	flag.Float64Var(&minDuration, "min-duration", 0, "Only convert samples lasting at least this many seconds")
+	flag.Float64Var(&maxDuration, "max-duration", 0, "Only convert samples lasting at most this many seconds (0 for no limit)")
+	flag.IntVar(&minRate, "min-samplerate", 0, "Only convert samples with at least this sample rate in Hz")
+	flag.IntVar(&channelsOf, "channels", 0, "Only convert mono (1) or stereo (2) samples, 0 for both")
+	flag.BoolVar(&skipDupes, "skip-duplicates", false, "With -exbdir, skip banks whose EXB file has the same content or name as one found before")
+	flag.IntVar(&bankJobs, "jobs", max(1, min(runtime.NumCPU()/2, 8)), "Number of banks processed concurrently with -exbdir (use 1 for spinning disks)")
+	flag.IntVar(&fileJobs, "workers", runtime.NumCPU(), "Number of files converted concurrently within a directory or bank")
+	flag.StringVar(&onConflict, "on-conflict", converter.ConflictOverwrite, "What to do when a converted file already exists: overwrite, skip, rename or error")
+	flag.IntVar(&maxNameLen, "max-name-length", 0, "Truncate output filenames longer than this many characters, adding a hash suffix (0 for no limit)")
+	flag.BoolVar(&keepUnicode, "preserve-unicode", false, "Keep non-ASCII characters in output filenames, only replacing those invalid on Windows, macOS or Linux")
+	flag.BoolVar(&keepNames, "preserve-names", false, "Name output files after the original .ebl files, without the EXB name prefix")
+	flag.BoolVar(&folderNames, "name-by-folder", false, "With -exb or -exbdir, name output files after their bank, SamplePool folder and root key (e.g. \"Bank - Strings - C3 - Violin.wav\")")
+	flag.StringVar(&normalize, "normalize", "", "Scale the audio of every sample so it peaks at this level in dBFS, e.g. -1")
+	flag.StringVar(&ditherMode, "dither", wav.DitherNone, "Dither applied when -normalize reduces samples back to 16 bits: none, tpdf or shaped (TPDF with noise shaping)")
+	flag.BoolVar(&verifyMode, "verify", false, "Cross-check decoded audio lengths against header fields and flag inconsistent samples")
+	flag.BoolVar(&strictMode, "strict", false, "Fail files the parser has to work around irregularities of (filename mismatch, unexpected padding, inconsistent file size...)")
+	flag.BoolVar(&anomalies, "anomalies", false, "Flag samples decoding to digital silence, clipping, DC offset or byte-swapped/garbled audio")
+	flag.BoolVar(&detectPitch, "detect-pitch", false, "Estimate the root key of samples whose name has no note, for the smpl chunk and manifest")
+	flag.IntVar(&forceRate, "force-samplerate", 0, "Write every sample at this sample rate in Hz instead of the header value (0 keeps it, implausible header rates fall back to 44100)")
+	flag.BoolVar(&stereoMode, "merge-stereo", false, "Merge split left/right mono samples (e.g. Pad-L/Pad-R) into stereo WAVs")
+	flag.BoolVar(&checksums, "checksums", false, "Write a .sha256 checksum file next to each converted file")
+	flag.StringVar(&postCmd, "post-cmd", "", "Shell command run after each converted sample, described by EBL2WAV_* environment variables")
+	flag.StringVar(&catalogFmt, "catalog", "", "Also write a sample catalog next to the manifest (csv or tsv)")
+	flag.StringVar(&dbPath, "db", "", "Record conversion results and sample metadata in this SQLite database (requires sqlite3)")
+	flag.StringVar(&progressFmt, "progress", progressText, "How progress is reported: text, or json for newline-delimited JSON events on stdout, other messages going to stderr")
+	flag.BoolVar(&tuiMode, "tui", false, "Interactively pick the banks found with -exbdir and follow their conversion")
+	flag.StringVar(&language, "lang", "", "Language of progress messages and the summary: "+strings.Join(i18n.Languages(), ", ")+" (detected from LC_ALL, LC_MESSAGES or LANG by default)")
+	flag.BoolVar(&quietMode, "q", false, "Quiet, only print errors and the final summary")
+	flag.BoolVar(&verbose, "v", false, "Verbose, also list every converted file")
+	flag.BoolVar(&veryVerbose, "vv", false, "Very verbose, also print the details of every converted sample")
 	flag.BoolVar(&version, "version", false, "Display version information")
 }
 
 const VERSION = "1.0.0"
 
+// Exit codes of the convert command
+const (
+	exitOK           = 0 // Every file was converted
+	exitFatal        = 1 // The run couldn't be completed
+	exitFailures     = 2 // The run completed but some files or banks failed to convert
+	exitNothingFound = 3 // No EBL or EXB file was found
+
+	exitUsage = 64 // Unknown flag or invalid flag value, whatever the command
+)
+
+// batchResult aggregates the outcome of a run
+type batchResult struct {
+	converter.Result
+	FailedBanks int // Banks skipped because of an error
+}
+
+// exitCode returns the exit code reporting the outcome of the run
+func (b batchResult) exitCode() int {
+	switch {
+	case b.Files == 0 && b.FailedBanks == 0:
+		return exitNothingFound
+	case b.Failed() > 0 || b.FailedBanks > 0 || len(runStats.RefDiffers) > 0:
+		return exitFailures
+	}
+	return exitOK
+}
+
 func main() {
-	flag.Parse()
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.Usage = printUsage
+	i18n.SetLanguage(i18n.Detect())
+
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "help":
+			printUsage()
+			return
+		case "-help-json", "--help-json":
+			printHelpJSON()
+			return
+		}
+		if cmd := findCommand(os.Args[1]); cmd != nil {
+			cmd.Run(os.Args[2:])
+			return
+		}
+	}
+
+	// Flags without a subcommand (ebl2wav -i <input>) are the convert subcommand
+	runConvert(os.Args[1:])
+}
+
+// runConvert converts EBL files, banks or directories of banks:
+// ebl2wav convert [options] <file.ebl|bank.exb|dir|url>
+func runConvert(args []string) {
+	inputs, err := parseArgs(flag.CommandLine, args)
+	if err != nil {
+		exitParseError(err)
+	}
+	if language != "" {
+		if err := i18n.SetLanguage(language); err != nil {
+			fmt.Fprintf(messages, "Error: -lang: %v\n", err)
+			exit(exitFatal)
+		}
+	}
+	if len(inputs) > 1 {
+		fmt.Fprintln(messages, "Error: convert takes a single input, convert a directory to process several files")
+		exit(exitFatal)
+	}
+	if len(inputs) == 1 {
+		if inputPath != "" || exbPath != "" || exbDirPath != "" {
+			fmt.Fprintln(messages, "Error: the input can't be given both as an argument and with -i, -exb or -exbdir")
+			exit(exitFatal)
+		}
+		if err := resolveInput(inputs[0]); err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+	}
 
 	// Display version if requested
 	if version {
-		fmt.Printf("ebl2wav version %s\n", VERSION)
-		os.Exit(0)
+		fmt.Fprintf(messages, "ebl2wav version %s\n", VERSION)
+		exit(0)
+	}
+
+	if err := startProfiles(); err != nil {
+		fmt.Fprintf(messages, "Error: %v\n", err)
+		exit(exitFatal)
+	}
+
+	switch {
+	case quietMode && (verbose || veryVerbose):
+		fmt.Fprintln(messages, "Error: -q can't be combined with -v or -vv")
+		exit(exitFatal)
+	case quietMode:
+		outputLevel = converter.LevelQuiet
+	case veryVerbose:
+		outputLevel = converter.LevelVeryVerbose
+	case verbose:
+		outputLevel = converter.LevelVerbose
+	}
+
+	validPolicy := false
+	for _, policy := range converter.ConflictPolicies {
+		validPolicy = validPolicy || onConflict == policy
+	}
+	if !validPolicy {
+		fmt.Fprintf(messages, "Error: -on-conflict must be one of %s\n", strings.Join(converter.ConflictPolicies, ", "))
+		exit(exitFatal)
+	}
+
+	if forceRate != 0 && !ebl.PlausibleSampleRate(forceRate) {
+		fmt.Fprintf(messages, "Error: -force-samplerate must be between %d and %d\n", ebl.MinSampleRate, ebl.MaxSampleRate)
+		exit(exitFatal)
+	}
+
+	switch {
+	case minDuration < 0 || maxDuration < 0:
+		fmt.Fprintln(messages, "Error: -min-duration and -max-duration can't be negative")
+		exit(exitFatal)
+	case maxDuration > 0 && minDuration > maxDuration:
+		fmt.Fprintln(messages, "Error: -min-duration can't be longer than -max-duration")
+		exit(exitFatal)
+	case minRate < 0:
+		fmt.Fprintln(messages, "Error: -min-samplerate can't be negative")
+		exit(exitFatal)
+	case channelsOf < 0 || channelsOf > 2:
+		fmt.Fprintln(messages, "Error: -channels must be 1 for mono, 2 for stereo or 0 for both")
+		exit(exitFatal)
+	}
+
+	if maxNameLen < 0 {
+		fmt.Fprintln(messages, "Error: -max-name-length can't be negative")
+		exit(exitFatal)
+	}
+
+	if previewFmt != preview.FormatMP3 && previewFmt != preview.FormatOGG {
+		fmt.Fprintln(messages, "Error: -preview-format must be mp3 or ogg")
+		exit(exitFatal)
+	}
+	if previewLen <= 0 {
+		fmt.Fprintln(messages, "Error: -preview-length must be positive")
+		exit(exitFatal)
+	}
+
+	if waveFmt != "" && waveFmt != waveform.FormatPNG && waveFmt != waveform.FormatSVG {
+		fmt.Fprintln(messages, "Error: -waveform must be png or svg")
+		exit(exitFatal)
+	}
+	var waveErr error
+	waveOptions.Width, waveOptions.Height, waveErr = waveform.ParseSize(waveSize)
+	if waveErr == nil {
+		waveOptions.Foreground, waveErr = waveform.ParseColor(waveColor)
+	}
+	if waveErr == nil {
+		waveOptions.Background, waveErr = waveform.ParseColor(waveBg)
+	}
+	if waveErr != nil {
+		fmt.Fprintf(messages, "Error: %v\n", waveErr)
+		exit(exitFatal)
+	}
+
+	if normalize != "" {
+		var err error
+		if peakLevel, err = wav.ParsePeak(normalize); err != nil {
+			fmt.Fprintf(messages, "Error: -normalize: %v\n", err)
+			exit(exitFatal)
+		}
+	}
+	validDither := false
+	for _, mode := range wav.DitherModes {
+		validDither = validDither || ditherMode == mode
+	}
+	switch {
+	case !validDither:
+		fmt.Fprintf(messages, "Error: -dither must be one of %s\n", strings.Join(wav.DitherModes, ", "))
+		exit(exitFatal)
+	case ditherMode != wav.DitherNone && normalize == "":
+		fmt.Fprintln(messages, "Error: -dither only applies to samples scaled by -normalize")
+		exit(exitFatal)
+	}
+
+	validFormat := false
+	for _, format := range wav.Formats {
+		validFormat = validFormat || outFormat == format
+	}
+	if !validFormat {
+		fmt.Fprintf(messages, "Error: -format must be one of %s\n", strings.Join(wav.Formats, ", "))
+		exit(exitFatal)
+	}
+	if outFormat == wav.FormatRaw && (flacMode || previews || dsPreset) {
+		fmt.Fprintln(messages, "Error: -flac, -previews and -dspreset need WAV files, they can't be used with -format raw")
+		exit(exitFatal)
+	}
+
+	if (isFlagSet("flac-level") || isFlagSet("flac-threads") || flacArgs != "") && !flacMode {
+		fmt.Fprintln(messages, "Error: -flac-level, -flac-threads and -flac-args need -flac")
+		exit(exitFatal)
+	}
+	if flacLevel < flac.MinCompressionLevel || flacLevel > flac.MaxCompressionLevel {
+		fmt.Fprintf(messages, "Error: -flac-level must be between %d and %d\n", flac.MinCompressionLevel, flac.MaxCompressionLevel)
+		exit(exitFatal)
+	}
+	if flacThreads < 0 {
+		fmt.Fprintln(messages, "Error: -flac-threads can't be negative")
+		exit(exitFatal)
+	}
+
+	if rulesPath != "" && !byCategory {
+		fmt.Fprintln(messages, "Error: -category-rules needs -by-category")
+		exit(exitFatal)
+	}
+	if byCategory {
+		categoryRules = category.DefaultRules()
+		if rulesPath != "" {
+			var err error
+			if categoryRules, err = category.Load(rulesPath); err != nil {
+				fmt.Fprintf(messages, "Error: %v\n", err)
+				exit(exitFatal)
+			}
+		}
+	}
+
+	if catalogFmt != "" && catalogFmt != catalog.FormatCSV && catalogFmt != catalog.FormatTSV {
+		fmt.Fprintln(messages, "Error: -catalog must be csv or tsv")
+		exit(exitFatal)
+	}
+
+	if progressFmt != progressText && progressFmt != progressJSON {
+		fmt.Fprintln(messages, "Error: -progress must be text or json")
+		exit(exitFatal)
+	}
+	if progressFmt == progressJSON {
+		if tuiMode {
+			fmt.Fprintln(messages, "Error: -tui can't be used with -progress json")
+			exit(exitFatal)
+		}
+		startJSONProgress()
+	}
+
+	if (zipMode || tarPath != "") && (previews || sliceMode || postCmd != "" || compareRef != "") {
+		fmt.Fprintln(messages, "Error: -zip and -tar write the converted files straight into the archive, they can't be combined with -previews, -slices, -post-cmd or -compare-ref")
+		exit(exitFatal)
+	}
+	if tarPath != "" {
+		switch {
+		case zipMode || dbPath != "":
+			fmt.Fprintln(messages, "Error: -tar can't be combined with -zip or -db")
+			exit(exitFatal)
+		case tarPath == "-" && progressFmt == progressJSON:
+			fmt.Fprintln(messages, "Error: -tar - can't be used with -progress json, both write to stdout")
+			exit(exitFatal)
+		}
+		if err := startTar(); err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+	} else if tarZstd {
+		fmt.Fprintln(messages, "Error: -zstd needs an archive given with -tar")
+		exit(exitFatal)
+	}
+
+	if dbPath != "" {
+		var err error
+		sampleDB, err = sqlite.NewDatabase(dbPath, debugMode)
+		if err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+		sampleDB.SetOutput(messages)
+	}
+
+	if err := setupIOLimits(); err != nil {
+		fmt.Fprintf(messages, "Error: %v\n", err)
+		exit(exitFatal)
+	}
+	flac.SetFFmpegPath(ffmpegBin)
+	if ffmpegBin != "" {
+		if _, err := flac.FindFFmpeg(); err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+	}
+
+	if mergeMode {
+		switch {
+		case exbDirPath == "":
+			fmt.Fprintln(messages, "Error: -merge needs a directory of EXB files given with -exbdir")
+			exit(exitFatal)
+		case zipMode || tarPath != "" || outFormat == wav.FormatRaw || previews || waveFmt != "" || sliceMode || dbPath != "" || compareRef != "":
+			fmt.Fprintln(messages, "Error: -merge can't be combined with -zip, -tar, -format raw, -previews, -waveform, -slices, -db or -compare-ref")
+			exit(exitFatal)
+		}
+		if err := startMerge(); err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+	}
+
+	if compareRef != "" {
+		if info, err := os.Stat(compareRef); err != nil || !info.IsDir() {
+			fmt.Fprintf(messages, "Error: -compare-ref %s is not a directory\n", compareRef)
+			exit(exitFatal)
+		}
+	}
+
+	if folderNames {
+		switch {
+		case exbPath == "" && exbDirPath == "":
+			fmt.Fprintln(messages, "Error: -name-by-folder needs an EXB file given with -exb or -exbdir")
+			exit(exitFatal)
+		case keepNames:
+			fmt.Fprintln(messages, "Error: -name-by-folder can't be used with -preserve-names")
+			exit(exitFatal)
+		}
+	}
+
+	if tuiMode && exbDirPath == "" {
+		fmt.Fprintln(messages, "Error: -tui needs a directory of EXB files given with -exbdir")
+		exit(exitFatal)
 	}
 
 	// Process directory of EXB files if provided
 	if exbDirPath != "" {
-		processExbDirectory(exbDirPath)
-		return
+		var result batchResult
+		if tuiMode {
+			result = runTUI(exbDirPath)
+		} else {
+			result = processExbDirectory(exbDirPath)
+		}
+		if mergeMode {
+			finishMerge(messages)
+		}
+		printSummary()
+		exit(result.exitCode())
 	}
 
 	// Process EXB file if provided
 	if exbPath != "" {
 		if filepath.Ext(exbPath) != ".exb" {
-			fmt.Println("Error: EXB path must point to an .exb file")
-			os.Exit(1)
+			fmt.Fprintln(messages, "Error: EXB path must point to an .exb file")
+			exit(exitFatal)
 		}
 
 		// Process the EXB file
-		processExbFile(exbPath)
-		return
+		checkFreeSpace(samplePools([]string{exbPath}))
+		result, err := processExbFile(exbPath, messages, nil)
+		if err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+		printSummary()
+		exit(batchResult{Result: result}.exitCode())
 	}
 
 	// Check for required input path if not using EXB mode
 	if inputPath == "" {
-		fmt.Println("Error: Input path is required. Use -i flag, provide an .exb file with -exb, or specify a directory of EXB files with -exbdir.")
+		fmt.Fprintln(messages, "Error: Input path is required. Give an .ebl file, .exb file or directory to convert, or use the -i, -exb or -exbdir flags.")
 		printUsage()
-		os.Exit(1)
+		exit(exitFatal)
 	}
 
 	// Set default output path if not provided
 	if outputPath == "" {
 		outputPath = "E-MU Sounds"
-		fmt.Printf("No output directory selected - Defaulting to %s\n", outputPath)
+		logf(messages, "No output directory selected - Defaulting to %s\n", outputPath)
+	}
+	checkFreeSpace([]string{inputPath})
+
+	// Process input path, either local or in object storage
+	remote := sink.IsURL(inputPath)
+	var inputInfo os.FileInfo
+	if !remote {
+		inputInfo, err = os.Stat(inputPath)
+		if err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			exit(exitFatal)
+		}
+		if inputInfo.IsDir() {
+			if err := safepath.CheckOutput(inputPath, outputPath); err != nil {
+				fmt.Fprintf(messages, "Error: %v, pick another output directory with -o\n", err)
+				exit(exitFatal)
+			}
+		}
+	}
+
+	// Create output directory if needed, -tar writes nothing there
+	if tarStream == nil {
+		if err := os.MkdirAll(outputPath, 0755); err != nil {
+			fmt.Fprintf(messages, "Error creating output directory: %v\n", err)
+			exit(exitFatal)
+		}
+	}
+
+	// Converted files go straight into the archive with -zip or -tar
+	name := filepath.Base(outputPath)
+	workDir := longpath.Fix(outputPath)
+	packed, err := openArchive(workDir, name)
+	if err != nil {
+		fmt.Fprintf(messages, "Error: %v\n", err)
+		exit(exitFatal)
+	}
+	if packed != nil {
+		workDir = packed.dir
 	}
 
 	// Create converter with options
 	conv := converter.NewConverter(converter.Options{
 		Debug:            debugMode,
 		NoWrite:          false,
-		PreserveFilename: false,
+		PreserveFilename: keepNames,
 		ErrorSave:        errorSave,
+		Verify:           verifyMode,
+		Strict:           strictMode,
+		Anomalies:        anomalies,
+		DetectPitch:      detectPitch,
+		ForceSampleRate:  forceRate,
+		MergeStereo:      stereoMode,
+		Checksums:        checksums,
+		Level:            outputLevel,
+		Workers:          fileJobs,
+		OnConflict:       onConflict,
+		MaxNameLength:    maxNameLen,
+		PreserveUnicode:  keepUnicode,
+		Normalize:        normalize != "",
+		NormalizePeak:    peakLevel,
+		Dither:           ditherMode,
+		Waveform:         waveFmt,
+		WaveformOptions:  waveOptions,
+		Hooks:            postHooks(),
+		FollowSymlinks:   followLinks,
+		Format:           outFormat,
+		Slices:           sliceMode,
+		Events:           converterEvents(),
+		Limiter:          ioLimiter,
+		Categories:       categoryRules,
+		Layers:           layerDirs,
+		Filter:           sampleFilter(),
 		ExbName:          "", // No EXB name when using -i flag
+		Output:           messages,
+		Sink:             packed.destination(),
+		FLAC:             archiveFLAC(packed, messages),
 	})
 
-	// Process input path
-	inputInfo, err := os.Stat(inputPath)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Create output directory if needed
-	if err := os.MkdirAll(outputPath, 0755); err != nil {
-		fmt.Printf("Error creating output directory: %v\n", err)
-		os.Exit(1)
-	}
-
-	if errorSave {
-		errorDir := filepath.Join(outputPath, "errors")
+	if errorSave && packed == nil {
+		errorDir := filepath.Join(workDir, safepath.ErrorsDir)
 		if err := os.MkdirAll(errorDir, 0755); err != nil {
-			fmt.Printf("Error creating error directory: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(messages, "Error creating error directory: %v\n", err)
+			exit(exitFatal)
 		}
 	}
 
 	if debugMode {
-		fmt.Printf("DEBUG MODE: %t, ERROR SAVE: %t, FLAC MODE: %t\n", debugMode, errorSave, flacMode)
-		fmt.Printf("Using %d CPU cores\n", runtime.NumCPU())
+		fmt.Fprintf(messages, "DEBUG MODE: %t, ERROR SAVE: %t, FLAC MODE: %t\n", debugMode, errorSave, flacMode)
+		fmt.Fprintf(messages, "Using %d CPU cores\n", runtime.NumCPU())
 	}
 
 	// Convert EBL to WAV
-	if inputInfo.IsDir() {
+	var result converter.Result
+	if remote {
+		// Stream objects from the bucket
+		bucket, prefix, err := sink.ParseURL(inputPath)
+		if err == nil {
+			result, err = conv.ProcessBucket(bucket, prefix, workDir)
+		}
+		if err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			packed.discard()
+			exit(exitFatal)
+		}
+	} else if inputInfo.IsDir() {
 		// Process directory
-		err = conv.ProcessDirectory(inputPath, outputPath)
+		result, err = conv.ProcessDirectory(inputPath, workDir)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			packed.discard()
+			exit(exitFatal)
 		}
 	} else {
 		// Process single file
 		if filepath.Ext(inputPath) != ".ebl" {
-			fmt.Println("Input file must be an EBL file.")
-			os.Exit(1)
+			fmt.Fprintln(messages, "Input file must be an EBL file.")
+			exit(exitFatal)
 		}
-		success, err := conv.ConvertFile(inputPath, outputPath)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
-		}
-		if success {
-			fmt.Printf("Converted %s\n", filepath.Base(inputPath))
+		result.Files = 1
+		converted, err := conv.ConvertFile(inputPath, workDir)
+		if err == nil {
+			result.Converted = 1
+			switch {
+			case converted.Filtered:
+				logf(messages, "Filtered out %s\n", filepath.Base(inputPath))
+			case converted.Placeholder:
+				logf(messages, "Skipped placeholder %s\n", filepath.Base(inputPath))
+			case converted.Skipped:
+				logf(messages, "Kept existing %s\n", converted.Output)
+			default:
+				logf(messages, "Converted %s\n", filepath.Base(inputPath))
+			}
+			if err := conv.WriteManifest(workDir); err != nil {
+				fmt.Fprintf(messages, "Error: %v\n", err)
+			}
 		} else {
-			fmt.Printf("Failed to convert %s\n", filepath.Base(inputPath))
+			fmt.Fprintf(messages, "Failed to convert %s: %v\n", filepath.Base(inputPath), err)
 		}
 	}
 
-	// Convert WAV to FLAC if requested
-	if flacMode {
-		convertToFlac(outputPath)
+	addStats(conv.Stats())
+
+	if packed != nil {
+		// Describe the converted files into their archive
+		packed.finish(conv, messages)
+	} else {
+		// Render sample previews if requested, from the WAV files
+		if previews {
+			generatePreviews(workDir, messages)
+		}
+
+		// Convert WAV to FLAC if requested
+		if flacMode {
+			convertToFlac(workDir, messages)
+		}
+
+		// Export DecentSampler preset if requested
+		if dsPreset {
+			exportDSPreset(workDir, name, messages)
+		}
+
+		// Export the sample catalog if requested
+		if catalogFmt != "" {
+			exportCatalog(workDir, messages)
+		}
+
+		// Describe the converted files if requested
+		if readmeMode {
+			writeInventory(workDir, name, messages)
+		}
+
+		// Compare with the reference outputs if requested
+		if compareRef != "" {
+			compareReference(workDir, compareRef, "", messages)
+		}
+
+		// Record the samples in the database if requested
+		if sampleDB != nil {
+			recordDatabase(workDir, outputPath, name, messages)
+		}
 	}
+
+	printSummary()
+	exit(batchResult{Result: result}.exitCode())
 }
 
-// processExbDirectory processes all EXB files in a directory and its subdirectories
-func processExbDirectory(exbDirPath string) {
-	// Verify the directory exists
-	dirInfo, err := os.Stat(exbDirPath)
-	if err != nil {
-		fmt.Printf("Error accessing directory: %v\n", err)
-		os.Exit(1)
+// addStats adds the statistics of a converter to the run statistics
+func addStats(stats *converter.Stats) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	runStats.Add(stats)
+}
+
+// printSummary prints the run statistics and writes them to the -stats file if requested
+func printSummary() {
+	runStats.Print(messages)
+	emitEvent(converter.Event{Type: eventTotals, Stats: runStats})
+
+	if statsPath != "" {
+		if err := runStats.Save(statsPath); err != nil {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+		}
 	}
+}
+
+// processExbDirectory processes all EXB files in a directory and its subdirectories,
+// returning the aggregated result of every bank
+func processExbDirectory(exbDirPath string) batchResult {
+	exbFiles := findExbFiles(exbDirPath)
+	logf(messages, "Found %d EXB files to process.\n", len(exbFiles))
+	exbFiles = removeDuplicateBanks(exbFiles, skipDupes, messages)
+	checkFreeSpace(samplePools(exbFiles))
 
-	if !dirInfo.IsDir() {
-		fmt.Printf("Error: %s is not a directory\n", exbDirPath)
-		os.Exit(1)
+	// Process the EXB files with a bounded pool of workers
+	numWorkers := min(max(1, bankJobs), len(exbFiles))
+	if numWorkers > 1 {
+		logf(messages, "Processing up to %d banks concurrently.\n", numWorkers)
 	}
 
-	fmt.Printf("Scanning %s for EXB files...\n", exbDirPath)
+	// Output is released in bank order whatever the order banks complete in
+	seq := newSequencer(messages)
+	results := make([]converter.Result, len(exbFiles))
+	errs := make([]error, len(exbFiles))
 
-	// Find all EXB files recursively
-	var exbFiles []string
-	err = filepath.Walk(exbDirPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".exb" {
-			exbFiles = append(exbFiles, path)
+	runBanks(len(exbFiles), numWorkers, func(i int) {
+		exbFile := exbFiles[i]
+		baseExbName := strings.TrimSuffix(filepath.Base(exbFile), filepath.Ext(exbFile))
+
+		// Label every line so the output of concurrent banks stays readable
+		out := newPrefixWriter(seq.Writer(i), fmt.Sprintf("[%d/%d %s] ", i+1, len(exbFiles), baseExbName))
+		logf(out, "Processing %s\n", exbFile)
+		results[i], errs[i] = processExbFile(exbFile, out, nil)
+		if errs[i] != nil {
+			fmt.Fprintf(out, "Error: %v\n", errs[i])
+			fmt.Fprintln(out, "Skipping this EXB file.")
 		}
-		return nil
+		out.Flush()
+		seq.Done(i)
 	})
 
-	if err != nil {
-		fmt.Printf("Error scanning for EXB files: %v\n", err)
-		os.Exit(1)
+	result := sumResults(results, errs)
+	if result.FailedBanks > 0 {
+		logf(messages, "Processed %d EXB files, %d failed.\n", len(exbFiles), result.FailedBanks)
+	} else {
+		logf(messages, "Successfully processed %d EXB files.\n", len(exbFiles))
 	}
+	return result
+}
 
-	if len(exbFiles) == 0 {
-		fmt.Println("No EXB files found.")
-		os.Exit(1)
+// sumResults aggregates the results of banks, counting those which returned an error
+// as failed
+func sumResults(results []converter.Result, errs []error) batchResult {
+	var batch batchResult
+	for i, result := range results {
+		batch.Add(result)
+		if errs[i] != nil {
+			batch.FailedBanks++
+		}
 	}
+	return batch
+}
 
-	fmt.Printf("Found %d EXB files to process.\n", len(exbFiles))
+// runBanks calls process with the index of each of the n banks, running up to
+// numWorkers banks concurrently
+func runBanks(n, numWorkers int, process func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				process(i)
+			}
+		}()
+	}
 
-	// Process each EXB file
-	for i, exbFile := range exbFiles {
-		fmt.Printf("[%d/%d] Processing %s\n", i+1, len(exbFiles), exbFile)
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
 
-		// Save the current output path
-		originalOutputPath := outputPath
+// findExbFiles returns the EXB files found in a directory and its subdirectories, or
+// below an object storage URL. It exits when none can be found.
+func findExbFiles(exbDirPath string) []string {
+	var exbFiles []string
+	if sink.IsURL(exbDirPath) {
+		logf(messages, "Listing %s for EXB files...\n", exbDirPath)
 
-		// Process the EXB file
-		exbPath = exbFile
-		processExbFile(exbFile)
+		var err error
+		exbFiles, err = listRemoteFiles(exbDirPath, ".exb")
+		if err != nil {
+			fmt.Fprintf(messages, "Error listing EXB files: %v\n", err)
+			exit(exitFatal)
+		}
+	} else {
+		// Verify the directory exists
+		dirInfo, err := os.Stat(exbDirPath)
+		if err != nil {
+			fmt.Fprintf(messages, "Error accessing directory: %v\n", err)
+			exit(exitFatal)
+		}
+
+		if !dirInfo.IsDir() {
+			fmt.Fprintf(messages, "Error: %s is not a directory\n", exbDirPath)
+			exit(exitFatal)
+		}
 
-		// Restore the output path
-		outputPath = originalOutputPath
+		logf(messages, "Scanning %s for EXB files...\n", exbDirPath)
+
+		// Find all EXB and project files recursively
+		var projects []string
+		err = fswalk.Walk(exbDirPath, followLinks, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if strings.ToLower(filepath.Ext(path)) == ".exb" {
+				exbFiles = append(exbFiles, path)
+			} else if exb.IsProject(path) {
+				projects = append(projects, path)
+			}
+			return nil
+		})
+
+		if err != nil {
+			fmt.Fprintf(messages, "Error scanning for EXB files: %v\n", err)
+			exit(exitFatal)
+		}
+		exbFiles = addProjectBanks(exbFiles, projects, messages)
+	}
+
+	if len(exbFiles) == 0 {
+		fmt.Fprintln(messages, "No EXB files found.")
+		exit(exitNothingFound)
 	}
 
-	fmt.Printf("Successfully processed %d EXB files.\n", len(exbFiles))
+	return exbFiles
 }
 
-// processExbFile processes an EXB file and its associated SamplePool folder
-func processExbFile(exbPath string) {
+// processExbFile processes an EXB file and its associated SamplePool folder. It returns
+// an error when the bank couldn't be processed. progress, when not nil, is called as the
+// samples are converted.
+func processExbFile(exbPath string, out io.Writer, progress func(converter.ProgressEvent)) (converter.Result, error) {
+	bank := strings.TrimSuffix(filepath.Base(exbPath), filepath.Ext(exbPath))
+	emitBankEvent(eventBankStarted, bank, nil)
+
+	result, err := convertBank(exbPath, out, progress)
+	if err != nil {
+		emitBankEvent(eventBankFailed, bank, err)
+	} else {
+		emitBankEvent(eventBankCompleted, bank, nil)
+	}
+	return result, err
+}
+
+// convertBank converts the bank of processExbFile
+func convertBank(exbPath string, out io.Writer, progress func(converter.ProgressEvent)) (converter.Result, error) {
 	// Extract the base name without the .exb extension to use as prefix
 	baseExbName := filepath.Base(exbPath)
 	baseExbName = strings.TrimSuffix(baseExbName, filepath.Ext(baseExbName))
 
-	// Check if SamplePool directory exists
-	exbDir := filepath.Dir(exbPath)
-	samplePoolDir := filepath.Join(exbDir, "SamplePool")
-
-	if _, err := os.Stat(samplePoolDir); os.IsNotExist(err) {
-		fmt.Printf("Error: SamplePool directory not found at %s\n", samplePoolDir)
-		// Don't exit when processing multiple EXB files
-		if exbDirPath == "" {
-			os.Exit(1)
-		} else {
-			fmt.Println("Skipping this EXB file.")
-			return
+	// Find the SamplePool directory, from the references of the EXB file or by its
+	// name. Remote SamplePools are only known once listed.
+	remote := sink.IsURL(exbPath)
+	exbDir := pathDir(exbPath)
+	samplePoolDir := exbDir + "/" + exb.DefaultSamplePool + "/"
+	if !remote {
+		var err error
+		if samplePoolDir, err = exb.FindSamplePool(exbPath); err != nil {
+			return converter.Result{}, err
 		}
 	}
 
-	// Set default output path if not provided
+	// Banks of a directory of EXB files each get a folder of their own, mirroring the
+	// input, so the steps run on the output directory of a bank (FLAC conversion,
+	// presets, catalog, README) never touch the files of banks converted alongside it
 	thisOutputPath := outputPath
-	if thisOutputPath == "" {
-		// If processing a directory of EXB files, use a subdirectory structure that mirrors the input
-		if exbDirPath != "" {
-			relPath, err := filepath.Rel(exbDirPath, exbDir)
-			if err == nil && relPath != "." {
-				thisOutputPath = filepath.Join("E-MU Sounds", relPath, baseExbName)
-			} else {
-				thisOutputPath = filepath.Join("E-MU Sounds", baseExbName)
-			}
-		} else {
-			thisOutputPath = filepath.Join("E-MU Sounds", baseExbName)
+	if mergeStaging != "" {
+		// Banks are converted on their own, then merged into the library
+		thisOutputPath = mergeBankDir(exbPath, baseExbName)
+	} else if exbDirPath != "" {
+		thisOutputPath = filepath.Join(outputRoot(), baseExbName)
+		if relPath, err := relPath(exbDirPath, exbDir); err == nil && relPath != "." {
+			thisOutputPath = filepath.Join(outputRoot(), relPath, baseExbName)
 		}
-		fmt.Printf("No output directory selected - Defaulting to %s\n", thisOutputPath)
+	} else if thisOutputPath == "" {
+		thisOutputPath = filepath.Join(outputRoot(), baseExbName)
+	}
+	if outputPath == "" && mergeStaging == "" {
+		logf(out, "No output directory selected - Defaulting to %s\n", thisOutputPath)
 	}
 
-	// Create output directory
-	if err := os.MkdirAll(thisOutputPath, 0755); err != nil {
-		fmt.Printf("Error creating output directory: %v\n", err)
-		if exbDirPath == "" {
-			os.Exit(1)
-		} else {
-			fmt.Println("Skipping this EXB file.")
-			return
+	if !remote {
+		if err := safepath.CheckOutput(samplePoolDir, thisOutputPath); err != nil {
+			return converter.Result{}, err
+		}
+	}
+
+	// Create output directory, -tar writes nothing there
+	if tarStream == nil {
+		if err := os.MkdirAll(thisOutputPath, 0755); err != nil {
+			return converter.Result{}, fmt.Errorf("error creating output directory: %w", err)
 		}
 	}
 
+	// Converted files go straight into the archive with -zip or -tar
+	workDir := longpath.Fix(thisOutputPath)
+	packed, err := openArchive(workDir, baseExbName)
+	if err != nil {
+		return converter.Result{}, err
+	}
+	if packed != nil {
+		workDir = packed.dir
+	}
+
 	// Create error directory if needed
-	if errorSave {
-		errorDir := filepath.Join(thisOutputPath, "errors")
+	if errorSave && packed == nil {
+		errorDir := filepath.Join(workDir, safepath.ErrorsDir)
 		if err := os.MkdirAll(errorDir, 0755); err != nil {
-			fmt.Printf("Error creating error directory: %v\n", err)
+			fmt.Fprintf(out, "Error creating error directory: %v\n", err)
 			if exbDirPath == "" {
-				os.Exit(1)
+				exit(exitFatal)
 			} else {
-				fmt.Println("Continuing without error directory.")
+				fmt.Fprintln(out, "Continuing without error directory.")
 			}
 		}
 	}
@@ -268,67 +999,477 @@ func processExbFile(exbPath string) {
 	conv := converter.NewConverter(converter.Options{
 		Debug:            debugMode,
 		NoWrite:          false,
-		PreserveFilename: false,
+		PreserveFilename: keepNames,
+		NameByFolder:     folderNames,
 		ErrorSave:        errorSave,
+		Verify:           verifyMode,
+		Strict:           strictMode,
+		Anomalies:        anomalies,
+		DetectPitch:      detectPitch,
+		ForceSampleRate:  forceRate,
+		MergeStereo:      stereoMode,
+		Checksums:        checksums,
+		Level:            outputLevel,
+		Workers:          fileJobs,
+		OnConflict:       onConflict,
+		MaxNameLength:    maxNameLen,
+		PreserveUnicode:  keepUnicode,
+		Normalize:        normalize != "",
+		NormalizePeak:    peakLevel,
+		Dither:           ditherMode,
+		Waveform:         waveFmt,
+		WaveformOptions:  waveOptions,
+		Hooks:            postHooks(),
+		FollowSymlinks:   followLinks,
+		Format:           outFormat,
+		Slices:           sliceMode,
+		Events:           converterEvents(),
+		Limiter:          ioLimiter,
+		Categories:       categoryRules,
+		Layers:           layerDirs,
+		Filter:           sampleFilter(),
 		ExbName:          baseExbName, // Use the EXB name for prefixing WAV files
+		Output:           out,
+		Progress:         progress,
+		Sink:             packed.destination(),
+		FLAC:             archiveFLAC(packed, out),
 	})
 
 	// Find all .ebl files in the SamplePool directory
-	fmt.Printf("Processing EXB file: %s\n", baseExbName)
-	fmt.Printf("Scanning %s for .ebl files...\n", samplePoolDir)
+	logf(out, "Processing EXB file: %s\n", baseExbName)
+	logf(out, "Scanning %s for .ebl files...\n", samplePoolDir)
 
 	// Process the SamplePool directory
-	err := conv.ProcessDirectory(samplePoolDir, thisOutputPath)
-	if err != nil {
-		fmt.Printf("Error processing SamplePool directory: %v\n", err)
-		if exbDirPath == "" {
-			os.Exit(1)
-		} else {
-			fmt.Println("Skipping to the next EXB file.")
-			return
+	var result converter.Result
+	if remote {
+		var bucket *sink.S3
+		var prefix string
+		bucket, prefix, err = sink.ParseURL(samplePoolDir)
+		if err == nil {
+			result, err = conv.ProcessBucket(bucket, prefix, workDir)
+		}
+	} else {
+		if checkPool {
+			checked := converter.NewStats()
+			checkSamplePool(exbPath, samplePoolDir, checked, out)
+			addStats(checked)
 		}
+		result, err = conv.ProcessDirectory(samplePoolDir, workDir)
+	}
+	addStats(conv.Stats())
+	if err != nil {
+		packed.discard()
+		return result, fmt.Errorf("error processing SamplePool directory: %w", err)
+	}
+
+	// Describe the bank into its archive
+	if packed != nil {
+		packed.finish(conv, out)
+		return result, nil
+	}
+
+	// Render sample previews if requested, from the WAV files
+	if previews {
+		generatePreviews(workDir, out)
 	}
 
 	// Convert WAV to FLAC if requested
 	if flacMode {
-		convertToFlac(thisOutputPath)
+		convertToFlac(workDir, out)
+	}
+
+	// Export DecentSampler preset if requested, merged libraries get theirs once merged
+	if dsPreset && mergeStaging == "" {
+		exportDSPreset(workDir, baseExbName, out)
 	}
+
+	// Export the sample catalog if requested, for the whole library once merged
+	if catalogFmt != "" && mergeStaging == "" {
+		exportCatalog(workDir, out)
+	}
+
+	// Describe the bank if requested, merged banks share the library
+	if readmeMode && mergeStaging == "" {
+		writeInventory(workDir, baseExbName, out)
+	}
+
+	// Compare with the reference outputs if requested, laid out like the output directory
+	if compareRef != "" {
+		refDir := compareRef
+		if rel, err := filepath.Rel(outputRoot(), thisOutputPath); err == nil {
+			refDir = filepath.Join(compareRef, rel)
+		}
+		compareReference(workDir, refDir, baseExbName, out)
+	}
+
+	// Record the samples in the database if requested
+	if sampleDB != nil {
+		recordDatabase(workDir, thisOutputPath, baseExbName, out)
+	}
+
+	return result, nil
 }
 
-// convertToFlac converts all WAV files in the output directory to FLAC
-func convertToFlac(outputDir string) {
-	// Initialize FLAC converter
+// outputRoot returns the output directory given with -o, or the default one
+func outputRoot() string {
+	if outputPath == "" {
+		return "E-MU Sounds"
+	}
+	return outputPath
+}
+
+// checkSamplePool reports the samples of a bank missing from its SamplePool and the
+// EBL files of the pool the bank doesn't reference
+func checkSamplePool(exbPath, samplePoolDir string, stats *converter.Stats, out io.Writer) {
+	check, err := exb.CheckPool(exbPath, samplePoolDir, followLinks)
+	if err != nil {
+		fmt.Fprintf(out, "Error checking SamplePool: %v\n", err)
+		return
+	}
+	if check.References == 0 {
+		fmt.Fprintf(out, "POOL CHECK: no sample reference found in %s, skipped\n", filepath.Base(exbPath))
+		return
+	}
+
+	for _, ref := range check.Missing {
+		fmt.Fprintf(out, "MISSING SAMPLE: %s\n", ref)
+		stats.Missing = append(stats.Missing, exbPath+": "+ref)
+	}
+	for _, rel := range check.Orphans {
+		orphan := filepath.Join(samplePoolDir, filepath.FromSlash(rel))
+		fmt.Fprintf(out, "ORPHAN SAMPLE: %s\n", orphan)
+		stats.Orphans = append(stats.Orphans, orphan)
+	}
+	logf(out, "Checked %d sample references against %d EBL files: %d missing, %d orphans\n",
+		check.References, check.Files, len(check.Missing), len(check.Orphans))
+}
+
+// newFLACConverter returns the FLAC converter set up by the -flac-* flags, nil when it
+// can't be, samples then being left as WAV files
+func newFLACConverter(out io.Writer) *flac.Converter {
 	flacConverter, err := flac.NewConverter(debugMode)
 	if err != nil {
-		fmt.Printf("Error initializing FLAC converter: %v\n", err)
-		fmt.Println("WAV files were not converted to FLAC.")
+		fmt.Fprintf(out, "Error initializing FLAC converter: %v\n", err)
+		fmt.Fprintln(out, "WAV files were not converted to FLAC.")
+		return nil
+	}
+	flacConverter.SetOutput(out)
+	flacConverter.SetEncoder("ebl2wav " + VERSION)
+	flacConverter.SetCompressionLevel(flacLevel)
+	flacConverter.SetThreads(flacThreads)
+	flacConverter.SetExtraArgs(strings.Fields(flacArgs))
+	return flacConverter
+}
+
+// archiveFLAC returns the FLAC converter encoding the samples written into an archive
+// with -flac, as they are converted. Samples written to the output directory are
+// converted afterwards, see convertToFlac.
+func archiveFLAC(packed *bankArchive, out io.Writer) *flac.Converter {
+	if !flacMode || packed == nil {
+		return nil
+	}
+	return newFLACConverter(out)
+}
+
+// convertToFlac converts all WAV files in the output directory to FLAC
+func convertToFlac(outputDir string, out io.Writer) {
+	flacConverter := newFLACConverter(out)
+	if flacConverter == nil {
 		return
 	}
 
-	fmt.Println("Converting WAV files to FLAC format (using parallel processing)...")
+	logf(out, "Converting WAV files to FLAC format (using parallel processing)...\n")
 	startTime := time.Now()
 
 	// Convert all WAV files in the output directory
-	err = flacConverter.ConvertDirectory(outputDir)
+	err := flacConverter.ConvertDirectory(outputDir)
+
+	// Point the manifest at the FLAC files that were produced
+	editErr := manifest.Edit(outputDir, func(m *manifest.Manifest) {
+		m.ReplaceExtension(outputDir, ".wav", ".flac")
+	})
+	if editErr == nil && sliceMode {
+		editErr = slices.ReplaceExtension(outputDir, ".wav", ".flac")
+	}
+	if editErr != nil {
+		fmt.Fprintf(out, "Error updating manifest: %v\n", editErr)
+	}
+
 	if err != nil {
-		fmt.Printf("Error converting to FLAC: %v\n", err)
-		fmt.Println("Some WAV files may not have been converted.")
+		var dirErr *flac.DirectoryError
+		if errors.As(err, &dirErr) {
+			reportFlacErrors(outputDir, dirErr.Failed, out)
+		}
+		fmt.Fprintf(out, "Error converting to FLAC: %v\n", err)
+		fmt.Fprintln(out, "Some WAV files may not have been converted.")
 		return
 	}
 
 	elapsed := time.Since(startTime)
-	fmt.Printf("FLAC conversion completed successfully in %.2f seconds.\n", elapsed.Seconds())
+	logf(out, "FLAC conversion completed successfully in %.2f seconds.\n", elapsed.Seconds())
+}
+
+// flacErrorLog is the file of the errors folder receiving the ffmpeg output of the
+// files which failed to convert to FLAC
+const flacErrorLog = "flac-errors.log"
+
+// reportFlacErrors prints the files which failed to convert to FLAC, adds them to the
+// run statistics and writes what ffmpeg printed for each into the errors folder
+func reportFlacErrors(outputDir string, failed []*flac.FileError, out io.Writer) {
+	stats := converter.NewStats()
+	var report strings.Builder
+	for _, failure := range failed {
+		fmt.Fprintf(out, "FLAC ERROR: %v\n", failure)
+		stats.FlacErrors = append(stats.FlacErrors, failure.Error())
+
+		fmt.Fprintf(&report, "%s\n%v\n", failure.File, failure.Err)
+		if failure.Stderr != "" {
+			fmt.Fprintf(&report, "ffmpeg output:\n%s\n", strings.TrimRight(failure.Stderr, "\n"))
+		}
+		report.WriteString("\n")
+	}
+	addStats(stats)
+
+	errorDir := filepath.Join(outputDir, safepath.ErrorsDir)
+	logPath := filepath.Join(errorDir, flacErrorLog)
+	err := os.MkdirAll(errorDir, 0755)
+	if err == nil {
+		err = atomicfile.WriteFile(logPath, []byte(report.String()))
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Error writing %s: %v\n", logPath, err)
+		return
+	}
+	fmt.Fprintf(out, "The ffmpeg output of the failed files is in %s\n", logPath)
+}
+
+// generatePreviews renders a preview of every sample listed in the manifest of the output directory
+func generatePreviews(outputDir string, out io.Writer) {
+	generator, err := preview.NewGenerator(debugMode, previewFmt, previewLen)
+	if err != nil {
+		fmt.Fprintf(out, "Error initializing preview generator: %v\n", err)
+		fmt.Fprintln(out, "No previews were rendered.")
+		return
+	}
+	generator.SetOutput(out)
+
+	count, err := generator.GenerateDirectory(outputDir)
+	if err != nil {
+		fmt.Fprintf(out, "Error rendering previews: %v\n", err)
+	}
+	if count > 0 {
+		logf(out, "Rendered %d previews into %s\n", count, filepath.Join(outputDir, preview.Dir))
+	}
+}
+
+// exportDSPreset writes a DecentSampler preset referencing the samples in the output directory
+func exportDSPreset(outputDir, name string, out io.Writer) {
+	exporter := dspreset.NewExporter(debugMode)
+	exporter.SetOutput(out)
+
+	presetPath, err := exporter.ExportDirectory(outputDir, name)
+	if err != nil {
+		fmt.Fprintf(out, "Error exporting DecentSampler preset: %v\n", err)
+		return
+	}
+
+	logf(out, "DecentSampler preset written to %s\n", presetPath)
+}
+
+// exportCatalog writes the sample catalog of the output directory in the -catalog format
+func exportCatalog(outputDir string, out io.Writer) {
+	catalogPath, err := catalog.Write(outputDir, catalogFmt)
+	if err != nil {
+		fmt.Fprintf(out, "Error exporting catalog: %v\n", err)
+		return
+	}
+
+	logf(out, "Catalog written to %s\n", catalogPath)
+}
+
+// compareReference compares the samples of the bank converted into outputDir with the
+// reference outputs in refDir, reporting the differences
+func compareReference(outputDir, refDir, name string, out io.Writer) {
+	var comparison *audit.Comparison
+	manifestPath := filepath.Join(outputDir, manifest.Filename)
+	// Read the manifest while holding its lock, banks converted concurrently may be updating it
+	err := manifest.Edit(outputDir, func(m *manifest.Manifest) {
+		auditor := audit.NewAuditor(debugMode)
+		auditor.SetOutput(out)
+		comparison = auditor.CompareReference(manifestPath, m, name, refDir)
+	})
+	if err != nil {
+		fmt.Fprintf(out, "Error comparing with reference outputs: %v\n", err)
+		return
+	}
+
+	stats := converter.NewStats()
+	stats.RefCompared = comparison.Compared
+	for _, difference := range comparison.Differences {
+		fmt.Fprintf(out, "REFERENCE DIFFERENCE: %s\n", difference)
+		stats.RefDiffers = append(stats.RefDiffers, difference.String())
+	}
+	addStats(stats)
+	logf(out, "Compared %d outputs with %s: %d identical, %d with the same audio, %d different\n",
+		comparison.Compared, refDir, comparison.Identical, comparison.SameAudio, len(comparison.Differences))
+}
+
+// writeInventory writes the README.md and README.html describing the bank converted into
+// outputDir
+func writeInventory(outputDir, name string, out io.Writer) {
+	paths, err := inventory.Write(outputDir, name)
+	if err != nil {
+		fmt.Fprintf(out, "Error writing inventory: %v\n", err)
+		return
+	}
+
+	logf(out, "Inventory written to %s\n", strings.Join(paths, " and "))
+}
+
+// recordDatabase records the samples listed in the manifest of workDir in the -db database.
+// outputDir is where the files end up.
+func recordDatabase(workDir, outputDir, name string, out io.Writer) {
+	editErr := manifest.Edit(workDir, func(m *manifest.Manifest) {
+		addToDatabase(m, outputDir, name, "", out)
+	})
+	if editErr != nil {
+		fmt.Fprintf(out, "Error recording samples in database: %v\n", editErr)
+	}
+}
+
+// addToDatabase records the samples of a manifest in the -db database. They were
+// converted into outputDir, or into the zip archive at archivePath when not empty.
+func addToDatabase(m *manifest.Manifest, outputDir, name, archivePath string, out io.Writer) {
+	if err := sampleDB.AddManifest(m, name, outputDir, archivePath); err != nil {
+		fmt.Fprintf(out, "Error recording samples in database: %v\n", err)
+		return
+	}
+	logf(out, "Samples recorded in %s\n", dbPath)
+}
+
+// Helper functions for min/max operations
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// parseArgs parses flags which may be interleaved with positional arguments, so
+// "ebl2wav convert Bank.exb -flac" works like "ebl2wav convert -flac Bank.exb"
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// resolveInput sets -i, -exb or -exbdir from a positional input: .exb files are
+// banks, directories (or URLs) containing .exb files are processed as directories of
+// banks, anything else is converted as EBL input
+func resolveInput(p string) error {
+	if strings.ToLower(filepath.Ext(p)) == ".exb" {
+		exbPath = p
+		return nil
+	}
+
+	if sink.IsURL(p) {
+		banks, err := listRemoteFiles(p, ".exb")
+		if err != nil {
+			return err
+		}
+		if len(banks) > 0 {
+			exbDirPath = p
+		} else {
+			inputPath = p
+		}
+		return nil
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && containsBanks(p) {
+		exbDirPath = p
+	} else {
+		inputPath = p
+	}
+	return nil
+}
+
+// containsBanks reports whether an .exb or project file is stored below dir
+func containsBanks(dir string) bool {
+	found := false
+	fswalk.Walk(dir, followLinks, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() && (strings.ToLower(filepath.Ext(path)) == ".exb" || exb.IsProject(path)) {
+			found = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return found
 }
 
 func printUsage() {
-	fmt.Println("Usage: ebl2wav -i <input> [options] or ebl2wav -exb <exbfile> [options] or ebl2wav -exbdir <directory> [options]")
-	fmt.Println("Options:")
+	fmt.Fprintln(messages, "Usage: ebl2wav <command> [options] [arguments]")
+	fmt.Fprintln(messages, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(messages, "  %-11s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintln(messages, "\nRun ebl2wav <command> -h for the options of a command, ebl2wav -help-json describes")
+	fmt.Fprintln(messages, "every command and option as JSON.")
+	fmt.Fprintln(messages, "\nThe convert options can also be used without a subcommand, e.g. ebl2wav -i <input>,")
+	fmt.Fprintln(messages, "ebl2wav -exb <exbfile> or ebl2wav -exbdir <directory>.")
+	fmt.Fprintln(messages, "\nConvert options:")
 	flag.PrintDefaults()
-	fmt.Println("\nExamples:")
-	fmt.Println("  ebl2wav -i /path/to/input/                # Process directory of .ebl files")
-	fmt.Println("  ebl2wav -i file.ebl -o .                  # Process single file")
-	fmt.Println("  ebl2wav -exb Sample.exb                   # Process .ebl files in SamplePool folder")
-	fmt.Println("  ebl2wav -exbdir /path/to/soundbanks/      # Process all .exb files recursively")
-	fmt.Println("  ebl2wav -exbdir /path/to/soundbanks/ -flac # Convert all soundbanks to FLAC")
-	fmt.Println("  ebl2wav -i /path/to/input/ -d -e          # Process with debug mode and error saving")
+	fmt.Fprintln(messages, "\nExamples:")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/input/                # Process directory of .ebl files")
+	fmt.Fprintln(messages, "  ebl2wav convert file.ebl -o .                  # Process single file")
+	fmt.Fprintln(messages, "  ebl2wav convert Sample.exb                     # Process .ebl files in SamplePool folder")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/soundbanks/           # Process all .exb files recursively")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/soundbanks/ -flac     # Convert all soundbanks to FLAC")
+	fmt.Fprintln(messages, "  ebl2wav convert Sample.exb -dspreset           # Also write a DecentSampler preset")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/soundbanks/ -zip      # Package each converted bank as a zip")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/soundbanks/ -tar a.tar # Stream all converted banks into one tar")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/soundbanks/ -merge    # Merge all banks into one deduplicated library")
+	fmt.Fprintln(messages, "  ebl2wav convert /path/to/input/ -d -e          # Process with debug mode and error saving")
+	fmt.Fprintln(messages, "  ebl2wav inspect Sample.exb                     # Show the samples of a bank")
+}
+
+// postHooks returns the hooks run after each converted sample, set by -post-cmd
+func postHooks() []converter.Hook {
+	if postCmd == "" {
+		return nil
+	}
+	return []converter.Hook{converter.NewCommandHook(postCmd)}
+}
+
+// sampleFilter returns the samples selected by -min-duration, -max-duration,
+// -min-samplerate and -channels
+func sampleFilter() converter.Filter {
+	return converter.Filter{
+		MinDuration:   minDuration,
+		MaxDuration:   maxDuration,
+		MinSampleRate: minRate,
+		Channels:      channelsOf,
+	}
 }
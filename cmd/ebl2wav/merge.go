@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/merge"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+var (
+	// mergeStaging is the directory banks are converted into before being merged into
+	// the -merge library, empty without -merge
+	mergeStaging string
+
+	// mergedBanks lists the banks converted into mergeStaging
+	mergedBanks []merge.Bank
+	mergeMu     sync.Mutex
+)
+
+// libraryDir returns the directory of the -merge library
+func libraryDir() string {
+	if outputPath == "" {
+		return "E-MU Sounds"
+	}
+	return outputPath
+}
+
+// startMerge creates the staging directory of the -merge library, inside the library
+// so samples are moved rather than copied
+func startMerge() error {
+	library := libraryDir()
+	if !sink.IsURL(exbDirPath) {
+		if err := safepath.CheckOutput(exbDirPath, library); err != nil {
+			return fmt.Errorf("%w, pick another output directory with -o", err)
+		}
+	}
+	if err := os.MkdirAll(library, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	var err error
+	mergeStaging, err = os.MkdirTemp(library, ".merge-")
+	if err != nil {
+		return fmt.Errorf("error creating staging directory: %w", err)
+	}
+	return nil
+}
+
+// mergeBankDir returns the staging directory a bank is converted into with -merge,
+// mirroring the layout of the -exbdir tree, and records the bank for finishMerge
+func mergeBankDir(exbPath, name string) string {
+	dir := filepath.Join(mergeStaging, name)
+	if rel, err := relPath(exbDirPath, pathDir(exbPath)); err == nil && rel != "." {
+		dir = filepath.Join(mergeStaging, rel, name)
+	}
+
+	mergeMu.Lock()
+	defer mergeMu.Unlock()
+	mergedBanks = append(mergedBanks, merge.Bank{Name: name, Dir: dir})
+	return dir
+}
+
+// finishMerge merges the banks converted into the staging directory into the library,
+// then removes the staging directory
+func finishMerge(out io.Writer) {
+	library := libraryDir()
+
+	// Banks complete in any order, the first bank of the tree keeps the shared samples
+	sort.Slice(mergedBanks, func(i, j int) bool {
+		return mergedBanks[i].Dir < mergedBanks[j].Dir
+	})
+
+	merger := merge.NewMerger(library, debugMode)
+	merger.SetOutput(out)
+	result, err := merger.Merge(mergedBanks)
+	if err != nil {
+		fmt.Fprintf(out, "Error merging banks: %v\n", err)
+		fmt.Fprintf(out, "Converted files were left in %s\n", mergeStaging)
+		return
+	}
+	if err := os.RemoveAll(mergeStaging); err != nil {
+		fmt.Fprintf(out, "Error removing staging directory: %v\n", err)
+	}
+
+	logf(out, "Merged %d banks into %s: %d distinct samples for %d bank samples, %.1f MB of duplicates removed\n",
+		result.Banks, library, result.Unique, result.Samples, float64(result.Saved)/(1024*1024))
+	logf(out, "Wrote an SFZ and a DecentSampler preset referencing %s/ for each of %d banks\n",
+		merge.SamplesDir, len(result.Presets)/2)
+
+	// Export the sample catalog of the whole library if requested
+	if catalogFmt != "" {
+		exportCatalog(library, out)
+	}
+}
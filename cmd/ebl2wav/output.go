@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/i18n"
+)
+
+// logf prints a progress message in the -lang language unless -q is set. Errors are
+// printed directly so they show at every output level.
+func logf(out io.Writer, format string, args ...interface{}) {
+	if outputLevel >= converter.LevelNormal {
+		fmt.Fprintf(out, i18n.T(format), args...)
+	}
+}
+
+// outputMu serializes writes of every prefixWriter so lines of concurrent banks don't mix
+var outputMu sync.Mutex
+
+// prefixWriter prefixes every line written to it, writing whole lines at once
+type prefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+// newPrefixWriter creates a writer labeling each line with prefix
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:      w,
+		prefix: prefix,
+	}
+}
+
+// Write buffers p and writes every complete line
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return len(p), err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+}
+
+// Flush writes any incomplete buffered line
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	err := pw.writeLine(append(pw.buf, '\n'))
+	pw.buf = nil
+	return err
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	if _, err := io.WriteString(pw.w, pw.prefix); err != nil {
+		return err
+	}
+	_, err := pw.w.Write(line)
+	return err
+}
+
+// sequencer releases the output of concurrently processed banks in bank order, so
+// logs don't depend on scheduling. The output of the first unfinished bank is
+// written as it comes, later banks are buffered until their turn.
+type sequencer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	next int
+	bufs map[int]*bytes.Buffer
+	done map[int]bool
+}
+
+// newSequencer creates a sequencer writing to w
+func newSequencer(w io.Writer) *sequencer {
+	return &sequencer{
+		w:    w,
+		bufs: make(map[int]*bytes.Buffer),
+		done: make(map[int]bool),
+	}
+}
+
+// Writer returns the writer of the i-th bank
+func (s *sequencer) Writer(i int) io.Writer {
+	return sequencedWriter{s: s, i: i}
+}
+
+// Done marks the output of the i-th bank complete, releasing the output of the
+// following banks that are ready
+func (s *sequencer) Done(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done[i] = true
+	for s.done[s.next] {
+		delete(s.done, s.next)
+		s.next++
+		if buf, ok := s.bufs[s.next]; ok {
+			s.w.Write(buf.Bytes())
+			delete(s.bufs, s.next)
+		}
+	}
+}
+
+type sequencedWriter struct {
+	s *sequencer
+	i int
+}
+
+func (sw sequencedWriter) Write(p []byte) (int, error) {
+	sw.s.mu.Lock()
+	defer sw.s.mu.Unlock()
+
+	if sw.i == sw.s.next {
+		return sw.s.w.Write(p)
+	}
+	buf, ok := sw.s.bufs[sw.i]
+	if !ok {
+		buf = new(bytes.Buffer)
+		sw.s.bufs[sw.i] = buf
+	}
+	return buf.Write(p)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/archive"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+)
+
+// packOptions holds the flags of the pack subcommand
+type packOptions struct {
+	outputDir string
+}
+
+func (o *packOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("pack")
+	fs.StringVar(&o.outputDir, "o", "", "Directory the archives are written to (defaults to each directory's parent)")
+	return fs
+}
+
+// runPack moves the files of each converted directory into <dir>.zip, removing the
+// directory: ebl2wav pack [options] <dir>...
+func runPack(args []string) {
+	var opts packOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, dir := range fs.Args() {
+		dir = filepath.Clean(dir)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Printf("Error: %s is not a directory\n", dir)
+			failed = true
+			continue
+		}
+
+		// Packing removes the files, source banks must be left alone
+		if source, err := safepath.FindSource(dir); err != nil || source != "" {
+			if err == nil {
+				err = fmt.Errorf("%w %s, only converted directories can be packed", safepath.ErrSourceFile, source)
+			}
+			fmt.Printf("Error: %v\n", err)
+			failed = true
+			continue
+		}
+
+		zipDir := opts.outputDir
+		if zipDir == "" {
+			zipDir = filepath.Dir(dir)
+		}
+		zipPath := filepath.Join(zipDir, filepath.Base(dir)+".zip")
+
+		if err := archive.ZipDirectory(dir, zipPath); err != nil {
+			fmt.Printf("Error packaging %s: %v\n", dir, err)
+			failed = true
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("Error removing %s: %v\n", dir, err)
+		}
+		fmt.Printf("Packaged %s\n", zipPath)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
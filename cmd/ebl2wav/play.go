@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/playback"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+)
+
+// playOptions holds the flags of the play subcommand
+type playOptions struct {
+	player string
+	debug  bool
+}
+
+func (o *playOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("play")
+	fs.StringVar(&o.player, "player", "", "Audio player command the decoded WAV file is given to (defaults to afplay, ffplay, pw-play, paplay or aplay, whichever is found)")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runPlay decodes EBL files and plays them one after the other through the default
+// audio device: ebl2wav play [options] <file.ebl|bank.exb|dir>...
+func runPlay(args []string) {
+	var opts playOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var files []string
+	for _, arg := range fs.Args() {
+		found, err := findEBLFiles(arg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, found...)
+	}
+
+	player, err := playback.Find(opts.player)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Ctrl-C stops the sample playing and the ones left
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	parser := ebl.NewParser(opts.debug, false)
+	encoder := wav.NewEncoder(opts.debug, false, false, "")
+	failed := false
+	for i, file := range files {
+		err := playFile(ctx, parser, encoder, player, file, fmt.Sprintf("[%d/%d] ", i+1, len(files)))
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("Stopped.")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", filepath.Base(file), err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// playFile decodes an EBL file into a temporary WAV file and plays it
+func playFile(ctx context.Context, parser *ebl.Parser, encoder *wav.Encoder, player *playback.Player, path, prefix string) error {
+	eblFile, err := parser.ReadFile(path, "")
+	if err != nil {
+		return err
+	}
+	defer eblFile.Release()
+
+	if eblFile.Frames() == 0 {
+		fmt.Printf("%sSkipped placeholder %s: no audio\n", prefix, filepath.Base(path))
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "ebl2wav-play-*.wav")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = encoder.WriteWAVTo(tmp, eblFile)
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error decoding: %w", err)
+	}
+
+	channels := "mono"
+	if eblFile.Channels() == 2 {
+		channels = "stereo"
+	}
+	fmt.Printf("%sPlaying %s: %q, %.2fs, %d Hz, %s\n", prefix, filepath.Base(path), eblFile.Name(),
+		eblFile.Duration(), eblFile.HeaderData.SampleRate, channels)
+	return player.Play(ctx, tmp.Name())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+// presetsOptions holds the flags of the presets subcommand
+type presetsOptions struct {
+	name  string
+	debug bool
+}
+
+func (o *presetsOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("presets")
+	fs.StringVar(&o.name, "name", "", "Preset name (defaults to the directory name)")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runPresets writes a DecentSampler preset mapping the converted samples of each
+// directory: ebl2wav presets [options] <dir>...
+func runPresets(args []string) {
+	var opts presetsOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	debugMode = opts.debug
+	for _, dir := range fs.Args() {
+		presetName := opts.name
+		if presetName == "" {
+			presetName = filepath.Base(filepath.Clean(dir))
+		}
+		exportDSPreset(dir, presetName, os.Stdout)
+	}
+}
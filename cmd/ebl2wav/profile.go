@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+var (
+	cpuProfile string
+	memProfile string
+
+	// cpuProfileFile is the open -cpuprofile file while profiling
+	cpuProfileFile *os.File
+)
+
+func init() {
+	flag.StringVar(&cpuProfile, "cpuprofile", "", "Write a CPU profile of the conversion to this file (see go tool pprof)")
+	flag.StringVar(&memProfile, "memprofile", "", "Write a memory profile to this file once the conversion is done")
+}
+
+// startProfiles starts the CPU profile requested with -cpuprofile
+func startProfiles() error {
+	if cpuProfile == "" {
+		return nil
+	}
+
+	file, err := os.Create(cpuProfile)
+	if err != nil {
+		return fmt.Errorf("error creating CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("error starting CPU profile: %w", err)
+	}
+	cpuProfileFile = file
+	return nil
+}
+
+// stopProfiles stops the CPU profile and writes the memory profile, if requested
+func stopProfiles() {
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		cpuProfileFile.Close()
+		cpuProfileFile = nil
+	}
+
+	if memProfile != "" {
+		file, err := os.Create(memProfile)
+		if err != nil {
+			fmt.Fprintf(messages, "Error creating memory profile: %v\n", err)
+			return
+		}
+		defer file.Close()
+
+		// Collect garbage first so the profile shows live memory accurately
+		runtime.GC()
+		if err := pprof.Lookup("allocs").WriteTo(file, 0); err != nil {
+			fmt.Fprintf(messages, "Error writing memory profile: %v\n", err)
+		}
+		memProfile = ""
+	}
+}
+
+// exit restores the terminal of the interactive mode, completes the -tar stream and
+// writes the profiles, then exits with code
+func exit(code int) {
+	closeTerminal()
+	if err := closeTar(); err != nil {
+		fmt.Fprintf(messages, "Error: %v\n", err)
+		code = exitFatal
+	}
+	stopProfiles()
+	os.Exit(code)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+)
+
+// Progress modes set with -progress
+const (
+	progressText = "text" // Human readable messages
+	progressJSON = "json" // Newline-delimited JSON events on stdout, messages on stderr
+)
+
+// Events of the run reported besides the converter events
+const (
+	eventBankStarted   = "bank_started"
+	eventBankCompleted = "bank_completed"
+	eventBankFailed    = "bank_failed"
+	eventTotals        = "totals"
+)
+
+// eventWriter writes progress events as JSON lines
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// events is the destination of -progress json events, nil in text mode
+var events *eventWriter
+
+// startJSONProgress sends the progress events to stdout, moving every other message
+// to stderr so the stream can be parsed as is
+func startJSONProgress() {
+	events = &eventWriter{enc: json.NewEncoder(os.Stdout)}
+	messages = os.Stderr
+}
+
+// emitEvent writes an event when -progress json is set. It is passed to the
+// converters as their Events option, and may be called concurrently.
+func emitEvent(event converter.Event) {
+	if events == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	events.enc.Encode(event)
+}
+
+// converterEvents returns the Events option of the converters
+func converterEvents() func(converter.Event) {
+	if events == nil {
+		return nil
+	}
+	return emitEvent
+}
+
+// emitBankEvent reports the start or end of a bank, err telling why it failed
+func emitBankEvent(eventType, bank string, err error) {
+	event := converter.Event{Type: eventType, Bank: bank}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	emitEvent(event)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+)
+
+// addProjectBanks adds the banks referenced by project files to the EXB files found by
+// a scan, as some libraries ship their banks as project files loading EXB files stored
+// elsewhere. Banks already found aren't added again, references which don't resolve
+// are reported.
+func addProjectBanks(exbFiles, projects []string, out io.Writer) []string {
+	found := make(map[string]bool)
+	for _, exbFile := range exbFiles {
+		found[bankKey(exbFile)] = true
+	}
+
+	added := 0
+	for _, project := range projects {
+		p, err := exb.ReadProject(project)
+		if err != nil {
+			fmt.Fprintf(out, "PROJECT ERROR: %s: %v\n", project, err)
+			continue
+		}
+		for _, ref := range p.Missing {
+			fmt.Fprintf(out, "MISSING BANK: %s references %s\n", project, ref)
+		}
+		for _, bank := range p.Banks {
+			if key := bankKey(bank); !found[key] {
+				found[key] = true
+				exbFiles = append(exbFiles, bank)
+				added++
+			}
+		}
+	}
+
+	if len(projects) > 0 {
+		logf(out, "Found %d project files referencing %d more banks.\n", len(projects), added)
+	}
+	return exbFiles
+}
+
+// bankKey identifies an EXB file whatever the path it was reached by
+func bankKey(exbFile string) string {
+	if abs, err := filepath.Abs(exbFile); err == nil {
+		exbFile = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(exbFile); err == nil {
+		exbFile = resolved
+	}
+	return exbFile
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// listRemoteFiles returns the URLs of the objects with the given extension stored below an
+// s3:// or gs:// URL
+func listRemoteFiles(rawURL, ext string) ([]string, error) {
+	bucket, prefix, err := sink.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	objects, err := bucket.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, _, _ := strings.Cut(rawURL, "://")
+	var urls []string
+	for _, object := range objects {
+		if strings.ToLower(path.Ext(object.Key)) == ext {
+			urls = append(urls, fmt.Sprintf("%s://%s/%s", scheme, bucket.Bucket, object.Key))
+		}
+	}
+	return urls, nil
+}
+
+// pathDir returns the parent directory of a local path or object storage URL
+func pathDir(p string) string {
+	if !sink.IsURL(p) {
+		return filepath.Dir(p)
+	}
+	scheme, rest, _ := strings.Cut(p, "://")
+	return scheme + "://" + path.Dir(strings.TrimSuffix(rest, "/"))
+}
+
+// relPath returns target relative to base, both being local paths or object storage URLs.
+// It fails when target isn't below base, such as banks referenced by project files.
+func relPath(base, target string) (string, error) {
+	if !sink.IsURL(target) {
+		rel, err := filepath.Rel(base, target)
+		if err != nil {
+			return "", err
+		}
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s is not below %s", target, base)
+		}
+		return rel, nil
+	}
+
+	base = strings.TrimSuffix(base, "/")
+	if target == base {
+		return ".", nil
+	}
+	if !strings.HasPrefix(target, base+"/") {
+		return "", fmt.Errorf("%s is not below %s", target, base)
+	}
+	return filepath.FromSlash(strings.TrimPrefix(target, base+"/")), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/service"
+)
+
+// stdio combines stdin and stdout into a single connection
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+func (stdio) Close() error { return nil }
+
+// rpcOptions holds the flags of the rpc subcommand
+type rpcOptions struct {
+	addr     string
+	useStdio bool
+	debug    bool
+}
+
+func (o *rpcOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("rpc")
+	fs.StringVar(&o.addr, "addr", "localhost:8081", "Address to listen on")
+	fs.BoolVar(&o.useStdio, "stdio", false, "Serve a single client over stdin/stdout instead of listening")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode (only with -addr, debug output would corrupt the stdio stream)")
+	return fs
+}
+
+// runRPC starts the JSON-RPC service: ebl2wav rpc [options]
+func runRPC(args []string) {
+	var opts rpcOptions
+	parseFlags(opts.flags(), args)
+
+	// Keep stdout for the protocol with -stdio, messages go to stderr instead
+	var out io.Writer = os.Stdout
+	if opts.useStdio {
+		out = os.Stderr
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("Library", service.NewLibrary(opts.debug && !opts.useStdio, out)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if opts.useStdio {
+		server.ServeCodec(jsonrpc.NewServerCodec(stdio{os.Stdin, os.Stdout}))
+		return
+	}
+
+	listener, err := net.Listen("tcp", opts.addr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("JSON-RPC service listening on %s\n", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/server"
+)
+
+// serveOptions holds the flags of the serve subcommand
+type serveOptions struct {
+	addr    string
+	workDir string
+	root    string
+	jobTTL  time.Duration
+	debug   bool
+}
+
+func (o *serveOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("serve")
+	fs.StringVar(&o.addr, "addr", "localhost:8080", "Address to listen on")
+	fs.StringVar(&o.workDir, "workdir", filepath.Join(os.TempDir(), "ebl2wav-server"), "Directory for uploads and converted files")
+	fs.StringVar(&o.root, "root", "", "Library directory browsed by the web UI, path based jobs must point inside it")
+	fs.DurationVar(&o.jobTTL, "job-ttl", 24*time.Hour, "Remove finished jobs and their files after this long (0 keeps them until the server stops)")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runServe starts the HTTP server mode: ebl2wav serve [options]
+func runServe(args []string) {
+	var opts serveOptions
+	parseFlags(opts.flags(), args)
+
+	srv, err := server.NewServer(server.Options{
+		Debug:   opts.debug,
+		WorkDir: opts.workDir,
+		Root:    opts.root,
+		JobTTL:  opts.jobTTL,
+	})
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Listening on http://%s (work directory: %s)\n", opts.addr, opts.workDir)
+	if err := http.ListenAndServe(opts.addr, srv); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/diskspace"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// checkFreeSpace estimates the size of the files converted from the EBL files at
+// paths and exits before converting anything when the output directory doesn't have
+// room for them. Remote inputs aren't estimated.
+func checkFreeSpace(paths []string) {
+	if skipSpace {
+		return
+	}
+	var local []string
+	for _, path := range paths {
+		if !sink.IsURL(path) {
+			local = append(local, path)
+		}
+	}
+	if len(local) == 0 {
+		return
+	}
+
+	estimate, err := converter.EstimateOutput(local, followLinks)
+	if err != nil {
+		// Scanning errors are reported by the conversion
+		return
+	}
+	dest := outputPath
+	if dest == "" {
+		dest = "E-MU Sounds"
+	}
+	err = diskspace.Check(dest, estimate.Bytes)
+	switch {
+	case errors.Is(err, diskspace.ErrInsufficient):
+		fmt.Fprintf(messages, "Error: converting %d EBL files: %v\n", estimate.Files, err)
+		fmt.Fprintln(messages, "Free some space, pick another output directory with -o, or use -skip-space-check.")
+		exit(exitFatal)
+	case err != nil && debugMode:
+		fmt.Fprintf(messages, "Free space not checked: %v\n", err)
+	}
+}
+
+// samplePools returns the SamplePool directories of banks, those which can't be
+// found being reported when the banks are converted
+func samplePools(exbFiles []string) []string {
+	var pools []string
+	for _, exbFile := range exbFiles {
+		if sink.IsURL(exbFile) {
+			continue
+		}
+		if pool, err := exb.FindSamplePool(exbFile); err == nil {
+			pools = append(pools, pool)
+		}
+	}
+	return pools
+}
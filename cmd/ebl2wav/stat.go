@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// statOptions holds the flags of the stat subcommand
+type statOptions struct {
+	header bool
+}
+
+func (o *statOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("stat")
+	fs.BoolVar(&o.header, "header", false, "Print a line naming the columns first")
+	return fs
+}
+
+// statColumns names the tab-separated columns printed by stat
+var statColumns = []string{"path", "duration", "samplerate", "channels", "bits", "rootkey", "regions", "name", "header3name", "comment"}
+
+// fieldReplacer keeps names from breaking the columns of stat lines
+var fieldReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// runStat prints the details of EBL files one per line, for shell pipelines:
+// ebl2wav stat [options] <file.ebl|bank.exb|dir>...
+func runStat(args []string) {
+	var opts statOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if opts.header {
+		fmt.Println(strings.Join(statColumns, "\t"))
+	}
+
+	parser := ebl.NewParser(false, false)
+	failed := false
+	for _, arg := range fs.Args() {
+		files, err := findEBLFiles(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+			failed = true
+			continue
+		}
+		for _, file := range files {
+			line, err := statLine(parser, file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+				failed = true
+				continue
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// statLine reads the headers of an EBL file, without its audio, into a line of
+// tab-separated columns (see statColumns). Missing values are printed as "-".
+func statLine(parser *ebl.Parser, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	eblFile, err := parser.ReadHeader(file, path, info.Size())
+	if err != nil {
+		return "", err
+	}
+
+	var regions []string
+	for _, region := range eblFile.Regions() {
+		regions = append(regions, fmt.Sprintf("%d-%d", region.Start, region.End))
+	}
+	fields := []string{
+		path,
+		fmt.Sprintf("%.3f", eblFile.Duration()),
+		fmt.Sprint(eblFile.HeaderData.SampleRate),
+		fmt.Sprint(eblFile.Channels()),
+		"16",
+		ebl.NoteName(eblFile.RootKey),
+		strings.Join(regions, ","),
+		eblFile.HeaderData.FilenameStr,
+		eblFile.Header3.Filename,
+		eblFile.HeaderData.CommentStr,
+	}
+	for i, field := range fields {
+		if field == "" {
+			field = "-"
+		}
+		fields[i] = fieldReplacer.Replace(field)
+	}
+	return strings.Join(fields, "\t"), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/archive"
+)
+
+var (
+	tarPath string
+	tarZstd bool
+
+	// tarStream is the open -tar stream, nil without -tar
+	tarStream *archive.TarWriter
+	// tarFile is the file of the -tar stream, nil when it is written to stdout
+	tarFile *os.File
+)
+
+func init() {
+	flag.StringVar(&tarPath, "tar", "", "Stream the converted banks into a single tar archive written to this file, or - for stdout, instead of leaving their files in the output directory")
+	flag.BoolVar(&tarZstd, "zstd", false, "Compress the -tar archive with zstd (needs the zstd command)")
+}
+
+// startTar opens the -tar stream. Written to stdout, every other message moves to
+// stderr so the archive can be piped as is.
+func startTar() error {
+	var w io.Writer
+	if tarPath == "-" {
+		w = os.Stdout
+		messages = os.Stderr
+	} else {
+		file, err := os.Create(tarPath)
+		if err != nil {
+			return fmt.Errorf("error creating tar archive: %w", err)
+		}
+		tarFile, w = file, file
+	}
+
+	stream, err := archive.NewTarWriter(w, tarZstd)
+	if err != nil {
+		if tarFile != nil {
+			tarFile.Close()
+			os.Remove(tarPath)
+			tarFile = nil
+		}
+		return err
+	}
+	tarStream = stream
+	return nil
+}
+
+// checkTar stops the run once writing to the -tar stream failed: the archive is left
+// incomplete, exit reporting the error
+func checkTar() {
+	if tarStream != nil && tarStream.Err() != nil {
+		exit(exitFatal)
+	}
+}
+
+// closeTar completes the -tar stream, if any
+func closeTar() error {
+	if tarStream == nil {
+		return nil
+	}
+	err := tarStream.Close()
+	tarStream = nil
+	if tarFile != nil {
+		if closeErr := tarFile.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("error writing tar archive: %w", closeErr)
+		}
+		tarFile = nil
+	}
+	return err
+}
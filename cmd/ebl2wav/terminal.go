@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Keys returned by readKeys
+const (
+	keyUp     = "up"
+	keyDown   = "down"
+	keySpace  = "space"
+	keyEnter  = "enter"
+	keyCtrlC  = "ctrl-c"
+	keyEscape = "escape"
+)
+
+// terminal puts the terminal in raw mode on the alternate screen for the interactive
+// mode. Raw mode is set with stty, so the interactive mode isn't available on Windows.
+type terminal struct {
+	state string        // stty settings to restore
+	done  chan struct{} // Closed once the terminal is restored
+	once  sync.Once
+}
+
+// openedTerminal is the terminal in raw mode, restored by exit
+var openedTerminal *terminal
+
+// openTerminal switches the terminal to raw mode
+func openTerminal() (*terminal, error) {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil, fmt.Errorf("the interactive mode needs a terminal")
+	}
+
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("error reading terminal settings: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("error setting terminal to raw mode: %w", err)
+	}
+
+	// Alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	openedTerminal = &terminal{state: state, done: make(chan struct{})}
+	return openedTerminal, nil
+}
+
+// Close restores the terminal and stops the readKeys goroutine. It can be called
+// more than once.
+func (t *terminal) Close() {
+	t.once.Do(func() {
+		close(t.done)
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		stty(t.state)
+	})
+}
+
+// closeTerminal restores the terminal left in raw mode, if any
+func closeTerminal() {
+	if openedTerminal != nil {
+		openedTerminal.Close()
+	}
+}
+
+// Size returns the number of rows and columns of the terminal
+func (t *terminal) Size() (int, int) {
+	var rows, cols int
+	if out, err := stty("size"); err == nil {
+		fmt.Sscanf(out, "%d %d", &rows, &cols)
+	}
+	// Some terminals don't report their size
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// Render redraws the screen with lines, truncated to the terminal size
+func (t *terminal) Render(lines []string) {
+	rows, cols := t.Size()
+	if len(lines) > rows {
+		lines = lines[:rows]
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		if visibleLen(line) > cols {
+			line = truncate(line, cols)
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\x1b[J")
+	fmt.Print(b.String())
+}
+
+// readKeys returns a channel receiving the keys pressed. Letters are sent as is. Keys
+// are no longer sent once done is closed, the goroutine returning after the read
+// pending on stdin.
+func readKeys(done <-chan struct{}) <-chan string {
+	keys := make(chan string)
+	send := func(key string) bool {
+		select {
+		case keys <- key:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			input := buf[:n]
+			for len(input) > 0 {
+				var key string
+				switch {
+				case len(input) >= 3 && input[0] == 0x1b && input[1] == '[' && input[2] == 'A':
+					key = keyUp
+					input = input[3:]
+				case len(input) >= 3 && input[0] == 0x1b && input[1] == '[' && input[2] == 'B':
+					key = keyDown
+					input = input[3:]
+				case len(input) >= 3 && input[0] == 0x1b && input[1] == '[':
+					// Other escape sequences are ignored
+					input = input[3:]
+					continue
+				case input[0] == 0x1b:
+					key = keyEscape
+					input = input[1:]
+				case input[0] == ' ':
+					key = keySpace
+					input = input[1:]
+				case input[0] == '\r' || input[0] == '\n':
+					key = keyEnter
+					input = input[1:]
+				case input[0] == 3:
+					key = keyCtrlC
+					input = input[1:]
+				default:
+					key = string(input[:1])
+					input = input[1:]
+				}
+				if !send(key) {
+					return
+				}
+			}
+		}
+	}()
+	return keys
+}
+
+// stty runs stty on the terminal attached to stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// visibleLen returns the number of characters of s, ignoring ANSI escape sequences
+func visibleLen(s string) int {
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == 0x1b:
+			inEscape = true
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// truncate shortens s to width visible characters, keeping ANSI escape sequences
+func truncate(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == 0x1b:
+			inEscape = true
+			b.WriteRune(r)
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+			b.WriteRune(r)
+		case n < width:
+			b.WriteRune(r)
+			n++
+		}
+	}
+	return b.String()
+}
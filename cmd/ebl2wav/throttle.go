@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/iolimit"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// ioLimiter bounds the files converted at once and their throughput, set up by
+// setupIOLimits. nil when nothing is limited.
+var ioLimiter *iolimit.Limiter
+
+// setupIOLimits validates -max-open-files and -max-throughput and creates ioLimiter.
+// Unless -max-open-files is set, runs reading or writing a network share convert up
+// to iolimit.NetworkMaxOpenFiles files at once.
+func setupIOLimits() error {
+	if maxOpen < 0 {
+		return fmt.Errorf("-max-open-files can't be negative")
+	}
+	rate, err := iolimit.ParseRate(maxRate)
+	if err != nil {
+		return fmt.Errorf("-max-throughput: %w", err)
+	}
+
+	openFiles := maxOpen
+	if !isFlagSet("max-open-files") {
+		if path := networkPath(); path != "" {
+			openFiles = iolimit.NetworkMaxOpenFiles
+			logf(messages, "%s is on a network share, converting up to %d files at once (set -max-open-files to change this).\n", path, openFiles)
+		}
+	}
+	ioLimiter = iolimit.NewLimiter(openFiles, rate)
+	return nil
+}
+
+// networkPath returns the first input or output path on a network share, or an
+// empty string when they are all local
+func networkPath() string {
+	output := outputPath
+	if output == "" {
+		output = "E-MU Sounds"
+	}
+	for _, path := range []string{inputPath, exbPath, exbDirPath, output} {
+		if path != "" && !sink.IsURL(path) && iolimit.IsNetworkPath(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// isFlagSet reports whether the flag name was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
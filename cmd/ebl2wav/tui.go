@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+)
+
+// Bank states of the interactive mode
+const (
+	bankQueued     = "queued"
+	bankConverting = "converting"
+	bankDone       = "done"
+)
+
+// tuiBank is a bank listed by the interactive mode
+type tuiBank struct {
+	path     string
+	name     string
+	selected bool
+	status   string
+	done     int
+	total    int
+	errors   int
+}
+
+// tui is the interactive mode: banks found under -exbdir are listed for selection,
+// then converted while their progress is displayed
+type tui struct {
+	mu     sync.Mutex
+	term   *terminal
+	keys   <-chan string
+	root   string
+	banks  []*tuiBank
+	cursor int
+	errors []string // Error lines of every bank, most recent last
+}
+
+// runTUI runs the interactive mode on the banks found in exbDirPath, returning the
+// aggregated result of the converted banks
+func runTUI(exbDirPath string) batchResult {
+	exbFiles := removeDuplicateBanks(findExbFiles(exbDirPath), skipDupes, os.Stdout)
+	checkFreeSpace(samplePools(exbFiles))
+
+	term, err := openTerminal()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		exit(exitFatal)
+	}
+
+	ui := &tui{term: term, keys: readKeys(term.done), root: exbDirPath}
+	for _, exbFile := range exbFiles {
+		ui.banks = append(ui.banks, &tuiBank{
+			path:     exbFile,
+			name:     strings.TrimSuffix(filepath.Base(exbFile), filepath.Ext(exbFile)),
+			selected: true,
+		})
+	}
+
+	if !ui.selectBanks() {
+		term.Close()
+		fmt.Println("No bank converted.")
+		exit(exitOK)
+	}
+	result := ui.convert()
+	term.Close()
+
+	// Leave the errors on the normal screen
+	for _, line := range ui.errors {
+		fmt.Println(line)
+	}
+	return result
+}
+
+// selectBanks lets the user pick the banks to convert. It returns false when the user quits.
+func (ui *tui) selectBanks() bool {
+	for {
+		ui.term.Render(ui.selectionLines())
+
+		key, ok := <-ui.keys
+		if !ok {
+			return false
+		}
+		switch key {
+		case keyUp, "k":
+			if ui.cursor > 0 {
+				ui.cursor--
+			}
+		case keyDown, "j":
+			if ui.cursor < len(ui.banks)-1 {
+				ui.cursor++
+			}
+		case keySpace:
+			ui.banks[ui.cursor].selected = !ui.banks[ui.cursor].selected
+		case "a":
+			// Select all, or none when all are selected
+			all := true
+			for _, bank := range ui.banks {
+				all = all && bank.selected
+			}
+			for _, bank := range ui.banks {
+				bank.selected = !all
+			}
+		case keyEnter:
+			if ui.selectedCount() > 0 {
+				return true
+			}
+		case "q", keyEscape, keyCtrlC:
+			return false
+		}
+	}
+}
+
+// selectionLines renders the bank selection screen
+func (ui *tui) selectionLines() []string {
+	rows, _ := ui.term.Size()
+	lines := []string{
+		fmt.Sprintf("\x1b[1mebl2wav\x1b[0m - %d banks found in %s, %d selected", len(ui.banks), ui.root, ui.selectedCount()),
+		"",
+	}
+
+	// Keep the cursor visible
+	height := max(1, rows-4)
+	offset := max(0, min(ui.cursor-height/2, len(ui.banks)-height))
+	for i := offset; i < len(ui.banks) && i < offset+height; i++ {
+		bank := ui.banks[i]
+		check := "[ ]"
+		if bank.selected {
+			check = "[x]"
+		}
+		line := fmt.Sprintf(" %s %s", check, ui.bankLabel(bank))
+		if i == ui.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "", "\x1b[2m↑/↓ move  space select  a select all  enter convert  q quit\x1b[0m")
+	return lines
+}
+
+// convert converts the selected banks, displaying their progress
+func (ui *tui) convert() batchResult {
+	var selected []*tuiBank
+	for _, bank := range ui.banks {
+		if bank.selected {
+			bank.status = bankQueued
+			selected = append(selected, bank)
+		}
+	}
+
+	results := make([]converter.Result, len(selected))
+	errs := make([]error, len(selected))
+	finished := make(chan struct{})
+	go func() {
+		runBanks(len(selected), min(max(1, bankJobs), len(selected)), func(i int) {
+			bank := selected[i]
+			ui.update(func() { bank.status = bankConverting })
+
+			out := &tuiLog{ui: ui, bank: bank}
+			results[i], errs[i] = processExbFile(bank.path, out, func(event converter.ProgressEvent) {
+				ui.update(func() {
+					bank.done = event.Done
+					bank.total = event.Total
+				})
+			})
+			if errs[i] != nil {
+				fmt.Fprintf(out, "Error: %v\n", errs[i])
+			}
+			out.Flush()
+
+			ui.update(func() { bank.status = bankDone })
+		})
+		close(finished)
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		ui.mu.Lock()
+		lines := ui.progressLines(selected, false)
+		ui.mu.Unlock()
+		ui.term.Render(lines)
+
+		select {
+		case <-finished:
+			ui.mu.Lock()
+			lines := ui.progressLines(selected, true)
+			ui.mu.Unlock()
+			ui.term.Render(lines)
+			<-ui.keys
+			return sumResults(results, errs)
+		case key := <-ui.keys:
+			if key == keyCtrlC {
+				ui.term.Close()
+				fmt.Println("Interrupted.")
+				exit(130)
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// progressLines renders the conversion screen. Callers hold ui.mu.
+func (ui *tui) progressLines(banks []*tuiBank, finished bool) []string {
+	rows, cols := ui.term.Size()
+	completed := 0
+	for _, bank := range banks {
+		if bank.status == bankDone {
+			completed++
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("\x1b[1mebl2wav\x1b[0m - converting %d banks, %d done", len(banks), completed),
+		"",
+	}
+
+	// Show the last errors at the bottom, the banks in the space left
+	maxErrors := min(len(ui.errors), 5)
+	height := max(1, rows-6-maxErrors)
+	// Start the list a little before the first unfinished bank
+	first := len(banks)
+	for i, bank := range banks {
+		if bank.status != bankDone {
+			first = i
+			break
+		}
+	}
+	offset := max(0, min(first-2, len(banks)-height))
+	for i := offset; i < len(banks) && i < offset+height; i++ {
+		lines = append(lines, ui.progressLine(banks[i], cols))
+	}
+
+	if maxErrors > 0 {
+		lines = append(lines, "", fmt.Sprintf("\x1b[1mErrors (%d)\x1b[0m", len(ui.errors)))
+		for _, line := range ui.errors[len(ui.errors)-maxErrors:] {
+			lines = append(lines, "\x1b[31m"+line+"\x1b[0m")
+		}
+	}
+
+	footer := "\x1b[2mctrl-c abort\x1b[0m"
+	if finished {
+		footer = "\x1b[1mAll banks processed.\x1b[0m Press any key to exit."
+	}
+	return append(lines, "", footer)
+}
+
+// progressLine renders the progress of a bank
+func (ui *tui) progressLine(bank *tuiBank, cols int) string {
+	label := fmt.Sprintf(" %-30s ", truncate(ui.bankLabel(bank), 30))
+
+	var status string
+	switch bank.status {
+	case bankQueued:
+		status = "\x1b[2mqueued\x1b[0m"
+	case bankConverting, bankDone:
+		width := max(10, min(40, cols-len(label)-30))
+		filled := 0
+		if bank.total > 0 {
+			filled = width * bank.done / bank.total
+		}
+		status = fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat("-", width-filled), bank.done, bank.total)
+		if bank.status == bankDone {
+			status = "\x1b[32m" + status + " done\x1b[0m"
+		}
+	}
+	switch {
+	case bank.errors == 1:
+		status += " \x1b[31m1 error\x1b[0m"
+	case bank.errors > 1:
+		status += fmt.Sprintf(" \x1b[31m%d errors\x1b[0m", bank.errors)
+	}
+	return label + status
+}
+
+// bankLabel returns the bank name, with its folder when it isn't the bank's own
+func (ui *tui) bankLabel(bank *tuiBank) string {
+	dir := filepath.Base(pathDir(bank.path))
+	if dir == bank.name || dir == "." {
+		return bank.name
+	}
+	return dir + "/" + bank.name
+}
+
+// selectedCount returns the number of selected banks
+func (ui *tui) selectedCount() int {
+	n := 0
+	for _, bank := range ui.banks {
+		if bank.selected {
+			n++
+		}
+	}
+	return n
+}
+
+// update applies a change to the displayed state
+func (ui *tui) update(fn func()) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	fn()
+}
+
+// tuiLog collects the error lines written by the conversion of a bank
+type tuiLog struct {
+	ui   *tui
+	bank *tuiBank
+	buf  []byte
+}
+
+// Write buffers p and records every complete error line
+func (l *tuiLog) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		l.record(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+}
+
+// Flush records any incomplete buffered line
+func (l *tuiLog) Flush() {
+	if len(l.buf) > 0 {
+		l.record(string(l.buf))
+		l.buf = nil
+	}
+}
+
+func (l *tuiLog) record(line string) {
+	if !strings.Contains(line, "ERROR") && !strings.HasPrefix(line, "Error") {
+		return
+	}
+	l.ui.update(func() {
+		l.bank.errors++
+		l.ui.errors = append(l.ui.errors, l.bank.name+": "+line)
+	})
+}
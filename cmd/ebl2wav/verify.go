@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/audit"
+)
+
+// verifyOptions holds the flags of the verify subcommand
+type verifyOptions struct {
+	jsonOutput bool
+	debug      bool
+}
+
+func (o *verifyOptions) flags() *flag.FlagSet {
+	fs := newFlagSet("verify")
+	fs.BoolVar(&o.jsonOutput, "json", false, "Print the report as JSON")
+	fs.BoolVar(&o.debug, "d", false, "Debug mode")
+	return fs
+}
+
+// runVerify audits previously converted libraries: ebl2wav verify [options] <dir>...
+func runVerify(args []string) {
+	var opts verifyOptions
+	fs := opts.flags()
+	parseFlags(fs, args)
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"E-MU Sounds"}
+	}
+
+	auditor := audit.NewAuditor(opts.debug)
+	report := &audit.Report{}
+	for _, dir := range dirs {
+		dirReport, err := auditor.AuditDirectory(dir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		report.Manifests += dirReport.Manifests
+		report.Samples += dirReport.Samples
+		report.Unverified += dirReport.Unverified
+		report.Problems = append(report.Problems, dirReport.Problems...)
+	}
+
+	if opts.jsonOutput {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+		fmt.Printf("Checked %d files in %d manifests: %d problems", report.Samples, report.Manifests, len(report.Problems))
+		if report.Unverified > 0 {
+			fmt.Printf(", %d files without checksum", report.Unverified)
+		}
+		fmt.Println()
+	}
+
+	if report.Manifests == 0 {
+		fmt.Println("No manifest found.")
+		os.Exit(1)
+	}
+	if len(report.Problems) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,422 @@
+// Package analysis aggregates the header values of a corpus of EBL files to help
+// identify the header fields whose meaning is still unknown
+package analysis
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// Fields lists the header data values analyzed, in header order
+var Fields = []string{"V1", "V2", "V3", "V4", "V5", "V6", "V7", "V8", "V9", "SampleRate", "V11", "V12"}
+
+// Knowns lists the quantities the fields are compared with, all of them understood
+var Knowns = []string{"Size", "FormSize", "Header3Size", "Header4Size", "HeaderRead", "Channel1Size", "Channel2Size", "Frames", "Channels", "TrailerSize"}
+
+// values returns the analyzed fields and known quantities of a file by name
+func values(f *ebl.EBLFile) map[string]int {
+	h := f.HeaderData
+	return map[string]int{
+		"V1":           h.V1,
+		"V2":           h.V2,
+		"V3":           h.V3,
+		"V4":           h.V4,
+		"V5":           h.V5,
+		"V6":           h.V6,
+		"V7":           h.V7,
+		"V8":           h.V8,
+		"V9":           h.V9,
+		"SampleRate":   h.SampleRate,
+		"V11":          h.V11,
+		"V12":          h.V12,
+		"Size":         int(f.Size),
+		"FormSize":     f.Header1.FileSize,
+		"Header3Size":  f.Header3.DataSize,
+		"Header4Size":  f.Header4.Size,
+		"HeaderRead":   int(f.HeaderRead),
+		"Channel1Size": f.Channel1Size,
+		"Channel2Size": f.Channel2Size,
+		"Frames":       f.Frames(),
+		"Channels":     f.Channels(),
+		"TrailerSize":  f.Version.TrailerSize,
+	}
+}
+
+// Scope names, files are also grouped by layout variant as "variant <name>"
+const (
+	ScopeAll    = "all"
+	ScopeMono   = "mono"
+	ScopeStereo = "stereo"
+)
+
+// sample is the values of a file
+type sample struct {
+	path   string
+	values map[string]int
+}
+
+// Corpus collects the header values of EBL files
+type Corpus struct {
+	samples  []sample
+	scopes   map[string][]int // Indexes of the samples of each scope
+	failures map[string]string
+}
+
+// NewCorpus creates an empty corpus
+func NewCorpus() *Corpus {
+	return &Corpus{
+		scopes:   make(map[string][]int),
+		failures: make(map[string]string),
+	}
+}
+
+// Add adds the values of a parsed file
+func (c *Corpus) Add(path string, f *ebl.EBLFile) {
+	i := len(c.samples)
+	c.samples = append(c.samples, sample{path: path, values: values(f)})
+
+	channels := ScopeStereo
+	if f.Channels() == 1 {
+		channels = ScopeMono
+	}
+	for _, scope := range []string{ScopeAll, channels, "variant " + f.Version.String()} {
+		c.scopes[scope] = append(c.scopes[scope], i)
+	}
+}
+
+// AddFailure records a file which couldn't be parsed
+func (c *Corpus) AddFailure(path string, err error) {
+	c.failures[path] = err.Error()
+}
+
+// Len returns the number of files added
+func (c *Corpus) Len() int {
+	return len(c.samples)
+}
+
+// WriteCSV writes the values of every file as CSV, a row per file, for analysis
+// in other tools
+func (c *Corpus) WriteCSV(w io.Writer) error {
+	header := append([]string{"path"}, Fields...)
+	header = append(header, Knowns...)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("error writing CSV: %w", err)
+	}
+	for _, s := range c.samples {
+		row := []string{s.path}
+		for _, name := range header[1:] {
+			row = append(row, strconv.Itoa(s.values[name]))
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("error writing CSV: %w", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ValueCount is a value and the number of files having it
+type ValueCount struct {
+	Value int `json:"value"`
+	Count int `json:"count"`
+}
+
+// Relation is an equation between a field and other values holding for a share of
+// the files of a scope
+type Relation struct {
+	Scope string  `json:"scope"`
+	Expr  string  `json:"expr"`  // e.g. "V7 = V6 + Channel1Size" or "V1 = 301"
+	Share float64 `json:"share"` // Fraction of the files of the scope, 0..1
+	Files int     `json:"files"` // Files in the scope
+}
+
+// Correlation is a strong linear correlation between a field and another value,
+// reported for the fields without exact relation
+type Correlation struct {
+	Scope string  `json:"scope"`
+	With  string  `json:"with"`
+	R     float64 `json:"r"` // Pearson correlation coefficient
+}
+
+// FieldReport describes the distribution of a field
+type FieldReport struct {
+	Name         string        `json:"name"`
+	Min          int           `json:"min"`
+	Max          int           `json:"max"`
+	Distinct     int           `json:"distinct"`
+	Common       []ValueCount  `json:"common"` // Most common values
+	Relations    []Relation    `json:"relations,omitempty"`
+	Correlations []Correlation `json:"correlations,omitempty"`
+}
+
+// Report is the outcome of the analysis of a corpus
+type Report struct {
+	Files    int               `json:"files"`
+	Scopes   map[string]int    `json:"scopes"` // Files per scope
+	Fields   []FieldReport     `json:"fields"`
+	Failures map[string]string `json:"failures,omitempty"` // Parsing errors by path
+}
+
+// Options tune the analysis
+type Options struct {
+	Threshold   float64 // Share of the files of a scope a relation must hold for, 0.95 by default
+	MinFiles    int     // Files a scope needs to be analyzed, 2 by default
+	Correlation float64 // Minimum absolute coefficient of the reported correlations, 0.99 by default
+	TopValues   int     // Most common values listed per field, 5 by default
+}
+
+func (o *Options) defaults() {
+	if o.Threshold <= 0 {
+		o.Threshold = 0.95
+	}
+	if o.MinFiles <= 0 {
+		o.MinFiles = 2
+	}
+	if o.Correlation <= 0 {
+		o.Correlation = 0.99
+	}
+	if o.TopValues <= 0 {
+		o.TopValues = 5
+	}
+}
+
+// Analyze aggregates the distributions of the fields and the relations between them
+// and the known quantities. Relations are looked for across every file first, then
+// within the mono, stereo and variant scopes for the ones not holding everywhere.
+func (c *Corpus) Analyze(opts Options) *Report {
+	opts.defaults()
+
+	report := &Report{
+		Files:    len(c.samples),
+		Scopes:   make(map[string]int),
+		Failures: c.failures,
+	}
+	for scope, indexes := range c.scopes {
+		report.Scopes[scope] = len(indexes)
+	}
+
+	for _, field := range Fields {
+		fr := c.distribution(field, opts.TopValues)
+
+		found := make(map[string]bool)
+		for _, scope := range c.scopeNames() {
+			indexes := c.scopes[scope]
+			if len(indexes) < opts.MinFiles {
+				continue
+			}
+			for _, rel := range c.relations(field, indexes, opts.Threshold) {
+				if found[rel.Expr] {
+					continue
+				}
+				found[rel.Expr] = true
+				rel.Scope = scope
+				fr.Relations = append(fr.Relations, rel)
+			}
+			if scope == ScopeAll && len(fr.Relations) == 0 {
+				fr.Correlations = c.correlations(field, indexes, opts.Correlation)
+			}
+		}
+		report.Fields = append(report.Fields, fr)
+	}
+
+	return report
+}
+
+// scopeNames returns the scopes, all first then the others in lexical order
+func (c *Corpus) scopeNames() []string {
+	names := []string{ScopeAll}
+	for scope := range c.scopes {
+		if scope != ScopeAll {
+			names = append(names, scope)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// distribution returns the range and most common values of a field
+func (c *Corpus) distribution(field string, top int) FieldReport {
+	fr := FieldReport{Name: field}
+	counts := make(map[int]int)
+	for i, s := range c.samples {
+		v := s.values[field]
+		counts[v]++
+		if i == 0 || v < fr.Min {
+			fr.Min = v
+		}
+		if i == 0 || v > fr.Max {
+			fr.Max = v
+		}
+	}
+	fr.Distinct = len(counts)
+	fr.Common = mostCommon(counts, top)
+	return fr
+}
+
+// mostCommon returns the n most common values, the smallest first on ties
+func mostCommon(counts map[int]int, n int) []ValueCount {
+	common := make([]ValueCount, 0, len(counts))
+	for value, count := range counts {
+		common = append(common, ValueCount{value, count})
+	}
+	sort.Slice(common, func(i, j int) bool {
+		if common[i].Count != common[j].Count {
+			return common[i].Count > common[j].Count
+		}
+		return common[i].Value < common[j].Value
+	})
+	if len(common) > n {
+		common = common[:n]
+	}
+	return common
+}
+
+// others returns the names of the values a field is compared with
+func others(field string) []string {
+	var names []string
+	for _, name := range append(append([]string{}, Fields...), Knowns...) {
+		if name != field {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// relations returns the relations of a field holding for threshold of the files,
+// simplest first: a constant, a constant offset from another value, then the sum of
+// two values plus a constant offset. Relations implied by a simpler one are left out.
+func (c *Corpus) relations(field string, indexes []int, threshold float64) []Relation {
+	var relations []Relation
+	n := len(indexes)
+	holds := func(counts map[int]int) (int, float64, bool) {
+		best := mostCommon(counts, 1)[0]
+		share := float64(best.Count) / float64(n)
+		return best.Value, share, share >= threshold
+	}
+
+	// Constant
+	constants := make(map[string]bool)
+	counts := make(map[int]int)
+	for _, i := range indexes {
+		counts[c.samples[i].values[field]]++
+	}
+	if value, share, ok := holds(counts); ok {
+		relations = append(relations, Relation{Expr: fmt.Sprintf("%s = %d", field, value), Share: share, Files: n})
+		return relations
+	}
+	for _, name := range others(field) {
+		counts := make(map[int]int)
+		for _, i := range indexes {
+			counts[c.samples[i].values[name]]++
+		}
+		if _, _, ok := holds(counts); ok {
+			constants[name] = true
+		}
+	}
+
+	// Offset from another value, constants add nothing to the constant case
+	explained := make(map[string]bool)
+	for _, name := range others(field) {
+		if constants[name] {
+			continue
+		}
+		counts := make(map[int]int)
+		for _, i := range indexes {
+			v := c.samples[i].values
+			counts[v[field]-v[name]]++
+		}
+		if offset, share, ok := holds(counts); ok {
+			relations = append(relations, Relation{Expr: field + " = " + name + formatOffset(offset), Share: share, Files: n})
+			explained[name] = true
+		}
+	}
+	if len(relations) > 0 {
+		return relations
+	}
+
+	// Sum of two values
+	names := others(field)
+	for a := 0; a < len(names); a++ {
+		for b := a + 1; b < len(names); b++ {
+			if constants[names[a]] || constants[names[b]] || explained[names[a]] || explained[names[b]] {
+				continue
+			}
+			counts := make(map[int]int)
+			for _, i := range indexes {
+				v := c.samples[i].values
+				counts[v[field]-v[names[a]]-v[names[b]]]++
+			}
+			if offset, share, ok := holds(counts); ok {
+				expr := fmt.Sprintf("%s = %s + %s%s", field, names[a], names[b], formatOffset(offset))
+				relations = append(relations, Relation{Expr: expr, Share: share, Files: n})
+			}
+		}
+	}
+	return relations
+}
+
+// formatOffset returns " + n", " - n" or an empty string for 0
+func formatOffset(offset int) string {
+	switch {
+	case offset > 0:
+		return fmt.Sprintf(" + %d", offset)
+	case offset < 0:
+		return fmt.Sprintf(" - %d", -offset)
+	}
+	return ""
+}
+
+// correlations returns the values most strongly correlated with a field, for fields
+// without exact relation
+func (c *Corpus) correlations(field string, indexes []int, minR float64) []Correlation {
+	var correlations []Correlation
+	for _, name := range others(field) {
+		r := pearson(c.samples, indexes, field, name)
+		if math.Abs(r) >= minR {
+			correlations = append(correlations, Correlation{Scope: ScopeAll, With: name, R: r})
+		}
+	}
+	sort.SliceStable(correlations, func(i, j int) bool {
+		return math.Abs(correlations[i].R) > math.Abs(correlations[j].R)
+	})
+	if len(correlations) > maxCorrelations {
+		correlations = correlations[:maxCorrelations]
+	}
+	return correlations
+}
+
+// maxCorrelations is the number of correlations reported per field
+const maxCorrelations = 3
+
+// pearson returns the correlation coefficient of two values across samples, 0 when
+// either is constant
+func pearson(samples []sample, indexes []int, x, y string) float64 {
+	n := float64(len(indexes))
+	var sumX, sumY float64
+	for _, i := range indexes {
+		sumX += float64(samples[i].values[x])
+		sumY += float64(samples[i].values[y])
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for _, i := range indexes {
+		dx := float64(samples[i].values[x]) - meanX
+		dy := float64(samples[i].values[y]) - meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varX*varY)
+}
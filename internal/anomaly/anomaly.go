@@ -0,0 +1,176 @@
+// Package anomaly flags decoded audio that is unlikely to be what the sample holds:
+// digital silence, clipping, DC offset and byte-swapped or garbled data, the usual
+// result of a header variant being misparsed
+package anomaly
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Anomaly kinds
+const (
+	KindSilence     = "silence"
+	KindClipped     = "clipped"
+	KindDCOffset    = "dc offset"
+	KindByteSwapped = "byte-swapped"
+	KindGarbled     = "garbled"
+)
+
+// Thresholds of the checks
+const (
+	minSamples     = 256   // Shorter channels are only checked for silence and clipping
+	clipRun        = 3     // Consecutive full scale samples making a clipped run
+	minClipRuns    = 3     // Clipped runs flagging a channel
+	maxDCOffset    = 0.02  // Mean value flagging a channel, of full scale (about -34 dBFS)
+	minLevel       = 0.01  // RMS level, of full scale, below which the correlation checks are skipped
+	smoothAudio    = 0.5   // Correlation between successive samples of typical audio exceeds this
+	roughAudio     = 0.3   // Correlation below which audio decoded another way may be flagged
+	noiseLikeAudio = 0.05  // Correlation below which (in absolute value) audio looks like noise
+	fullScale      = 32768 // 16-bit full scale
+)
+
+// Anomaly is a problem found in a channel
+type Anomaly struct {
+	Kind    string
+	Channel int
+	Detail  string
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("channel %d %s: %s", a.Channel, a.Kind, a.Detail)
+}
+
+// series accumulates the sums giving the mean, level and lag-1 autocorrelation of a
+// sequence of samples in a single pass
+type series struct {
+	n          float64
+	sum, sumSq float64
+	sumLag     float64 // Sum of the products of successive samples
+	first      float64
+	prev       float64
+}
+
+func (s *series) add(v float64) {
+	if s.n == 0 {
+		s.first = v
+	} else {
+		s.sumLag += v * s.prev
+	}
+	s.prev = v
+	s.n++
+	s.sum += v
+	s.sumSq += v * v
+}
+
+func (s *series) mean() float64 {
+	return s.sum / s.n
+}
+
+func (s *series) rms() float64 {
+	return math.Sqrt(s.sumSq / s.n)
+}
+
+// correlation returns the lag-1 autocorrelation of the samples around their mean,
+// close to 1 for audio and to 0 for white noise
+func (s *series) correlation() float64 {
+	m := s.mean()
+	variance := s.sumSq/s.n - m*m
+	if variance <= 0 || s.n < 2 {
+		return 0
+	}
+	lag := s.sumLag - m*(2*s.sum-s.first-s.prev) + (s.n-1)*m*m
+	return lag / (s.n - 1) / variance
+}
+
+// Detect reads the 16-bit little endian PCM data of each channel and returns the
+// anomalies found, none for plausible audio
+func Detect(channels ...io.Reader) ([]Anomaly, error) {
+	var anomalies []Anomaly
+	for c, r := range channels {
+		found, err := detectChannel(c+1, r)
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, found...)
+	}
+	return anomalies, nil
+}
+
+// detectChannel checks the data of a single channel
+func detectChannel(channel int, r io.Reader) ([]Anomaly, error) {
+	// The samples are also decoded big endian, which matches both byte-swapped data and
+	// data starting one byte off, the high byte of a sample then preceding the low
+	// byte of the next
+	var decoded, swapped series
+	var peak float64
+	var clipped, runs, run int
+
+	br := bufio.NewReader(r)
+	var pair [2]byte
+	for {
+		if _, err := io.ReadFull(br, pair[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading channel %d: %w", channel, err)
+		}
+
+		v := float64(int16(uint16(pair[0]) | uint16(pair[1])<<8))
+		decoded.add(v)
+		swapped.add(float64(int16(uint16(pair[1]) | uint16(pair[0])<<8)))
+
+		if math.Abs(v) > peak {
+			peak = math.Abs(v)
+		}
+		if v >= fullScale-1 || v <= -fullScale {
+			run++
+			if run == clipRun {
+				runs++
+				clipped += clipRun
+			} else if run > clipRun {
+				clipped++
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	var anomalies []Anomaly
+	if decoded.n == 0 {
+		return nil, nil
+	}
+	if peak == 0 {
+		return append(anomalies, Anomaly{KindSilence, channel, "every sample is zero"}), nil
+	}
+	if runs >= minClipRuns {
+		anomalies = append(anomalies, Anomaly{KindClipped, channel,
+			fmt.Sprintf("%d samples (%.2f%%) at full scale in %d runs", clipped, 100*float64(clipped)/decoded.n, runs)})
+	}
+	if decoded.n < minSamples {
+		return anomalies, nil
+	}
+
+	if mean := decoded.mean() / fullScale; math.Abs(mean) > maxDCOffset {
+		anomalies = append(anomalies, Anomaly{KindDCOffset, channel, fmt.Sprintf("mean %+.1f%% of full scale", 100*mean)})
+	}
+
+	// Audio changes little from one sample to the next, while byte-swapped or
+	// misaligned data looks like noise until decoded the right way
+	if decoded.rms()/fullScale < minLevel {
+		return anomalies, nil
+	}
+	corr := decoded.correlation()
+	switch {
+	case corr >= roughAudio:
+	case swapped.correlation() > smoothAudio:
+		anomalies = append(anomalies, Anomaly{KindByteSwapped, channel,
+			fmt.Sprintf("decodes as audio big endian or one byte off (correlation %.2f, %.2f as decoded)", swapped.correlation(), corr)})
+	case math.Abs(corr) < noiseLikeAudio:
+		anomalies = append(anomalies, Anomaly{KindGarbled, channel,
+			fmt.Sprintf("successive samples are uncorrelated (%.2f), noise or misdecoded data", corr)})
+	}
+	return anomalies, nil
+}
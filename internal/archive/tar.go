@@ -0,0 +1,143 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+)
+
+// tarBufferSize is the size of the writes made to the destination of a tar stream,
+// large enough for tape drives and object storage uploads to stream efficiently
+const tarBufferSize = 1 << 20
+
+// TarWriter writes converted files into a single tar stream, optionally compressed
+// with zstd. It is a sink (see the sink package) safe for concurrent use.
+type TarWriter struct {
+	mu   sync.Mutex
+	tw   *tar.Writer
+	buf  *bufio.Writer
+	zstd *exec.Cmd      // zstd compressing the stream, nil when uncompressed
+	pipe io.WriteCloser // Input of zstd
+	err  error          // Error writing to the stream failed with
+}
+
+// NewTarWriter starts a tar stream written to w. With compress, the stream is
+// compressed by the zstd command, which must be installed.
+func NewTarWriter(w io.Writer, compress bool) (*TarWriter, error) {
+	t := &TarWriter{}
+	if compress {
+		zstdPath, err := exec.LookPath("zstd")
+		if err != nil {
+			return nil, fmt.Errorf("zstd not found. Please install zstd to compress tar streams")
+		}
+		t.zstd = exec.Command(zstdPath, "-q", "-c", "-T0")
+		t.zstd.Stdout = w
+		t.zstd.Stderr = os.Stderr
+		if t.pipe, err = t.zstd.StdinPipe(); err != nil {
+			return nil, fmt.Errorf("error starting zstd: %w", err)
+		}
+		if err := t.zstd.Start(); err != nil {
+			return nil, fmt.Errorf("error starting zstd: %w", err)
+		}
+		w = t.pipe
+	}
+
+	t.buf = bufio.NewWriterSize(w, tarBufferSize)
+	t.tw = tar.NewWriter(t.buf)
+	return t, nil
+}
+
+// Create returns a writer adding the named file, a slash separated path, to the stream
+// when closed. Files are buffered in memory until then, as tar headers give the size
+// of files before their content, and so concurrent conversions don't interleave their
+// data. Once writing to the stream failed, it is left incomplete and every file
+// fails, see Err.
+func (t *TarWriter) Create(name string) (io.WriteCloser, error) {
+	if err := t.Err(); err != nil {
+		return nil, err
+	}
+	return &tarFile{tar: t, name: path.Clean(name)}, nil
+}
+
+// Err returns the error writing to the stream failed with, if any
+func (t *TarWriter) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// add writes a file to the stream
+func (t *TarWriter) add(name string, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+	// Owners are left out and times fixed, so converting the same banks twice
+	// produces identical archives
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  ModTime(),
+	}
+	err := t.tw.WriteHeader(header)
+	if err == nil {
+		_, err = t.tw.Write(data)
+	}
+	if err != nil {
+		t.err = fmt.Errorf("error adding %s to tar: %w", name, err)
+		return t.err
+	}
+	return nil
+}
+
+// tarFile buffers a file of the stream until it is closed
+type tarFile struct {
+	bytes.Buffer
+	tar  *TarWriter
+	name string
+}
+
+func (f *tarFile) Close() error {
+	return f.tar.add(f.name, f.Bytes())
+}
+
+// Abort discards the file, which is never added to the stream
+func (f *tarFile) Abort() error {
+	f.Reset()
+	return nil
+}
+
+// Close completes the stream, waiting for zstd to compress it. It doesn't close the
+// writer given to NewTarWriter. The stream is left incomplete when writing to it failed.
+func (t *TarWriter) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	err := t.tw.Close()
+	if flushErr := t.buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if t.zstd != nil {
+		t.pipe.Close()
+		if waitErr := t.zstd.Wait(); err == nil && waitErr != nil {
+			err = fmt.Errorf("error compressing with zstd: %w", waitErr)
+		}
+	}
+	if t.err != nil {
+		return t.err
+	}
+	if err != nil {
+		return fmt.Errorf("error writing tar stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModTime returns the modification time recorded for archived files. It is fixed so
+// converting the same bank twice produces identical archives, and can be set with the
+// SOURCE_DATE_EPOCH environment variable used by reproducible builds.
+func ModTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ZipDirectory moves every file below dir into a new zip archive at zipPath, in
+// lexical order. Each file is removed as soon as it has been added, so packaging
+// never needs twice the disk space of the converted bank.
+func ZipDirectory(dir, zipPath string) error {
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		return fmt.Errorf("error creating zip file: %w", err)
+	}
+	defer zipFile.Close()
+
+	zw := zip.NewWriter(zipFile)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if err := addFile(zw, path, filepath.ToSlash(relPath), info); err != nil {
+			return fmt.Errorf("error adding %s to zip: %w", relPath, err)
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("error writing zip file: %w", err)
+	}
+	return nil
+}
+
+// addFile copies the file at path into the archive under name
+func addFile(zw *zip.Writer, path, name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Modified = ModTime()
+	header.SetMode(0644)
+	header.Method = zip.Deflate
+	// FLAC is already compressed, deflating it only costs time
+	if strings.ToLower(filepath.Ext(name)) == ".flac" {
+		header.Method = zip.Store
+	}
+
+	out, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,82 @@
+// Package atomicfile writes files under a temporary name and renames them once
+// complete, so interrupted runs never leave truncated files that look converted
+package atomicfile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+)
+
+// Suffix is appended to the name of files while they are written. A leftover
+// partial file is replaced when its file is written again.
+const Suffix = ".partial"
+
+// File is a file being written to path + Suffix, moved to path by Close
+type File struct {
+	*os.File
+	path   string
+	closed bool
+}
+
+// Create creates the temporary file of path, truncating a leftover one. Source EBL
+// and EXB files are never replaced.
+func Create(path string) (*File, error) {
+	if safepath.IsSource(path) {
+		return nil, fmt.Errorf("%w: %s", safepath.ErrSourceFile, path)
+	}
+	file, err := os.Create(path + Suffix)
+	if err != nil {
+		return nil, err
+	}
+	return &File{File: file, path: path}, nil
+}
+
+// Close flushes the file to disk and renames it to its final path, replacing an
+// existing file. The temporary file is removed when this fails.
+func (f *File) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	err := f.File.Sync()
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.File.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.File.Name())
+		return fmt.Errorf("error writing %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving an existing file at the final
+// path untouched. It does nothing once the file is closed.
+func (f *File) Abort() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	f.File.Close()
+	return os.Remove(f.File.Name())
+}
+
+// WriteFile writes data to path like os.WriteFile, path only ever holding the
+// previous or the new content
+func WriteFile(path string, data []byte) error {
+	f, err := Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// Problem kinds
+const (
+	ProblemMissing    = "missing"
+	ProblemChecksum   = "checksum mismatch"
+	ProblemDuration   = "duration mismatch"
+	ProblemUnreadable = "unreadable"
+)
+
+// Problem describes a converted file that doesn't match its manifest entry
+type Problem struct {
+	Manifest string `json:"manifest"` // Path of the manifest listing the file
+	Output   string `json:"output"`   // Path of the file, relative to the manifest
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// String returns a one line description of the problem
+func (p Problem) String() string {
+	path := filepath.Join(filepath.Dir(p.Manifest), filepath.FromSlash(p.Output))
+	if p.Detail == "" {
+		return fmt.Sprintf("%s: %s", path, p.Kind)
+	}
+	return fmt.Sprintf("%s: %s (%s)", path, p.Kind, p.Detail)
+}
+
+// Report summarizes the audit of a library
+type Report struct {
+	Manifests  int       `json:"manifests"`
+	Samples    int       `json:"samples"`
+	Unverified int       `json:"unverified"` // Samples without a recorded checksum
+	Problems   []Problem `json:"problems"`
+}
+
+// Auditor checks previously converted libraries against their manifests
+type Auditor struct {
+	debug bool
+	out   io.Writer // Destination of debug messages, see SetOutput
+}
+
+// NewAuditor creates a new auditor
+func NewAuditor(debug bool) *Auditor {
+	return &Auditor{
+		debug: debug,
+		out:   os.Stdout,
+	}
+}
+
+// SetOutput sets where debug messages are written, os.Stdout by default
+func (a *Auditor) SetOutput(w io.Writer) {
+	a.out = w
+}
+
+// Debug logs a message if debug mode is enabled
+func (a *Auditor) Debug(message string) {
+	if a.debug {
+		fmt.Fprintln(a.out, message)
+	}
+}
+
+// AuditDirectory checks every manifest found in root and its subdirectories
+func (a *Auditor) AuditDirectory(root string) (*Report, error) {
+	report := &Report{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != manifest.Filename {
+			return nil
+		}
+
+		m, err := manifest.Load(filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		a.AuditManifest(path, m, report)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error auditing directory: %w", err)
+	}
+
+	return report, nil
+}
+
+// AuditManifest checks that the files listed in the manifest stored at manifestPath exist
+// and match their recorded checksums and durations
+func (a *Auditor) AuditManifest(manifestPath string, m *manifest.Manifest, report *Report) {
+	report.Manifests++
+	dir := filepath.Dir(manifestPath)
+
+	for _, sample := range m.Samples {
+		report.Samples++
+		problem := Problem{Manifest: manifestPath, Output: sample.Output}
+		outputPath := filepath.Join(dir, filepath.FromSlash(sample.Output))
+		a.Debug(fmt.Sprintf("Checking %s", outputPath))
+
+		if _, err := os.Stat(outputPath); err != nil {
+			problem.Kind = ProblemMissing
+			report.Problems = append(report.Problems, problem)
+			continue
+		}
+
+		if sample.SHA256 == "" {
+			report.Unverified++
+		} else {
+			sum, err := manifest.Checksum(outputPath)
+			if err != nil {
+				problem.Kind = ProblemUnreadable
+				problem.Detail = err.Error()
+				report.Problems = append(report.Problems, problem)
+				continue
+			}
+			if sum != sample.SHA256 {
+				problem.Kind = ProblemChecksum
+				problem.Detail = fmt.Sprintf("expected %s, got %s", sample.SHA256, sum)
+				report.Problems = append(report.Problems, problem)
+				continue
+			}
+		}
+
+		duration, err := audioDuration(outputPath)
+		if err != nil {
+			problem.Kind = ProblemUnreadable
+			problem.Detail = err.Error()
+			report.Problems = append(report.Problems, problem)
+			continue
+		}
+		// Allow for rounding of a single frame
+		tolerance := 1e-6
+		if sample.SampleRate > 0 {
+			tolerance += 1 / float64(sample.SampleRate)
+		}
+		if math.Abs(duration-sample.Duration) > tolerance {
+			problem.Kind = ProblemDuration
+			problem.Detail = fmt.Sprintf("expected %.3fs, got %.3fs", sample.Duration, duration)
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+}
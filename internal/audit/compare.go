@@ -0,0 +1,281 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/preview"
+	"github.com/mattetti/e-mu-soundbanks/internal/slices"
+)
+
+// Kinds of differences with reference outputs
+const (
+	ReferenceMissing = "missing reference"
+	OutputMissing    = "missing output" // Reference files the conversion didn't produce
+	ReferenceFormat  = "format differs"
+	ReferenceAudio   = "audio differs"
+	ReferenceBytes   = "bytes differ" // Files whose audio isn't compared on its own, e.g. FLAC
+)
+
+// compareBlockSize is the size of the blocks files are compared in
+const compareBlockSize = 64 * 1024
+
+// Comparison summarizes how converted files compare with reference outputs
+type Comparison struct {
+	Compared    int       `json:"compared"`
+	Identical   int       `json:"identical"` // Byte for byte
+	SameAudio   int       `json:"sameAudio"` // WAV files differing only outside their format and audio data, e.g. in metadata chunks
+	Differences []Problem `json:"differences"`
+}
+
+// CompareReference compares the files listed in the manifest stored at manifestPath
+// with the files at the same paths below refDir, a directory of previously validated
+// outputs. Only the samples of bank are compared when banks share the manifest. WAV
+// files that differ are compared again on their format and audio data alone. Audio
+// files of refDir with no converted counterpart are reported as missing outputs.
+func (a *Auditor) CompareReference(manifestPath string, m *manifest.Manifest, bank, refDir string) *Comparison {
+	dir := filepath.Dir(manifestPath)
+	comparison := &Comparison{}
+
+	for _, sample := range m.Samples {
+		if sample.Bank != "" && bank != "" && sample.Bank != bank {
+			continue
+		}
+		comparison.Compared++
+		problem := Problem{Manifest: manifestPath, Output: sample.Output}
+		outputPath := filepath.Join(dir, filepath.FromSlash(sample.Output))
+		refPath := filepath.Join(refDir, filepath.FromSlash(sample.Output))
+		a.Debug(fmt.Sprintf("Comparing %s with %s", outputPath, refPath))
+
+		if _, err := os.Stat(refPath); err != nil {
+			problem.Kind = ReferenceMissing
+			problem.Detail = refPath
+			comparison.Differences = append(comparison.Differences, problem)
+			continue
+		}
+
+		kind, detail, err := compareFiles(outputPath, refPath)
+		switch {
+		case err != nil:
+			problem.Kind = ProblemUnreadable
+			problem.Detail = err.Error()
+		case kind == "":
+			if detail == "" {
+				comparison.Identical++
+			} else {
+				comparison.SameAudio++
+			}
+			continue
+		default:
+			problem.Kind = kind
+			problem.Detail = detail
+		}
+		comparison.Differences = append(comparison.Differences, problem)
+	}
+
+	for _, output := range a.missingOutputs(m, bank, refDir) {
+		comparison.Differences = append(comparison.Differences, Problem{
+			Manifest: manifestPath,
+			Output:   output,
+			Kind:     OutputMissing,
+			Detail:   filepath.Join(refDir, filepath.FromSlash(output)),
+		})
+	}
+	return comparison
+}
+
+// referenceExts are the extensions of the audio files compared with their reference
+var referenceExts = map[string]bool{".wav": true, ".flac": true, ".raw": true}
+
+// missingOutputs returns the paths, relative to refDir, of the audio files of refDir
+// missing from the manifest. Files of other banks, listed by either manifest, and
+// previews and slices, produced on request only, are left out.
+func (a *Auditor) missingOutputs(m *manifest.Manifest, bank, refDir string) []string {
+	listed := make(map[string]bool)
+	for _, sample := range m.Samples {
+		listed[sample.Output] = true
+	}
+	if ref, err := manifest.Load(refDir); err == nil {
+		for _, sample := range ref.Samples {
+			if sample.Bank != "" && bank != "" && sample.Bank != bank {
+				listed[sample.Output] = true
+			}
+		}
+	}
+
+	var missing []string
+	err := filepath.Walk(refDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(refDir, path)
+		if err != nil {
+			return err
+		}
+		output := filepath.ToSlash(rel)
+		if info.IsDir() {
+			if output == preview.Dir || output == slices.Dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if referenceExts[strings.ToLower(filepath.Ext(output))] && !listed[output] {
+			missing = append(missing, output)
+		}
+		return nil
+	})
+	if err != nil {
+		a.Debug(fmt.Sprintf("Error listing %s: %v", refDir, err))
+	}
+	return missing
+}
+
+// compareFiles compares the file at path with its reference. It returns an empty kind
+// when they hold the same audio, with an empty detail when they are identical.
+func compareFiles(path, refPath string) (kind, detail string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	ref, err := os.Open(refPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer ref.Close()
+
+	offset, equal, err := compareReaders(file, ref)
+	if err != nil || equal {
+		return "", "", err
+	}
+	if strings.ToLower(filepath.Ext(path)) != ".wav" {
+		return ReferenceBytes, fmt.Sprintf("first difference at byte %d", offset), nil
+	}
+
+	// Compare the format and audio data of the WAV files
+	format, data, err := wavSections(file)
+	if err != nil {
+		return "", "", err
+	}
+	refFormat, refData, err := wavSections(ref)
+	if err != nil {
+		return "", "", fmt.Errorf("reference: %w", err)
+	}
+	if !bytes.Equal(format, refFormat) {
+		return ReferenceFormat, describeFormat(format) + ", reference " + describeFormat(refFormat), nil
+	}
+
+	offset, equal, err = compareReaders(data, refData)
+	if err != nil {
+		return "", "", err
+	}
+	if equal {
+		return "", "audio data identical", nil
+	}
+	blockAlign := int64(binary.LittleEndian.Uint16(format[12:14]))
+	if blockAlign == 0 {
+		blockAlign = 1
+	}
+	if data.Size() != refData.Size() {
+		return ReferenceAudio, fmt.Sprintf("%d frames, reference has %d, first difference at frame %d",
+			data.Size()/blockAlign, refData.Size()/blockAlign, offset/blockAlign), nil
+	}
+	return ReferenceAudio, fmt.Sprintf("first difference at frame %d", offset/blockAlign), nil
+}
+
+// compareReaders returns whether a and b hold the same bytes, otherwise the offset of
+// the first difference
+func compareReaders(a, b io.Reader) (int64, bool, error) {
+	bufA := make([]byte, compareBlockSize)
+	bufB := make([]byte, compareBlockSize)
+	var offset int64
+	for {
+		nA, errA := io.ReadFull(a, bufA)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return 0, false, errA
+		}
+		nB, errB := io.ReadFull(b, bufB)
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return 0, false, errB
+		}
+
+		n := nA
+		if nB < n {
+			n = nB
+		}
+		for i := 0; i < n; i++ {
+			if bufA[i] != bufB[i] {
+				return offset + int64(i), false, nil
+			}
+		}
+		if nA != nB {
+			return offset + int64(n), false, nil
+		}
+		if nA < compareBlockSize {
+			return 0, true, nil
+		}
+		offset += int64(n)
+	}
+}
+
+// wavSections returns the content of the format chunk of a WAV file and its audio data
+func wavSections(file *os.File) ([]byte, *io.SectionReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	var riff [12]byte
+	if _, err := file.ReadAt(riff[:], 0); err != nil {
+		return nil, nil, fmt.Errorf("error reading WAV header: %w", err)
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return nil, nil, fmt.Errorf("not a WAV file")
+	}
+
+	var format []byte
+	offset := int64(12)
+	for offset+8 <= info.Size() {
+		var header [8]byte
+		if _, err := file.ReadAt(header[:], offset); err != nil {
+			return nil, nil, fmt.Errorf("error reading WAV chunk: %w", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		offset += 8
+
+		switch string(header[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, nil, fmt.Errorf("invalid WAV format chunk size %d", size)
+			}
+			format = make([]byte, size)
+			if _, err := file.ReadAt(format, offset); err != nil {
+				return nil, nil, fmt.Errorf("error reading WAV format: %w", err)
+			}
+		case "data":
+			if format == nil {
+				return nil, nil, fmt.Errorf("WAV data chunk before format chunk")
+			}
+			if offset+size > info.Size() {
+				size = info.Size() - offset
+			}
+			return format, io.NewSectionReader(file, offset, size), nil
+		}
+		// Chunks are padded to an even size
+		offset += size + size%2
+	}
+	return nil, nil, fmt.Errorf("no WAV data chunk")
+}
+
+// describeFormat describes the content of a WAV format chunk
+func describeFormat(format []byte) string {
+	channels := binary.LittleEndian.Uint16(format[2:4])
+	rate := binary.LittleEndian.Uint32(format[4:8])
+	bits := binary.LittleEndian.Uint16(format[14:16])
+	return fmt.Sprintf("%d Hz, %d channel(s), %d bits", rate, channels, bits)
+}
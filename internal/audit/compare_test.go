@@ -0,0 +1,62 @@
+package audit_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/audit"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// writeFiles writes files of the given content below dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCompareReferenceMissingOutputs checks that reference files with no converted
+// counterpart are reported, leaving out other banks, previews, slices and other files
+func TestCompareReferenceMissingOutputs(t *testing.T) {
+	outputDir := t.TempDir()
+	refDir := t.TempDir()
+	writeFiles(t, outputDir, map[string]string{"Kick.flac": "kick"})
+	writeFiles(t, refDir, map[string]string{
+		"Kick.flac":         "kick",
+		"Snare.flac":        "snare",
+		"Toms/Tom.flac":     "tom",
+		"Bass.flac":         "bass",
+		"previews/Kick.mp3": "preview",
+		"slices/Kick_1.wav": "slice",
+		"catalog.csv":       "catalog",
+		manifest.Filename:   `{"samples": [{"bank": "Bass", "output": "Bass.flac"}]}`,
+	})
+
+	m := &manifest.Manifest{Samples: []manifest.Sample{{Bank: "Drums", Output: "Kick.flac"}}}
+	manifestPath := filepath.Join(outputDir, manifest.Filename)
+	comparison := audit.NewAuditor(false).CompareReference(manifestPath, m, "Drums", refDir)
+
+	if comparison.Compared != 1 || comparison.Identical != 1 {
+		t.Errorf("compared %d files, %d identical, expected 1 identical", comparison.Compared, comparison.Identical)
+	}
+	var missing []string
+	for _, difference := range comparison.Differences {
+		if difference.Kind != audit.OutputMissing {
+			t.Errorf("unexpected difference %s", difference)
+			continue
+		}
+		missing = append(missing, difference.Output)
+	}
+	if want := []string{"Snare.flac", "Toms/Tom.flac"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("got missing outputs %v, expected %v", missing, want)
+	}
+}
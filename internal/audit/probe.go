@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// audioDuration reads the duration in seconds of a WAV or FLAC file from its headers
+func audioDuration(path string) (float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		return wavDuration(file)
+	case ".flac":
+		return flacDuration(file)
+	}
+	return 0, fmt.Errorf("unsupported audio format: %s", filepath.Ext(path))
+}
+
+// wavDuration walks the RIFF chunks of a WAV stream to find its format and data size
+func wavDuration(r io.Reader) (float64, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return 0, fmt.Errorf("error reading WAV header: %w", err)
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return 0, fmt.Errorf("not a WAV file")
+	}
+
+	var byteRate uint32
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return 0, fmt.Errorf("error reading WAV chunk: %w", err)
+		}
+		id := string(header[:4])
+		size := binary.LittleEndian.Uint32(header[4:])
+
+		switch id {
+		case "fmt ":
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return 0, fmt.Errorf("error reading WAV format: %w", err)
+			}
+			if size < 16 {
+				return 0, fmt.Errorf("invalid WAV format chunk size %d", size)
+			}
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+		case "data":
+			if byteRate == 0 {
+				return 0, fmt.Errorf("WAV data before format chunk")
+			}
+			return float64(size) / float64(byteRate), nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(size)+int64(size%2)); err != nil {
+				return 0, fmt.Errorf("error skipping WAV chunk %q: %w", id, err)
+			}
+		}
+	}
+}
+
+// flacDuration reads the total sample count and sample rate from the STREAMINFO block
+func flacDuration(r io.Reader) (float64, error) {
+	var header [4 + 4 + 34]byte // "fLaC", metadata block header, STREAMINFO
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, fmt.Errorf("error reading FLAC header: %w", err)
+	}
+	if !bytes.Equal(header[:4], []byte("fLaC")) || header[4]&0x7f != 0 {
+		return 0, fmt.Errorf("not a FLAC file")
+	}
+
+	info := header[8:]
+	// Sample rate (20 bits), channels (3), bits per sample (5) and total samples (36)
+	packed := binary.BigEndian.Uint64(info[10:18])
+	sampleRate := packed >> 44
+	totalSamples := packed & (1<<36 - 1)
+	if sampleRate == 0 {
+		return 0, fmt.Errorf("invalid FLAC sample rate")
+	}
+	return float64(totalSamples) / float64(sampleRate), nil
+}
@@ -0,0 +1,413 @@
+// Package bankdiff compares EXB banks, or a bank and a converted output directory,
+// to tell whether re-rips or repacked banks hold the same samples
+package bankdiff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// Kinds of compared sides
+const (
+	KindBank   = "bank"
+	KindOutput = "output"
+)
+
+// Sample reference comparison results. Presets themselves aren't compared, only the
+// samples EXB files reference.
+const (
+	ReferencesSame        = "same"
+	ReferencesDifferent   = "different"
+	ReferencesNotCompared = "not compared"
+)
+
+// Sample is a sample of a compared side
+type Sample struct {
+	Key          string // Path of the EBL file in the SamplePool, lowercased with forward slashes
+	Name         string
+	SourceSHA256 string // Hex SHA-256 of the EBL file, empty when unknown
+	AudioSHA256  string // Hex SHA-256 of the decoded audio, only known for banks
+	SampleRate   int
+	Channels     int
+	Frames       int
+	RootKey      int    // MIDI note, -1 when unknown
+	Error        string // Set when the EBL file couldn't be parsed
+
+	merged   bool // Half of a stereo pair merged into a single output, only its source is compared
+	detected bool // Root key estimated by -detect-pitch rather than read from the header
+	replaced bool // Sample rate replaced during conversion
+}
+
+// Side is a bank or output directory and its samples, keyed by Sample.Key
+type Side struct {
+	Path       string
+	Kind       string
+	References []string // Samples referenced by the EXB file, keyed like Sample.Key, nil for outputs
+	Samples    map[string]*Sample
+}
+
+// Change describes a sample found on both sides which differs
+type Change struct {
+	Key     string   `json:"key"`
+	Name    string   `json:"name,omitempty"`
+	Details []string `json:"details"`
+}
+
+// Report lists the differences between two sides
+type Report struct {
+	A         string   `json:"a"`
+	B         string   `json:"b"`
+	Added     []string `json:"added"`   // Samples only in B
+	Removed   []string `json:"removed"` // Samples only in A
+	Changed   []Change `json:"changed"`
+	Unchanged int      `json:"unchanged"`
+
+	References        string   `json:"references"`
+	AddedReferences   []string `json:"addedReferences,omitempty"`   // Samples only referenced by the EXB file of B
+	RemovedReferences []string `json:"removedReferences,omitempty"` // Samples only referenced by the EXB file of A
+}
+
+// Equal reports whether both sides hold the same samples and, when compared, reference
+// the same samples
+func (r *Report) Equal() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Changed) == 0 && r.References != ReferencesDifferent
+}
+
+// Loader reads the sides to compare
+type Loader struct {
+	parser *ebl.Parser
+	bank   string
+}
+
+// NewLoader creates a new loader. bank selects the samples of a bank in output
+// directories holding several, all samples are compared when empty.
+func NewLoader(debug bool, bank string) *Loader {
+	return &Loader{
+		parser: ebl.NewParser(debug, false),
+		bank:   bank,
+	}
+}
+
+// Load reads an .exb file, a directory holding one or a converted output directory
+func (l *Loader) Load(p string) (*Side, error) {
+	if strings.EqualFold(filepath.Ext(p), ".exb") {
+		return l.LoadBank(p)
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is neither an .exb file nor a directory", p)
+	}
+	if _, err := os.Stat(filepath.Join(p, manifest.Filename)); err == nil {
+		return l.LoadOutput(p)
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory: %w", err)
+	}
+	var exbFiles []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".exb") {
+			exbFiles = append(exbFiles, filepath.Join(p, entry.Name()))
+		}
+	}
+	switch len(exbFiles) {
+	case 0:
+		return nil, fmt.Errorf("no .exb file or %s found in %s", manifest.Filename, p)
+	case 1:
+		return l.LoadBank(exbFiles[0])
+	}
+	return nil, fmt.Errorf("%s holds %d .exb files, name the one to compare", p, len(exbFiles))
+}
+
+// LoadBank reads the EBL files of the SamplePool of an .exb file
+func (l *Loader) LoadBank(exbPath string) (*Side, error) {
+	refs, err := exb.ReadReferences(exbPath)
+	if err != nil {
+		return nil, err
+	}
+	side := &Side{
+		Path:       exbPath,
+		Kind:       KindBank,
+		References: []string{},
+		Samples:    make(map[string]*Sample),
+	}
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		// References may be Windows paths of the machine the bank was saved on
+		if key := sampleKey(strings.ReplaceAll(ref, `\`, "/")); !seen[key] {
+			seen[key] = true
+			side.References = append(side.References, key)
+		}
+	}
+
+	samplePool, err := exb.FindSamplePool(exbPath)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(samplePool, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".ebl") {
+			return nil
+		}
+		rel, err := filepath.Rel(samplePool, p)
+		if err != nil {
+			return err
+		}
+		sample := l.readSample(p)
+		sample.Key = strings.ToLower(filepath.ToSlash(rel))
+		side.Samples[sample.Key] = sample
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning SamplePool: %w", err)
+	}
+	return side, nil
+}
+
+// readSample parses an EBL file and hashes its audio
+func (l *Loader) readSample(p string) *Sample {
+	sample := &Sample{RootKey: -1}
+	sample.SourceSHA256, _ = manifest.Checksum(p)
+
+	eblFile, err := l.parser.ReadFile(p, "")
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	defer eblFile.Release()
+
+	sample.Name = eblFile.Name()
+	sample.SampleRate = eblFile.HeaderData.SampleRate
+	sample.Channels = eblFile.Channels()
+	sample.Frames = eblFile.Frames()
+	sample.RootKey = eblFile.RootKey
+
+	hash := sha256.New()
+	for c := 1; c <= eblFile.Channels(); c++ {
+		if _, err := io.Copy(hash, eblFile.ChannelReader(c)); err != nil {
+			sample.Error = fmt.Sprintf("error reading audio: %v", err)
+			return sample
+		}
+	}
+	sample.AudioSHA256 = hex.EncodeToString(hash.Sum(nil))
+	return sample
+}
+
+// LoadOutput reads the manifest of a converted output directory
+func (l *Loader) LoadOutput(dir string) (*Side, error) {
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	side := &Side{
+		Path:    dir,
+		Kind:    KindOutput,
+		Samples: make(map[string]*Sample),
+	}
+
+	for _, s := range m.Samples {
+		bank := s.Bank
+		if bank == "" {
+			bank = m.Bank
+		}
+		if l.bank != "" && !strings.EqualFold(bank, l.bank) {
+			continue
+		}
+
+		sample := &Sample{
+			Key:          sampleKey(s.Source),
+			Name:         s.Name,
+			SourceSHA256: s.SourceSHA256,
+			SampleRate:   s.SampleRate,
+			Channels:     s.Channels,
+			Frames:       s.Frames,
+			RootKey:      -1,
+			detected:     s.DetectedPitch != 0,
+			replaced:     rateReplaced(s.Warnings),
+		}
+		if s.RootKey != nil {
+			sample.RootKey = *s.RootKey
+		}
+		if s.Pair != "" {
+			// Merged from a stereo pair, each half being a mono EBL file in the bank
+			sample.merged = true
+			right := &Sample{Key: sampleKey(s.Pair), SourceSHA256: s.PairSHA256, merged: true}
+			side.Samples[right.Key] = right
+		}
+		side.Samples[sample.Key] = sample
+	}
+	if len(side.Samples) == 0 && l.bank != "" {
+		return nil, fmt.Errorf("no sample of bank %q in %s", l.bank, dir)
+	}
+	return side, nil
+}
+
+// rateReplaced reports whether the warnings of a manifest sample tell its header
+// sample rate was replaced during conversion
+func rateReplaced(warnings []string) bool {
+	for _, warning := range warnings {
+		if strings.HasPrefix(warning, "implausible sample rate") {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleKey returns the key of an EBL file from its path: the part following the
+// SamplePool directory, or its name when the path doesn't hold one
+func sampleKey(p string) string {
+	p = strings.ToLower(filepath.ToSlash(p))
+	if i := strings.LastIndex(p, "samplepool/"); i >= 0 {
+		return p[i+len("samplepool/"):]
+	}
+	return path.Base(p)
+}
+
+// Compare returns the differences between two sides
+func Compare(a, b *Side) *Report {
+	report := &Report{
+		A:       a.Path,
+		B:       b.Path,
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []Change{},
+
+		References: ReferencesNotCompared,
+	}
+	// Nothing is known of EXB files holding no reference found by the scan
+	if len(a.References) > 0 && len(b.References) > 0 {
+		report.RemovedReferences = missingFrom(a.References, b.References)
+		report.AddedReferences = missingFrom(b.References, a.References)
+		report.References = ReferencesSame
+		if len(report.AddedReferences) > 0 || len(report.RemovedReferences) > 0 {
+			report.References = ReferencesDifferent
+		}
+	}
+
+	for key, sa := range a.Samples {
+		sb, ok := b.Samples[key]
+		if !ok {
+			report.Removed = append(report.Removed, key)
+			continue
+		}
+		if details := compareSamples(sa, sb); len(details) > 0 {
+			name := sa.Name
+			if name == "" {
+				name = sb.Name
+			}
+			report.Changed = append(report.Changed, Change{Key: key, Name: name, Details: details})
+		} else {
+			report.Unchanged++
+		}
+	}
+	for key := range b.Samples {
+		if _, ok := a.Samples[key]; !ok {
+			report.Added = append(report.Added, key)
+		}
+	}
+
+	sort.Strings(report.Added)
+	sort.Strings(report.Removed)
+	sort.Slice(report.Changed, func(i, j int) bool {
+		return report.Changed[i].Key < report.Changed[j].Key
+	})
+	return report
+}
+
+// missingFrom returns the sorted keys of refs which other lacks
+func missingFrom(refs, other []string) []string {
+	in := make(map[string]bool, len(other))
+	for _, key := range other {
+		in[key] = true
+	}
+	var missing []string
+	for _, key := range refs {
+		if !in[key] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// compareSamples describes how two samples with the same key differ, nil when they
+// are the same
+func compareSamples(a, b *Sample) []string {
+	if a.SourceSHA256 != "" && a.SourceSHA256 == b.SourceSHA256 {
+		return nil
+	}
+	if a.Error != "" || b.Error != "" {
+		return []string{fmt.Sprintf("unreadable (%s)", firstNonEmpty(a.Error, b.Error))}
+	}
+	if a.merged || b.merged {
+		// Only the source file of merged halves is known
+		if a.SourceSHA256 == "" || b.SourceSHA256 == "" {
+			return nil
+		}
+		return []string{"file differs"}
+	}
+
+	var details []string
+	if a.Name != b.Name {
+		details = append(details, fmt.Sprintf("name %q -> %q", a.Name, b.Name))
+	}
+	if a.SampleRate != b.SampleRate && !a.replaced && !b.replaced {
+		details = append(details, fmt.Sprintf("sample rate %d -> %d Hz", a.SampleRate, b.SampleRate))
+	}
+	if a.Channels != b.Channels {
+		details = append(details, fmt.Sprintf("channels %d -> %d", a.Channels, b.Channels))
+	}
+	if a.Frames != b.Frames {
+		details = append(details, fmt.Sprintf("frames %d -> %d", a.Frames, b.Frames))
+	}
+	if a.RootKey != b.RootKey && !a.detected && !b.detected {
+		details = append(details, fmt.Sprintf("root key %s -> %s", noteName(a.RootKey), noteName(b.RootKey)))
+	}
+	if a.AudioSHA256 != "" && b.AudioSHA256 != "" && a.AudioSHA256 != b.AudioSHA256 {
+		details = append(details, "audio differs")
+	}
+	if len(details) == 0 && a.SourceSHA256 != "" && b.SourceSHA256 != "" {
+		if a.AudioSHA256 != "" && b.AudioSHA256 != "" {
+			details = append(details, "file differs, same audio and header values")
+		} else {
+			details = append(details, "file differs")
+		}
+	}
+	return details
+}
+
+// noteName returns the name of a MIDI note, "unknown" when not set
+func noteName(note int) string {
+	if name := ebl.NoteName(note); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
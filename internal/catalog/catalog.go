@@ -0,0 +1,111 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// Supported catalog formats
+const (
+	FormatCSV = "csv"
+	FormatTSV = "tsv"
+)
+
+// header lists the catalog columns
+var header = []string{"bank", "sample", "duration", "sample_rate", "channels", "root_note", "path"}
+
+// Filename returns the name of the catalog written in the given format
+func Filename(format string) string {
+	return "catalog." + format
+}
+
+// Write writes one row per sample of the manifest stored in dir to dir/catalog.<format>
+func Write(dir, format string) (string, error) {
+	comma, err := separator(format)
+	if err != nil {
+		return "", err
+	}
+
+	catalogPath := filepath.Join(dir, Filename(format))
+	var writeErr error
+	// Read the manifest while holding its lock, banks converted concurrently may be updating it
+	err = manifest.Edit(dir, func(m *manifest.Manifest) {
+		writeErr = writeFile(catalogPath, comma, m)
+	})
+	if err != nil {
+		return "", err
+	}
+	if writeErr != nil {
+		return "", writeErr
+	}
+	return catalogPath, nil
+}
+
+// Encode writes the catalog rows of m to w in the given format, as Write does
+func Encode(w io.Writer, format string, m *manifest.Manifest) error {
+	comma, err := separator(format)
+	if err != nil {
+		return err
+	}
+	return encode(w, comma, m)
+}
+
+// separator returns the field separator of a catalog format
+func separator(format string) (rune, error) {
+	switch format {
+	case FormatCSV:
+		return ',', nil
+	case FormatTSV:
+		return '\t', nil
+	default:
+		return 0, fmt.Errorf("unsupported catalog format: %q", format)
+	}
+}
+
+// writeFile writes the catalog rows of m to path
+func writeFile(path string, comma rune, m *manifest.Manifest) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating catalog: %w", err)
+	}
+	defer file.Close()
+	return encode(file, comma, m)
+}
+
+// encode writes the catalog rows of m to out
+func encode(out io.Writer, comma rune, m *manifest.Manifest) error {
+	w := csv.NewWriter(out)
+	w.Comma = comma
+	w.Write(header)
+	for _, sample := range m.Samples {
+		bank := sample.Bank
+		if bank == "" {
+			bank = m.Bank
+		}
+		rootNote := ""
+		if sample.RootKey != nil {
+			rootNote = ebl.NoteName(*sample.RootKey)
+		}
+		w.Write([]string{
+			bank,
+			sample.Name,
+			strconv.FormatFloat(sample.Duration, 'f', 3, 64),
+			strconv.Itoa(sample.SampleRate),
+			strconv.Itoa(sample.Channels),
+			rootNote,
+			sample.Output,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing catalog: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package category sorts samples into categories such as drums, loops or pads, from
+// keywords found in their names and comments. Rules can be loaded from a JSON file.
+package category
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/textnorm"
+)
+
+// Rule files samples whose text holds one of Keywords under Category
+type Rule struct {
+	Category string   `json:"category"`
+	Keywords []string `json:"keywords"`
+}
+
+// Rules are matched in order, samples matching none of them going to Default
+type Rules struct {
+	Rules   []Rule `json:"rules"`
+	Default string `json:"default"`
+}
+
+// DefaultCategory receives the samples matching no rule when Rules.Default isn't set
+const DefaultCategory = "Other"
+
+// DefaultRules returns the built-in rules. Loops come first so "Drum Loop" is a loop.
+func DefaultRules() *Rules {
+	return &Rules{
+		Rules: []Rule{
+			{Category: "Loops", Keywords: []string{"loop", "groove", "break", "breakbeat", "bpm"}},
+			{Category: "Drums", Keywords: []string{"drum", "kick", "bd", "snare", "sd", "hat", "hihat", "hh", "cymbal", "crash", "ride", "tom", "clap", "rim", "perc", "percussion", "conga", "bongo", "shaker", "tambourine", "cowbell", "kit"}},
+			{Category: "Bass", Keywords: []string{"bass", "subbass"}},
+			{Category: "Pads", Keywords: []string{"pad", "atmosphere", "atmos", "ambient", "drone"}},
+			{Category: "Keys", Keywords: []string{"piano", "keys", "ep", "rhodes", "wurli", "organ", "clav", "harpsichord", "celesta"}},
+			{Category: "Strings", Keywords: []string{"string", "violin", "viola", "cello", "orchestra", "pizz", "pizzicato"}},
+			{Category: "Brass", Keywords: []string{"brass", "trumpet", "trombone", "horn", "tuba", "sax"}},
+			{Category: "Woodwinds", Keywords: []string{"flute", "clarinet", "oboe", "bassoon", "woodwind"}},
+			{Category: "Guitars", Keywords: []string{"guitar", "gtr", "strum"}},
+			{Category: "Vocals", Keywords: []string{"vox", "vocal", "voice", "choir"}},
+			{Category: "Leads", Keywords: []string{"lead", "synth", "arp"}},
+			{Category: "FX", Keywords: []string{"fx", "sfx", "noise", "riser", "sweep", "impact", "hit"}},
+		},
+		Default: DefaultCategory,
+	}
+}
+
+// Load reads rules from a JSON file such as
+//
+//	{"rules": [{"category": "Drums", "keywords": ["kick", "snare"]}], "default": "Other"}
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading category rules: %w", err)
+	}
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing category rules %s: %w", path, err)
+	}
+	if rules.Default == "" {
+		rules.Default = DefaultCategory
+	}
+	for _, name := range append(categories(rules.Rules), rules.Default) {
+		if err := validName(name); err != nil {
+			return nil, fmt.Errorf("invalid category rules %s: %w", path, err)
+		}
+	}
+	return &rules, nil
+}
+
+// categories returns the categories of rules
+func categories(rules []Rule) []string {
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		names[i] = rule.Category
+	}
+	return names
+}
+
+// validName checks that a category can name a folder
+func validName(name string) error {
+	if strings.TrimSpace(name) == "" || name == "." || name == ".." || strings.ContainsAny(name, `<>:"/\|?*`) {
+		return fmt.Errorf("category %q can't be used as a folder name", name)
+	}
+	return nil
+}
+
+// Match returns the category of a sample from texts describing it, such as its name,
+// comment and folder, looked at in order. Keywords match whole words regardless of
+// case and accents, or with a trailing s for plurals. Words are split at digits too,
+// so "Kick01" holds "kick".
+func (r *Rules) Match(texts ...string) string {
+	for _, text := range texts {
+		words := make(map[string]bool)
+		for _, word := range splitWords(text) {
+			words[word] = true
+		}
+		for _, rule := range r.Rules {
+			for _, keyword := range rule.Keywords {
+				keyword = textnorm.Fold(keyword)
+				if words[keyword] || words[keyword+"s"] {
+					return rule.Category
+				}
+			}
+		}
+	}
+	return r.Default
+}
+
+// splitWords returns the folded words of s, split at every character which isn't a
+// letter and between letters and digits
+func splitWords(s string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, textnorm.Fold(string(word)))
+			word = word[:0]
+		}
+	}
+	for _, r := range textnorm.NFC(s) {
+		switch {
+		case unicode.IsLetter(r):
+			if len(word) > 0 && unicode.IsDigit(word[len(word)-1]) {
+				flush()
+			}
+			word = append(word, r)
+		case unicode.IsDigit(r):
+			if len(word) > 0 && !unicode.IsDigit(word[len(word)-1]) {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
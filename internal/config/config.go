@@ -0,0 +1,50 @@
+// Package config reads the settings file of ebl2wav, holding machine specific
+// settings that don't belong on every command line
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Filename is the name of the settings file in the ebl2wav configuration directory
+const Filename = "config.json"
+
+// Config holds the settings read from the settings file
+type Config struct {
+	FFmpeg string `json:"ffmpeg,omitempty"` // Path of the ffmpeg binary
+}
+
+// Path returns the path of the settings file: ebl2wav/config.json in the user
+// configuration directory, e.g. ~/.config on Linux or %AppData% on Windows
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ebl2wav", Filename), nil
+}
+
+// Load reads the settings file. A missing file gives empty settings.
+func Load() (Config, error) {
+	path, err := Path()
+	if err != nil {
+		return Config{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading settings: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("error parsing settings %s: %w", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,246 @@
+package converter_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// writeInputs writes n synthetic EBL files named "Sample NN" into dir, every other
+// one stereo, returning their paths
+func writeInputs(t *testing.T, dir string, n int) []string {
+	t.Helper()
+	var paths []string
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("Sample %02d", i)
+		path := filepath.Join(dir, name+".ebl")
+		err := testgen.WriteFile(path, testgen.Options{Name: name, Frames: 1000 + 10*i, Stereo: i%2 == 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// wavFiles returns the names of the WAV files in dir
+func wavFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".wav") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// TestConvertFileConcurrent converts files and streams from many goroutines with a
+// shared converter, reading its statistics while they run. Run with -race.
+func TestConvertFileConcurrent(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	inputs := writeInputs(t, inputDir, 32)
+
+	var mu sync.Mutex
+	completed := 0
+	var output bytes.Buffer
+	conv := converter.NewConverter(converter.Options{
+		Output: &output,
+		Level:  converter.LevelVerbose,
+		Events: func(event converter.Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			if event.Type == converter.EventFileCompleted {
+				completed++
+			}
+		},
+	})
+
+	var inputBytes int64
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputBytes += info.Size()
+
+		wg.Add(1)
+		go func(i int, input string, size int64) {
+			defer wg.Done()
+			var result converter.FileResult
+			var err error
+			if i%4 == 0 {
+				data, readErr := os.ReadFile(input)
+				if readErr != nil {
+					t.Error(readErr)
+					return
+				}
+				result, err = conv.ConvertReader(bytes.NewReader(data), input, size, outputDir)
+			} else {
+				result, err = conv.ConvertFile(input, outputDir)
+			}
+			if err != nil {
+				t.Errorf("error converting %s: %v", input, err)
+				return
+			}
+			if info, err := os.Stat(result.Output); err != nil || info.Size() != result.Bytes {
+				t.Errorf("%s: result gives %d bytes written to %s: %v", input, result.Bytes, result.Output, err)
+			}
+			conv.Stats()
+			conv.Samples()
+		}(i, input, info.Size())
+	}
+	wg.Wait()
+
+	stats := conv.Stats()
+	if stats.Samples != len(inputs) {
+		t.Errorf("%d samples converted, expected %d", stats.Samples, len(inputs))
+	}
+	if stats.Mono != len(inputs)/2 || stats.Stereo != len(inputs)/2 {
+		t.Errorf("%d mono and %d stereo samples, expected %d of each", stats.Mono, stats.Stereo, len(inputs)/2)
+	}
+	if stats.InputBytes != inputBytes {
+		t.Errorf("%d input bytes counted, expected %d", stats.InputBytes, inputBytes)
+	}
+	if samples := conv.Samples(); len(samples) != len(inputs) {
+		t.Errorf("%d samples recorded, expected %d", len(samples), len(inputs))
+	}
+	if completed != len(inputs) {
+		t.Errorf("%d completion events, expected %d", completed, len(inputs))
+	}
+	if files := wavFiles(t, outputDir); len(files) != len(inputs) {
+		t.Errorf("%d WAV files written, expected %d", len(files), len(inputs))
+	}
+
+	// The messages of each file are printed together
+	if lines := strings.Count(output.String(), "Converted "); lines != len(inputs) {
+		t.Errorf("%d conversion messages, expected %d:\n%s", lines, len(inputs), output.String())
+	}
+}
+
+// TestConvertFileSameOutput converts the same file from many goroutines, the rename
+// policy giving each conversion a file of its own
+func TestConvertFileSameOutput(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	input := writeInputs(t, inputDir, 1)[0]
+
+	conv := converter.NewConverter(converter.Options{
+		Output:     &bytes.Buffer{},
+		OnConflict: converter.ConflictRename,
+	})
+
+	const n = 16
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := conv.ConvertFile(input, outputDir); err != nil {
+				t.Errorf("error converting %s: %v", input, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if files := wavFiles(t, outputDir); len(files) != n {
+		t.Errorf("%d WAV files written, expected %d: %v", len(files), n, files)
+	}
+	if renamed := conv.Stats().Conflicts["renamed"]; renamed != n-1 {
+		t.Errorf("%d samples renamed, expected %d", renamed, n-1)
+	}
+}
+
+// TestProcessDirectoryConcurrent converts a directory with several workers while
+// single files are converted with the same converter
+func TestProcessDirectoryConcurrent(t *testing.T) {
+	inputDir, otherDir, outputDir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeInputs(t, inputDir, 24)
+	others := writeInputs(t, otherDir, 8)
+
+	conv := converter.NewConverter(converter.Options{
+		Output:  &bytes.Buffer{},
+		Workers: 4,
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, err := conv.ProcessDirectory(inputDir, filepath.Join(outputDir, "dir"))
+		if err != nil || result.Converted != 24 {
+			t.Errorf("%d files converted: %v", result.Converted, err)
+		}
+	}()
+	for _, input := range others {
+		wg.Add(1)
+		go func(input string) {
+			defer wg.Done()
+			if _, err := conv.ConvertFile(input, outputDir); err != nil {
+				t.Errorf("error converting %s: %v", input, err)
+			}
+		}(input)
+	}
+	wg.Wait()
+
+	if samples := conv.Stats().Samples; samples != 32 {
+		t.Errorf("%d samples converted, expected 32", samples)
+	}
+}
+
+// TestProcessDirectorySink converts a directory into zip archives with several
+// workers, the files going into the archive in the same order whatever the order
+// they are converted in
+func TestProcessDirectorySink(t *testing.T) {
+	inputDir := t.TempDir()
+	writeInputs(t, inputDir, 24)
+
+	var archives [2]bytes.Buffer
+	for i := range archives {
+		zip := sink.NewZip(&archives[i])
+		conv := converter.NewConverter(converter.Options{
+			Output:    &bytes.Buffer{},
+			Workers:   4,
+			Checksums: true,
+			Sink:      zip,
+		})
+		result, err := conv.ProcessDirectory(inputDir, ".")
+		if err != nil || result.Converted != 24 {
+			t.Fatalf("%d files converted: %v", result.Converted, err)
+		}
+		if err := zip.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bytes.Equal(archives[0].Bytes(), archives[1].Bytes()) {
+		t.Error("archives of the same directory differ")
+	}
+	r, err := zip.NewReader(bytes.NewReader(archives[0].Bytes()), int64(archives[0].Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A WAV file and its checksum per sample, then the manifest
+	if len(r.File) != 24*2+1 {
+		t.Fatalf("%d files archived, expected %d", len(r.File), 24*2+1)
+	}
+	if name := r.File[0].Name; name != "Sample_00.wav" {
+		t.Errorf("first file archived is %s, expected Sample_00.wav", name)
+	}
+	if name := r.File[len(r.File)-1].Name; name != "manifest.json" {
+		t.Errorf("last file archived is %s, expected manifest.json", name)
+	}
+}
@@ -0,0 +1,91 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Policies applied when a converted file already exists, set in Options.OnConflict
+const (
+	ConflictOverwrite = "overwrite" // Replace the existing file (default)
+	ConflictSkip      = "skip"      // Keep the existing file and don't convert the sample
+	ConflictRename    = "rename"    // Write the sample as "Name (2).wav", "Name (3).wav"...
+	ConflictError     = "error"     // Fail the sample
+)
+
+// ConflictPolicies lists the valid Options.OnConflict values
+var ConflictPolicies = []string{ConflictOverwrite, ConflictSkip, ConflictRename, ConflictError}
+
+// ErrOutputExists is returned for samples whose output exists with the error policy
+var ErrOutputExists = errors.New("output file already exists")
+
+// Conflict actions counted in Stats.Conflicts
+const (
+	conflictOverwritten = "overwritten"
+	conflictSkipped     = "skipped"
+	conflictRenamed     = "renamed"
+	conflictFailed      = "failed"
+)
+
+// convertedExts lists the extensions a converted sample may have, FLAC files replace
+// the WAV files once encoded and raw PCM files are written instead of WAV files
+var convertedExts = []string{".wav", ".flac", ".raw"}
+
+// existingOutput returns the name of the file holding the sample written as filename
+// in dir when it was already converted, as WAV, FLAC or raw PCM, or an empty string
+func (c *Converter) existingOutput(dir, filename string) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, ext := range convertedExts {
+		if c.exists(filepath.Join(dir, base+ext)) {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// availableName returns filename with the first " (n)" suffix not used in dir
+func (c *Converter) availableName(dir, filename string) string {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, n, ext)
+		if c.existingOutput(dir, candidate) == "" {
+			return candidate
+		}
+	}
+}
+
+// resolveConflict applies the conflict policy when the output of a sample exists. It
+// returns the filename to write, or an empty name when the sample is skipped.
+func (c *Converter) resolveConflict(outputDir, outputFilename string) (string, error) {
+	if c.options.NoWrite {
+		return outputFilename, nil
+	}
+	existing := c.existingOutput(outputDir, outputFilename)
+	if existing == "" {
+		return outputFilename, nil
+	}
+
+	switch c.options.OnConflict {
+	case ConflictSkip:
+		c.stats.Conflicts[conflictSkipped]++
+		c.logf(LevelNormal, "CONFLICT: %s exists, skipped\n", existing)
+		return "", nil
+	case ConflictRename:
+		renamed := c.availableName(outputDir, outputFilename)
+		c.stats.Conflicts[conflictRenamed]++
+		c.logf(LevelNormal, "CONFLICT: %s exists, writing %s\n", existing, renamed)
+		return renamed, nil
+	case ConflictError:
+		c.stats.Conflicts[conflictFailed]++
+		c.stats.Failures[FailureConflict]++
+		fmt.Fprintf(c.out, "CONFLICT ERROR: %s exists\n", existing)
+		return "", fmt.Errorf("%s: %w", existing, ErrOutputExists)
+	default:
+		c.stats.Conflicts[conflictOverwritten]++
+		c.logf(LevelVerbose, "CONFLICT: %s exists, overwriting\n", existing)
+		return outputFilename, nil
+	}
+}
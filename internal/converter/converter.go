@@ -1,76 +1,760 @@
 package converter
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/mattetti/e-mu-soundbanks/internal/anomaly"
+	"github.com/mattetti/e-mu-soundbanks/internal/category"
 	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/fswalk"
+	"github.com/mattetti/e-mu-soundbanks/internal/i18n"
+	"github.com/mattetti/e-mu-soundbanks/internal/iolimit"
+	"github.com/mattetti/e-mu-soundbanks/internal/keymap"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/pitch"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+	"github.com/mattetti/e-mu-soundbanks/internal/slices"
 	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+	"github.com/mattetti/e-mu-soundbanks/internal/waveform"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
 )
 
+// Output levels set in Options.Level. Errors and problems found in the samples are
+// printed at every level.
+const (
+	LevelQuiet       = -1 // Errors only
+	LevelNormal      = 0  // Progress of each folder
+	LevelVerbose     = 1  // Also every converted file
+	LevelVeryVerbose = 2  // Also the details of every converted sample
+)
+
+// streamThreshold is the audio size above which samples are streamed from their
+// file while encoding instead of loaded, bounding memory for long recordings
+const streamThreshold = 16 << 20
+
 // Options represents the conversion options
 type Options struct {
 	Debug            bool
 	NoWrite          bool
 	PreserveFilename bool
 	ErrorSave        bool
-	ExbName          string // The name of the EXB file (for prefixing WAV files)
+	ExbName          string              // The name of the EXB file (for prefixing WAV files)
+	Output           io.Writer           // Destination of progress messages, defaults to os.Stdout
+	Verify           bool                // Cross-check decoded audio lengths against the header fields
+	MergeStereo      bool                // Merge split -L/-R mono files into stereo WAVs
+	Checksums        bool                // Write a .sha256 sidecar next to each converted file
+	Progress         func(ProgressEvent) // Called as ProcessDirectory and ProcessBucket work through the files, from the calling goroutine, may be nil
+	Level            int                 // Output level, LevelNormal by default
+	Workers          int                 // Files converted concurrently by ProcessDirectory, defaults to the number of CPUs
+	OnConflict       string              // Policy applied when an output file exists, ConflictOverwrite by default
+	MaxNameLength    int                 // Maximum length of output filenames, longer names are truncated with a hash suffix. 0 for no limit
+	PreserveUnicode  bool                // Keep non-ASCII characters of sample names in output filenames
+	Normalize        bool                // Scale the audio of every sample so it peaks at NormalizePeak
+	NormalizePeak    float64             // dBFS, e.g. -1
+	Dither           string              // Dither mode used when normalized samples are reduced to 16 bits, see wav.DitherModes
+	Waveform         string              // Format of the waveform image written next to each sample (waveform.FormatPNG or FormatSVG), empty for none
+	WaveformOptions  waveform.Options    // Size and colors of the waveform images
+	Anomalies        bool                // Flag silent, clipped, DC-offset and garbled audio
+	DetectPitch      bool                // Estimate the root key of samples whose name doesn't give one
+	ForceSampleRate  int                 // Sample rate written for every sample instead of the header value, 0 to keep it
+	Hooks            []Hook              // Run after each successful conversion, not with NoWrite
+	FollowSymlinks   bool                // Follow links to directories in ProcessDirectory
+	Format           string              // Output format (wav.FormatWAV or FormatRaw), WAV by default
+	Slices           bool                // Cut samples with regions into slices, see the slices package
+	Events           func(event Event)   // Called with the progress of each file, concurrently by the workers of ProcessDirectory, may be nil
+	Limiter          *iolimit.Limiter    // Bounds the files converted at once and the throughput of their reads and writes, may be shared by converters
+	Categories       *category.Rules     // Sort samples into a folder per category instead of mirroring the input folders, nil to mirror them
+	Filter           Filter              // Samples not selected are left out, counted as handled rather than failed
+	Strict           bool                // Fail the files the parser had to work around irregularities of, see ebl.Parser.SetStrict
+	Layers           bool                // Sort samples into velocity layer and round robin folders, see keymap.LayerDir
+	NameByFolder     bool                // Name samples after their bank, SamplePool folder and root key, see wav.Encoder.FolderFilename
+	Sink             sink.Sink           // Destination of the converted files instead of the file system, e.g. an archive, output directories then being relative paths naming its folders. Slices and hooks need files on disk and are left out.
+	FLAC             *flac.Converter     // Encodes the samples to FLAC as they are written instead of the output format, nil to keep the format
 }
 
-// Converter handles the conversion process
+// fallbackSampleRate replaces the implausible sample rates of corrupted headers
+const fallbackSampleRate = 44100
+
+// Converter handles the conversion process. It is safe for concurrent use: every
+// file is converted by a worker with state of its own (see begin), whose messages,
+// samples and statistics are merged back once the file is done.
 type Converter struct {
 	options Options
-	parser  *ebl.Parser
-	encoder *wav.Encoder
+	parser  *ebl.Parser  // Shared with the workers, only read once created
+	encoder *wav.Encoder // Shared with the workers, only read once created
+	outputs *outputLocks // Shared with the workers
+	folder  string       // SamplePool folder of the files converted by a worker, naming them with NameByFolder
+
+	mu      sync.Mutex // Guards out, samples and stats
+	out     io.Writer
+	samples []manifest.Sample // Samples converted so far, paths relative to the working directory
+	stats   *Stats
 }
 
 // NewConverter creates a new converter
 func NewConverter(options Options) *Converter {
+	out := options.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	encoder := wav.NewEncoder(options.Debug, options.NoWrite, options.PreserveFilename, options.ExbName)
+	encoder.SetOutput(out)
+	encoder.SetMaxNameLength(options.MaxNameLength)
+	encoder.SetPreserveUnicode(options.PreserveUnicode)
+	if options.Normalize {
+		encoder.SetNormalize(options.NormalizePeak)
+	}
+	encoder.SetDither(options.Dither)
+	encoder.SetFormat(options.Format)
+	encoder.SetLimiter(options.Limiter)
+
+	parser := ebl.NewParser(options.Debug, options.ErrorSave)
+	parser.SetOutput(out)
+	parser.SetStreamThreshold(streamThreshold)
+	parser.SetStrict(options.Strict)
+
 	return &Converter{
 		options: options,
-		parser:  ebl.NewParser(options.Debug, options.ErrorSave),
-		encoder: wav.NewEncoder(options.Debug, options.NoWrite, options.PreserveFilename, options.ExbName),
+		out:     out,
+		parser:  parser,
+		encoder: encoder,
+		stats:   NewStats(),
+		outputs: newOutputLocks(),
 	}
 }
 
-// ConvertFile converts a single EBL file to WAV
-func (c *Converter) ConvertFile(inputFile, outputDir string) (bool, error) {
-	errorDir := filepath.Join(outputDir, "errors")
+// logf prints a progress message when the output level is at least level, translated
+// into the language selected with i18n.SetLanguage
+func (c *Converter) logf(level int, format string, args ...interface{}) {
+	if c.options.Level >= level {
+		c.printf(i18n.T(format), args...)
+	}
+}
+
+// printf prints a message whatever the output level
+func (c *Converter) printf(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.out, format, args...)
+}
+
+// Samples returns a copy of the samples converted so far
+func (c *Converter) Samples() []manifest.Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]manifest.Sample(nil), c.samples...)
+}
+
+// Stats returns a copy of the statistics of every file converted so far
+func (c *Converter) Stats() *Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := NewStats()
+	stats.Add(c.stats)
+	return stats
+}
+
+// ConvertFile converts a single EBL file to WAV. Its messages are printed once the
+// file is done. A nil error means the file was converted, skipped by the conflict
+// policy or filtered out, which the result tells apart.
+func (c *Converter) ConvertFile(inputFile, outputDir string) (FileResult, error) {
+	worker, done := c.begin()
+	defer done()
+	return worker.convertFile(inputFile, outputDir)
+}
+
+// convertFile converts a single EBL file to WAV with the state of c
+func (c *Converter) convertFile(inputFile, outputDir string) (FileResult, error) {
+	c.options.Limiter.Acquire()
+	defer c.options.Limiter.Release()
+	errorDir := filepath.Join(outputDir, safepath.ErrorsDir)
+
+	info, statErr := os.Stat(inputFile)
+	if statErr == nil {
+		c.stats.InputBytes += info.Size()
+	}
+	c.emit(Event{Type: EventFileStarted, File: inputFile})
+	if statErr == nil && info.Size() == 0 {
+		return c.skipPlaceholder(inputFile), nil
+	}
 
 	// Parse EBL file
-	eblFile, err := c.parser.ReadFile(inputFile, errorDir)
+	eblFile, sum, err := c.readFile(inputFile)
 	if err != nil {
-		fmt.Printf("EBL READ ERROR: %s\n", filepath.Base(inputFile))
+		c.stats.Failures[failureCategory(err)]++
+		c.printReadError(filepath.Base(inputFile), err)
 		if c.options.ErrorSave {
 			c.saveErrorFile(inputFile, errorDir)
 		}
-		return false, err
+		c.emitFailed(inputFile, err)
+		return FileResult{}, err
+	}
+	defer eblFile.Release()
+
+	return c.writeSample(eblFile, source{inputFile, sum}, source{}, outputDir)
+}
+
+// ConvertReader converts an EBL stream of the given size to WAV, e.g. an object
+// downloaded from cloud storage. name identifies the source in messages and the manifest.
+// The result is reported like ConvertFile's.
+func (c *Converter) ConvertReader(r io.Reader, name string, size int64, outputDir string) (FileResult, error) {
+	worker, done := c.begin()
+	defer done()
+	return worker.convertReader(r, name, size, outputDir)
+}
+
+// convertReader converts an EBL stream to WAV with the state of c
+func (c *Converter) convertReader(r io.Reader, name string, size int64, outputDir string) (FileResult, error) {
+	c.stats.InputBytes += size
+	c.emit(Event{Type: EventFileStarted, File: name})
+	if size == 0 {
+		return c.skipPlaceholder(name), nil
+	}
+
+	eblFile, sum, err := c.readStream(c.options.Limiter.Reader(r), name, size)
+	if err != nil {
+		c.stats.Failures[failureCategory(err)]++
+		c.printReadError(path.Base(name), err)
+		c.emitFailed(name, err)
+		return FileResult{}, err
+	}
+	defer eblFile.Release()
+
+	return c.writeSample(eblFile, source{name, sum}, source{}, outputDir)
+}
+
+// printReadError reports a file which couldn't be parsed, with the reasons strict mode
+// rejected it for
+func (c *Converter) printReadError(name string, err error) {
+	if errors.Is(err, ebl.ErrStrict) {
+		fmt.Fprintf(c.out, "STRICT: %s: %v\n", name, err)
+		return
+	}
+	fmt.Fprintf(c.out, "EBL READ ERROR: %s\n", name)
+}
+
+// readFile parses an EBL file, also returning the hex SHA-256 of its content
+func (c *Converter) readFile(inputFile string) (*ebl.EBLFile, string, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("error opening file: %w", err)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, "", fmt.Errorf("error getting file info: %w", err)
+	}
+
+	// Large samples are streamed from the file, which then stays open until Release
+	limiter := c.options.Limiter
+	eblFile, sum, err := c.readSource(limiter.Reader(file), limiter.ReaderAt(file), inputFile, fileInfo.Size())
+	if err != nil || !eblFile.Streamed() {
+		file.Close()
+	}
+	return eblFile, sum, err
+}
+
+// readStream parses an EBL stream, also returning the hex SHA-256 of its content
+func (c *Converter) readStream(r io.Reader, name string, size int64) (*ebl.EBLFile, string, error) {
+	return c.readSource(r, nil, name, size)
+}
+
+// readSource parses an EBL stream like readStream, streaming large samples from src
+// when given (see ebl.Parser.ReadSource)
+func (c *Converter) readSource(r io.Reader, src io.ReaderAt, name string, size int64) (*ebl.EBLFile, string, error) {
+	hash := sha256.New()
+	eblFile, err := c.parser.ReadSource(io.TeeReader(r, hash), src, name, size)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Hash whatever the parser left unread
+	if _, err := io.Copy(hash, r); err != nil {
+		eblFile.Release()
+		return nil, "", fmt.Errorf("error reading file: %w", err)
+	}
+	return eblFile, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ConvertPair converts two mono EBL files holding the left and right halves of a stereo
+// sample into a single stereo WAV. Halves that can't be merged are converted separately.
+// It returns the number of input files converted.
+func (c *Converter) ConvertPair(leftFile, rightFile, outputDir string) (int, error) {
+	worker, done := c.begin()
+	defer done()
+	return worker.convertPair(leftFile, rightFile, outputDir)
+}
+
+// convertPair converts the halves of a stereo sample with the state of c
+func (c *Converter) convertPair(leftFile, rightFile, outputDir string) (int, error) {
+	c.options.Limiter.Acquire()
+	defer c.options.Limiter.Release()
+	errorDir := filepath.Join(outputDir, safepath.ErrorsDir)
+
+	var halves [2]*ebl.EBLFile
+	var sources [2]source
+	placeholders := 0
+	for i, inputFile := range []string{leftFile, rightFile} {
+		info, statErr := os.Stat(inputFile)
+		if statErr == nil {
+			c.stats.InputBytes += info.Size()
+		}
+		c.emit(Event{Type: EventFileStarted, File: inputFile})
+		if statErr == nil && info.Size() == 0 {
+			c.skipPlaceholder(inputFile)
+			placeholders++
+			continue
+		}
+
+		eblFile, sum, err := c.readFile(inputFile)
+		if err != nil {
+			c.stats.Failures[failureCategory(err)]++
+			c.printReadError(filepath.Base(inputFile), err)
+			if c.options.ErrorSave {
+				c.saveErrorFile(inputFile, errorDir)
+			}
+			c.emitFailed(inputFile, err)
+			continue
+		}
+		defer eblFile.Release()
+		halves[i] = eblFile
+		sources[i] = source{inputFile, sum}
+	}
+
+	if halves[0] != nil && halves[1] != nil {
+		merged, err := mergeStereo(halves[0], halves[1])
+		if err == nil {
+			if _, err := c.writeSample(merged, sources[0], sources[1], outputDir); err != nil {
+				return 0, err
+			}
+			return 2, nil
+		}
+		fmt.Fprintf(c.out, "STEREO PAIR SKIPPED: %s / %s: %v\n", filepath.Base(leftFile), filepath.Base(rightFile), err)
+	}
+
+	// Convert whatever could be read on its own
+	converted := placeholders
+	var lastErr error
+	for i := range halves {
+		if halves[i] == nil {
+			continue
+		}
+		if _, err := c.writeSample(halves[i], sources[i], source{}, outputDir); err != nil {
+			lastErr = err
+		} else {
+			converted++
+		}
+	}
+	return converted, lastErr
+}
+
+// source identifies an EBL file read for conversion
+type source struct {
+	path   string
+	sha256 string
+}
+
+// FileResult describes the conversion of a single file by ConvertFile or ConvertReader
+type FileResult struct {
+	Output      string   // File written, or the existing file kept when Skipped
+	Duration    float64  // Audio duration in seconds
+	Bytes       int64    // Size of the file written
+	Skipped     bool     // The existing output was kept by the conflict policy
+	Filtered    bool     // Left out by Options.Filter
+	Placeholder bool     // Zero-length file or sample without audio, left out without failing
+	Strategy    string   // Alternate parse strategy which read the file after the standard one failed, see ebl.Parser.SetRetry
+	Warnings    []string // Anomalies which didn't stop the conversion, also listed in the manifest
+}
+
+// skipPlaceholder counts files found to be placeholders, which are reported apart from
+// failures, and returns their result
+func (c *Converter) skipPlaceholder(files ...string) FileResult {
+	for _, file := range files {
+		c.stats.Placeholders++
+		c.logf(LevelVerbose, "Skipped placeholder %s: no audio\n", filepath.Base(file))
+		c.emit(Event{Type: EventFilePlaceholder, File: file})
+	}
+	return FileResult{Placeholder: true}
+}
+
+// writeSample encodes a parsed EBL file to WAV and records it. pair is the right half's
+// source when eblFile was merged from a stereo pair.
+func (c *Converter) writeSample(eblFile *ebl.EBLFile, src, pair source, outputDir string) (FileResult, error) {
+	errorDir := filepath.Join(outputDir, safepath.ErrorsDir)
+	inputFile := src.path
+
+	// Both halves of merged pairs are reported alike
+	sources := []string{inputFile}
+	if pair.path != "" {
+		sources = append(sources, pair.path)
+	}
+
+	// Banks hold placeholders for samples that were never recorded
+	if eblFile.Frames() == 0 {
+		return c.skipPlaceholder(sources...), nil
+	}
+
+	if reason := c.options.Filter.reject(eblFile, c.outputSampleRate(eblFile)); reason != "" {
+		c.stats.Filtered++
+		c.logf(LevelVerbose, "Filtered out %s: %s\n", filepath.Base(inputFile), reason)
+		for _, file := range sources {
+			c.emit(Event{Type: EventFileFiltered, File: file, Error: reason})
+		}
+		return FileResult{Duration: eblFile.Duration(), Filtered: true}, nil
+	}
+
+	// Samples go to the folder of their category, found from their name, comment and
+	// source folder, then to the folders of their velocity layer and round robin
+	var sampleCategory, sampleDir string
+	if c.options.Categories != nil {
+		sampleCategory = c.options.Categories.Match(eblFile.Name(), eblFile.HeaderData.CommentStr, filepath.Base(filepath.Dir(inputFile)))
+		sampleDir = sampleCategory
+	}
+	if c.options.Layers {
+		sampleDir = filepath.Join(sampleDir, filepath.FromSlash(keymap.LayerDir(eblFile.Name())))
+	}
+	if sampleDir != "" {
+		outputDir = filepath.Join(outputDir, sampleDir)
+		if !c.options.NoWrite && c.options.Sink == nil {
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				c.stats.Failures[FailureWrite]++
+				fmt.Fprintf(c.out, "WAV WRITE ERROR: %s\n", filepath.Base(inputFile))
+				for _, file := range sources {
+					c.emitFailed(file, err)
+				}
+				return FileResult{}, fmt.Errorf("error creating sample directory: %w", err)
+			}
+		}
+	}
+
+	// Encode to WAV. Samples named alike are handled one at a time so concurrent
+	// workers don't interleave their data in the same file.
+	outputFilename := c.encoder.OutputFilename(eblFile)
+	if c.options.NameByFolder {
+		outputFilename = c.encoder.FolderFilename(eblFile, c.folder)
+	}
+	if c.options.FLAC != nil {
+		outputFilename = strings.TrimSuffix(outputFilename, filepath.Ext(outputFilename)) + ".flac"
+	}
+	unlock := c.outputs.lock(filepath.Join(outputDir, outputFilename))
+	defer unlock()
+
+	outputPath := filepath.Join(outputDir, outputFilename)
+	outputFilename, err := c.resolveConflict(outputDir, outputFilename)
+	if err != nil {
+		for _, file := range sources {
+			c.emitFailed(file, err)
+		}
+		return FileResult{}, err
+	}
+	if outputFilename == "" {
+		// Skipped, the existing file is kept
+		for _, file := range sources {
+			c.emit(Event{Type: EventFileSkipped, File: file, Output: outputPath})
+		}
+		return FileResult{Output: outputPath, Duration: eblFile.Duration(), Skipped: true}, nil
+	}
+
+	var warnings []string
+	if fallback := c.encoder.NameFallback(eblFile); fallback != "" {
+		warnings = append(warnings, fallback)
+	}
+	if eblFile.Strategy != ebl.StrategyStandard {
+		c.stats.Recovered++
+		c.logf(LevelVerbose, "Recovered %s with the %s parse strategy\n", filepath.Base(inputFile), eblFile.Strategy)
+	}
+	if size := eblFile.Version.TrailerSize; size != 0 && size != ebl.KnownTrailerSize {
+		warnings = append(warnings, fmt.Sprintf("%d-byte trailer ignored", size))
+	}
+	// Corrupted headers may give a sample rate of 0 or absurd values, producing broken WAVs
+	if headerRate := eblFile.HeaderData.SampleRate; c.options.ForceSampleRate > 0 {
+		eblFile.HeaderData.SampleRate = c.options.ForceSampleRate
+	} else if !ebl.PlausibleSampleRate(headerRate) {
+		eblFile.HeaderData.SampleRate = fallbackSampleRate
+		warnings = append(warnings, fmt.Sprintf("implausible sample rate %d Hz in header, written as %d Hz", headerRate, fallbackSampleRate))
+	}
+	for _, warning := range warnings {
+		c.logf(LevelVerbose, "WARNING: %s: %s\n", filepath.Base(inputFile), warning)
+	}
+
+	// Estimate the root key of samples whose name doesn't give it, so the smpl chunk
+	// maps them in samplers
+	var detectedPitch float64
+	if c.options.DetectPitch && eblFile.RootKey < 0 {
+		estimate, ok, err := pitch.Detect(eblFile.ChannelReader(1), eblFile.HeaderData.SampleRate)
+		if err != nil {
+			fmt.Fprintf(c.out, "PITCH DETECTION ERROR: %s: %v\n", filepath.Base(inputFile), err)
+		} else if ok && estimate.Note >= 0 && estimate.Note <= 127 {
+			eblFile.RootKey = estimate.Note
+			detectedPitch = estimate.Frequency
+		}
 	}
 
-	// Encode to WAV
-	_, err = c.encoder.WriteWAV(eblFile, outputDir)
+	var sum string
+	var size int64
+	if !c.options.NoWrite {
+		sum, size, err = c.writeOutput(eblFile, filepath.Join(outputDir, outputFilename))
+	}
 	if err != nil {
-		fmt.Printf("WAV WRITE ERROR: %s\n", filepath.Base(inputFile))
+		c.stats.Failures[FailureWrite]++
+		fmt.Fprintf(c.out, "WAV WRITE ERROR: %s\n", filepath.Base(inputFile))
 		if c.options.ErrorSave {
 			c.saveErrorFile(inputFile, errorDir)
 		}
-		return false, err
+		for _, file := range sources {
+			c.emitFailed(file, err)
+		}
+		return FileResult{}, err
+	}
+
+	sample := newManifestSample(eblFile, c.options.ExbName, filepath.Join(outputDir, outputFilename))
+	sample.SourceSHA256 = src.sha256
+	sample.Pair = pair.path
+	sample.PairSHA256 = pair.sha256
+	sample.DetectedPitch = math.Round(detectedPitch*100) / 100
+	sample.Warnings = warnings
+	sample.Category = sampleCategory
+
+	if !c.options.NoWrite {
+		sample.SHA256 = sum
+		if c.options.Checksums {
+			sidecar := []byte(manifest.SidecarLine(sample.Output, sum))
+			if err := c.writeData(sample.Output+manifest.SidecarExt, sidecar); err != nil {
+				fmt.Fprintf(c.out, "CHECKSUM ERROR: %s: error writing checksum file: %v\n", outputFilename, err)
+			}
+		}
+	}
+
+	if c.options.Waveform != "" && !c.options.NoWrite {
+		sample.Waveform, err = c.writeWaveform(eblFile, sample.Output)
+		if err != nil {
+			fmt.Fprintf(c.out, "WAVEFORM ERROR: %s: %v\n", outputFilename, err)
+		}
 	}
 
-	return true, nil
+	if c.options.Slices && !c.options.NoWrite && c.options.Sink == nil {
+		sample.SliceMap, err = slices.Write(c.encoder, eblFile, sample.Output)
+		if err != nil {
+			fmt.Fprintf(c.out, "SLICE ERROR: %s: %v\n", outputFilename, err)
+		} else if sample.SliceMap != "" {
+			c.stats.Sliced++
+		}
+	}
+
+	if c.options.Verify {
+		sample.Issues = eblFile.Verify()
+		for _, issue := range sample.Issues {
+			fmt.Fprintf(c.out, "VERIFY: %s: %s\n", filepath.Base(inputFile), issue)
+		}
+	}
+
+	if c.options.Anomalies {
+		anomalies, err := detectAnomalies(eblFile)
+		if err != nil {
+			fmt.Fprintf(c.out, "ANOMALY CHECK ERROR: %s: %v\n", filepath.Base(inputFile), err)
+		}
+		for _, anomaly := range anomalies {
+			sample.Anomalies = append(sample.Anomalies, anomaly.String())
+			c.stats.Anomalies[anomaly.Kind]++
+			fmt.Fprintf(c.out, "ANOMALY: %s: %s\n", filepath.Base(inputFile), anomaly)
+		}
+		if len(anomalies) > 0 {
+			c.stats.Anomalous = append(c.stats.Anomalous, inputFile)
+		}
+	}
+
+	c.samples = append(c.samples, sample)
+	c.recordSample(sample, size)
+
+	c.logf(LevelVerbose, "Converted %s -> %s\n", filepath.Base(inputFile), outputFilename)
+	rootKey := "unknown"
+	if eblFile.RootKey >= 0 {
+		rootKey = ebl.NoteName(eblFile.RootKey)
+	}
+	c.logf(LevelVeryVerbose, "  %q: %d Hz, %d channel(s), %d frames (%.3fs), root key %s, %s\n",
+		sample.Name, sample.SampleRate, sample.Channels, sample.Frames, sample.Duration, rootKey, sample.Variant)
+
+	if !c.options.NoWrite && c.options.Sink == nil {
+		c.runHooks(sample)
+	}
+	for _, file := range sources {
+		c.emit(Event{Type: EventFileCompleted, File: file, Output: sample.Output})
+	}
+	return FileResult{Output: sample.Output, Duration: sample.Duration, Bytes: size, Strategy: sample.Strategy, Warnings: warnings}, nil
+}
+
+// writeWaveform renders the waveform of a sample next to its output file, returning
+// the path of the image
+func (c *Converter) writeWaveform(eblFile *ebl.EBLFile, outputPath string) (string, error) {
+	readers := []io.Reader{eblFile.ChannelReader(1)}
+	if eblFile.Channels() == 2 {
+		readers = append(readers, eblFile.ChannelReader(2))
+	}
+	peaks, err := waveform.Compute(c.options.WaveformOptions.Width, eblFile.Frames(), readers...)
+	if err != nil {
+		return "", err
+	}
+
+	imagePath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "." + c.options.Waveform
+	_, _, err = c.writeFile(imagePath, func(w io.Writer) error {
+		return peaks.Write(w, c.options.Waveform, c.options.WaveformOptions)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error writing image: %w", err)
+	}
+	return imagePath, nil
+}
+
+// detectAnomalies checks the decoded audio of a sample for anomalies
+func detectAnomalies(eblFile *ebl.EBLFile) ([]anomaly.Anomaly, error) {
+	readers := []io.Reader{eblFile.ChannelReader(1)}
+	if eblFile.Channels() == 2 {
+		readers = append(readers, eblFile.ChannelReader(2))
+	}
+	return anomaly.Detect(readers...)
+}
+
+// newManifestSample describes a converted EBL file for the manifest
+func newManifestSample(eblFile *ebl.EBLFile, bank, outputPath string) manifest.Sample {
+	sample := manifest.Sample{
+		Bank:       bank,
+		Source:     eblFile.Path,
+		Output:     outputPath,
+		Name:       eblFile.Name(),
+		Comment:    eblFile.HeaderData.CommentStr,
+		SampleRate: eblFile.HeaderData.SampleRate,
+		Channels:   eblFile.Channels(),
+		Frames:     eblFile.Frames(),
+		Duration:   eblFile.Duration(),
+		Variant:    eblFile.Version.String(),
+	}
+	if eblFile.Strategy != ebl.StrategyStandard {
+		sample.Strategy = string(eblFile.Strategy)
+	}
+	if eblFile.RootKey >= 0 {
+		rootKey := eblFile.RootKey
+		sample.RootKey = &rootKey
+	}
+	return sample
+}
+
+// recordSample adds a converted sample and the size of its file to the run statistics
+func (c *Converter) recordSample(sample manifest.Sample, size int64) {
+	c.stats.Samples++
+	c.stats.Duration += sample.Duration
+	c.stats.SampleRates[sample.SampleRate]++
+	if len(sample.Issues) > 0 {
+		c.stats.Flagged++
+	}
+	if sample.Category != "" {
+		c.stats.Categories[sample.Category]++
+	}
+	if sample.Channels == 1 {
+		c.stats.Mono++
+	} else {
+		c.stats.Stereo++
+	}
+	c.stats.OutputBytes += size
+}
+
+// WriteManifest writes a manifest.json describing every sample converted so far into
+// outputDir. Manifests written to disk are merged with the one already there.
+func (c *Converter) WriteManifest(outputDir string) error {
+	if c.options.NoWrite {
+		return nil
+	}
+	if c.options.Sink != nil {
+		var data bytes.Buffer
+		if err := c.Manifest(outputDir).Encode(&data); err != nil {
+			return err
+		}
+		if err := c.writeData(filepath.Join(outputDir, manifest.Filename), data.Bytes()); err != nil {
+			return fmt.Errorf("error writing manifest: %w", err)
+		}
+		return nil
+	}
+
+	samples := c.manifestSamples(outputDir)
+	return manifest.Edit(outputDir, func(m *manifest.Manifest) {
+		m.Merge(c.options.ExbName, samples)
+	})
+}
+
+// Manifest returns the manifest describing the samples converted so far into outputDir,
+// as WriteManifest writes it to Options.Sink
+func (c *Converter) Manifest(outputDir string) *manifest.Manifest {
+	m := &manifest.Manifest{}
+	m.Merge(c.options.ExbName, c.manifestSamples(outputDir))
+	return m
+}
+
+// manifestSamples returns the samples converted so far, their files given relative to outputDir
+func (c *Converter) manifestSamples(outputDir string) []manifest.Sample {
+	converted := c.Samples()
+	samples := make([]manifest.Sample, 0, len(converted))
+	for _, sample := range converted {
+		if relPath, err := filepath.Rel(outputDir, sample.Output); err == nil {
+			sample.Output = filepath.ToSlash(relPath)
+		}
+		if relPath, err := filepath.Rel(outputDir, sample.Waveform); err == nil && sample.Waveform != "" {
+			sample.Waveform = filepath.ToSlash(relPath)
+		}
+		if relPath, err := filepath.Rel(outputDir, sample.SliceMap); err == nil && sample.SliceMap != "" {
+			sample.SliceMap = filepath.ToSlash(relPath)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// Result summarizes the EBL files processed by ProcessDirectory or ProcessBucket
+type Result struct {
+	Files     int // EBL files found
+	Converted int // Files converted, skipped by the conflict policy or found to be placeholders. Both files of a merged stereo pair count.
+}
+
+// Failed returns the number of files which couldn't be converted
+func (r Result) Failed() int {
+	return r.Files - r.Converted
+}
+
+// Add merges other into r
+func (r *Result) Add(other Result) {
+	r.Files += other.Files
+	r.Converted += other.Converted
 }
 
 // ProcessDirectory processes all EBL files in a directory and its subdirectories
-func (c *Converter) ProcessDirectory(inputDir, outputDir string) error {
-	fmt.Printf("Scanning %s/ ...", inputDir)
+func (c *Converter) ProcessDirectory(inputDir, outputDir string) (Result, error) {
+	// Converted files and error copies written inside the input would be found again
+	// by later scans
+	if !c.options.NoWrite && c.options.Sink == nil {
+		if err := safepath.CheckOutput(inputDir, outputDir); err != nil {
+			return Result{}, err
+		}
+	}
+
+	c.logf(LevelNormal, "Scanning %s/ ...", inputDir)
 
 	// Find all .ebl files recursively
 	var files []string
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+	err := fswalk.Walk(inputDir, c.options.FollowSymlinks, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -80,17 +764,18 @@ func (c *Converter) ProcessDirectory(inputDir, outputDir string) error {
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("error scanning directory: %w", err)
+		return Result{}, fmt.Errorf("error scanning directory: %w", err)
 	}
 
-	fmt.Printf("Done.\nPlanning to process %d EBL files in %s/\n", len(files), inputDir)
+	c.logf(LevelNormal, "Done.\nPlanning to process %d EBL files in %s/\n", len(files), inputDir)
+	c.emit(Event{Type: EventScanned, Total: len(files)})
 
 	// Group files by directory
 	dirMap := make(map[string][]string)
 	for _, file := range files {
 		relPath, err := filepath.Rel(inputDir, filepath.Dir(file))
 		if err != nil {
-			return fmt.Errorf("error calculating relative path: %w", err)
+			return Result{}, fmt.Errorf("error calculating relative path: %w", err)
 		}
 		if relPath == "." {
 			relPath = ""
@@ -101,41 +786,91 @@ func (c *Converter) ProcessDirectory(inputDir, outputDir string) error {
 		dirMap[relPath] = append(dirMap[relPath], file)
 	}
 
-	// Process files by directory
-	totalConverted := 0
-	startTime := time.Now()
+	// Queue the files by directory, in a stable order
+	dirs := make([]string, 0, len(dirMap))
+	for dir := range dirMap {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
 
-	for dir, dirFiles := range dirMap {
-		fmt.Printf("%s - %d file(s).\n", dir, len(dirFiles))
+	var jobs []fileJob
+	for _, dir := range dirs {
+		dirFiles := dirMap[dir]
 
-		// Create output directory if necessary
+		// Create output directory if necessary, samples sorted by category all start
+		// from the output directory
 		dirOutputPath := filepath.Join(outputDir, dir)
-		if !c.options.NoWrite {
+		if c.options.Categories != nil {
+			dirOutputPath = outputDir
+		}
+		if !c.options.NoWrite && c.options.Sink == nil {
 			if err := os.MkdirAll(dirOutputPath, 0755); err != nil {
-				return fmt.Errorf("error creating output directory: %w", err)
+				return Result{Files: len(files)}, fmt.Errorf("error creating output directory: %w", err)
 			}
 		}
 
-		// Convert files
-		converted := 0
-		for _, file := range dirFiles {
-			success, err := c.ConvertFile(file, dirOutputPath)
-			if err != nil && c.options.Debug {
-				fmt.Printf("Error converting %s: %v\n", file, err)
-				continue
-			}
-			if success {
-				converted++
-				totalConverted++
+		if c.options.MergeStereo {
+			var pairs [][2]string
+			pairs, dirFiles = findStereoPairs(dirFiles)
+			for _, pair := range pairs {
+				jobs = append(jobs, fileJob{dir: dir, files: []string{pair[0], pair[1]}, outputDir: dirOutputPath})
 			}
 		}
-		fmt.Printf("Converted %d files in folder.\n", converted)
+		for _, file := range dirFiles {
+			jobs = append(jobs, fileJob{dir: dir, files: []string{file}, outputDir: dirOutputPath})
+		}
 	}
 
+	// Convert the files concurrently, results are merged and printed by directory in
+	// queue order whatever the order files complete in
+	result := Result{Files: len(files)}
+	startTime := time.Now()
+
+	processed := 0
+	c.reportProgress(ProgressEvent{Total: len(files)})
+
+	converted := 0
+	var sinkErr error
+	c.runJobs(jobs, func(i int, job *fileJob) {
+		if i == 0 || jobs[i-1].dir != job.dir {
+			c.logf(LevelNormal, "%s - %d file(s).\n", job.dir, len(dirMap[job.dir]))
+			converted = 0
+		}
+
+		// Once a write to the sink failed, e.g. to an archive, the files left are dropped
+		if job.pending != nil && sinkErr == nil {
+			sinkErr = c.commit(job.pending)
+		}
+
+		c.merge(job.worker, job.output.Bytes())
+		converted += job.converted
+		result.Converted += job.converted
+
+		processed += len(job.files)
+		c.reportProgress(ProgressEvent{
+			File:      job.files[len(job.files)-1],
+			Done:      processed,
+			Total:     len(files),
+			Converted: result.Converted,
+			Elapsed:   time.Since(startTime),
+		})
+
+		if i == len(jobs)-1 || jobs[i+1].dir != job.dir {
+			c.logf(LevelNormal, "Converted %d files in folder.\n", converted)
+		}
+	})
+
 	elapsed := time.Since(startTime)
-	fmt.Printf("Converted %d/%d files. Duration: %.2fs\n", totalConverted, len(files), elapsed.Seconds())
+	c.logf(LevelNormal, "Converted %d/%d files. Duration: %.2fs\n", result.Converted, len(files), elapsed.Seconds())
 
-	return nil
+	if sinkErr != nil {
+		return result, sinkErr
+	}
+	if err := c.WriteManifest(outputDir); err != nil {
+		return result, err
+	}
+
+	return result, nil
 }
 
 // saveErrorFile saves a copy of a file that caused an error
@@ -146,30 +881,41 @@ func (c *Converter) saveErrorFile(inputFile, errorDir string) {
 	}
 
 	// Create error directory if it doesn't exist
-	if err := os.MkdirAll(errorDir, 0755); err != nil {
-		fmt.Printf("Error creating error directory: %v\n", err)
-		return
+	if c.options.Sink == nil {
+		if err := os.MkdirAll(errorDir, 0755); err != nil {
+			fmt.Fprintf(c.out, "Error creating error directory: %v\n", err)
+			return
+		}
 	}
 
 	// Open input file
 	inFile, err := os.Open(inputFile)
 	if err != nil {
-		fmt.Printf("Error opening file for error copy: %v\n", err)
+		fmt.Fprintf(c.out, "Error opening file for error copy: %v\n", err)
 		return
 	}
 	defer inFile.Close()
 
-	// Create output file
+	// Create output file, never over the file itself
 	errorFilePath := filepath.Join(errorDir, filepath.Base(inputFile))
-	outFile, err := os.Create(errorFilePath)
-	if err != nil {
-		fmt.Printf("Error creating error file: %v\n", err)
+	if sameFile(inputFile, errorFilePath) {
 		return
 	}
-	defer outFile.Close()
+	_, _, err = c.writeFile(errorFilePath, func(w io.Writer) error {
+		_, err := io.Copy(w, inFile)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(c.out, "Error copying file content: %v\n", err)
+	}
+}
 
-	// Copy content
-	if _, err := io.Copy(outFile, inFile); err != nil {
-		fmt.Printf("Error copying file content: %v\n", err)
+// sameFile reports whether a and b are the same existing file
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
 	}
+	infoB, err := os.Stat(b)
+	return err == nil && os.SameFile(infoA, infoB)
 }
@@ -0,0 +1,66 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/fswalk"
+)
+
+// fileOverhead is the space allowed for each converted file besides its audio: WAV
+// chunks, manifest entry and sidecar files
+const fileOverhead = 4096
+
+// Estimate is the output size expected from converting EBL files
+type Estimate struct {
+	Files int   // EBL files found
+	Bytes int64 // Size of the converted files
+}
+
+// EstimateOutput estimates the size of the files written by converting the EBL files
+// at paths, files or directories scanned recursively, from the channel sizes of their
+// headers. The audio isn't read, and files whose header can't be read count for
+// their own size.
+func EstimateOutput(paths []string, followLinks bool) (Estimate, error) {
+	parser := ebl.NewParser(false, false)
+	var estimate Estimate
+	for _, root := range paths {
+		err := fswalk.Walk(root, followLinks, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || strings.ToLower(filepath.Ext(path)) != ".ebl" {
+				return nil
+			}
+			estimate.Files++
+			estimate.Bytes += estimateFile(parser, path, info.Size()) + fileOverhead
+			return nil
+		})
+		if err != nil {
+			return estimate, fmt.Errorf("error scanning directory: %w", err)
+		}
+	}
+	return estimate, nil
+}
+
+// estimateFile returns the audio size of an EBL file, or its size when its header
+// can't be read. Corrupted headers can't make a file count for more than its size.
+func estimateFile(parser *ebl.Parser, path string, size int64) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return size
+	}
+	defer file.Close()
+
+	eblFile, err := parser.ReadHeader(file, path, size)
+	if err != nil {
+		return size
+	}
+	if audio := int64(eblFile.DataSizeCalc); audio < size {
+		return audio
+	}
+	return size
+}
@@ -0,0 +1,45 @@
+package converter
+
+import "time"
+
+// Event types reported to Options.Events
+const (
+	EventScanned         = "scanned"          // ProcessDirectory found the files to convert, Total giving their number
+	EventFileStarted     = "file_started"     // A file is being converted
+	EventFileCompleted   = "file_completed"   // A file was converted to Output
+	EventFileSkipped     = "file_skipped"     // A file was already converted to Output and kept
+	EventFileFiltered    = "file_filtered"    // A file was left out by Options.Filter, Error telling why
+	EventFilePlaceholder = "file_placeholder" // A file was skipped as a placeholder without audio
+	EventFileFailed      = "file_failed"      // A file couldn't be converted, Error telling why
+)
+
+// Event reports the progress of a conversion, for front ends following it live
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Bank   string    `json:"bank,omitempty"`
+	File   string    `json:"file,omitempty"`   // Source EBL file
+	Output string    `json:"output,omitempty"` // Converted file
+	Error  string    `json:"error,omitempty"`
+	Total  int       `json:"total,omitempty"`
+	Stats  *Stats    `json:"stats,omitempty"` // Run totals, for the events of callers
+}
+
+// emit reports an event to the Events option if set
+func (c *Converter) emit(event Event) {
+	if c.options.Events == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Bank = c.options.ExbName
+	c.options.Events(event)
+}
+
+// emitFailed reports the failure of a file
+func (c *Converter) emitFailed(file string, err error) {
+	event := Event{Type: EventFileFailed, File: file}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	c.emit(event)
+}
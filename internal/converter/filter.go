@@ -0,0 +1,44 @@
+package converter
+
+import (
+	"fmt"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// Filter selects the samples converted, its zero values selecting every sample
+type Filter struct {
+	MinDuration   float64 // Seconds
+	MaxDuration   float64 // Seconds
+	MinSampleRate int     // Hz
+	Channels      int     // 1 for mono samples only, 2 for stereo
+}
+
+// reject returns why a sample is filtered out, or an empty string when it is
+// converted. Durations are measured at the sample rate the sample is written with.
+func (f Filter) reject(eblFile *ebl.EBLFile, sampleRate int) string {
+	duration := float64(eblFile.Frames()) / float64(sampleRate)
+	switch {
+	case f.Channels > 0 && eblFile.Channels() != f.Channels:
+		return fmt.Sprintf("%d channel(s)", eblFile.Channels())
+	case f.MinSampleRate > 0 && sampleRate < f.MinSampleRate:
+		return fmt.Sprintf("sample rate %d Hz", sampleRate)
+	case f.MinDuration > 0 && duration < f.MinDuration:
+		return fmt.Sprintf("%.3fs long", duration)
+	case f.MaxDuration > 0 && duration > f.MaxDuration:
+		return fmt.Sprintf("%.3fs long", duration)
+	}
+	return ""
+}
+
+// outputSampleRate returns the sample rate a sample is written with, see writeSample
+func (c *Converter) outputSampleRate(eblFile *ebl.EBLFile) int {
+	switch rate := eblFile.HeaderData.SampleRate; {
+	case c.options.ForceSampleRate > 0:
+		return c.options.ForceSampleRate
+	case !ebl.PlausibleSampleRate(rate):
+		return fallbackSampleRate
+	default:
+		return rate
+	}
+}
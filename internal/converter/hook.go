@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// Hook post-processes converted samples, e.g. to tag or upload them. Hooks run after
+// each successful conversion, concurrently when several workers convert files, and
+// may print to out, the destination of the converter's messages. A failing hook
+// doesn't fail the conversion.
+type Hook interface {
+	AfterConvert(sample manifest.Sample, out io.Writer) error
+}
+
+// HookFunc adapts a function to the Hook interface
+type HookFunc func(sample manifest.Sample, out io.Writer) error
+
+// AfterConvert calls f
+func (f HookFunc) AfterConvert(sample manifest.Sample, out io.Writer) error {
+	return f(sample, out)
+}
+
+// CommandHook runs a shell command after each conversion, the sample being described
+// by EBL2WAV_* environment variables
+type CommandHook struct {
+	command string
+}
+
+// NewCommandHook creates a hook running command with sh -c, or cmd /C on Windows
+func NewCommandHook(command string) *CommandHook {
+	return &CommandHook{command: command}
+}
+
+// AfterConvert runs the command, its output going to out
+func (h *CommandHook) AfterConvert(sample manifest.Sample, out io.Writer) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", h.command)
+	} else {
+		cmd = exec.Command("sh", "-c", h.command)
+	}
+	env, err := HookEnv(sample)
+	if err != nil {
+		return err
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running post command: %w", err)
+	}
+	return nil
+}
+
+// HookEnv returns the environment variables describing a converted sample:
+//
+//	EBL2WAV_SOURCE, EBL2WAV_SOURCE_SHA256  Source EBL file and its checksum
+//	EBL2WAV_PAIR                           Right half's EBL file of merged stereo pairs
+//	EBL2WAV_OUTPUT, EBL2WAV_OUTPUT_DIR     Converted file and its directory
+//	EBL2WAV_SHA256                         Checksum of the converted file
+//	EBL2WAV_BANK, EBL2WAV_NAME, EBL2WAV_COMMENT
+//	EBL2WAV_SAMPLE_RATE, EBL2WAV_CHANNELS, EBL2WAV_FRAMES, EBL2WAV_DURATION
+//	EBL2WAV_ROOT_KEY, EBL2WAV_ROOT_NOTE    MIDI note and its name, empty when unknown
+//	EBL2WAV_WAVEFORM                       Waveform image written by -waveform
+//	EBL2WAV_SAMPLE_JSON                    The manifest entry of the sample
+func HookEnv(sample manifest.Sample) ([]string, error) {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding sample: %w", err)
+	}
+
+	rootKey, rootNote := "", ""
+	if sample.RootKey != nil {
+		rootKey = strconv.Itoa(*sample.RootKey)
+		rootNote = ebl.NoteName(*sample.RootKey)
+	}
+
+	return []string{
+		"EBL2WAV_SOURCE=" + sample.Source,
+		"EBL2WAV_SOURCE_SHA256=" + sample.SourceSHA256,
+		"EBL2WAV_PAIR=" + sample.Pair,
+		"EBL2WAV_OUTPUT=" + sample.Output,
+		"EBL2WAV_OUTPUT_DIR=" + filepath.Dir(sample.Output),
+		"EBL2WAV_SHA256=" + sample.SHA256,
+		"EBL2WAV_BANK=" + sample.Bank,
+		"EBL2WAV_NAME=" + sample.Name,
+		"EBL2WAV_COMMENT=" + sample.Comment,
+		"EBL2WAV_SAMPLE_RATE=" + strconv.Itoa(sample.SampleRate),
+		"EBL2WAV_CHANNELS=" + strconv.Itoa(sample.Channels),
+		"EBL2WAV_FRAMES=" + strconv.Itoa(sample.Frames),
+		"EBL2WAV_DURATION=" + strconv.FormatFloat(sample.Duration, 'f', 6, 64),
+		"EBL2WAV_ROOT_KEY=" + rootKey,
+		"EBL2WAV_ROOT_NOTE=" + rootNote,
+		"EBL2WAV_WAVEFORM=" + sample.Waveform,
+		"EBL2WAV_SAMPLE_JSON=" + string(data),
+	}, nil
+}
+
+// runHooks runs the hooks on a converted sample
+func (c *Converter) runHooks(sample manifest.Sample) {
+	for _, hook := range c.options.Hooks {
+		if err := hook.AfterConvert(sample, c.out); err != nil {
+			c.stats.HookFailures++
+			fmt.Fprintf(c.out, "HOOK ERROR: %s: %v\n", filepath.Base(sample.Output), err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// Files written to Options.Sink are named after their path, output directories then
+// being relative paths standing for folders of the sink
+
+// sinkName returns the name in Options.Sink of the file at filePath
+func sinkName(filePath string) string {
+	return filepath.ToSlash(filepath.Clean(filePath))
+}
+
+// create creates the file at filePath, in Options.Sink when set. Files written to
+// disk get their name once closed, see atomicfile.
+func (c *Converter) create(filePath string) (io.WriteCloser, error) {
+	if c.options.Sink == nil {
+		file, err := atomicfile.Create(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error creating output file: %w", err)
+		}
+		return file, nil
+	}
+
+	name := sinkName(filePath)
+	w, err := c.options.Sink.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	c.outputs.add(name)
+	return w, nil
+}
+
+// exists reports whether the file at filePath exists, or was written to Options.Sink
+func (c *Converter) exists(filePath string) bool {
+	if c.options.Sink != nil {
+		return c.outputs.written(sinkName(filePath))
+	}
+	_, err := os.Stat(filePath)
+	return err == nil
+}
+
+// abort discards a file whose writing failed, closing it when it can't be discarded
+func abort(w io.WriteCloser) {
+	if aborter, ok := w.(sink.Aborter); ok {
+		aborter.Abort()
+		return
+	}
+	w.Close()
+}
+
+// writeFile writes the file at filePath with write, returning the hex SHA-256 and the
+// size of its content
+func (c *Converter) writeFile(filePath string, write func(w io.Writer) error) (string, int64, error) {
+	w, err := c.create(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash := sha256.New()
+	counter := &byteCounter{}
+	if err := write(io.MultiWriter(c.options.Limiter.Writer(w), hash, counter)); err != nil {
+		abort(w)
+		return "", 0, err
+	}
+	if err := w.Close(); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), counter.n, nil
+}
+
+// writeOutput encodes a sample to outputPath, in the output format or FLAC, returning
+// the hex SHA-256 and the size of the file
+func (c *Converter) writeOutput(eblFile *ebl.EBLFile, outputPath string) (string, int64, error) {
+	switch {
+	case c.options.FLAC != nil:
+		return c.writeFile(outputPath, func(w io.Writer) error {
+			// Stream the WAV encoding through ffmpeg
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(c.encoder.WriteWAVTo(pw, eblFile))
+			}()
+			err := c.options.FLAC.Encode(w, pr, flac.Tags{
+				Title:   eblFile.Name(),
+				Album:   c.options.ExbName,
+				Comment: eblFile.HeaderData.CommentStr,
+			})
+			pr.Close()
+			return err
+		})
+	case c.options.Format == wav.FormatRaw:
+		sum, size, err := c.writeFile(outputPath, func(w io.Writer) error {
+			return c.encoder.WriteRawTo(w, eblFile)
+		})
+		if err != nil {
+			return "", 0, err
+		}
+		data, err := json.MarshalIndent(wav.NewRawInfo(eblFile), "", "  ")
+		if err != nil {
+			return "", 0, fmt.Errorf("error encoding raw file description: %w", err)
+		}
+		if err := c.writeData(wav.RawInfoPath(outputPath), append(data, '\n')); err != nil {
+			return "", 0, fmt.Errorf("error writing raw file description: %w", err)
+		}
+		return sum, size, nil
+	default:
+		return c.writeFile(outputPath, func(w io.Writer) error {
+			return c.encoder.WriteWAVTo(w, eblFile)
+		})
+	}
+}
+
+// writeData writes data to the file at filePath
+func (c *Converter) writeData(filePath string, data []byte) error {
+	_, _, err := c.writeFile(filePath, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	return err
+}
+
+// commit writes the files a job held back in pending to Options.Sink, in name order
+func (c *Converter) commit(pending *sink.Memory) error {
+	for _, name := range pending.Files() {
+		data, _ := pending.File(name)
+		w, err := c.options.Sink.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			abort(w)
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	b.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,41 @@
+package converter
+
+import "time"
+
+// ProgressEvent reports how far ProcessDirectory or ProcessBucket got, so applications
+// embedding the converter can render progress without parsing its output
+type ProgressEvent struct {
+	Bank      string        `json:"bank,omitempty"` // Options.ExbName
+	File      string        `json:"file,omitempty"` // Last source file handled, empty before the first
+	Done      int           `json:"done"`           // Files handled so far, converted or not
+	Total     int           `json:"total"`          // Files to handle
+	Converted int           `json:"converted"`      // Files converted, kept by the conflict policy, filtered out or placeholders
+	Failed    int           `json:"failed"`         // Files which failed to convert
+	Elapsed   time.Duration `json:"elapsed"`        // Time since the files were scanned
+}
+
+// Fraction returns the part of the files handled, from 0 to 1
+func (e ProgressEvent) Fraction() float64 {
+	if e.Total == 0 {
+		return 1
+	}
+	return float64(e.Done) / float64(e.Total)
+}
+
+// Remaining estimates the time left from the pace so far, 0 when it can't be known yet
+func (e ProgressEvent) Remaining() time.Duration {
+	if e.Done == 0 || e.Done >= e.Total {
+		return 0
+	}
+	return time.Duration(float64(e.Elapsed) / float64(e.Done) * float64(e.Total-e.Done))
+}
+
+// reportProgress calls the Progress option if set
+func (c *Converter) reportProgress(event ProgressEvent) {
+	if c.options.Progress == nil {
+		return
+	}
+	event.Bank = c.options.ExbName
+	event.Failed = event.Done - event.Converted
+	c.options.Progress(event)
+}
@@ -0,0 +1,183 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// fileJob is a file, or stereo pair of files, queued by ProcessDirectory
+type fileJob struct {
+	dir       string   // Directory relative to the input directory
+	files     []string // A single file, or the left and right files of a stereo pair
+	outputDir string
+
+	// Set once the job ran
+	worker    *Converter
+	output    bytes.Buffer
+	converted int
+	pending   *sink.Memory // Files written to Options.Sink, held back until the job is released
+}
+
+// runJobs converts the queued files with a pool of workers. done is called from the
+// calling goroutine with each completed job, in queue order. Jobs are started at most
+// jobsAhead times the number of workers ahead of the first job not released, bounding
+// the output held back.
+func (c *Converter) runJobs(jobs []fileJob, done func(i int, job *fileJob)) {
+	numWorkers := c.options.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	if numWorkers > len(jobs) {
+		numWorkers = len(jobs)
+	}
+	started := make(chan struct{}, jobsAhead*numWorkers)
+
+	queue := make(chan int)
+	completed := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				c.runJob(&jobs[i])
+				completed <- i
+			}
+		}()
+	}
+
+	go func() {
+		for i := range jobs {
+			started <- struct{}{}
+			queue <- i
+		}
+		close(queue)
+		wg.Wait()
+		close(completed)
+	}()
+
+	// Release jobs in order, holding back those completing early
+	finished := make([]bool, len(jobs))
+	next := 0
+	for i := range completed {
+		finished[i] = true
+		for next < len(jobs) && finished[next] {
+			done(next, &jobs[next])
+			jobs[next].worker = nil
+			jobs[next].pending = nil
+			next++
+			<-started
+		}
+	}
+}
+
+// jobsAhead is the number of jobs per worker started ahead of the first job not released
+const jobsAhead = 4
+
+// runJob converts the files of a job with a worker of its own. Files written to
+// Options.Sink are held back, so they are written in queue order whatever the order
+// jobs complete in.
+func (c *Converter) runJob(job *fileJob) {
+	job.worker = c.worker(&job.output)
+	if c.options.Sink != nil {
+		job.pending = sink.NewMemory()
+		job.worker.options.Sink = job.pending
+	}
+
+	if job.dir != "/" {
+		job.worker.folder = filepath.Base(job.dir)
+	}
+
+	if len(job.files) == 2 {
+		n, err := job.worker.convertPair(job.files[0], job.files[1], job.outputDir)
+		if err != nil && c.options.Debug {
+			fmt.Fprintf(&job.output, "Error converting %s: %v\n", job.files[0], err)
+		}
+		job.converted = n
+		return
+	}
+
+	if _, err := job.worker.convertFile(job.files[0], job.outputDir); err != nil {
+		if c.options.Debug {
+			fmt.Fprintf(&job.output, "Error converting %s: %v\n", job.files[0], err)
+		}
+		return
+	}
+	job.converted = 1
+}
+
+// begin returns a worker converting a file with state of its own, and the function
+// merging its messages, samples and statistics back into c
+func (c *Converter) begin() (*Converter, func()) {
+	var output bytes.Buffer
+	worker := c.worker(&output)
+	return worker, func() { c.merge(worker, output.Bytes()) }
+}
+
+// worker returns a converter sharing the options, parser and encoder of c which writes
+// its messages to out and collects its own samples and statistics, merged back with
+// merge. A worker is only used by one goroutine at a time.
+func (c *Converter) worker(out io.Writer) *Converter {
+	return &Converter{
+		options: c.options,
+		out:     out,
+		parser:  c.parser,
+		encoder: c.encoder,
+		stats:   NewStats(),
+		outputs: c.outputs,
+	}
+}
+
+// merge prints the messages of a worker and adds the samples and statistics it collected
+func (c *Converter) merge(worker *Converter, output []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out.Write(output)
+	c.samples = append(c.samples, worker.samples...)
+	c.stats.Add(worker.stats)
+}
+
+// outputLocks serializes writes to the same output path
+type outputLocks struct {
+	mu    sync.Mutex
+	paths map[string]*sync.Mutex
+	names map[string]bool // Files written to Options.Sink, which can't be listed
+}
+
+func newOutputLocks() *outputLocks {
+	return &outputLocks{paths: make(map[string]*sync.Mutex), names: make(map[string]bool)}
+}
+
+// add records a file written to Options.Sink
+func (l *outputLocks) add(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.names[name] = true
+}
+
+// written reports whether a file was written to Options.Sink
+func (l *outputLocks) written(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.names[name]
+}
+
+// lock locks path, returning the function unlocking it
+func (l *outputLocks) lock(path string) func() {
+	l.mu.Lock()
+	m, ok := l.paths[path]
+	if !ok {
+		m = &sync.Mutex{}
+		l.paths[path] = m
+	}
+	l.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
@@ -0,0 +1,110 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// ProcessBucket converts every EBL object stored below prefix in an object storage bucket,
+// mirroring the key structure in outputDir. Objects are streamed, nothing is downloaded to disk.
+func (c *Converter) ProcessBucket(bucket *sink.S3, prefix, outputDir string) (Result, error) {
+	// The prefix names a single object or a folder, keys are mirrored relative to its folder
+	baseDir := strings.TrimSuffix(prefix, "/")
+	if strings.ToLower(path.Ext(prefix)) == ".ebl" {
+		baseDir = path.Dir(prefix)
+	} else if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	c.logf(LevelNormal, "Listing %s/%s ...", bucket.Bucket, prefix)
+
+	objects, err := bucket.List(prefix)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var files []sink.Object
+	for _, object := range objects {
+		if strings.ToLower(path.Ext(object.Key)) == ".ebl" {
+			files = append(files, object)
+		}
+	}
+
+	c.logf(LevelNormal, "Done.\nPlanning to process %d EBL objects in %s\n", len(files), prefix)
+
+	result := Result{Files: len(files)}
+	startTime := time.Now()
+
+	c.reportProgress(ProgressEvent{Total: len(files)})
+	for i, file := range files {
+		if i > 0 {
+			c.reportProgress(ProgressEvent{
+				File:      files[i-1].Key,
+				Done:      i,
+				Total:     len(files),
+				Converted: result.Converted,
+				Elapsed:   time.Since(startTime),
+			})
+		}
+
+		relDir := path.Dir(file.Key)
+		if baseDir != "" && baseDir != "." {
+			relDir = strings.TrimPrefix(strings.TrimPrefix(relDir, baseDir), "/")
+		}
+		if relDir == "." {
+			relDir = ""
+		}
+		dirOutputPath := filepath.Join(outputDir, filepath.FromSlash(relDir))
+		if c.options.Categories != nil {
+			dirOutputPath = outputDir
+		}
+		if !c.options.NoWrite && c.options.Sink == nil {
+			if err := os.MkdirAll(dirOutputPath, 0755); err != nil {
+				return result, fmt.Errorf("error creating output directory: %w", err)
+			}
+		}
+
+		body, err := bucket.Open(file.Key)
+		if err != nil {
+			c.mu.Lock()
+			c.stats.Failures[FailureRead]++
+			c.mu.Unlock()
+			c.printf("EBL READ ERROR: %s\n", path.Base(file.Key))
+			if c.options.Debug {
+				c.printf("Error converting %s: %v\n", file.Key, err)
+			}
+			continue
+		}
+
+		_, err = c.ConvertReader(body, file.Key, file.Size, dirOutputPath)
+		body.Close()
+		if err != nil {
+			if c.options.Debug {
+				c.printf("Error converting %s: %v\n", file.Key, err)
+			}
+			continue
+		}
+		result.Converted++
+	}
+
+	if len(files) > 0 {
+		c.reportProgress(ProgressEvent{
+			File:      files[len(files)-1].Key,
+			Done:      len(files),
+			Total:     len(files),
+			Converted: result.Converted,
+			Elapsed:   time.Since(startTime),
+		})
+	}
+
+	elapsed := time.Since(startTime)
+	c.logf(LevelNormal, "Converted %d/%d files. Duration: %.2fs\n", result.Converted, len(files), elapsed.Seconds())
+
+	return result, c.WriteManifest(outputDir)
+}
@@ -0,0 +1,261 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/i18n"
+)
+
+// Failure categories used in Stats.Failures
+const (
+	FailureInvalidFormat = "invalid format"
+	FailureTruncated     = "truncated"
+	FailureRead          = "read error"
+	FailureWrite         = "write error"
+	FailureConflict      = "output exists"
+	FailureStrict        = "not strictly valid"
+)
+
+// Stats aggregates statistics about a conversion run
+type Stats struct {
+	Samples      int            `json:"samples"`     // Successfully converted samples
+	Duration     float64        `json:"duration"`    // Total audio duration in seconds
+	InputBytes   int64          `json:"inputBytes"`  // Size of every EBL file processed
+	OutputBytes  int64          `json:"outputBytes"` // Size of every WAV file written
+	Mono         int            `json:"mono"`
+	Stereo       int            `json:"stereo"`
+	Flagged      int            `json:"flagged"`                // Converted samples with header inconsistencies
+	HookFailures int            `json:"hookFailures,omitempty"` // Failed hook runs, their samples still count as converted
+	Sliced       int            `json:"sliced,omitempty"`       // Samples cut into slices at their regions
+	Filtered     int            `json:"filtered,omitempty"`     // Samples left out by Options.Filter
+	Placeholders int            `json:"placeholders,omitempty"` // Zero-length files and samples without audio, skipped rather than failed
+	Recovered    int            `json:"recovered,omitempty"`    // Files read by an alternate parse strategy after failing the standard one
+	SampleRates  map[int]int    `json:"sampleRates"`            // Sample count per sample rate
+	Failures     map[string]int `json:"failures"`               // Failure count per category
+	Conflicts    map[string]int `json:"conflicts"`              // Existing outputs per action taken (overwritten, skipped, renamed, failed)
+	Anomalies    map[string]int `json:"anomalies"`              // Anomalies found per kind (see the anomaly package)
+	Categories   map[string]int `json:"categories,omitempty"`   // Samples sorted into each category by Options.Categories
+	Anomalous    []string       `json:"anomalous,omitempty"`    // Source files of the samples with anomalies
+	Missing      []string       `json:"missing,omitempty"`      // Samples referenced by EXB files without an EBL file, as "bank.exb: reference"
+	Orphans      []string       `json:"orphans,omitempty"`      // EBL files of SamplePools no EXB reference points to
+	FlacErrors   []string       `json:"flacErrors,omitempty"`   // WAV files ffmpeg couldn't convert to FLAC, as "file: error"
+	RefCompared  int            `json:"refCompared,omitempty"`  // Outputs compared with the reference outputs given with -compare-ref
+	RefDiffers   []string       `json:"refDiffers,omitempty"`   // Outputs differing from their reference, as "file: kind (detail)"
+}
+
+// NewStats creates an empty statistics summary
+func NewStats() *Stats {
+	return &Stats{
+		SampleRates: make(map[int]int),
+		Failures:    make(map[string]int),
+		Conflicts:   make(map[string]int),
+		Anomalies:   make(map[string]int),
+		Categories:  make(map[string]int),
+	}
+}
+
+// Add merges other into s
+func (s *Stats) Add(other *Stats) {
+	s.Samples += other.Samples
+	s.Duration += other.Duration
+	s.InputBytes += other.InputBytes
+	s.OutputBytes += other.OutputBytes
+	s.Mono += other.Mono
+	s.Stereo += other.Stereo
+	s.Flagged += other.Flagged
+	s.HookFailures += other.HookFailures
+	s.Sliced += other.Sliced
+	s.Filtered += other.Filtered
+	s.Placeholders += other.Placeholders
+	s.Recovered += other.Recovered
+	for rate, count := range other.SampleRates {
+		s.SampleRates[rate] += count
+	}
+	for category, count := range other.Failures {
+		s.Failures[category] += count
+	}
+	for action, count := range other.Conflicts {
+		s.Conflicts[action] += count
+	}
+	for kind, count := range other.Anomalies {
+		s.Anomalies[kind] += count
+	}
+	for name, count := range other.Categories {
+		s.Categories[name] += count
+	}
+	s.Anomalous = append(s.Anomalous, other.Anomalous...)
+	s.Missing = append(s.Missing, other.Missing...)
+	s.Orphans = append(s.Orphans, other.Orphans...)
+	s.FlacErrors = append(s.FlacErrors, other.FlacErrors...)
+	s.RefCompared += other.RefCompared
+	s.RefDiffers = append(s.RefDiffers, other.RefDiffers...)
+}
+
+// TotalFailures returns the number of files which failed to convert
+func (s *Stats) TotalFailures() int {
+	total := 0
+	for _, count := range s.Failures {
+		total += count
+	}
+	return total
+}
+
+// Print writes a human readable summary to w, in the language selected with
+// i18n.SetLanguage
+func (s *Stats) Print(w io.Writer) {
+	fmt.Fprintln(w, i18n.T("Summary:"))
+	fmt.Fprintf(w, i18n.T("  Samples converted: %d (%d mono, %d stereo)\n"), s.Samples, s.Mono, s.Stereo)
+	fmt.Fprintf(w, i18n.T("  Failures:          %d\n"), s.TotalFailures())
+	if s.Flagged > 0 {
+		fmt.Fprintf(w, i18n.T("  Flagged by verify: %d\n"), s.Flagged)
+	}
+	if len(s.Anomalous) > 0 {
+		fmt.Fprintf(w, i18n.T("  With anomalies:    %d\n"), len(s.Anomalous))
+	}
+	if s.Sliced > 0 {
+		fmt.Fprintf(w, i18n.T("  Sliced loops:      %d\n"), s.Sliced)
+	}
+	if s.Filtered > 0 {
+		fmt.Fprintf(w, i18n.T("  Filtered out:      %d\n"), s.Filtered)
+	}
+	if s.Placeholders > 0 {
+		fmt.Fprintf(w, i18n.T("  Placeholders:      %d\n"), s.Placeholders)
+	}
+	if s.Recovered > 0 {
+		fmt.Fprintf(w, i18n.T("  Recovered:         %d\n"), s.Recovered)
+	}
+	if len(s.Missing) > 0 {
+		fmt.Fprintf(w, i18n.T("  Missing samples:   %d\n"), len(s.Missing))
+	}
+	if len(s.Orphans) > 0 {
+		fmt.Fprintf(w, i18n.T("  Orphan samples:    %d\n"), len(s.Orphans))
+	}
+	if s.RefCompared > 0 {
+		fmt.Fprintf(w, i18n.T("  Reference check:   %d compared, %d different\n"), s.RefCompared, len(s.RefDiffers))
+	}
+	if s.HookFailures > 0 {
+		fmt.Fprintf(w, i18n.T("  Hook failures:     %d\n"), s.HookFailures)
+	}
+	if len(s.FlacErrors) > 0 {
+		fmt.Fprintf(w, i18n.T("  FLAC failures:     %d\n"), len(s.FlacErrors))
+	}
+	if len(s.Conflicts) > 0 {
+		total := 0
+		actions := make([]string, 0, len(s.Conflicts))
+		for action, count := range s.Conflicts {
+			total += count
+			actions = append(actions, action)
+		}
+		sort.Strings(actions)
+		for i, action := range actions {
+			actions[i] = fmt.Sprintf("%d %s", s.Conflicts[action], action)
+		}
+		fmt.Fprintf(w, i18n.T("  Existing outputs:  %d (%s)\n"), total, strings.Join(actions, ", "))
+	}
+	fmt.Fprintf(w, i18n.T("  Audio duration:    %s\n"), time.Duration(s.Duration*float64(time.Second)).Round(time.Millisecond))
+	fmt.Fprintf(w, i18n.T("  Input size:        %s\n"), formatBytes(s.InputBytes))
+	fmt.Fprintf(w, i18n.T("  Output size:       %s\n"), formatBytes(s.OutputBytes))
+
+	if len(s.SampleRates) > 0 {
+		fmt.Fprintln(w, i18n.T("  Sample rates:"))
+		rates := make([]int, 0, len(s.SampleRates))
+		for rate := range s.SampleRates {
+			rates = append(rates, rate)
+		}
+		sort.Ints(rates)
+		for _, rate := range rates {
+			fmt.Fprintf(w, "    %6d Hz: %d\n", rate, s.SampleRates[rate])
+		}
+	}
+
+	if len(s.Categories) > 0 {
+		fmt.Fprintln(w, i18n.T("  Samples by category:"))
+		names := make([]string, 0, len(s.Categories))
+		for name := range s.Categories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "    %s: %d\n", name, s.Categories[name])
+		}
+	}
+
+	if len(s.Anomalies) > 0 {
+		fmt.Fprintln(w, i18n.T("  Anomalies by kind:"))
+		kinds := make([]string, 0, len(s.Anomalies))
+		for kind := range s.Anomalies {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Fprintf(w, "    %s: %d\n", kind, s.Anomalies[kind])
+		}
+		fmt.Fprintln(w, i18n.T("  Samples with anomalies:"))
+		anomalous := append([]string(nil), s.Anomalous...)
+		sort.Strings(anomalous)
+		for _, path := range anomalous {
+			fmt.Fprintf(w, "    %s\n", path)
+		}
+	}
+
+	if len(s.Failures) > 0 {
+		fmt.Fprintln(w, i18n.T("  Failures by category:"))
+		categories := make([]string, 0, len(s.Failures))
+		for category := range s.Failures {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			fmt.Fprintf(w, "    %s: %d\n", category, s.Failures[category])
+		}
+	}
+}
+
+// Save writes the statistics as JSON to path
+func (s *Stats) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding statistics: %w", err)
+	}
+
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing statistics: %w", err)
+	}
+	return nil
+}
+
+// failureCategory classifies an EBL read error
+func failureCategory(err error) string {
+	switch {
+	case errors.Is(err, ebl.ErrInvalidFormat):
+		return FailureInvalidFormat
+	case errors.Is(err, ebl.ErrStrict):
+		return FailureStrict
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return FailureTruncated
+	default:
+		return FailureRead
+	}
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// sidePattern matches names of split stereo halves, e.g. "Pad-L", "Pad_R", "Pad L" or "Pad (Right)"
+var sidePattern = regexp.MustCompile(`(?i)^(.+?)(?:[\s_\-\.]+(l|r|left|right)|\s*\((l|r|left|right)\))$`)
+
+// splitSide returns the name without its left/right suffix and the side ("L" or "R")
+func splitSide(name string) (string, string, bool) {
+	m := sidePattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", false
+	}
+	side := m[2] + m[3]
+	return m[1], strings.ToUpper(side[:1]), true
+}
+
+// findStereoPairs pairs the files whose names only differ by a left/right suffix.
+// Files without a counterpart are returned in rest, in their original order.
+func findStereoPairs(files []string) (pairs [][2]string, rest []string) {
+	type halves struct{ left, right string }
+	byStem := make(map[string]*halves)
+	for _, file := range files {
+		stem, side, ok := splitSide(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(filepath.Join(filepath.Dir(file), stem))
+		h := byStem[key]
+		if h == nil {
+			h = &halves{}
+			byStem[key] = h
+		}
+		if side == "L" {
+			h.left = file
+		} else {
+			h.right = file
+		}
+	}
+
+	paired := make(map[string]bool)
+	for _, file := range files {
+		stem, _, ok := splitSide(strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+		if !ok {
+			rest = append(rest, file)
+			continue
+		}
+		h := byStem[strings.ToLower(filepath.Join(filepath.Dir(file), stem))]
+		if h.left == "" || h.right == "" {
+			rest = append(rest, file)
+			continue
+		}
+		if !paired[h.left] {
+			paired[h.left] = true
+			pairs = append(pairs, [2]string{h.left, h.right})
+		}
+	}
+	return pairs, rest
+}
+
+// mergeStereo combines two mono EBL files into a single stereo EBL file. It fails if
+// the halves aren't both mono or don't share the same length and sample rate.
+func mergeStereo(left, right *ebl.EBLFile) (*ebl.EBLFile, error) {
+	if left.Channels() != 1 || right.Channels() != 1 {
+		return nil, fmt.Errorf("both halves must be mono")
+	}
+	if left.Channel1Size != right.Channel1Size {
+		return nil, fmt.Errorf("halves differ in length (%d and %d bytes)", left.Channel1Size, right.Channel1Size)
+	}
+	if left.HeaderData.SampleRate != right.HeaderData.SampleRate {
+		return nil, fmt.Errorf("halves differ in sample rate (%d and %d Hz)",
+			left.HeaderData.SampleRate, right.HeaderData.SampleRate)
+	}
+
+	merged := *left
+	merged.Channel2Size = right.Channel1Size
+	merged.Channel2Data = right.Channel1Data
+	merged.Channel2Stream = right.Channel1Stream
+	merged.DataSizeCalc = merged.Channel1Size + merged.Channel2Size
+
+	// Name the stereo file after the halves without their side suffix
+	if stem, _, ok := splitSide(left.HeaderData.FilenameStr); ok {
+		merged.HeaderData.FilenameStr = stem
+	}
+	if stem, _, ok := splitSide(left.Header3.Filename); ok {
+		merged.Header3.Filename = stem
+	}
+	if stem, _, ok := splitSide(strings.TrimSuffix(left.Filename, filepath.Ext(left.Filename))); ok {
+		merged.Filename = stem + filepath.Ext(left.Filename)
+	}
+
+	return &merged, nil
+}
@@ -0,0 +1,68 @@
+// Package diskspace checks that a destination has room for the files of a conversion
+// before it starts, so large runs fail at once instead of partway through
+package diskspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsupported is returned by Free on systems whose free space can't be queried
+var ErrUnsupported = errors.New("free space can't be queried on this system")
+
+// ErrInsufficient is returned by Check when the destination is too small
+var ErrInsufficient = errors.New("not enough free space")
+
+// Check returns an error wrapping ErrInsufficient when the filesystem of dir has less
+// than need bytes available. dir doesn't have to exist yet, the space of its closest
+// existing parent is checked.
+func Check(dir string, need int64) error {
+	existing, err := closestExisting(dir)
+	if err != nil {
+		return err
+	}
+	free, err := Free(existing)
+	if err != nil {
+		return err
+	}
+	if uint64(need) > free {
+		return fmt.Errorf("%w in %s: %s needed, %s available", ErrInsufficient, existing, formatBytes(need), formatBytes(int64(free)))
+	}
+	return nil
+}
+
+// closestExisting returns dir or its closest parent which exists
+func closestExisting(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no existing directory found for %s", dir)
+		}
+		dir = parent
+	}
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package diskspace
+
+// Free returns ErrUnsupported, free space is only queried on Linux, macOS, FreeBSD
+// and Windows
+func Free(path string) (uint64, error) {
+	return 0, ErrUnsupported
+}
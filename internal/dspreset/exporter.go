@@ -0,0 +1,197 @@
+package dspreset
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/keymap"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/slices"
+)
+
+// Exporter writes DecentSampler presets referencing converted samples
+type Exporter struct {
+	debug bool
+	out   io.Writer // Destination of warnings and debug messages, see SetOutput
+}
+
+// NewExporter creates a new DecentSampler exporter
+func NewExporter(debug bool) *Exporter {
+	return &Exporter{
+		debug: debug,
+		out:   os.Stdout,
+	}
+}
+
+// SetOutput sets where warnings and debug messages are written, os.Stdout by default
+func (e *Exporter) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// Debug logs a message if debug mode is enabled
+func (e *Exporter) Debug(message string) {
+	if e.debug {
+		fmt.Fprintln(e.out, message)
+	}
+}
+
+// ExportDirectory scans dir for converted WAV/FLAC samples and writes <name>.dspreset into it,
+// mapping them as keymap.Map does with the root keys of the manifest of dir, if any.
+// It returns the path of the written preset.
+func (e *Exporter) ExportDirectory(dir, name string) (string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == slices.Dir {
+			// Slices of loops play the loop in pieces, they aren't samples of their own
+			return filepath.SkipDir
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !info.IsDir() && (ext == ".wav" || ext == ".flac") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error finding samples: %w", err)
+	}
+
+	if len(files) == 0 {
+		return "", fmt.Errorf("no samples found in %s", dir)
+	}
+	sort.Strings(files)
+
+	// Samples converted without a manifest, or missing from it, have no known root key
+	rootKeys := make(map[string]int)
+	if m, err := manifest.Load(dir); err == nil {
+		for _, sample := range m.Samples {
+			if sample.RootKey != nil {
+				rootKeys[sample.Output] = *sample.RootKey
+			}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		e.Debug(fmt.Sprintf("Error reading manifest, mapping samples without root keys: %v", err))
+	}
+
+	samples := make([]keymap.Sample, len(files))
+	for i, file := range files {
+		relPath, err := filepath.Rel(dir, file)
+		if err != nil {
+			return "", fmt.Errorf("error calculating relative path: %w", err)
+		}
+		samples[i] = keymap.Sample{Path: filepath.ToSlash(relPath), RootKey: -1}
+		if rootKey, ok := rootKeys[samples[i].Path]; ok {
+			samples[i].RootKey = rootKey
+		}
+	}
+
+	presetPath := filepath.Join(dir, name+".dspreset")
+	if err := e.Write(presetPath, name, samples); err != nil {
+		return "", err
+	}
+	return presetPath, nil
+}
+
+// Write writes a preset mapping samples, given as paths relative to the preset with
+// forward slashes, as ExportDirectory does
+func (e *Exporter) Write(presetPath, name string, samples []keymap.Sample) error {
+	content, err := e.encode(name, samples)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(presetPath, content, 0644); err != nil {
+		return fmt.Errorf("error writing preset: %w", err)
+	}
+	return nil
+}
+
+// Encode writes the preset Write would write to w
+func (e *Exporter) Encode(w io.Writer, name string, samples []keymap.Sample) error {
+	content, err := e.encode(name, samples)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(content); err != nil {
+		return fmt.Errorf("error writing preset: %w", err)
+	}
+	return nil
+}
+
+// encode returns the XML of the preset mapping samples
+func (e *Exporter) encode(name string, samples []keymap.Sample) ([]byte, error) {
+	zones, dropped := keymap.Map(samples)
+	if dropped > 0 {
+		fmt.Fprintf(e.out, "Warning: %d samples don't fit on the keyboard and were left out of %s.dspreset\n",
+			dropped, name)
+	}
+
+	// Single-sample zones share one group, round robin zones each get their own group
+	plain := Group{Name: name}
+	var roundRobins []Group
+	for _, z := range zones {
+		if !z.RoundRobin() {
+			plain.Samples = append(plain.Samples, sample(z, z.Samples[0]))
+			continue
+		}
+
+		e.Debug(fmt.Sprintf("Round robin detected for %s (%d samples)", z.Name, len(z.Samples)))
+		group := Group{
+			Name:      z.Name,
+			SeqMode:   "round_robin",
+			SeqLength: len(z.Samples),
+		}
+		for j, path := range z.Samples {
+			s := sample(z, path)
+			s.SeqPosition = j + 1
+			group.Samples = append(group.Samples, s)
+		}
+		roundRobins = append(roundRobins, group)
+	}
+
+	preset := Preset{
+		MinVersion: "1.0.0",
+		UI: UI{
+			Width:  812,
+			Height: 375,
+			Tab: Tab{
+				Name: "main",
+				Labels: []Label{
+					{X: 20, Y: 20, Width: 772, Height: 40, Text: name, TextSize: 24},
+				},
+			},
+		},
+	}
+	if len(plain.Samples) > 0 {
+		preset.Groups.Groups = append(preset.Groups.Groups, plain)
+	}
+	preset.Groups.Groups = append(preset.Groups.Groups, roundRobins...)
+
+	output, err := xml.MarshalIndent(preset, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding preset: %w", err)
+	}
+
+	content := append([]byte(xml.Header), output...)
+	return append(content, '\n'), nil
+}
+
+// sample returns the sample at path playing the keys and velocities of z
+func sample(z keymap.Zone, path string) Sample {
+	return Sample{
+		Path:     path,
+		RootNote: z.Root,
+		LoNote:   z.LoNote,
+		HiNote:   z.HiNote,
+		LoVel:    z.LoVel,
+		HiVel:    z.HiVel,
+	}
+}
@@ -0,0 +1,58 @@
+package dspreset
+
+import "encoding/xml"
+
+// Preset represents the root element of a DecentSampler .dspreset file
+type Preset struct {
+	XMLName    xml.Name `xml:"DecentSampler"`
+	MinVersion string   `xml:"minVersion,attr"`
+	UI         UI       `xml:"ui"`
+	Groups     Groups   `xml:"groups"`
+}
+
+// UI represents the (minimal) user interface section of a preset
+type UI struct {
+	Width  int `xml:"width,attr"`
+	Height int `xml:"height,attr"`
+	Tab    Tab `xml:"tab"`
+}
+
+// Tab represents a UI tab
+type Tab struct {
+	Name   string  `xml:"name,attr"`
+	Labels []Label `xml:"label"`
+}
+
+// Label represents a static text label on a UI tab
+type Label struct {
+	X        int    `xml:"x,attr"`
+	Y        int    `xml:"y,attr"`
+	Width    int    `xml:"width,attr"`
+	Height   int    `xml:"height,attr"`
+	Text     string `xml:"text,attr"`
+	TextSize int    `xml:"textSize,attr"`
+}
+
+// Groups holds every sample group of the preset
+type Groups struct {
+	Groups []Group `xml:"group"`
+}
+
+// Group represents a set of samples sharing playback settings
+type Group struct {
+	Name      string   `xml:"name,attr,omitempty"`
+	SeqMode   string   `xml:"seqMode,attr,omitempty"`   // "round_robin" when samples rotate
+	SeqLength int      `xml:"seqLength,attr,omitempty"` // Number of round robin positions
+	Samples   []Sample `xml:"sample"`
+}
+
+// Sample represents a single mapped sample
+type Sample struct {
+	Path        string `xml:"path,attr"` // Relative to the .dspreset file, forward slashes
+	RootNote    int    `xml:"rootNote,attr"`
+	LoNote      int    `xml:"loNote,attr"`
+	HiNote      int    `xml:"hiNote,attr"`
+	LoVel       int    `xml:"loVel,attr"`
+	HiVel       int    `xml:"hiVel,attr"`
+	SeqPosition int    `xml:"seqPosition,attr,omitempty"`
+}
@@ -0,0 +1,34 @@
+package ebl_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+)
+
+// benchmarkFiles are typical samples: a one-shot and a 10 second stereo sample
+var benchmarkFiles = []testgen.Case{
+	{Name: "mono-1s", Options: testgen.Options{Name: "Kick", Frames: 44100}},
+	{Name: "stereo-10s", Options: testgen.Options{Name: "Pad C3", Frames: 441000, Stereo: true}},
+	{Name: "padded-trailer", Options: testgen.Options{Name: "Tom", Frames: 44100, HeaderPadding: 24, PaddedHeader4: true, Trailer: make([]byte, 36)}},
+}
+
+func BenchmarkRead(b *testing.B) {
+	for _, bc := range benchmarkFiles {
+		data := testgen.Generate(bc.Options)
+		b.Run(bc.Name, func(b *testing.B) {
+			parser := ebl.NewParser(false, false)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := parser.Read(bytes.NewReader(data), bc.Name+".ebl", int64(len(data)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				f.Release()
+			}
+		})
+	}
+}
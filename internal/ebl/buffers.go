@@ -0,0 +1,65 @@
+package ebl
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Channel buffers are pooled by power of two capacity, from 4 KiB to 64 MiB. Larger
+// and released buffers of other capacities are left to the garbage collector.
+const (
+	minBufferClass = 12
+	maxBufferClass = 26
+)
+
+var bufferPools [maxBufferClass + 1]sync.Pool
+
+// getBuffer returns a buffer of size bytes, reusing a released one when possible
+func getBuffer(size int) []byte {
+	if size <= 0 {
+		return make([]byte, 0)
+	}
+	class := bits.Len(uint(size - 1))
+	if class < minBufferClass {
+		class = minBufferClass
+	}
+	if class > maxBufferClass {
+		return make([]byte, size)
+	}
+
+	if b, ok := bufferPools[class].Get().(*[]byte); ok {
+		return (*b)[:size]
+	}
+	return make([]byte, size, 1<<class)
+}
+
+// putBuffer makes a buffer from getBuffer available again
+func putBuffer(b []byte) {
+	c := cap(b)
+	if c == 0 {
+		return
+	}
+	class := bits.Len(uint(c - 1))
+	if class < minBufferClass || class > maxBufferClass || c != 1<<class {
+		return
+	}
+	b = b[:0]
+	bufferPools[class].Put(&b)
+}
+
+// Release returns the audio buffers of the file to the pool shared by parsers, saving
+// allocations when converting large batches, and closes the file streamed audio is
+// read from. The audio data must not be used afterwards.
+func (f *EBLFile) Release() {
+	putBuffer(f.Channel1Data)
+	putBuffer(f.Channel2Data)
+	f.Channel1Data = nil
+	f.Channel2Data = nil
+
+	if f.closer != nil {
+		f.closer.Close()
+		f.closer = nil
+	}
+	f.Channel1Stream = nil
+	f.Channel2Stream = nil
+}
@@ -0,0 +1,174 @@
+package ebl
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Character sets names are decoded from
+const (
+	CharsetUTF16    = "UTF-16LE"
+	CharsetShiftJIS = "Shift-JIS"
+	CharsetLatin1   = "Latin-1"
+)
+
+// decodeName decodes a fixed size name field, returning the name and its character
+// set. Names are normally UTF-16LE, but some banks store them in a legacy 8-bit code
+// page, a single null terminating the bytes. Those fields are recognized by their
+// padding and decoded as Shift-JIS, or Latin-1 when they aren't valid Shift-JIS.
+func (p *Parser) decodeName(b []byte) (string, string) {
+	n := bytes.IndexByte(b, 0)
+	if n < 2 || !allZero(b[n:]) {
+		// UTF-16 text, ASCII names having a null high byte at index 1
+		return p.decodeUTF16(b), CharsetUTF16
+	}
+
+	// A null at an even offset could end UTF-16 text without Latin characters, which
+	// is kept unless the bytes are ASCII or hold double byte Shift-JIS characters, whose
+	// trail bytes can't be the high bytes of UTF-16 kana
+	narrow := b[:n]
+	if n%2 == 0 {
+		wide := p.decodeUTF16(b)
+		if plausibleUTF16(wide) && !isASCII(narrow) {
+			if name, ok := decodeShiftJIS(narrow); !ok || !hasDoubleByte(name) {
+				return wide, CharsetUTF16
+			}
+		}
+	}
+
+	if name, ok := decodeShiftJIS(narrow); ok {
+		return name, CharsetShiftJIS
+	}
+	return decodeLatin1(narrow), CharsetLatin1
+}
+
+// allZero reports whether b only holds null bytes
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isASCII reports whether b is printable ASCII text
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// hasDoubleByte reports whether a decoded Shift-JIS name holds characters encoded on
+// two bytes, which are neither ASCII nor half-width katakana
+func hasDoubleByte(s string) bool {
+	for _, r := range s {
+		if r > 0x7f && (r < 0xff61 || r > 0xff9f) {
+			return true
+		}
+	}
+	return false
+}
+
+// plausibleUTF16 reports whether s could be a name, rejecting the unpaired surrogates,
+// control and private use characters produced by decoding 8-bit text as UTF-16
+func plausibleUTF16(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeLatin1 decodes ISO 8859-1 bytes, which map to the first 256 code points
+func decodeLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// jisSymbols maps the cells of the first JIS X 0208 row, holding the punctuation and
+// marks used in Japanese names
+var jisSymbols = [...]rune{
+	1: '　', '、', '。', '，', '．', '・', '：', '；', '？', '！', '゛', '゜', '´', '｀', '¨', '＾',
+	'￣', '＿', 'ヽ', 'ヾ', 'ゝ', 'ゞ', '〃', '仝', '々', '〆', '〇', 'ー', '―', '‐', '／',
+}
+
+// decodeShiftJIS decodes Shift-JIS bytes, reporting false if they aren't valid. The
+// kanji rows of JIS X 0208 need a mapping table, so only ASCII, half-width katakana,
+// full-width letters and digits, kana and the common punctuation are decoded, names
+// using other characters falling back to Latin-1.
+func decodeShiftJIS(b []byte) (string, bool) {
+	runes := make([]rune, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c < 0x80:
+			if c < 0x20 || c == 0x7f {
+				return "", false
+			}
+			runes = append(runes, rune(c))
+		case c >= 0xa1 && c <= 0xdf:
+			// Half-width katakana
+			runes = append(runes, 0xff61+rune(c-0xa1))
+		case (c >= 0x81 && c <= 0x9f) || (c >= 0xe0 && c <= 0xef):
+			if i+1 == len(b) {
+				return "", false
+			}
+			r, ok := jisRune(c, b[i+1])
+			if !ok {
+				return "", false
+			}
+			runes = append(runes, r)
+			i++
+		default:
+			return "", false
+		}
+	}
+	return string(runes), true
+}
+
+// jisRune decodes a double byte Shift-JIS character from its JIS X 0208 row and cell
+func jisRune(lead, trail byte) (rune, bool) {
+	if trail < 0x40 || trail == 0x7f || trail > 0xfc {
+		return 0, false
+	}
+	var row, cell int
+	if lead <= 0x9f {
+		row = int(lead-0x81)*2 + 1
+	} else {
+		row = int(lead-0xc1)*2 + 1
+	}
+	switch {
+	case trail >= 0x9f:
+		row++
+		cell = int(trail) - 0x9e
+	case trail > 0x7f:
+		cell = int(trail) - 0x40
+	default:
+		cell = int(trail) - 0x3f
+	}
+
+	switch {
+	case row == 1 && cell < len(jisSymbols):
+		return jisSymbols[cell], true
+	case row == 3 && ((cell >= 16 && cell <= 25) || (cell >= 33 && cell <= 58) || (cell >= 65 && cell <= 90)):
+		// Full-width digits and letters, at the cells of their ASCII counterparts
+		return 0xff00 + rune(cell), true
+	case row == 4 && cell >= 1 && cell <= 83:
+		return 0x3041 + rune(cell-1), true
+	case row == 5 && cell >= 1 && cell <= 86:
+		return 0x30a1 + rune(cell-1), true
+	}
+	return 0, false
+}
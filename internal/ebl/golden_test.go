@@ -0,0 +1,196 @@
+package ebl_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files")
+
+// TestGolden parses the synthetic variants, checks the decoded PCM against the
+// generated audio and compares the decoded headers with testdata/golden
+func TestGolden(t *testing.T) {
+	for _, tc := range testgen.Cases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			data := testgen.Generate(tc.Options)
+			f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), tc.Name+".ebl", int64(len(data)))
+			if err != nil {
+				t.Fatalf("error parsing: %v", err)
+			}
+
+			channel1, channel2 := tc.Options.Channels()
+			if !bytes.Equal(f.Channel1Data, channel1) {
+				t.Errorf("channel 1 differs from the generated audio (%d bytes, expected %d)", len(f.Channel1Data), len(channel1))
+			}
+			if !bytes.Equal(f.Channel2Data, channel2) {
+				t.Errorf("channel 2 differs from the generated audio (%d bytes, expected %d)", len(f.Channel2Data), len(channel2))
+			}
+
+			compareGolden(t, filepath.Join("testdata", "golden", tc.Name+".golden"), describe(f))
+		})
+	}
+}
+
+// describe returns the decoded headers of a file as text
+func describe(f *ebl.EBLFile) string {
+	var b strings.Builder
+	h := f.HeaderData
+	fmt.Fprintf(&b, "Name: %q\n", f.Name())
+	fmt.Fprintf(&b, "Comment: %q\n", h.CommentStr)
+	fmt.Fprintf(&b, "Header1: FileSize=%d\n", f.Header1.FileSize)
+	fmt.Fprintf(&b, "Header2: Prefix=%s NextHeaderBytes=%d\n", f.Header2.Prefix, f.Header2.NextHeaderBytes)
+	fmt.Fprintf(&b, "Header3: DataSize=%d Data=%d Filename=%q\n", f.Header3.DataSize, f.Header3.Data, f.Header3.Filename)
+	fmt.Fprintf(&b, "Padding: %d\n", f.Padding)
+	fmt.Fprintf(&b, "Header4: Size=%d Data=%x\n", f.Header4.Size, f.Header4.Data)
+	fmt.Fprintf(&b, "V1-V5: %d %d %d %d %d\n", h.V1, h.V2, h.V3, h.V4, h.V5)
+	fmt.Fprintf(&b, "V6-V9: %d %d %d %d\n", h.V6, h.V7, h.V8, h.V9)
+	fmt.Fprintf(&b, "SampleRate: %d\n", h.SampleRate)
+	fmt.Fprintf(&b, "V11-V12: %d %d\n", h.V11, h.V12)
+	fmt.Fprintf(&b, "Channels: %d (%d + %d bytes)\n", f.Channels(), f.Channel1Size, f.Channel2Size)
+	fmt.Fprintf(&b, "Frames: %d\n", f.Frames())
+	fmt.Fprintf(&b, "Channel1: sha256:%x\n", sha256.Sum256(f.Channel1Data))
+	fmt.Fprintf(&b, "Channel2: sha256:%x\n", sha256.Sum256(f.Channel2Data))
+	fmt.Fprintf(&b, "RootKey: %d (%s)\n", f.RootKey, ebl.NoteName(f.RootKey))
+	fmt.Fprintf(&b, "Variant: %s\n", f.Version)
+	fmt.Fprintf(&b, "Regions: %v\n", f.Regions())
+	fmt.Fprintf(&b, "Trailer: %x\n", f.Trailer)
+	for _, chunk := range f.ExtraChunks {
+		fmt.Fprintf(&b, "Chunk: %s %x\n", chunk.ID, chunk.Data)
+	}
+	fmt.Fprintf(&b, "Read: %d of %d bytes\n", f.Read, f.Size)
+	for _, issue := range f.Verify() {
+		fmt.Fprintf(&b, "Issue: %s\n", issue)
+	}
+	for _, warning := range f.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", warning)
+	}
+	return b.String()
+}
+
+// TestHeaderOffsets pins the byte accounting of a standard file: Header 3 spans 78
+// bytes and ends at the offset of Header 4 it gives, leaving no padding to scan
+func TestHeaderOffsets(t *testing.T) {
+	options := testgen.Options{Name: "Kick", Frames: 441}
+	data := testgen.Generate(options)
+	f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), "Kick.ebl", int64(len(data)))
+	if err != nil {
+		t.Fatalf("error parsing: %v", err)
+	}
+
+	if f.Header3.Read != 78 {
+		t.Errorf("Header 3 read %d bytes, expected 78", f.Header3.Read)
+	}
+	if f.Header3.Data != 98 {
+		t.Errorf("Header 4 at offset %d, expected 98", f.Header3.Data)
+	}
+	if f.Padding != 0 {
+		t.Errorf("%d bytes of padding after Header 3, expected none", f.Padding)
+	}
+	if f.Version.Padded {
+		t.Error("Header 4 found in the padding of a standard file")
+	}
+	// Header 4 (14 bytes) and the header data (176 bytes) precede the audio
+	if f.AudioOffset != 98+14+176 {
+		t.Errorf("audio at offset %d, expected %d", f.AudioOffset, 98+14+176)
+	}
+	if f.Read != f.Size {
+		t.Errorf("read %d of %d bytes", f.Read, f.Size)
+	}
+}
+
+// TestStrict checks that strict mode fails exactly the variants parsed with warnings
+func TestStrict(t *testing.T) {
+	for _, tc := range testgen.Cases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			data := testgen.Generate(tc.Options)
+			f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), tc.Name+".ebl", int64(len(data)))
+			if err != nil {
+				t.Fatalf("error parsing: %v", err)
+			}
+
+			strict := ebl.NewParser(false, false)
+			strict.SetStrict(true)
+			_, err = strict.Read(bytes.NewReader(data), tc.Name+".ebl", int64(len(data)))
+			switch {
+			case len(f.Warnings) == 0 && err != nil:
+				t.Errorf("strict parsing failed without warnings: %v", err)
+			case len(f.Warnings) > 0 && !errors.Is(err, ebl.ErrStrict):
+				t.Errorf("strict parsing returned %v, expected ErrStrict for %q", err, f.Warnings)
+			}
+		})
+	}
+}
+
+// TestRetry checks that files failing the standard parse are read by the alternate
+// strategies when the parser can read them again
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  testgen.Options
+		strategy ebl.Strategy
+	}{
+		{"extra-header", testgen.Options{Name: "Organ", Frames: 300, Stereo: true, ExtraHeader: 40}, ebl.StrategyExtraHeader},
+		{"padded-header4", testgen.Options{Name: "Flute", Frames: 300, HeaderPadding: 16, ExtraHeader: 8}, ebl.StrategyPaddedHeader4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data := testgen.Generate(tc.options)
+			parser := ebl.NewParser(false, false)
+			if _, err := parser.Read(bytes.NewReader(data), tc.name+".ebl", int64(len(data))); err == nil {
+				t.Fatal("standard parse succeeded, expected it to fail without a source to retry from")
+			}
+
+			f, err := parser.ReadSource(bytes.NewReader(data), bytes.NewReader(data), tc.name+".ebl", int64(len(data)))
+			if err != nil {
+				t.Fatalf("error parsing with retries: %v", err)
+			}
+			if f.Strategy != tc.strategy {
+				t.Errorf("parsed with the %s strategy, expected %s", f.Strategy, tc.strategy)
+			}
+			channel1, channel2 := tc.options.Channels()
+			if !bytes.Equal(f.Channel1Data, channel1) || !bytes.Equal(f.Channel2Data, channel2) {
+				t.Error("decoded audio differs from the generated audio")
+			}
+			if f.Read != f.Size {
+				t.Errorf("read %d of %d bytes", f.Read, f.Size)
+			}
+
+			parser.SetRetry(false)
+			if _, err := parser.ReadSource(bytes.NewReader(data), bytes.NewReader(data), tc.name+".ebl", int64(len(data))); err == nil {
+				t.Error("parse succeeded with retries disabled")
+			}
+		})
+	}
+}
+
+// compareGolden compares got with the content of a golden file, rewriting it with -update
+func compareGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading golden file, run go test -update to create it: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s--- want\n%s", path, got, want)
+	}
+}
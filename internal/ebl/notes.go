@@ -0,0 +1,52 @@
+package ebl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// notePattern matches a note name such as "C3", "F#2" or "Bb-1" delimited by spaces, dashes or underscores
+var notePattern = regexp.MustCompile(`(?:^|[\s_\-])([A-Ga-g])([#b]?)(-?[0-9])(?:$|[\s_\-\.])`)
+
+// noteOffsets maps note letters to semitones above C
+var noteOffsets = map[string]int{"c": 0, "d": 2, "e": 4, "f": 5, "g": 7, "a": 9, "b": 11}
+
+// ParseNoteName returns the MIDI note number of the last note name found in s.
+// Octaves follow the E-MU convention where C3 is middle C (MIDI note 60).
+func ParseNoteName(s string) (int, bool) {
+	matches := notePattern.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	m := matches[len(matches)-1]
+
+	octave, err := strconv.Atoi(m[3])
+	if err != nil {
+		return 0, false
+	}
+
+	note := noteOffsets[strings.ToLower(m[1])] + (octave+2)*12
+	switch m[2] {
+	case "#":
+		note++
+	case "b":
+		note--
+	}
+
+	if note < 0 || note > 127 {
+		return 0, false
+	}
+	return note, true
+}
+
+// noteNames lists the note names of an octave, using sharps
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// NoteName returns the name of a MIDI note number, e.g. "C3" for 60 (E-MU convention)
+func NoteName(note int) string {
+	if note < 0 || note > 127 {
+		return ""
+	}
+	return noteNames[note%12] + strconv.Itoa(note/12-2)
+}
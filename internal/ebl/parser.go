@@ -1,34 +1,86 @@
 package ebl
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"unicode/utf16"
 )
 
+// ErrInvalidFormat is returned when a file doesn't have the expected EBL chunk layout
+var ErrInvalidFormat = errors.New("invalid EBL file")
+
+// ErrStrict is returned in strict mode for files the parser had to work around
+// irregularities of, see SetStrict
+var ErrStrict = errors.New("EBL file not strictly valid")
+
 // Parser handles reading and parsing EBL files
 type Parser struct {
-	debug     bool
-	errorSave bool
+	debug           bool
+	out             io.Writer // Destination of debug messages, see SetOutput
+	errorSave       bool
+	streamThreshold int64 // Audio larger than this is streamed from the file, 0 to always load it
+	headersOnly     bool  // Stop before the audio data, see SetHeadersOnly
+	strict          bool  // Fail files with warnings, see SetStrict
+	retry           bool  // Retry failed files with the alternate strategies, see SetRetry
 }
 
 // NewParser creates a new EBL parser
 func NewParser(debug, errorSave bool) *Parser {
 	return &Parser{
 		debug:     debug,
+		out:       os.Stdout,
 		errorSave: errorSave,
+		retry:     true,
 	}
 }
 
+// SetOutput sets where debug messages are written, os.Stdout by default
+func (p *Parser) SetOutput(w io.Writer) {
+	p.out = w
+}
+
+// SetStreamThreshold makes ReadFile and ReadSource leave the audio of files holding
+// more than n bytes of it in the file, read back in chunks when encoding, so memory
+// use stays bounded for long samples. 0 always loads the audio.
+func (p *Parser) SetStreamThreshold(n int64) {
+	p.streamThreshold = n
+}
+
+// SetHeadersOnly makes the parser stop before the channel data, returning files with
+// their headers, sizes and trailer but no audio. Metadata scans of large collections
+// then read a few hundred bytes per file instead of the whole sample.
+func (p *Parser) SetHeadersOnly(headersOnly bool) {
+	p.headersOnly = headersOnly
+}
+
+// SetStrict makes the parser fail the files it had to work around irregularities of,
+// listed in EBLFile.Warnings, with an error wrapping ErrStrict. Only files whose
+// layout is fully understood are then returned.
+func (p *Parser) SetStrict(strict bool) {
+	p.strict = strict
+}
+
+// SetRetry sets whether files failing to parse with the standard strategy are parsed
+// again with the AlternateStrategies before returning the error, which is the default.
+// Retries read the file again from the src given to ReadSource, streams without src
+// aren't retried, and neither are files in strict mode.
+func (p *Parser) SetRetry(retry bool) {
+	p.retry = retry
+}
+
 // Debug logs a message if debug mode is enabled
 func (p *Parser) Debug(message string) {
 	if p.debug {
-		fmt.Println(message)
+		fmt.Fprintln(p.out, message)
 	}
 }
 
@@ -60,30 +112,112 @@ func (p *Parser) decodeUTF16(b []byte) string {
 	return strings.TrimRight(string(runes), "\x00")
 }
 
-// ReadFile reads and parses an EBL file
+// readBufferSize is large enough to hold the header region of nearly every EBL file,
+// so headers are decoded from memory after a single read
+const readBufferSize = 64 * 1024
+
+// readerPool holds the buffered readers used by Read
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, readBufferSize)
+	},
+}
+
+// maxTrailerSize is the largest amount of data following the audio that is kept as a trailer
+const maxTrailerSize = 64 * 1024
+
+// readUint32 reads a single unsigned 32-bit integer
+func readUint32(r io.Reader, order binary.ByteOrder) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return order.Uint32(b[:]), nil
+}
+
+// ReadFile reads and parses an EBL file. The file stays open until Release when its
+// audio is streamed.
 func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	file, err := os.Open(inputFile)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file: %w", err)
 	}
-	defer file.Close()
 
 	// Get file size
 	fileInfo, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, fmt.Errorf("error getting file info: %w", err)
 	}
 
+	eblFile, err := p.ReadSource(file, file, inputFile, fileInfo.Size())
+	if err != nil || !eblFile.Streamed() {
+		file.Close()
+	}
+	return eblFile, err
+}
+
+// Read parses an EBL stream of the given size. path is only used to name the file.
+func (p *Parser) Read(reader io.Reader, path string, fileSize int64) (*EBLFile, error) {
+	return p.ReadSource(reader, nil, path, fileSize)
+}
+
+// ReadHeader parses the headers of an EBL stream like Read in headers-only mode (see
+// SetHeadersOnly), so the sizes and details of large samples are known without
+// reading them. The returned file holds no audio.
+func (p *Parser) ReadHeader(reader io.Reader, path string, fileSize int64) (*EBLFile, error) {
+	headers := *p
+	headers.headersOnly = true
+	return headers.ReadSource(reader, nil, path, fileSize)
+}
+
+// ReadSource parses an EBL stream like Read. src gives random access to the same
+// file, when the audio is larger than the stream threshold it isn't loaded but left
+// in src, which must stay open until the file is encoded and is closed by Release if
+// it is an io.Closer. src may be nil.
+//
+// Files failing to parse are retried with the AlternateStrategies when src is given,
+// see SetRetry. The strategy reading the file is recorded in EBLFile.Strategy.
+func (p *Parser) ReadSource(reader io.Reader, src io.ReaderAt, path string, fileSize int64) (*EBLFile, error) {
+	eblFile, err := p.read(reader, src, path, fileSize, StrategyStandard)
+	if err == nil || !p.retry || p.strict || src == nil {
+		return eblFile, err
+	}
+
+	for _, strategy := range AlternateStrategies {
+		p.Debug(fmt.Sprintf("Retrying %s with the %s strategy after: %v", path, strategy, err))
+		retried, retryErr := p.read(io.NewSectionReader(src, 0, fileSize), src, path, fileSize, strategy)
+		if retryErr != nil {
+			p.Debug(fmt.Sprintf("The %s strategy failed: %v", strategy, retryErr))
+			continue
+		}
+		retried.warn("parsed with the %s strategy after the standard parse failed: %v", strategy, err)
+		return retried, nil
+	}
+	return nil, err
+}
+
+// read parses an EBL stream like ReadSource, locating Header 4 with strategy
+func (p *Parser) read(reader io.Reader, src io.ReaderAt, path string, fileSize int64, strategy Strategy) (*EBLFile, error) {
+	r := readerPool.Get().(*bufio.Reader)
+	r.Reset(reader)
+	defer func() {
+		r.Reset(nil)
+		readerPool.Put(r)
+	}()
+	var err error
+
 	eblFile := &EBLFile{
-		Filename: filepath.Base(inputFile),
-		Path:     inputFile,
-		Size:     fileInfo.Size(),
+		Filename: filepath.Base(path),
+		Path:     path,
+		Size:     fileSize,
 		Read:     0,
+		Strategy: strategy,
 	}
 
 	// Read Header 1 (8 bytes)
 	prefix := make([]byte, 4)
-	if _, err := file.Read(prefix); err != nil {
+	if _, err := io.ReadFull(r, prefix); err != nil {
 		return nil, fmt.Errorf("error reading prefix: %w", err)
 	}
 
@@ -95,11 +229,11 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 		if p.debug {
 			p.Debug(fmt.Sprintf("Invalid Header 1 prefix. Expected 'FORM', got:\n%s", p.dumpHex(prefix, 4)))
 		}
-		return nil, fmt.Errorf("invalid EBL file: expected FORM prefix, got %s (hex: %x)", string(prefix), prefix)
+		return nil, fmt.Errorf("%w: expected FORM prefix, got %s (hex: %x)", ErrInvalidFormat, string(prefix), prefix)
 	}
 
 	var filesize uint32
-	if err := binary.Read(file, binary.BigEndian, &filesize); err != nil {
+	if filesize, err = readUint32(r, binary.BigEndian); err != nil {
 		return nil, fmt.Errorf("error reading file size: %w", err)
 	}
 
@@ -116,7 +250,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 
 	// Read Header 2 (12 bytes)
 	prefix2 := make([]byte, 8)
-	if _, err := file.Read(prefix2); err != nil {
+	if _, err := io.ReadFull(r, prefix2); err != nil {
 		return nil, fmt.Errorf("error reading header 2 prefix: %w", err)
 	}
 
@@ -124,18 +258,24 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 		p.Debug(fmt.Sprintf("Header 2 prefix: %s (hex: %x)", string(prefix2), prefix2))
 	}
 
-	if string(prefix2) != "E5B0TOC2" {
+	if !strings.HasPrefix(string(prefix2), "E5B0TOC") || prefix2[7] < '0' || prefix2[7] > '9' {
 		if p.debug {
 			p.Debug(fmt.Sprintf("Invalid Header 2 prefix. Expected 'E5B0TOC2', got:\n%s", p.dumpHex(prefix2, 8)))
 		}
-		return nil, fmt.Errorf("invalid EBL file: expected E5B0TOC2 prefix, got %s (hex: %x)", string(prefix2), prefix2)
+		return nil, fmt.Errorf("%w: expected E5B0TOC2 prefix, got %s (hex: %x)", ErrInvalidFormat, string(prefix2), prefix2)
 	}
 
 	var nextHeaderBytes uint32
-	if err := binary.Read(file, binary.BigEndian, &nextHeaderBytes); err != nil {
+	if nextHeaderBytes, err = readUint32(r, binary.BigEndian); err != nil {
 		return nil, fmt.Errorf("error reading next header bytes: %w", err)
 	}
 
+	eblFile.Version.TOC = int(prefix2[7] - '0')
+	if eblFile.Version.TOC != 2 {
+		p.Debug(fmt.Sprintf("WARN: Unknown TOC revision %d", eblFile.Version.TOC))
+		eblFile.warn("unknown TOC revision %d", eblFile.Version.TOC)
+	}
+
 	if p.debug {
 		p.Debug(fmt.Sprintf("Header 2 nextHeaderBytes: %d", nextHeaderBytes))
 	}
@@ -149,7 +289,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 
 	// Read Header 3 (78 bytes)
 	prefix3 := make([]byte, 4)
-	if _, err := file.Read(prefix3); err != nil {
+	if _, err := io.ReadFull(r, prefix3); err != nil {
 		return nil, fmt.Errorf("error reading header 3 prefix: %w", err)
 	}
 
@@ -161,14 +301,14 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 		if p.debug {
 			p.Debug(fmt.Sprintf("Invalid Header 3 prefix. Expected 'E5S1', got:\n%s", p.dumpHex(prefix3, 4)))
 		}
-		return nil, fmt.Errorf("invalid EBL file: expected E5S1 prefix, got %s (hex: %x)", string(prefix3), prefix3)
+		return nil, fmt.Errorf("%w: expected E5S1 prefix, got %s (hex: %x)", ErrInvalidFormat, string(prefix3), prefix3)
 	}
 
 	var dataSize, data uint32
-	if err := binary.Read(file, binary.BigEndian, &dataSize); err != nil {
+	if dataSize, err = readUint32(r, binary.BigEndian); err != nil {
 		return nil, fmt.Errorf("error reading data size: %w", err)
 	}
-	if err := binary.Read(file, binary.BigEndian, &data); err != nil {
+	if data, err = readUint32(r, binary.BigEndian); err != nil {
 		return nil, fmt.Errorf("error reading data: %w", err)
 	}
 
@@ -177,17 +317,20 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	}
 
 	zeros := make([]byte, 2)
-	if _, err := file.Read(zeros); err != nil {
+	if _, err := io.ReadFull(r, zeros); err != nil {
 		return nil, fmt.Errorf("error reading zeros: %w", err)
 	}
 
 	filenameBytes := make([]byte, 64)
-	if _, err := file.Read(filenameBytes); err != nil {
+	if _, err := io.ReadFull(r, filenameBytes); err != nil {
 		return nil, fmt.Errorf("error reading filename: %w", err)
 	}
 
-	// Decode filename using UTF-16LE instead of UTF-8
-	filename := p.decodeUTF16(filenameBytes)
+	// Decode filename using UTF-16LE instead of UTF-8, or the legacy code page of the bank
+	filename, charset := p.decodeName(filenameBytes)
+	if charset != CharsetUTF16 {
+		p.Debug(fmt.Sprintf("Filename decoded as %s: %s", charset, filename))
+	}
 
 	eblFile.Header3 = Header3{
 		Prefix:   prefix3,
@@ -195,16 +338,25 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 		Data:     int(data),
 		Zeros:    zeros,
 		Filename: filename,
-		Read:     74,
+		Read:     78,
 	}
-	eblFile.Read += 74
+	eblFile.Read += 78
 
 	if p.debug {
 		p.Debug(fmt.Sprintf("Header 3 filename: %s", filename))
 	}
 
-	// Handle padding if necessary
+	// Handle padding if necessary, the alternate strategies ignoring the offset of
+	// Header 4 given by Header 3
 	header3Padding := eblFile.Header3.Data - int(eblFile.Read)
+	switch strategy {
+	case StrategyExtraHeader:
+		header3Padding = extraHeaderSize
+	case StrategyPaddedHeader4:
+		if header3Padding, err = scanHeader4(r); err != nil {
+			return nil, err
+		}
+	}
 
 	// Initialize our flags for header 4 detection
 	foundHeader4InPadding := false
@@ -213,13 +365,14 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 
 	if header3Padding > 0 {
 		eblFile.Padding = header3Padding
+		eblFile.warn("%d bytes of padding after Header 3", header3Padding)
 		padding := make([]byte, header3Padding)
 
 		if p.debug {
 			p.Debug(fmt.Sprintf("Reading %d bytes of padding after Header 3", header3Padding))
 		}
 
-		bytesRead, err := file.Read(padding)
+		bytesRead, err := io.ReadFull(r, padding)
 		if err != nil {
 			if p.debug {
 				p.Debug(fmt.Sprintf("Error reading padding: %v (read %d of %d bytes)", err, bytesRead, header3Padding))
@@ -244,6 +397,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 				p.Debug(fmt.Sprintf("Found Header 4 prefix (E5S1) in the padding bytes at position %d", header4PrefixPos))
 			}
 			foundHeader4InPadding = true
+			eblFile.Version.Padded = true
 			header4PrefixFromPadding = []byte("E5S1") // Use the actual E5S1 string
 
 			// If we have enough bytes after the prefix, also grab the size field
@@ -273,7 +427,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 			size = binary.BigEndian.Uint32(header4SizeBytes)
 		} else {
 			// Otherwise we need to read the size
-			if err := binary.Read(file, binary.BigEndian, &size); err != nil {
+			if size, err = readUint32(r, binary.BigEndian); err != nil {
 				return nil, fmt.Errorf("error reading size after found header 4 prefix: %w", err)
 			}
 		}
@@ -285,7 +439,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	} else {
 		// Read Header 4 (14 bytes) - normal flow
 		prefix4 = make([]byte, 4)
-		bytesRead, err := file.Read(prefix4)
+		bytesRead, err := io.ReadFull(r, prefix4)
 		if err != nil {
 			if p.debug {
 				p.Debug(fmt.Sprintf("Error reading header 4 prefix: %v (read %d of 4 bytes)", err, bytesRead))
@@ -304,16 +458,16 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 			if p.debug {
 				// Try to examine what's next in the file to aid in debugging
 				remainingBytes := make([]byte, 20)
-				remainingBytesRead, _ := file.Read(remainingBytes)
+				remainingBytesRead, _ := r.Read(remainingBytes)
 
 				p.Debug(fmt.Sprintf("Invalid Header 4 prefix. Expected 'E5S1', got '%s' (hex: %x)", string(prefix4), prefix4))
 				p.Debug(fmt.Sprintf("Next %d bytes after invalid Header 4 prefix:\n%s",
 					remainingBytesRead, p.dumpHex(remainingBytes[:remainingBytesRead], remainingBytesRead)))
 			}
-			return nil, fmt.Errorf("invalid EBL file: expected E5S1 prefix, got %s (hex: %x)", string(prefix4), prefix4)
+			return nil, fmt.Errorf("%w: expected E5S1 prefix, got %s (hex: %x)", ErrInvalidFormat, string(prefix4), prefix4)
 		}
 
-		if err := binary.Read(file, binary.BigEndian, &size); err != nil {
+		if size, err = readUint32(r, binary.BigEndian); err != nil {
 			return nil, fmt.Errorf("error reading size: %w", err)
 		}
 
@@ -323,7 +477,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	}
 
 	data4 := make([]byte, 6)
-	if _, err := file.Read(data4); err != nil {
+	if _, err := io.ReadFull(r, data4); err != nil {
 		return nil, fmt.Errorf("error reading data: %w", err)
 	}
 
@@ -351,62 +505,43 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 
 	// Read Header Data
 	filenameBytes2 := make([]byte, 64)
-	if _, err := file.Read(filenameBytes2); err != nil {
+	if _, err := io.ReadFull(r, filenameBytes2); err != nil {
 		return nil, fmt.Errorf("error reading filename: %w", err)
 	}
 
 	// This second filename should also be decoded as UTF-16LE
-	filename2 := p.decodeUTF16(filenameBytes2)
+	filename2, _ := p.decodeName(filenameBytes2)
 
-	if p.debug && filename != filename2 {
+	if filename != filename2 {
 		p.Debug(fmt.Sprintf("Filename mismatch: Header3=%s, HeaderData=%s", filename, filename2))
-	}
-
-	var v1, v2, v3, v4, v5, v6, v7, v8, v9, sampleRate, v11, v12 uint32
-	if err := binary.Read(file, binary.LittleEndian, &v1); err != nil {
-		return nil, fmt.Errorf("error reading v1: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v2); err != nil {
-		return nil, fmt.Errorf("error reading v2: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v3); err != nil {
-		return nil, fmt.Errorf("error reading v3: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v4); err != nil {
-		return nil, fmt.Errorf("error reading v4: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v5); err != nil {
-		return nil, fmt.Errorf("error reading v5: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v6); err != nil {
-		return nil, fmt.Errorf("error reading v6: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v7); err != nil {
-		return nil, fmt.Errorf("error reading v7: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v8); err != nil {
-		return nil, fmt.Errorf("error reading v8: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v9); err != nil {
-		return nil, fmt.Errorf("error reading v9: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &sampleRate); err != nil {
-		return nil, fmt.Errorf("error reading frequency: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v11); err != nil {
-		return nil, fmt.Errorf("error reading v11: %w", err)
-	}
-	if err := binary.Read(file, binary.LittleEndian, &v12); err != nil {
-		return nil, fmt.Errorf("error reading v12: %w", err)
-	}
+		eblFile.warn("filename mismatch between Header3 (%q) and HeaderData (%q)", filename, filename2)
+	}
+
+	// Decode the 12 little endian values V1-V12 from a single read
+	values := make([]byte, 48)
+	if _, err := io.ReadFull(r, values); err != nil {
+		return nil, fmt.Errorf("error reading header data values: %w", err)
+	}
+	v1 := binary.LittleEndian.Uint32(values[0:])
+	v2 := binary.LittleEndian.Uint32(values[4:])
+	v3 := binary.LittleEndian.Uint32(values[8:])
+	v4 := binary.LittleEndian.Uint32(values[12:])
+	v5 := binary.LittleEndian.Uint32(values[16:])
+	v6 := binary.LittleEndian.Uint32(values[20:])
+	v7 := binary.LittleEndian.Uint32(values[24:])
+	v8 := binary.LittleEndian.Uint32(values[28:])
+	v9 := binary.LittleEndian.Uint32(values[32:])
+	sampleRate := binary.LittleEndian.Uint32(values[36:])
+	v11 := binary.LittleEndian.Uint32(values[40:])
+	v12 := binary.LittleEndian.Uint32(values[44:])
 
 	comment := make([]byte, 64)
-	if _, err := file.Read(comment); err != nil {
+	if _, err := io.ReadFull(r, comment); err != nil {
 		return nil, fmt.Errorf("error reading comment: %w", err)
 	}
 
 	// Also decode the comment as UTF-16LE
-	commentStr := p.decodeUTF16(comment)
+	commentStr, _ := p.decodeName(comment)
 
 	if p.debug {
 		p.Debug(fmt.Sprintf("HeaderData values: v1=%d, v2=%d, v3=%d, v4=%d, v5=%d, frequency=%d",
@@ -437,6 +572,19 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	}
 	eblFile.Read += 176
 
+	// The header field holding the root key hasn't been identified yet,
+	// fall back to note names embedded in the sample name (e.g. "Piano C3")
+	eblFile.RootKey = -1
+	for _, name := range []string{filename2, filename} {
+		if note, ok := ParseNoteName(name); ok {
+			eblFile.RootKey = note
+			if p.debug {
+				p.Debug(fmt.Sprintf("Root key %d detected from name %q", note, name))
+			}
+			break
+		}
+	}
+
 	// Calculate channel sizes
 	eblFile.Channel1Size = eblFile.HeaderData.V3 - eblFile.HeaderData.V2
 	eblFile.Channel2Size = eblFile.HeaderData.V5 - eblFile.HeaderData.V4
@@ -457,6 +605,7 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	} else {
 		if eblFile.Channel1Size*eblFile.Channel2Size != 0 {
 			p.Debug(fmt.Sprintf("Error: Channels Different length. C1: %d, C2: %d", eblFile.Channel1Size, eblFile.Channel2Size))
+			eblFile.warn("channels differ in length (%d and %d bytes)", eblFile.Channel1Size, eblFile.Channel2Size)
 		}
 	}
 
@@ -466,8 +615,9 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 	dataPadding := eblFile.HeaderData.V5 - eblFile.DataSizeCalc - 178
 	if dataPadding > 0 {
 		p.Debug(fmt.Sprintf("Reading %d bytes of data padding", dataPadding))
+		eblFile.warn("%d bytes of padding before the audio data", dataPadding)
 		padding := make([]byte, dataPadding)
-		if _, err := file.Read(padding); err != nil {
+		if _, err := io.ReadFull(r, padding); err != nil {
 			return nil, fmt.Errorf("error reading data padding: %w", err)
 		}
 		eblFile.Read += int64(dataPadding)
@@ -481,58 +631,185 @@ func (p *Parser) ReadFile(inputFile string, errorDir string) (*EBLFile, error) {
 			eblFile.Channel1Size, eblFile.Channel2Size))
 	}
 
-	// Read audio data
-	eblFile.Channel1Data = make([]byte, eblFile.Channel1Size)
-	bytesRead, err := io.ReadFull(file, eblFile.Channel1Data)
-	if err != nil {
-		if p.debug {
-			p.Debug(fmt.Sprintf("Error reading channel 1 data: %v (read %d of %d bytes)",
-				err, bytesRead, eblFile.Channel1Size))
-		}
-		return nil, fmt.Errorf("error reading channel 1 data: %w (read %d of %d bytes)",
-			err, bytesRead, eblFile.Channel1Size)
+	// Read audio data, or skip over it when streaming it from src
+	eblFile.AudioOffset = eblFile.Read
+	if p.headersOnly {
+		return p.skipAudio(eblFile, src)
 	}
-	eblFile.Read += int64(eblFile.Channel1Size)
 
-	eblFile.Channel2Data = make([]byte, eblFile.Channel2Size)
-	bytesRead, err = io.ReadFull(file, eblFile.Channel2Data)
-	if err != nil {
-		if p.debug {
-			p.Debug(fmt.Sprintf("Error reading channel 2 data: %v (read %d of %d bytes)",
-				err, bytesRead, eblFile.Channel2Size))
+	stream := src != nil && p.streamThreshold > 0 && int64(eblFile.DataSizeCalc) > p.streamThreshold
+	if stream {
+		p.Debug(fmt.Sprintf("Streaming %d bytes of audio data from the file", eblFile.DataSizeCalc))
+	}
+
+	for i, size := range []int{eblFile.Channel1Size, eblFile.Channel2Size} {
+		var data []byte
+		var bytesRead int
+		var err error
+		if stream {
+			var n int64
+			n, err = io.CopyN(io.Discard, r, int64(size))
+			bytesRead = int(n)
+		} else {
+			data = getBuffer(size)
+			bytesRead, err = io.ReadFull(r, data)
 		}
-		return nil, fmt.Errorf("error reading channel 2 data: %w (read %d of %d bytes)",
-			err, bytesRead, eblFile.Channel2Size)
+		if err != nil {
+			if p.debug {
+				p.Debug(fmt.Sprintf("Error reading channel %d data: %v (read %d of %d bytes)",
+					i+1, err, bytesRead, size))
+			}
+			return nil, fmt.Errorf("error reading channel %d data: %w (read %d of %d bytes)",
+				i+1, err, bytesRead, size)
+		}
+
+		var section *io.SectionReader
+		if stream {
+			section = io.NewSectionReader(src, eblFile.Read, int64(size))
+		}
+		if i == 0 {
+			eblFile.Channel1Data, eblFile.Channel1Stream = data, section
+		} else {
+			eblFile.Channel2Data, eblFile.Channel2Stream = data, section
+		}
+		eblFile.Read += int64(size)
 	}
-	eblFile.Read += int64(eblFile.Channel2Size)
 
 	// Check if we've reached the end of the file
 	endOfData := eblFile.Read
 	if endOfData != eblFile.Size {
 		difference := eblFile.Size - endOfData
-
-		// Many files have a 4-byte trailer at the end
-		if difference == 4 {
-			trailer := make([]byte, 4)
-			bytesRead, err := file.Read(trailer)
-			if err == nil && bytesRead == 4 {
-				eblFile.Read += 4
+		eblFile.Version.TrailerSize = int(difference)
+
+		// Some files end with a 36-byte additional data header
+		if difference > 0 && difference <= maxTrailerSize {
+			trailer := make([]byte, difference)
+			bytesRead, err := io.ReadFull(r, trailer)
+			if err == nil {
+				eblFile.Read += difference
+				eblFile.Trailer = trailer
+				eblFile.ExtraChunks = parseChunks(trailer)
 				if p.debug {
-					p.Debug(fmt.Sprintf("Read 4-byte trailer: %x", trailer))
+					p.Debug(fmt.Sprintf("Read %d-byte trailer:\n%s", bytesRead, p.dumpHex(trailer, 64)))
+					for _, chunk := range eblFile.ExtraChunks {
+						p.Debug(fmt.Sprintf("Trailer chunk %q: %d bytes", chunk.ID, len(chunk.Data)))
+					}
 				}
-				// File is now fully read
-				return eblFile, nil
 			}
 		}
 
-		// Only show as an error if it's not a 40-byte or 4-byte difference
-		if difference != 40 && difference != 4 {
+		// Only show as an error if it's not the known additional data header
+		if difference != KnownTrailerSize {
 			p.Debug(fmt.Sprintf("ERROR: Inconsistent filesize: Read: %d, Expected: %d, Difference: %d",
 				endOfData, eblFile.Size, difference))
-		} else if difference == 40 {
-			p.Debug("WARN: Found 40 bytes. Additional data header.")
+			eblFile.warn("inconsistent filesize: audio ends at %d of %d bytes", endOfData, eblFile.Size)
+		} else {
+			p.Debug("WARN: Found 36 bytes. Additional data header.")
+		}
+	}
+
+	if p.debug {
+		p.Debug(fmt.Sprintf("Variant: %s", eblFile.Version))
+	}
+
+	if err := p.checkStrict(eblFile); err != nil {
+		return nil, err
+	}
+
+	// Streamed audio is read from src until Release
+	if closer, ok := src.(io.Closer); ok && eblFile.Streamed() {
+		eblFile.closer = closer
+	}
+
+	return eblFile, nil
+}
+
+// scanHeader4 returns the number of bytes preceding the first Header 4 prefix within
+// maxHeader4Scan bytes of r, without consuming them
+func scanHeader4(r *bufio.Reader) (int, error) {
+	data, _ := r.Peek(maxHeader4Scan)
+	pos := bytes.Index(data, []byte("E5S1"))
+	if pos < 0 {
+		return 0, fmt.Errorf("%w: no E5S1 prefix within %d bytes of Header 3", ErrInvalidFormat, len(data))
+	}
+	return pos, nil
+}
+
+// checkStrict returns an error wrapping ErrStrict listing the warnings of a file in
+// strict mode, releasing the file
+func (p *Parser) checkStrict(eblFile *EBLFile) error {
+	if !p.strict || len(eblFile.Warnings) == 0 {
+		return nil
+	}
+	eblFile.Release()
+	return fmt.Errorf("%w: %s", ErrStrict, strings.Join(eblFile.Warnings, "; "))
+}
+
+// skipAudio completes a file parsed in headers-only mode without reading its audio.
+// The channel data must fit in the file, truncated files failing as when reading it,
+// and the trailer following it is read from src when given.
+func (p *Parser) skipAudio(eblFile *EBLFile, src io.ReaderAt) (*EBLFile, error) {
+	eblFile.HeadersOnly = true
+	for i, size := range []int{eblFile.Channel1Size, eblFile.Channel2Size} {
+		if available := eblFile.Size - eblFile.Read; int64(size) > available {
+			if available < 0 {
+				available = 0
+			}
+			return nil, fmt.Errorf("error reading channel %d data: %w (read %d of %d bytes)",
+				i+1, io.ErrUnexpectedEOF, available, size)
 		}
+		eblFile.Read += int64(size)
 	}
 
+	difference := eblFile.Size - eblFile.Read
+	eblFile.Version.TrailerSize = int(difference)
+	if difference != 0 && difference != KnownTrailerSize {
+		eblFile.warn("inconsistent filesize: audio ends at %d of %d bytes", eblFile.Read, eblFile.Size)
+	}
+	if src != nil && difference > 0 && difference <= maxTrailerSize {
+		trailer := make([]byte, difference)
+		if _, err := src.ReadAt(trailer, eblFile.Read); err == nil {
+			eblFile.Read += difference
+			eblFile.Trailer = trailer
+			eblFile.ExtraChunks = parseChunks(trailer)
+		}
+	}
+
+	if p.debug {
+		p.Debug(fmt.Sprintf("Skipped %d bytes of audio data, variant: %s", eblFile.DataSizeCalc, eblFile.Version))
+	}
+	if err := p.checkStrict(eblFile); err != nil {
+		return nil, err
+	}
 	return eblFile, nil
 }
+
+// parseChunks decodes data as a sequence of IFF chunks. It returns nil if data doesn't
+// consist exclusively of chunks with printable IDs.
+func parseChunks(data []byte) []Chunk {
+	var chunks []Chunk
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil
+		}
+		for _, c := range data[:4] {
+			if c < 0x20 || c > 0x7e {
+				return nil
+			}
+		}
+		size := binary.BigEndian.Uint32(data[4:8])
+		if uint64(size) > uint64(len(data)-8) {
+			return nil
+		}
+		chunks = append(chunks, Chunk{
+			ID:   string(data[:4]),
+			Data: data[8 : 8+size],
+		})
+		data = data[8+size:]
+		// Chunks are padded to an even size
+		if size%2 == 1 && len(data) > 0 {
+			data = data[1:]
+		}
+	}
+	return chunks
+}
@@ -1,5 +1,11 @@
 package ebl
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
 // EBLFile represents the structure of an EBL file
 type EBLFile struct {
 	Filename     string
@@ -19,6 +25,25 @@ type EBLFile struct {
 	DataSizeEst  int64
 	Channel1Data []byte
 	Channel2Data []byte
+	AudioOffset  int64 // Offset of the channel 1 data in the file
+	HeadersOnly  bool  // Parsed without its audio, see Parser.SetHeadersOnly
+
+	// Audio left in the file when streamed (see Parser.SetStreamThreshold), the
+	// channel data is then empty
+	Channel1Stream *io.SectionReader
+	Channel2Stream *io.SectionReader
+	closer         io.Closer // File of the streams, closed by Release
+	RootKey        int       // MIDI unity note from the sample name, -1 when unknown
+	Version        Version
+	Strategy       Strategy // Strategy the file was parsed with, see Parser.SetRetry
+	Trailer        []byte   // Raw data following the audio
+	ExtraChunks    []Chunk  // Trailer decoded as IFF chunks, when it has that shape
+	Warnings       []string // Irregularities the parser worked around, see Parser.SetStrict
+}
+
+// warn records an irregularity the parser worked around
+func (f *EBLFile) warn(format string, args ...interface{}) {
+	f.Warnings = append(f.Warnings, fmt.Sprintf(format, args...))
 }
 
 // Header1 represents the first header section of an EBL file
@@ -30,7 +55,7 @@ type Header1 struct {
 
 // Header2 represents the second header section of an EBL file
 type Header2 struct {
-	Prefix          []byte // "E5B0TOC2"
+	Prefix          []byte // "E5B0TOC2", the last digit being the TOC revision
 	NextHeaderBytes int    // Length of the next Chunk (78)
 	Read            int64
 }
@@ -55,8 +80,8 @@ type Header4 struct {
 
 // HeaderData represents the data chunk header
 type HeaderData struct {
-	Filename    []byte // 64 bytes of filename data (UTF-16LE)
-	FilenameStr string // Decoded UTF-16 filename
+	Filename    []byte // 64 bytes of filename data (UTF-16LE, or a legacy code page)
+	FilenameStr string // Decoded filename
 	V1          int    // Unknown. 301 le
 	V2          int    // Data Offset. 184 le
 	V3          int    // Data size (including offset)
@@ -73,3 +98,184 @@ type HeaderData struct {
 	CommentStr  string // Decoded UTF-16 comment
 	Read        int64
 }
+
+// Channels returns the number of audio channels (1 for mono, 2 for stereo)
+func (f *EBLFile) Channels() int {
+	if f.Channel2Size == 0 {
+		return 1
+	}
+	return 2
+}
+
+// Streamed reports whether the audio is read from the file when encoding rather
+// than held in Channel1Data and Channel2Data
+func (f *EBLFile) Streamed() bool {
+	return f.Channel1Stream != nil || f.Channel2Stream != nil
+}
+
+// ChannelReader returns a reader of the 16-bit PCM data of channel 1 or 2, from
+// memory or streamed from the file. Each call reads from the start of the channel.
+func (f *EBLFile) ChannelReader(n int) io.Reader {
+	data, stream := f.Channel1Data, f.Channel1Stream
+	if n == 2 {
+		data, stream = f.Channel2Data, f.Channel2Stream
+	}
+	if stream != nil {
+		return io.NewSectionReader(stream, 0, stream.Size())
+	}
+	return bytes.NewReader(data)
+}
+
+// Frames returns the number of sample frames (16-bit samples per channel)
+func (f *EBLFile) Frames() int {
+	return f.Channel1Size / 2
+}
+
+// Duration returns the audio duration in seconds, 0 when the sample rate is unknown
+func (f *EBLFile) Duration() float64 {
+	if f.HeaderData.SampleRate <= 0 {
+		return 0
+	}
+	return float64(f.Frames()) / float64(f.HeaderData.SampleRate)
+}
+
+// Range of plausible sample rates, header values outside of it come from corrupted files
+const (
+	MinSampleRate = 4000
+	MaxSampleRate = 192000
+)
+
+// PlausibleSampleRate reports whether rate is within the range of plausible sample rates
+func PlausibleSampleRate(rate int) bool {
+	return rate >= MinSampleRate && rate <= MaxSampleRate
+}
+
+// Region is a span of a sample in frames, End excluded
+type Region struct {
+	Start int
+	End   int
+}
+
+// Regions returns the regions marked by the V6/V7 and V8/V9 offset pairs. The pairs
+// usually span the whole first channel, only those marking part of it are returned.
+func (f *EBLFile) Regions() []Region {
+	h := f.HeaderData
+	channelStart := h.V2
+	channelEnd := h.V2 + f.Channel1Size
+
+	var regions []Region
+	for _, pair := range [][2]int{{h.V6, h.V7}, {h.V8, h.V9}} {
+		start, end := pair[0], pair[1]
+		if start < channelStart || end > channelEnd || start >= end {
+			continue
+		}
+		if start == channelStart && end == channelEnd {
+			continue
+		}
+		region := Region{Start: (start - channelStart) / 2, End: (end - channelStart) / 2}
+		if len(regions) > 0 && regions[0] == region {
+			continue
+		}
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// Slice returns the frames from start to end (excluded) of the sample as a file
+// sharing its audio data, without regions. A shorter right channel is cut alike and
+// padded with silence when encoded. The slice must not be released.
+func (f *EBLFile) Slice(start, end int) *EBLFile {
+	slice := *f
+	slice.HeaderData.V6, slice.HeaderData.V7 = 0, 0
+	slice.HeaderData.V8, slice.HeaderData.V9 = 0, 0
+	slice.closer = nil
+	slice.Channel1Size = (end - start) * 2
+	slice.Channel1Data, slice.Channel1Stream = sliceChannel(f.Channel1Data, f.Channel1Stream, start*2, end*2)
+	if f.Channel2Size > 0 {
+		slice.Channel2Size = slice.Channel1Size
+		slice.Channel2Data, slice.Channel2Stream = sliceChannel(f.Channel2Data, f.Channel2Stream, start*2, end*2)
+	}
+	return &slice
+}
+
+// sliceChannel returns the bytes from start to end of channel data held in memory or
+// streamed, clamped to the data available
+func sliceChannel(data []byte, stream *io.SectionReader, start, end int) ([]byte, *io.SectionReader) {
+	size := len(data)
+	if stream != nil {
+		size = int(stream.Size())
+	}
+	if end > size {
+		end = size
+	}
+	if start > end {
+		start = end
+	}
+	if stream != nil {
+		return nil, io.NewSectionReader(stream, int64(start), int64(end-start))
+	}
+	return data[start:end], nil
+}
+
+// Name returns the sample name decoded from the header, falling back to Header3's copy
+func (f *EBLFile) Name() string {
+	if f.HeaderData.FilenameStr != "" {
+		return f.HeaderData.FilenameStr
+	}
+	return f.Header3.Filename
+}
+
+// KnownTrailerSize is the size of the additional data header ending some files, which
+// is expected after the audio
+const KnownTrailerSize = 36
+
+// Strategy is a way of locating the headers of an EBL file, see Parser.SetRetry
+type Strategy string
+
+// Parse strategies
+const (
+	StrategyStandard      Strategy = "standard"       // Header 4 at the offset given by Header 3
+	StrategyExtraHeader   Strategy = "extra-header"   // Header 4 after a 40-byte extra header not accounted for by Header 3
+	StrategyPaddedHeader4 Strategy = "padded-header4" // Header 4 found by scanning the padding following Header 3
+)
+
+// AlternateStrategies are the strategies failed files are retried with, in order
+var AlternateStrategies = []Strategy{StrategyExtraHeader, StrategyPaddedHeader4}
+
+// extraHeaderSize is the size of the extra header read by StrategyExtraHeader
+const extraHeaderSize = 40
+
+// maxHeader4Scan is the number of bytes following Header 3 StrategyPaddedHeader4
+// searches for Header 4
+const maxHeader4Scan = 4096
+
+// Version identifies the layout variant of an EBL file. The mapping of layouts to
+// Emulator X/X2/X3 and Proteus X releases isn't documented, so variants are
+// identified by the structural differences the parser has to handle.
+type Version struct {
+	TOC         int  // Table of contents revision from the Header 2 prefix ("E5B0TOC2" = 2)
+	Padded      bool // Header 4 was found inside the padding following Header 3
+	TrailerSize int  // Bytes of data following the audio (0 or 36 in known files)
+}
+
+// String returns a short description of the variant, e.g. "TOC2+extended"
+func (v Version) String() string {
+	s := fmt.Sprintf("TOC%d", v.TOC)
+	if v.Padded {
+		s += "+padded"
+	}
+	switch v.TrailerSize {
+	case 0:
+	case KnownTrailerSize:
+		s += "+extended"
+	default:
+		s += fmt.Sprintf("+trailer%d", v.TrailerSize)
+	}
+	return s
+}
+
+// Chunk represents an IFF style data block (4 byte ID, big endian size, data)
+type Chunk struct {
+	ID   string
+	Data []byte
+}
@@ -0,0 +1,62 @@
+package ebl
+
+import "fmt"
+
+// Verify cross-checks the decoded audio length against the header fields and the
+// actual file size. It returns a description of every inconsistency found, an
+// empty result meaning the header math agrees with the decoded data.
+func (f *EBLFile) Verify() []string {
+	var issues []string
+	h := f.HeaderData
+
+	// Streamed audio was skipped over in full by the parser, and headers-only files
+	// were checked to hold it
+	if !f.Streamed() && !f.HeadersOnly && (len(f.Channel1Data) != f.Channel1Size || len(f.Channel2Data) != f.Channel2Size) {
+		issues = append(issues, fmt.Sprintf("decoded %d+%d bytes, expected %d+%d",
+			len(f.Channel1Data), len(f.Channel2Data), f.Channel1Size, f.Channel2Size))
+	}
+
+	if f.Channel1Size%2 != 0 || f.Channel2Size%2 != 0 {
+		issues = append(issues, fmt.Sprintf("channel sizes %d/%d aren't a whole number of 16-bit samples",
+			f.Channel1Size, f.Channel2Size))
+	}
+
+	if f.Channel2Size != 0 {
+		// Stereo: both channels are described by their own offsets
+		if f.Channel1Size != f.Channel2Size {
+			issues = append(issues, fmt.Sprintf("channel 1 (%d bytes) and channel 2 (%d bytes) differ in length",
+				f.Channel1Size, f.Channel2Size))
+		}
+	} else if h.V4-h.V3+2 != f.Channel1Size {
+		issues = append(issues, fmt.Sprintf("mono size %d disagrees with V4-V3+2 (%d)", f.Channel1Size, h.V4-h.V3+2))
+	}
+
+	if f.Channel1Size <= 0 {
+		issues = append(issues, "no audio data")
+	}
+
+	if !PlausibleSampleRate(h.SampleRate) {
+		issues = append(issues, fmt.Sprintf("sample rate %d Hz outside the plausible %d-%d Hz range",
+			h.SampleRate, MinSampleRate, MaxSampleRate))
+	}
+
+	// V6/V7 and V8/V9 are believed to be start/end offsets of the first channel, or of
+	// a region within it (see Regions)
+	channelEnd := h.V2 + f.Channel1Size
+	if h.V7 > h.V6 && h.V6 > 0 && h.V7-h.V6 != f.Channel1Size && (h.V6 < h.V2 || h.V7 > channelEnd) {
+		issues = append(issues, fmt.Sprintf("V7-V6 (%d) disagrees with channel 1 size (%d)", h.V7-h.V6, f.Channel1Size))
+	}
+	if h.V9 > h.V8 && h.V8 > 0 && h.V9-h.V8 != f.Channel1Size && (h.V8 < h.V2 || h.V9 > channelEnd) {
+		issues = append(issues, fmt.Sprintf("V9-V8 (%d) disagrees with channel 1 size (%d)", h.V9-h.V8, f.Channel1Size))
+	}
+
+	if int64(f.Header1.FileSize)+8 != f.Size {
+		issues = append(issues, fmt.Sprintf("FORM size %d disagrees with file size %d", f.Header1.FileSize+8, f.Size))
+	}
+
+	if f.Read != f.Size {
+		issues = append(issues, fmt.Sprintf("parsed %d bytes of a %d byte file", f.Read, f.Size))
+	}
+
+	return issues
+}
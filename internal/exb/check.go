@@ -0,0 +1,88 @@
+package exb
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/fswalk"
+)
+
+// PoolCheck compares the samples referenced by an EXB file with the EBL files of its
+// SamplePool
+type PoolCheck struct {
+	References int      // Samples referenced by the EXB file
+	Files      int      // EBL files in the SamplePool
+	Referenced []string // EBL files references point to, relative to the SamplePool, in reference order
+	Missing    []string // References without an EBL file, as stored in the EXB file
+	Orphans    []string // EBL files no reference points to, relative to the SamplePool
+}
+
+// CheckPool finds the missing and orphan samples of the bank at exbPath. References
+// match an EBL file when they end with its path in the pool, compared regardless of
+// case, or have its name when they are bare file names. Nothing is reported when the
+// EXB file holds no reference, as references may be stored in a way the scan doesn't
+// find.
+func CheckPool(exbPath, samplePool string, followLinks bool) (*PoolCheck, error) {
+	refs, err := ReadReferences(exbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// EBL files of the pool, by lowercased name
+	byName := make(map[string][]string)
+	var files []string
+	err = fswalk.Walk(samplePool, followLinks, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(p), sampleExt) {
+			return nil
+		}
+		rel, err := filepath.Rel(samplePool, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		files = append(files, rel)
+		name := strings.ToLower(path.Base(rel))
+		byName[name] = append(byName[name], rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning SamplePool: %w", err)
+	}
+
+	check := &PoolCheck{References: len(refs), Files: len(files)}
+	if len(refs) == 0 {
+		return check, nil
+	}
+
+	referenced := make(map[string]bool)
+	for _, ref := range refs {
+		lower := strings.ToLower(ref)
+		found := false
+		for _, rel := range byName[strings.ToLower(path.Base(ref))] {
+			if !strings.Contains(ref, "/") || lower == strings.ToLower(rel) || strings.HasSuffix(lower, "/"+strings.ToLower(rel)) {
+				if !referenced[rel] {
+					check.Referenced = append(check.Referenced, rel)
+				}
+				referenced[rel] = true
+				found = true
+			}
+		}
+		if !found {
+			check.Missing = append(check.Missing, ref)
+		}
+	}
+	for _, rel := range files {
+		if !referenced[rel] {
+			check.Orphans = append(check.Orphans, rel)
+		}
+	}
+	sort.Strings(check.Orphans)
+	return check, nil
+}
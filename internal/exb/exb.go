@@ -0,0 +1,206 @@
+// Package exb reads what is known of EXB bank files: the references to the EBL files
+// of their samples, and the SamplePool directory holding them. The EXB format isn't
+// decoded, references are found by scanning the file for paths ending in .ebl,
+// stored as ASCII or UTF-16 strings.
+package exb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/textnorm"
+)
+
+// DefaultSamplePool is the name of the folder holding the EBL files next to an EXB file
+const DefaultSamplePool = "SamplePool"
+
+// sampleExt ends the references to samples
+const sampleExt = ".ebl"
+
+// References returns the EBL files referenced in EXB data, with forward slashes, in
+// order of appearance and without duplicates. Paths may be absolute paths of the
+// machine the bank was made on, relative to the SamplePool or bare file names.
+func References(data []byte) []string {
+	return referencesTo(data, sampleExt)
+}
+
+// referencesTo returns the paths ending in ext found in data, like References
+func referencesTo(data []byte, ext string) []string {
+	var refs []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		for _, ref := range splitReferences(s, ext) {
+			if key := strings.ToLower(ref); !seen[key] {
+				seen[key] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	// ASCII strings, then UTF-16 strings at both alignments. Big endian UTF-16 is read
+	// as little endian one byte off. Code units made of two printable ASCII bytes are
+	// left out of UTF-16 strings, they mostly come from ASCII strings read as UTF-16
+	// and would prefix the references following them with garbage.
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && data[i] >= 0x20 && data[i] < 0x7f {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			add(string(data[start:i]))
+			start = -1
+		}
+	}
+	for offset := 0; offset < 2; offset++ {
+		var run []uint16
+		for i := offset; i+1 < len(data); i += 2 {
+			u := uint16(data[i]) | uint16(data[i+1])<<8
+			if r := rune(u); u >= 0x20 && !asciiPair(u) && (utf16.IsSurrogate(r) || unicode.IsPrint(r)) {
+				run = append(run, u)
+				continue
+			}
+			if len(run) > 0 {
+				add(string(utf16.Decode(run)))
+				run = run[:0]
+			}
+		}
+		if len(run) > 0 {
+			add(string(utf16.Decode(run)))
+		}
+	}
+	return refs
+}
+
+// asciiPair reports whether both bytes of a UTF-16 code unit are printable ASCII
+func asciiPair(u uint16) bool {
+	lo, hi := u&0xff, u>>8
+	return lo >= 0x20 && lo < 0x7f && hi >= 0x20 && hi < 0x7f
+}
+
+// splitReferences returns the paths ending in ext in a string found in EXB data
+func splitReferences(s, ext string) []string {
+	var refs []string
+	lower := strings.ToLower(s)
+	start := 0
+	for {
+		i := strings.Index(lower[start:], ext)
+		if i < 0 {
+			return refs
+		}
+		end := start + i + len(ext)
+		ref := strings.TrimSpace(strings.ReplaceAll(s[start:end], `\`, "/"))
+		if len(ref) > len(ext) && !strings.HasSuffix(ref, "/"+ext) {
+			refs = append(refs, ref)
+		}
+		start = end
+	}
+}
+
+// ReadReferences returns the EBL files referenced by the EXB file at path
+func ReadReferences(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading EXB file: %w", err)
+	}
+	return References(data), nil
+}
+
+// FindSamplePool returns the directory holding the EBL files of the EXB file at path:
+// the directory its references resolve in, else a folder next to it named SamplePool,
+// compared regardless of case, spacing and punctuation ("samplepool", "Sample Pool").
+func FindSamplePool(path string) (string, error) {
+	dir := filepath.Dir(path)
+	if refs, err := ReadReferences(path); err == nil {
+		if pool := poolFromReferences(dir, refs); pool != "" {
+			return pool, nil
+		}
+	}
+
+	defaultPool := filepath.Join(dir, DefaultSamplePool)
+	if info, err := os.Stat(defaultPool); err == nil && info.IsDir() {
+		return defaultPool, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err == nil {
+		for _, entry := range entries {
+			if !isPoolName(entry.Name()) {
+				continue
+			}
+			pool := filepath.Join(dir, entry.Name())
+			if info, err := os.Stat(pool); err == nil && info.IsDir() {
+				return pool, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("SamplePool directory not found at %s", defaultPool)
+}
+
+// poolFromReferences returns the directory below dir that the references resolve
+// in, empty when none resolves. For a reference such as C:/Banks/Strings/Sample
+// Pool/Violins/Violin C3.ebl, the first directory of the path found in dir, followed
+// by the rest of the path, gives the pool.
+func poolFromReferences(dir string, refs []string) string {
+	for _, ref := range refs {
+		parts := strings.Split(ref, "/")
+		for i := 0; i < len(parts)-1; i++ {
+			pool, ok := Resolve(dir, parts[i])
+			if !ok {
+				continue
+			}
+			if info, err := os.Stat(pool); err != nil || !info.IsDir() {
+				continue
+			}
+			if _, ok := Resolve(pool, parts[i+1:]...); ok {
+				return pool
+			}
+		}
+	}
+	return ""
+}
+
+// Resolve returns the path of the elements below dir, matching each regardless of
+// case when no entry has its exact name, as banks are copied between case sensitive
+// and insensitive filesystems. ok is false when a path element isn't found.
+func Resolve(dir string, elems ...string) (path string, ok bool) {
+	path = dir
+	for _, elem := range elems {
+		if elem == "" || elem == "." || elem == ".." || strings.ContainsAny(elem, `/\:`) {
+			return "", false
+		}
+		candidate := filepath.Join(path, elem)
+		if _, err := os.Lstat(candidate); err == nil {
+			path = candidate
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", false
+		}
+		found := false
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name(), elem) {
+				path = filepath.Join(path, entry.Name())
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return path, true
+}
+
+// isPoolName reports whether a folder name spells SamplePool, whatever its case,
+// spacing and punctuation
+func isPoolName(name string) bool {
+	return strings.ReplaceAll(textnorm.Fold(name), " ", "") == "samplepool"
+}
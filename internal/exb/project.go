@@ -0,0 +1,79 @@
+package exb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bankExt ends the references to banks
+const bankExt = ".exb"
+
+// ProjectExts are the extensions of the project files some libraries ship to open
+// their banks in Emulator X, instead of or along with bare EXB files. The banks they
+// load are found by scanning them for paths ending in .exb.
+var ProjectExts = []string{".exs", ".ems", ".es"}
+
+// IsProject reports whether path has the extension of a project file
+func IsProject(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, projectExt := range ProjectExts {
+		if ext == projectExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Project lists the banks referenced by a project file
+type Project struct {
+	Banks   []string // EXB files found, in order of reference
+	Missing []string // References which don't resolve, as stored in the project
+}
+
+// ReadProject returns the banks referenced by the project file at path. References are
+// resolved like those of EXB files: relative to the project directory, or for absolute
+// paths of the machine the project was made on, from the first directory of the path
+// found next to the project, so C:/Library/Strings/Strings.exb resolves in a copy of
+// the library holding the project and a Strings folder.
+func ReadProject(path string) (*Project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading project file: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	project := &Project{}
+	for _, ref := range referencesTo(data, bankExt) {
+		if bank, ok := resolveBank(dir, ref); ok {
+			project.Banks = append(project.Banks, bank)
+		} else {
+			project.Missing = append(project.Missing, ref)
+		}
+	}
+	return project, nil
+}
+
+// resolveBank returns the EXB file a reference of a project in dir points to
+func resolveBank(dir, ref string) (string, bool) {
+	// Relative references may lead out of the project directory
+	if !strings.HasPrefix(ref, "/") && !strings.Contains(ref, ":") {
+		bank := filepath.Join(dir, filepath.FromSlash(ref))
+		if info, err := os.Stat(bank); err == nil && !info.IsDir() {
+			return bank, true
+		}
+	}
+
+	parts := strings.Split(ref, "/")
+	for i := 0; i < len(parts); i++ {
+		bank, ok := Resolve(dir, parts[i:]...)
+		if !ok {
+			continue
+		}
+		if info, err := os.Stat(bank); err == nil && !info.IsDir() {
+			return bank, true
+		}
+	}
+	return "", false
+}
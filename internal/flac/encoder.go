@@ -1,26 +1,46 @@
 package flac
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+)
+
+// Compression levels of ffmpeg's FLAC encoder, higher levels giving smaller files
+// for more encoding time. FLAC decoding speed doesn't depend on the level.
+const (
+	MinCompressionLevel     = 0
+	MaxCompressionLevel     = 12
+	DefaultCompressionLevel = 8 // Highest level of the reference encoder
 )
 
 // Converter handles converting WAV files to FLAC
 type Converter struct {
 	ffmpegPath string
 	debug      bool
+	out        io.Writer // Destination of debug messages and ffmpeg output, see SetOutput
 	maxWorkers int
+	encoder    string   // Written in the ENCODER tag
+	level      int      // Compression level passed to ffmpeg
+	threads    int      // Threads of each ffmpeg encoder, 0 for ffmpeg's default
+	extraArgs  []string // Passed to ffmpeg after the encoder options
 }
 
 // NewConverter creates a new FLAC converter
 func NewConverter(debug bool) (*Converter, error) {
 	// Find ffmpeg in the system
-	ffmpegPath, err := findFFmpeg()
+	ffmpegPath, err := FindFFmpeg()
 	if err != nil {
 		return nil, err
 	}
@@ -33,10 +53,54 @@ func NewConverter(debug bool) (*Converter, error) {
 	return &Converter{
 		ffmpegPath: ffmpegPath,
 		debug:      debug,
+		out:        os.Stdout,
 		maxWorkers: maxWorkers,
+		encoder:    DefaultEncoder,
+		level:      DefaultCompressionLevel,
 	}, nil
 }
 
+// SetOutput sets where debug messages and ffmpeg output are written, os.Stdout by default
+func (c *Converter) SetOutput(w io.Writer) {
+	c.out = w
+}
+
+// SetCompressionLevel sets the compression level of the encoder, from
+// MinCompressionLevel to MaxCompressionLevel
+func (c *Converter) SetCompressionLevel(level int) {
+	c.level = level
+}
+
+// SetThreads sets the number of threads used by each ffmpeg process, 0 leaving
+// ffmpeg's default. Files are already encoded in parallel by ConvertDirectory.
+func (c *Converter) SetThreads(threads int) {
+	c.threads = threads
+}
+
+// SetExtraArgs sets ffmpeg arguments passed after the encoder options, such as
+// "-lpc_type cholesky", overriding them when they set the same options
+func (c *Converter) SetExtraArgs(args []string) {
+	c.extraArgs = args
+}
+
+// codecArgs returns the ffmpeg arguments selecting and configuring the FLAC encoder
+func (c *Converter) codecArgs() []string {
+	args := []string{
+		"-c:a", "flac", // Use FLAC codec
+		"-compression_level", strconv.Itoa(c.level),
+		"-fflags", "+bitexact", "-flags:a", "+bitexact", // Leave out the encoder version for reproducible output
+	}
+	if c.threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(c.threads))
+	}
+	return append(args, c.extraArgs...)
+}
+
+// SetEncoder sets the converter name and version written in the ENCODER tag
+func (c *Converter) SetEncoder(encoder string) {
+	c.encoder = encoder
+}
+
 // Helper functions for min/max operations
 func min(a, b int) int {
 	if a < b {
@@ -52,57 +116,8 @@ func max(a, b int) int {
 	return b
 }
 
-// findFFmpeg locates the ffmpeg binary on the system
-func findFFmpeg() (string, error) {
-	// Try to find ffmpeg in PATH
-	var cmd *exec.Cmd
-
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("where", "ffmpeg")
-	} else {
-		cmd = exec.Command("which", "ffmpeg")
-	}
-
-	output, err := cmd.Output()
-	if err == nil {
-		// Found ffmpeg in PATH
-		return strings.TrimSpace(string(output)), nil
-	}
-
-	// Check common installation locations based on OS
-	commonPaths := []string{}
-
-	if runtime.GOOS == "windows" {
-		commonPaths = []string{
-			`C:\Program Files\ffmpeg\bin\ffmpeg.exe`,
-			`C:\Program Files (x86)\ffmpeg\bin\ffmpeg.exe`,
-		}
-	} else if runtime.GOOS == "darwin" {
-		commonPaths = []string{
-			"/usr/local/bin/ffmpeg",
-			"/opt/homebrew/bin/ffmpeg",
-			"/opt/local/bin/ffmpeg",
-		}
-	} else {
-		// Linux/Unix
-		commonPaths = []string{
-			"/usr/bin/ffmpeg",
-			"/usr/local/bin/ffmpeg",
-			"/opt/ffmpeg/bin/ffmpeg",
-		}
-	}
-
-	for _, path := range commonPaths {
-		if _, err := os.Stat(path); err == nil {
-			return path, nil
-		}
-	}
-
-	return "", fmt.Errorf("ffmpeg not found. Please install ffmpeg to use the FLAC conversion feature")
-}
-
-// ConvertToFlac converts a WAV file to FLAC format
-func (c *Converter) ConvertToFlac(wavFile string) error {
+// ConvertToFlac converts a WAV file to a FLAC file tagged with tags
+func (c *Converter) ConvertToFlac(wavFile string, tags Tags) error {
 	// Check if input file exists
 	if _, err := os.Stat(wavFile); os.IsNotExist(err) {
 		return fmt.Errorf("input file does not exist: %s", wavFile)
@@ -111,43 +126,89 @@ func (c *Converter) ConvertToFlac(wavFile string) error {
 	// Create output filename
 	flacFile := strings.TrimSuffix(wavFile, ".wav") + ".flac"
 
+	// ffmpeg writes a temporary file which is tagged into the FLAC file, so an
+	// interrupted run leaves no truncated FLAC next to the WAV
+	encodedFile := flacFile + ".encoded" + atomicfile.Suffix
+	defer os.Remove(encodedFile)
+
 	// Build ffmpeg command with appropriate options
-	cmd := exec.Command(
-		c.ffmpegPath,
-		"-i", wavFile, // Input file
-		"-c:a", "flac", // Use FLAC codec
-		"-compression_level", "8", // Maximum compression
-		"-y",     // Overwrite output file if it exists
-		flacFile, // Output file
+	args := append([]string{"-i", wavFile}, c.codecArgs()...)
+	args = append(args,
+		"-f", "flac", // The temporary name has no .flac extension
+		"-y",        // Overwrite output file if it exists
+		encodedFile, // Output file
 	)
+	cmd := exec.Command(c.ffmpegPath, args...)
 
-	// If debug mode is on, show the ffmpeg output
+	// If debug mode is on, show the ffmpeg output. The end of its error output is kept
+	// to tell why it failed.
+	stderr := &tailBuffer{max: stderrTail}
 	if c.debug {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		fmt.Printf("Running: %s\n", cmd.String())
+		cmd.Stdout = c.out
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+		fmt.Fprintf(c.out, "Running: %s\n", cmd.String())
 	} else {
-		// Suppress ffmpeg output otherwise
-		cmd.Stdout = nil
-		cmd.Stderr = nil
+		cmd.Stderr = stderr
 	}
 
 	// Run the command
 	err := cmd.Run()
 	if err != nil {
-		return fmt.Errorf("error converting to FLAC: %w", err)
+		return &FileError{File: wavFile, Err: fmt.Errorf("error converting to FLAC: %w", err), Stderr: stderr.String()}
+	}
+	if err := tagFile(encodedFile, flacFile, tags); err != nil {
+		return &FileError{File: wavFile, Err: fmt.Errorf("error tagging FLAC file: %w", err)}
 	}
 
 	// Delete the original WAV file
-	err = os.Remove(wavFile)
+	err = safepath.Remove(wavFile)
 	if err != nil {
-		return fmt.Errorf("error removing original WAV file: %w", err)
+		return &FileError{File: wavFile, Err: fmt.Errorf("error removing original WAV file: %w", err)}
 	}
 
 	return nil
 }
 
-// ConvertDirectory converts all WAV files in a directory to FLAC using multiple workers
+// Encode transcodes the WAV stream read from r to FLAC written to w, tagged with tags.
+// The ENCODER tag defaults to the name given to SetEncoder.
+func (c *Converter) Encode(w io.Writer, r io.Reader, tags Tags) error {
+	if tags.Encoder == "" {
+		tags.Encoder = c.encoder
+	}
+	args := append([]string{"-f", "wav", "-i", "pipe:0"}, c.codecArgs()...) // WAV from stdin
+	args = append(args, "-f", "flac", "pipe:1")                             // FLAC to stdout
+	cmd := exec.Command(c.ffmpegPath, args...)
+	cmd.Stdin = r
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error converting to FLAC: %w", err)
+	}
+	stderr := &tailBuffer{max: stderrTail}
+	cmd.Stderr = stderr
+	if c.debug {
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+		fmt.Fprintf(c.out, "Running: %s\n", cmd.String())
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error converting to FLAC: %w", err)
+	}
+	copyErr := CopyTagged(w, stdout, tags)
+	if copyErr != nil {
+		// Drain the output so ffmpeg doesn't block writing it
+		io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		if line := lastLine(stderr.String()); line != "" {
+			return fmt.Errorf("error converting to FLAC: %w: %s", err, line)
+		}
+		return fmt.Errorf("error converting to FLAC: %w", err)
+	}
+	return copyErr
+}
+
+// ConvertDirectory converts all WAV files in a directory to FLAC using multiple workers.
+// Files which fail are left as WAV and returned in a *DirectoryError.
 func (c *Converter) ConvertDirectory(dir string) error {
 	// Find all WAV files in the directory and subdirectories
 	var wavFiles []string
@@ -170,6 +231,8 @@ func (c *Converter) ConvertDirectory(dir string) error {
 		return nil
 	}
 
+	tags := c.manifestTags(dir)
+
 	// Create a channel to send jobs to workers
 	jobs := make(chan string, len(wavFiles))
 
@@ -184,7 +247,7 @@ func (c *Converter) ConvertDirectory(dir string) error {
 
 	// Print info about parallelization
 	if c.debug {
-		fmt.Printf("Converting %d WAV files to FLAC using %d parallel workers\n",
+		fmt.Fprintf(c.out, "Converting %d WAV files to FLAC using %d parallel workers\n",
 			len(wavFiles), numWorkers)
 	}
 
@@ -197,18 +260,22 @@ func (c *Converter) ConvertDirectory(dir string) error {
 			// Process jobs until the channel is closed
 			for wavFile := range jobs {
 				if c.debug {
-					fmt.Printf("Worker %d: Converting %s to FLAC\n", id, wavFile)
+					fmt.Fprintf(c.out, "Worker %d: Converting %s to FLAC\n", id, wavFile)
 				}
 
-				err := c.ConvertToFlac(wavFile)
+				fileTags, ok := tags[wavFile]
+				if !ok {
+					fileTags = Tags{Encoder: c.encoder}
+				}
+				err := c.ConvertToFlac(wavFile, fileTags)
 				results <- err
 
 				if err != nil {
 					if c.debug {
-						fmt.Printf("Worker %d: Error converting %s: %v\n", id, wavFile, err)
+						fmt.Fprintf(c.out, "Worker %d: Error converting %s: %v\n", id, wavFile, err)
 					}
 				} else if c.debug {
-					fmt.Printf("Worker %d: Successfully converted %s\n", id, wavFile)
+					fmt.Fprintf(c.out, "Worker %d: Successfully converted %s\n", id, wavFile)
 				}
 			}
 		}(w)
@@ -225,15 +292,21 @@ func (c *Converter) ConvertDirectory(dir string) error {
 	close(results)
 
 	// Collect errors
-	var errorCount int
+	var failed []*FileError
 	for err := range results {
-		if err != nil {
-			errorCount++
+		if err == nil {
+			continue
+		}
+		var fileErr *FileError
+		if !errors.As(err, &fileErr) {
+			fileErr = &FileError{Err: err}
 		}
+		failed = append(failed, fileErr)
 	}
 
-	if errorCount > 0 {
-		return fmt.Errorf("%d files failed to convert", errorCount)
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].File < failed[j].File })
+		return &DirectoryError{Failed: failed}
 	}
 
 	return nil
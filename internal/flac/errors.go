@@ -0,0 +1,60 @@
+package flac
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stderrTail is the amount of ffmpeg error output kept for FileError
+const stderrTail = 4096
+
+// FileError is returned when a WAV file couldn't be converted to FLAC
+type FileError struct {
+	File   string // WAV file left unconverted
+	Err    error
+	Stderr string // End of the error output of ffmpeg, empty when it didn't fail
+}
+
+func (e *FileError) Error() string {
+	if line := lastLine(e.Stderr); line != "" {
+		return fmt.Sprintf("%s: %v: %s", e.File, e.Err, line)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// DirectoryError lists the files ConvertDirectory couldn't convert, by path
+type DirectoryError struct {
+	Failed []*FileError
+}
+
+func (e *DirectoryError) Error() string {
+	return fmt.Sprintf("%d files failed to convert", len(e.Failed))
+}
+
+// lastLine returns the last non-empty line of s, where ffmpeg prints why it failed
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
@@ -0,0 +1,163 @@
+package flac
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/config"
+)
+
+// FFmpegEnv names the environment variable giving the path of the ffmpeg binary
+const FFmpegEnv = "EBL2WAV_FFMPEG"
+
+var (
+	ffmpegMu   sync.Mutex
+	ffmpegPath string // Set by SetFFmpegPath
+)
+
+// SetFFmpegPath makes FindFFmpeg return path, e.g. from a command line flag.
+// An empty path restores the search.
+func SetFFmpegPath(path string) {
+	ffmpegMu.Lock()
+	defer ffmpegMu.Unlock()
+	ffmpegPath = path
+}
+
+// FindFFmpeg locates the ffmpeg binary. It is looked up in order:
+//   - the path set with SetFFmpegPath
+//   - the EBL2WAV_FFMPEG environment variable
+//   - the "ffmpeg" setting of the config file (see the config package)
+//   - a portable ffmpeg next to the executable, or in its ffmpeg/bin folder
+//   - the PATH
+//   - the common installation locations, including those of scoop, chocolatey
+//     and winget on Windows
+//
+// A path set explicitly must exist, the search doesn't go on when it doesn't.
+func FindFFmpeg() (string, error) {
+	ffmpegMu.Lock()
+	path := ffmpegPath
+	ffmpegMu.Unlock()
+	if path != "" {
+		return explicitFFmpeg(path, "-ffmpeg")
+	}
+	if path := os.Getenv(FFmpegEnv); path != "" {
+		return explicitFFmpeg(path, FFmpegEnv)
+	}
+	settings, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+	if settings.FFmpeg != "" {
+		configPath, _ := config.Path()
+		return explicitFFmpeg(settings.FFmpeg, configPath)
+	}
+
+	if path := portableFFmpeg(); path != "" {
+		return path, nil
+	}
+
+	// Try to find ffmpeg in PATH
+	if path, err := exec.LookPath(ffmpegBinary()); err == nil {
+		return path, nil
+	}
+
+	// Check common installation locations based on OS
+	for _, path := range commonFFmpegPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("ffmpeg not found. Please install ffmpeg to use FLAC conversion and previews, or give its path with -ffmpeg or %s", FFmpegEnv)
+}
+
+// explicitFFmpeg checks an ffmpeg path set by source
+func explicitFFmpeg(path, source string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg not found at %s (set by %s): %w", path, source, err)
+	}
+	if info.IsDir() {
+		// The folder of the binary
+		return explicitFFmpeg(filepath.Join(path, ffmpegBinary()), source)
+	}
+	return path, nil
+}
+
+// ffmpegBinary returns the filename of the ffmpeg binary
+func ffmpegBinary() string {
+	if runtime.GOOS == "windows" {
+		return "ffmpeg.exe"
+	}
+	return "ffmpeg"
+}
+
+// portableFFmpeg returns the path of an ffmpeg binary shipped alongside the
+// executable, or an empty string
+func portableFFmpeg() string {
+	executable, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	dir := filepath.Dir(executable)
+	for _, path := range []string{
+		filepath.Join(dir, ffmpegBinary()),
+		filepath.Join(dir, "ffmpeg", "bin", ffmpegBinary()),
+	} {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// commonFFmpegPaths lists the usual installation locations of ffmpeg
+func commonFFmpegPaths() []string {
+	switch runtime.GOOS {
+	case "windows":
+		paths := []string{
+			`C:\Program Files\ffmpeg\bin\ffmpeg.exe`,
+			`C:\Program Files (x86)\ffmpeg\bin\ffmpeg.exe`,
+			`C:\ffmpeg\bin\ffmpeg.exe`,
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			// scoop shims and app folder
+			paths = append(paths,
+				filepath.Join(home, "scoop", "shims", "ffmpeg.exe"),
+				filepath.Join(home, "scoop", "apps", "ffmpeg", "current", "bin", "ffmpeg.exe"))
+		}
+		chocolatey := os.Getenv("ChocolateyInstall")
+		if chocolatey == "" {
+			chocolatey = `C:\ProgramData\chocolatey`
+		}
+		paths = append(paths, filepath.Join(chocolatey, "bin", "ffmpeg.exe"))
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			// winget links, and the packages it extracted without linking them
+			winget := filepath.Join(local, "Microsoft", "WinGet")
+			paths = append(paths, filepath.Join(winget, "Links", "ffmpeg.exe"))
+			packages, _ := filepath.Glob(filepath.Join(winget, "Packages", "*FFmpeg*", "*", "bin", "ffmpeg.exe"))
+			paths = append(paths, packages...)
+		}
+		return paths
+	case "darwin":
+		return []string{
+			"/usr/local/bin/ffmpeg",
+			"/opt/homebrew/bin/ffmpeg",
+			"/opt/local/bin/ffmpeg",
+		}
+	}
+	// Linux/Unix
+	return []string{
+		"/usr/bin/ffmpeg",
+		"/usr/local/bin/ffmpeg",
+		"/opt/ffmpeg/bin/ffmpeg",
+		"/snap/bin/ffmpeg",
+	}
+}
@@ -0,0 +1,166 @@
+package flac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// DefaultEncoder names the converter in the ENCODER tag when SetEncoder isn't called
+const DefaultEncoder = "ebl2wav"
+
+// FLAC metadata block types
+const (
+	blockVorbisComment = 4
+	lastBlockFlag      = 0x80
+)
+
+// Tags are the Vorbis comments written to FLAC files, empty values being left out
+type Tags struct {
+	Title   string // Sample name
+	Album   string // EXB bank
+	Comment string // EBL comment
+	Encoder string // Converter name and version
+}
+
+// fields returns the tags as Vorbis comment fields
+func (t Tags) fields() []string {
+	var fields []string
+	for _, tag := range []struct{ name, value string }{
+		{"TITLE", t.Title},
+		{"ALBUM", t.Album},
+		{"COMMENT", t.Comment},
+		{"ENCODER", t.Encoder},
+	} {
+		if tag.value != "" {
+			fields = append(fields, tag.name+"="+tag.value)
+		}
+	}
+	return fields
+}
+
+// vorbisCommentBlock returns a VORBIS_COMMENT metadata block holding the tags,
+// flagged as the last block when last is set
+func (t Tags) vorbisCommentBlock(last bool) []byte {
+	fields := t.fields()
+	vendor := DefaultEncoder
+
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(vendor)))
+	body = append(body, vendor...)
+	body = binary.LittleEndian.AppendUint32(body, uint32(len(fields)))
+	for _, field := range fields {
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(field)))
+		body = append(body, field...)
+	}
+
+	header := uint32(blockVorbisComment)<<24 | uint32(len(body))
+	if last {
+		header |= lastBlockFlag << 24
+	}
+	return append(binary.BigEndian.AppendUint32(nil, header), body...)
+}
+
+// CopyTagged copies the FLAC stream read from r to w, replacing its Vorbis comments
+// with tags. ffmpeg copies tags it finds in the WAV files under its own names, so
+// the written comments don't depend on its version.
+func CopyTagged(w io.Writer, r io.Reader, tags Tags) error {
+	br := bufio.NewReader(r)
+	var marker [4]byte
+	if _, err := io.ReadFull(br, marker[:]); err != nil {
+		return fmt.Errorf("error reading FLAC stream: %w", err)
+	}
+	if string(marker[:]) != "fLaC" {
+		return fmt.Errorf("not a FLAC stream")
+	}
+	if _, err := w.Write(marker[:]); err != nil {
+		return fmt.Errorf("error writing FLAC stream: %w", err)
+	}
+
+	// Metadata blocks precede the audio frames, the last one being flagged
+	for last := false; !last; {
+		var header [4]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return fmt.Errorf("error reading FLAC metadata: %w", err)
+		}
+		last = header[0]&lastBlockFlag != 0
+		blockType := header[0] &^ lastBlockFlag
+		size := int64(binary.BigEndian.Uint32(header[:]) & 0xffffff)
+
+		if blockType == blockVorbisComment {
+			if _, err := io.CopyN(io.Discard, br, size); err != nil {
+				return fmt.Errorf("error reading FLAC metadata: %w", err)
+			}
+		} else {
+			header[0] = blockType
+			if _, err := w.Write(header[:]); err != nil {
+				return fmt.Errorf("error writing FLAC stream: %w", err)
+			}
+			if _, err := io.CopyN(w, br, size); err != nil {
+				return fmt.Errorf("error copying FLAC metadata: %w", err)
+			}
+		}
+		if last {
+			if _, err := w.Write(tags.vorbisCommentBlock(true)); err != nil {
+				return fmt.Errorf("error writing FLAC stream: %w", err)
+			}
+		}
+	}
+
+	if _, err := io.Copy(w, br); err != nil {
+		return fmt.Errorf("error copying FLAC frames: %w", err)
+	}
+	return nil
+}
+
+// tagFile writes the FLAC file src to dst with tags
+func tagFile(src, dst string, tags Tags) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening FLAC file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := atomicfile.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating FLAC file: %w", err)
+	}
+	bw := bufio.NewWriter(out)
+	err = CopyTagged(bw, in, tags)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Close()
+}
+
+// manifestTags returns the tags of the WAV files listed in the manifest of dir, by
+// path. Files of directories without a manifest are only tagged with the encoder.
+func (c *Converter) manifestTags(dir string) map[string]Tags {
+	tags := make(map[string]Tags)
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return tags
+	}
+	for _, sample := range m.Samples {
+		bank := sample.Bank
+		if bank == "" {
+			bank = m.Bank
+		}
+		tags[filepath.Join(dir, filepath.FromSlash(sample.Output))] = Tags{
+			Title:   sample.Name,
+			Album:   bank,
+			Comment: sample.Comment,
+			Encoder: c.encoder,
+		}
+	}
+	return tags
+}
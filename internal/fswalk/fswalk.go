@@ -0,0 +1,94 @@
+// Package fswalk walks directory trees like filepath.Walk, optionally following
+// symbolic links to directories, as bank collections on NAS often link folders
+// together
+package fswalk
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Walk walks the tree rooted at root like filepath.Walk. When follow is set,
+// symbolic links and Windows junctions to directories are walked too, paths going
+// through the link. Each directory is visited once, whatever the links leading to
+// it, so link cycles end and linked folders aren't listed twice. Broken links are
+// passed to fn as they are, without error.
+func Walk(root string, follow bool, fn filepath.WalkFunc) error {
+	if !follow {
+		return filepath.Walk(root, fn)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(root, info, fn, make(map[string]bool))
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walk visits path, following links, visited holding the directories seen so far
+// by their resolved path
+func walk(path string, info fs.FileInfo, fn filepath.WalkFunc, visited map[string]bool) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if visited[resolved] {
+			return nil
+		}
+		visited[resolved] = true
+	}
+
+	names, err := readDirNames(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		// Like filepath.Walk, fn decides whether a directory which can't be read
+		// stops the walk
+		return err1
+	}
+
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := os.Stat(filename)
+		if err != nil {
+			// Broken link, reported as the link itself
+			fileInfo, err = os.Lstat(filename)
+		}
+		if err != nil {
+			if err := fn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+
+		err = walk(filename, fileInfo, fn, visited)
+		if err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readDirNames returns the sorted names of the entries of a directory
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
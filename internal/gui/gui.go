@@ -0,0 +1,380 @@
+// Package gui is the desktop interface of ebl2wav-gui: a page served on the loopback
+// interface and opened in the browser, picking folders by browsing or drag and drop,
+// for E-MU owners migrating their libraries without using the command line
+package gui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+)
+
+// maxUploadMemory is the part of a multipart upload kept in memory, the rest is spooled to disk
+const maxUploadMemory = 32 << 20
+
+// maxLogLines is the number of conversion messages kept for the page
+const maxLogLines = 500
+
+// Options represents the interface options
+type Options struct {
+	Debug     bool
+	Token     string // Required in the X-Token header of API requests, so other pages can't drive the app
+	UploadDir string // Directory holding the folders dropped on the page
+}
+
+// Settings are the conversion settings picked on the page
+type Settings struct {
+	Input         string `json:"input"`  // .ebl file, .exb file or directory
+	Output        string `json:"output"` // Output directory, banks are converted into subdirectories
+	Format        string `json:"format"` // wav, raw or flac
+	MergeStereo   bool   `json:"mergeStereo"`
+	PreserveNames bool   `json:"preserveNames"`
+	OnConflict    string `json:"onConflict"`
+	DSPreset      bool   `json:"dspreset"`
+	Slices        bool   `json:"slices"`
+	Checksums     bool   `json:"checksums"`
+}
+
+// FormatFLAC converts the WAV files to FLAC once written, besides the wav.Formats
+const FormatFLAC = "flac"
+
+// Status is the progress of the current or last conversion
+type Status struct {
+	Running   bool             `json:"running"`
+	Bank      string           `json:"bank,omitempty"` // Bank being converted
+	Banks     int              `json:"banks"`          // Banks to convert, 0 for a folder without banks
+	BanksDone int              `json:"banksDone"`
+	Done      int              `json:"done"` // Files converted in the current folder
+	Total     int              `json:"total"`
+	Log       []string         `json:"log"`
+	Stats     *converter.Stats `json:"stats,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Output    string           `json:"output,omitempty"`
+}
+
+// App serves the page and runs the conversions it requests, one at a time
+type App struct {
+	options Options
+
+	mu       sync.Mutex
+	status   Status
+	uploadID int
+}
+
+// NewApp creates the interface
+func NewApp(options Options) (*App, error) {
+	if err := os.MkdirAll(options.UploadDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating upload directory: %w", err)
+	}
+	return &App{options: options, status: Status{Log: []string{}}}, nil
+}
+
+// Debug logs a message if debug mode is enabled
+func (a *App) Debug(message string) {
+	if a.options.Debug {
+		fmt.Println(message)
+	}
+}
+
+// ServeHTTP routes the page and its API
+//
+//	GET  /                  the page
+//	GET  /api/settings      default settings
+//	GET  /api/browse?dir=   folders, banks and samples of a directory, the home directory by default
+//	POST /api/upload        store a dropped folder, its files named by their relative path
+//	POST /api/convert       start a conversion with the JSON Settings
+//	GET  /api/status        progress of the conversion
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" || r.URL.Path == "/index.html" {
+		a.handleUI(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+	if a.options.Token != "" && r.Header.Get("X-Token") != a.options.Token {
+		writeError(w, http.StatusForbidden, "invalid token")
+		return
+	}
+
+	endpoint := strings.TrimPrefix(r.URL.Path, "/api/")
+	method := http.MethodGet
+	if endpoint == "upload" || endpoint == "convert" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch endpoint {
+	case "settings":
+		writeJSON(w, http.StatusOK, DefaultSettings())
+	case "browse":
+		a.handleBrowse(w, r)
+	case "upload":
+		a.handleUpload(w, r)
+	case "convert":
+		a.handleConvert(w, r)
+	case "status":
+		a.mu.Lock()
+		status := a.status
+		status.Log = append([]string(nil), a.status.Log...)
+		a.mu.Unlock()
+		writeJSON(w, http.StatusOK, status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// DefaultSettings returns the settings the page starts with, converting to WAV into
+// "E-MU Sounds" in the home directory
+func DefaultSettings() Settings {
+	output := "E-MU Sounds"
+	if home, err := os.UserHomeDir(); err == nil {
+		output = filepath.Join(home, output)
+	}
+	return Settings{
+		Output:     output,
+		Format:     wav.FormatWAV,
+		OnConflict: converter.ConflictOverwrite,
+	}
+}
+
+// Entry is an entry of a browsed directory
+type Entry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Dir  bool   `json:"dir"`
+}
+
+// Listing is the content of a browsed directory
+type Listing struct {
+	Dir     string  `json:"dir"`
+	Parent  string  `json:"parent,omitempty"` // Empty at the root
+	Entries []Entry `json:"entries"`
+}
+
+// handleBrowse lists the subdirectories, .exb and .ebl files of a directory
+func (a *App) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserHomeDir(); err != nil {
+			dir = string(filepath.Separator)
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	listing := Listing{Dir: dir, Entries: []Entry{}}
+	if parent := filepath.Dir(dir); parent != dir {
+		listing.Parent = parent
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			info, err := os.Stat(filepath.Join(dir, name))
+			isDir = err == nil && info.IsDir()
+		}
+		ext := strings.ToLower(filepath.Ext(name))
+		if isDir || ext == ".exb" || ext == ".ebl" {
+			listing.Entries = append(listing.Entries, Entry{Name: name, Path: filepath.Join(dir, name), Dir: isDir})
+		}
+	}
+	sort.SliceStable(listing.Entries, func(i, j int) bool {
+		ei, ej := listing.Entries[i], listing.Entries[j]
+		if ei.Dir != ej.Dir {
+			return ei.Dir
+		}
+		return strings.ToLower(ei.Name) < strings.ToLower(ej.Name)
+	})
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// uploadReply is the reply of an upload, giving the path to convert
+type uploadReply struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+}
+
+// handleUpload stores the files of a folder dropped on the page, browsers not giving
+// pages the path of dropped folders. The reply path is the dropped folder, or the
+// upload directory when several items were dropped.
+func (a *App) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("error parsing upload: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	a.mu.Lock()
+	a.uploadID++
+	dir := filepath.Join(a.options.UploadDir, strconv.Itoa(a.uploadID))
+	a.mu.Unlock()
+
+	roots := make(map[string]bool)
+	count := 0
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			rel := path.Clean("/" + strings.ReplaceAll(uploadPath(header), `\`, "/"))[1:]
+			if rel == "" {
+				continue
+			}
+			roots[strings.SplitN(rel, "/", 2)[0]] = true
+			if err := saveUpload(header, filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			count++
+		}
+	}
+	if count == 0 {
+		writeError(w, http.StatusBadRequest, "no files uploaded")
+		return
+	}
+
+	reply := uploadReply{Path: dir, Files: count}
+	if len(roots) == 1 {
+		for root := range roots {
+			reply.Path = filepath.Join(dir, root)
+		}
+	}
+	a.Debug(fmt.Sprintf("Uploaded %d files to %s", count, reply.Path))
+	writeJSON(w, http.StatusOK, reply)
+}
+
+// uploadPath returns the relative path an uploaded file was sent with, which
+// multipart.FileHeader.Filename reduces to its base name
+func uploadPath(header *multipart.FileHeader) string {
+	_, params, err := mime.ParseMediaType(header.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return header.Filename
+	}
+	return params["filename"]
+}
+
+// saveUpload copies an uploaded file to path, creating its directory
+func saveUpload(header *multipart.FileHeader, path string) error {
+	in, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("error reading upload: %w", err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error saving upload: %w", err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error saving upload: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("error saving upload: %w", err)
+	}
+	return nil
+}
+
+// handleConvert validates the settings and starts the conversion
+func (a *App) handleConvert(w http.ResponseWriter, r *http.Request) {
+	var settings Settings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("error decoding settings: %v", err))
+		return
+	}
+	if err := settings.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.mu.Lock()
+	if a.status.Running {
+		a.mu.Unlock()
+		writeError(w, http.StatusConflict, "a conversion is already running")
+		return
+	}
+	a.status = Status{Running: true, Log: []string{}, Output: settings.Output}
+	a.mu.Unlock()
+
+	go a.run(settings)
+	writeJSON(w, http.StatusAccepted, settings)
+}
+
+// validate checks the settings, filling in defaults
+func (s *Settings) validate() error {
+	if s.Input == "" {
+		return fmt.Errorf("pick a bank, a folder or a sample to convert")
+	}
+	info, err := os.Stat(s.Input)
+	if err != nil {
+		return fmt.Errorf("invalid input: %w", err)
+	}
+	if s.Output == "" {
+		return fmt.Errorf("pick an output folder")
+	}
+	if info.IsDir() {
+		if err := safepath.CheckOutput(s.Input, s.Output); err != nil {
+			return fmt.Errorf("pick an output folder outside of the input folder: %w", err)
+		}
+	}
+	if s.Format == "" {
+		s.Format = wav.FormatWAV
+	}
+	if s.Format != wav.FormatWAV && s.Format != wav.FormatRaw && s.Format != FormatFLAC {
+		return fmt.Errorf("unknown format %q", s.Format)
+	}
+	if s.Format == wav.FormatRaw && s.DSPreset {
+		return fmt.Errorf("DecentSampler presets need WAV or FLAC files")
+	}
+	if s.OnConflict == "" {
+		s.OnConflict = converter.ConflictOverwrite
+	}
+	for _, policy := range converter.ConflictPolicies {
+		if s.OnConflict == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown conflict policy %q", s.OnConflict)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
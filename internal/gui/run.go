@@ -0,0 +1,207 @@
+package gui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/dspreset"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/fswalk"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/slices"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+)
+
+// logWriter adds the lines written by the converter to the status log
+type logWriter struct {
+	app *App
+	buf []byte
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		l.app.logLine(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+}
+
+// logLine adds a line to the status log, dropping the oldest ones
+func (a *App) logLine(line string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status.Log = append(a.status.Log, line)
+	if len(a.status.Log) > maxLogLines {
+		a.status.Log = a.status.Log[len(a.status.Log)-maxLogLines:]
+	}
+}
+
+// update modifies the status while holding the app lock
+func (a *App) update(fn func(s *Status)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fn(&a.status)
+}
+
+// run converts the input of the settings: a bank, every bank found in a directory,
+// a directory of samples without banks or a single sample
+func (a *App) run(settings Settings) {
+	out := &logWriter{app: a}
+	stats := converter.NewStats()
+	err := a.convert(settings, stats, out)
+
+	a.update(func(s *Status) {
+		s.Running = false
+		s.Bank = ""
+		s.Stats = stats
+		if err != nil {
+			s.Error = err.Error()
+		}
+	})
+	if err != nil {
+		a.logLine(fmt.Sprintf("Error: %v", err))
+	}
+}
+
+// convert runs the conversion of run, adding the statistics of each converted
+// folder to stats
+func (a *App) convert(settings Settings, stats *converter.Stats, out *logWriter) error {
+	info, err := os.Stat(settings.Input)
+	if err != nil {
+		return err
+	}
+
+	var banks []string
+	if strings.EqualFold(filepath.Ext(settings.Input), ".exb") {
+		banks = []string{settings.Input}
+	} else if info.IsDir() {
+		err := fswalk.Walk(settings.Input, false, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.EqualFold(filepath.Ext(path), ".exb") {
+				banks = append(banks, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error scanning for banks: %w", err)
+		}
+	}
+
+	if len(banks) == 0 {
+		// Samples without a bank, converted into the output directory
+		return a.convertFolder(settings, settings.Input, settings.Output, "", stats, out)
+	}
+
+	a.update(func(s *Status) { s.Banks = len(banks) })
+	root := filepath.Dir(settings.Input)
+	if info.IsDir() {
+		root = settings.Input
+	}
+	for _, bankPath := range banks {
+		name := strings.TrimSuffix(filepath.Base(bankPath), filepath.Ext(bankPath))
+		a.update(func(s *Status) { s.Bank, s.Done, s.Total = name, 0, 0 })
+
+		// Banks are converted into folders mirroring the input tree
+		outputDir := filepath.Join(settings.Output, name)
+		if rel, err := filepath.Rel(root, filepath.Dir(bankPath)); err == nil && rel != "." {
+			outputDir = filepath.Join(settings.Output, rel, name)
+		}
+
+		samplePool, err := exb.FindSamplePool(bankPath)
+		if err == nil {
+			err = a.convertFolder(settings, samplePool, outputDir, name, stats, out)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error converting %s: %v\n", name, err)
+		}
+		a.update(func(s *Status) { s.BanksDone++ })
+	}
+	return nil
+}
+
+// convertFolder converts a directory or file of samples into outputDir, then runs the
+// steps working on the converted files
+func (a *App) convertFolder(settings Settings, input, outputDir, bank string, stats *converter.Stats, out *logWriter) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	format := settings.Format
+	if format == FormatFLAC {
+		format = wav.FormatWAV
+	}
+	conv := converter.NewConverter(converter.Options{
+		Debug:            a.options.Debug,
+		PreserveFilename: settings.PreserveNames,
+		ExbName:          bank,
+		Output:           out,
+		MergeStereo:      settings.MergeStereo,
+		Checksums:        settings.Checksums,
+		Progress: func(event converter.ProgressEvent) {
+			a.update(func(s *Status) { s.Done, s.Total = event.Done, event.Total })
+		},
+		OnConflict: settings.OnConflict,
+		Format:     format,
+		Slices:     settings.Slices,
+	})
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		_, err = conv.ProcessDirectory(input, outputDir)
+	} else if _, err = conv.ConvertFile(input, outputDir); err == nil {
+		a.update(func(s *Status) { s.Done, s.Total = 1, 1 })
+		err = conv.WriteManifest(outputDir)
+	}
+	stats.Add(conv.Stats())
+	if err != nil {
+		return err
+	}
+
+	if settings.Format == FormatFLAC {
+		fmt.Fprintln(out, "Converting WAV files to FLAC...")
+		flacConverter, err := flac.NewConverter(a.options.Debug)
+		if err != nil {
+			return err
+		}
+		err = flacConverter.ConvertDirectory(outputDir)
+		editErr := manifest.Edit(outputDir, func(m *manifest.Manifest) {
+			m.ReplaceExtension(outputDir, ".wav", ".flac")
+		})
+		if editErr == nil && settings.Slices {
+			editErr = slices.ReplaceExtension(outputDir, ".wav", ".flac")
+		}
+		if err == nil {
+			err = editErr
+		}
+		if err != nil {
+			return fmt.Errorf("error converting to FLAC: %w", err)
+		}
+	}
+
+	if settings.DSPreset {
+		name := bank
+		if name == "" {
+			name = filepath.Base(outputDir)
+		}
+		presetPath, err := dspreset.NewExporter(a.options.Debug).ExportDirectory(outputDir, name)
+		if err != nil {
+			return fmt.Errorf("error exporting DecentSampler preset: %w", err)
+		}
+		fmt.Fprintf(out, "DecentSampler preset written to %s\n", presetPath)
+	}
+	return nil
+}
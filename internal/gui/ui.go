@@ -0,0 +1,20 @@
+package gui
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed ui/index.html
+var indexHTML []byte
+
+// handleUI serves the embedded page
+func (a *App) handleUI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
@@ -0,0 +1,123 @@
+// Package i18n translates the progress messages and summaries printed by ebl2wav.
+// Messages are looked up by their English format string in the catalog of the selected
+// language, messages without a translation being printed in English. Lines meant for
+// scripts, such as "EBL READ ERROR:" or "MISSING SAMPLE:", are never translated.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// English is the language messages are written in
+const English = "en"
+
+// locales holds a JSON catalog per language, mapping English format strings to their
+// translation. Translations keep the verbs of the English string, in the same order
+// or with explicit argument indexes such as %[2]d.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	mu       sync.RWMutex
+	language = English
+	catalog  map[string]string
+)
+
+// Languages returns the languages messages can be printed in
+func Languages() []string {
+	languages := []string{English}
+	entries, _ := locales.ReadDir("locales")
+	for _, entry := range entries {
+		languages = append(languages, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Language returns the language messages are printed in
+func Language() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return language
+}
+
+// SetLanguage selects the language messages are printed in, given as a language code
+// ("fr") or a locale ("fr_FR.UTF-8"). The C and POSIX locales select English.
+func SetLanguage(lang string) error {
+	lang = normalize(lang)
+	if lang == English {
+		mu.Lock()
+		defer mu.Unlock()
+		language, catalog = English, nil
+		return nil
+	}
+
+	data, err := locales.ReadFile(path.Join("locales", lang+".json"))
+	if err != nil {
+		return fmt.Errorf("unsupported language %q, available: %s", lang, strings.Join(Languages(), ", "))
+	}
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("error reading %s messages: %w", lang, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	language, catalog = lang, messages
+	return nil
+}
+
+// Detect returns the language of the user's locale, from the LC_ALL, LC_MESSAGES and
+// LANG variables, English when they are unset or name an unsupported language
+func Detect() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		lang := normalize(value)
+		for _, supported := range Languages() {
+			if lang == supported {
+				return lang
+			}
+		}
+		return English
+	}
+	return English
+}
+
+// normalize returns the language code of a locale, "fr" for "fr_FR.UTF-8"
+func normalize(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "" || lang == "c" || lang == "posix" {
+		return English
+	}
+	return lang
+}
+
+// T returns the translation of an English format string, or the string itself when
+// the selected language has none
+func T(format string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if translated, ok := catalog[format]; ok {
+		return translated
+	}
+	return format
+}
+
+// Sprintf formats the translation of an English format string
+func Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(T(format), args...)
+}
@@ -0,0 +1,73 @@
+package i18n
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// verbPattern matches the formatting verbs of a message
+var verbPattern = regexp.MustCompile(`%(?:\[\d+\])?[-+# 0]*\d*(?:\.\d+)?[a-zA-Z%]`)
+
+// verbs returns the verbs of a format string, sorted as translations may reorder them
+// with explicit argument indexes
+func verbs(format string) []string {
+	found := verbPattern.FindAllString(format, -1)
+	for i, verb := range found {
+		found[i] = regexp.MustCompile(`\[\d+\]`).ReplaceAllString(verb, "")
+	}
+	sort.Strings(found)
+	return found
+}
+
+// TestCatalogs checks every translation keeps the verbs of its English message
+func TestCatalogs(t *testing.T) {
+	for _, lang := range Languages() {
+		if lang == English {
+			continue
+		}
+		data, err := locales.ReadFile(path.Join("locales", lang+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			t.Fatalf("%s: %v", lang, err)
+		}
+		for english, translated := range messages {
+			want, got := verbs(english), verbs(translated)
+			if len(want) != len(got) {
+				t.Errorf("%s: %q has verbs %v, translation %q has %v", lang, english, want, translated, got)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s: %q has verbs %v, translation %q has %v", lang, english, want, translated, got)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestSetLanguage(t *testing.T) {
+	defer SetLanguage(English)
+
+	if err := SetLanguage("fr_FR.UTF-8"); err != nil {
+		t.Fatal(err)
+	}
+	if got := T("Summary:"); got != "Résumé :" {
+		t.Errorf("T(Summary:) = %q", got)
+	}
+	if got := T("untranslated"); got != "untranslated" {
+		t.Errorf("untranslated messages should stay in English, got %q", got)
+	}
+	if err := SetLanguage("C"); err != nil || Language() != English {
+		t.Errorf("C locale should select English, got %q, %v", Language(), err)
+	}
+	if err := SetLanguage("xx"); err == nil {
+		t.Error("unsupported languages should fail")
+	}
+}
@@ -0,0 +1,304 @@
+// Package inventory describes a converted bank in a README.md and README.html written
+// next to its samples, so banks stay self-describing once archived or shared: sample
+// counts, total duration, the folders of the SamplePool and the files of the bank.
+package inventory
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// Filenames of the inventory
+const (
+	MarkdownFilename = "README.md"
+	HTMLFilename     = "README.html"
+)
+
+// Folder summarizes the samples of a folder of the bank
+type Folder struct {
+	Path     string // Folder relative to the bank, "." for its root
+	Samples  int
+	Duration float64 // Seconds
+}
+
+// Inventory describes a converted bank
+type Inventory struct {
+	Bank        string
+	Samples     int
+	Mono        int
+	Stereo      int
+	Duration    float64 // Seconds
+	SampleRates []int
+	Folders     []Folder // Folders holding samples
+	Presets     []string // Sampler presets written for the bank
+	Tree        []string // Files of the bank drawn as a tree, one line per file or folder
+}
+
+// Build describes the bank named bank from the manifest stored in dir. Only the samples
+// of the bank are listed when banks share the output directory.
+func Build(dir, bank string) (*Inventory, error) {
+	var m *manifest.Manifest
+	// Read the manifest while holding its lock, banks converted concurrently may be updating it
+	err := manifest.Edit(dir, func(loaded *manifest.Manifest) {
+		m = loaded
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %w", dir, err)
+	}
+	var rootFiles []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			rootFiles = append(rootFiles, entry.Name())
+		}
+	}
+	return New(m, bank, rootFiles), nil
+}
+
+// New describes the bank named bank from its manifest and the names of the files at
+// the root of its folder, e.g. for banks written into an archive
+func New(m *manifest.Manifest, bank string, rootFiles []string) *Inventory {
+
+	inv := &Inventory{Bank: bank}
+	rates := make(map[int]bool)
+	folders := make(map[string]*Folder)
+	var files []string
+	for _, sample := range m.Samples {
+		if sample.Bank != "" && bank != "" && sample.Bank != bank {
+			continue
+		}
+		inv.Samples++
+		inv.Duration += sample.Duration
+		if sample.Channels == 1 {
+			inv.Mono++
+		} else {
+			inv.Stereo++
+		}
+		rates[sample.SampleRate] = true
+
+		dir := path.Dir(sample.Output)
+		folder, ok := folders[dir]
+		if !ok {
+			folder = &Folder{Path: dir}
+			folders[dir] = folder
+		}
+		folder.Samples++
+		folder.Duration += sample.Duration
+
+		for _, file := range []string{sample.Output, sample.Preview, sample.Waveform, sample.SliceMap} {
+			if file != "" {
+				files = append(files, file)
+			}
+		}
+	}
+
+	for rate := range rates {
+		inv.SampleRates = append(inv.SampleRates, rate)
+	}
+	sort.Ints(inv.SampleRates)
+	for _, folder := range folders {
+		inv.Folders = append(inv.Folders, *folder)
+	}
+	sort.Slice(inv.Folders, func(i, j int) bool { return inv.Folders[i].Path < inv.Folders[j].Path })
+
+	// Presets, the catalog and the manifest sit at the root of the bank
+	sort.Strings(rootFiles)
+	for _, name := range rootFiles {
+		if strings.HasPrefix(name, ".") || name == MarkdownFilename || name == HTMLFilename {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".dspreset", ".sfz":
+			if bank == "" || strings.TrimSuffix(name, filepath.Ext(name)) == bank {
+				inv.Presets = append(inv.Presets, name)
+				files = append(files, name)
+			}
+		case ".json", ".csv", ".tsv":
+			files = append(files, name)
+		}
+	}
+	files = append(files, MarkdownFilename, HTMLFilename)
+	inv.Tree = drawTree(files)
+	return inv
+}
+
+// drawTree draws slash separated paths as a tree, folders first
+func drawTree(files []string) []string {
+	type node struct {
+		children map[string]*node
+	}
+	root := &node{children: make(map[string]*node)}
+	for _, file := range files {
+		n := root
+		for _, part := range strings.Split(file, "/") {
+			child, ok := n.children[part]
+			if !ok {
+				child = &node{children: make(map[string]*node)}
+				n.children[part] = child
+			}
+			n = child
+		}
+	}
+
+	var lines []string
+	var draw func(n *node, indent string)
+	draw = func(n *node, indent string) {
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			iDir, jDir := len(n.children[names[i]].children) > 0, len(n.children[names[j]].children) > 0
+			if iDir != jDir {
+				return iDir
+			}
+			return names[i] < names[j]
+		})
+		for i, name := range names {
+			child := n.children[name]
+			branch, next := "├── ", "│   "
+			if i == len(names)-1 {
+				branch, next = "└── ", "    "
+			}
+			if len(child.children) > 0 {
+				name += "/"
+			}
+			lines = append(lines, indent+branch+name)
+			draw(child, indent+next)
+		}
+	}
+	draw(root, "")
+	return lines
+}
+
+// Write writes the README.md and README.html of the bank converted into dir, returning
+// their paths
+func Write(dir, bank string) ([]string, error) {
+	inv, err := Build(dir, bank)
+	if err != nil {
+		return nil, err
+	}
+
+	mdPath := filepath.Join(dir, MarkdownFilename)
+	if err := os.WriteFile(mdPath, []byte(inv.Markdown()), 0644); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", MarkdownFilename, err)
+	}
+
+	htmlPath := filepath.Join(dir, HTMLFilename)
+	file, err := os.Create(htmlPath)
+	if err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", HTMLFilename, err)
+	}
+	if err := inv.HTML(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error writing %s: %w", HTMLFilename, err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("error writing %s: %w", HTMLFilename, err)
+	}
+	return []string{mdPath, htmlPath}, nil
+}
+
+// Markdown renders the inventory as a README.md
+func (inv *Inventory) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", inv.Bank)
+	fmt.Fprintf(&b, "E-MU Emulator X bank converted by ebl2wav.\n\n")
+	fmt.Fprintf(&b, "| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Samples | %d (%d mono, %d stereo) |\n", inv.Samples, inv.Mono, inv.Stereo)
+	fmt.Fprintf(&b, "| Total duration | %s |\n", inv.FormatDuration(inv.Duration))
+	fmt.Fprintf(&b, "| Sample rates | %s |\n", inv.FormatSampleRates())
+	if len(inv.Presets) > 0 {
+		fmt.Fprintf(&b, "| Presets | %s |\n", strings.Join(inv.Presets, ", "))
+	}
+
+	if len(inv.Folders) > 0 {
+		fmt.Fprintf(&b, "\n## Folders\n\n")
+		fmt.Fprintf(&b, "Samples are grouped by the folders of the bank's SamplePool, which usually follow its presets.\n\n")
+		fmt.Fprintf(&b, "| Folder | Samples | Duration |\n|---|---:|---:|\n")
+		for _, folder := range inv.Folders {
+			fmt.Fprintf(&b, "| %s | %d | %s |\n", strings.ReplaceAll(folder.Path, "|", `\|`), folder.Samples, inv.FormatDuration(folder.Duration))
+		}
+	}
+
+	fmt.Fprintf(&b, "\n## Files\n\n```\n%s/\n", inv.Bank)
+	for _, line := range inv.Tree {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	fmt.Fprintf(&b, "```\n")
+	return b.String()
+}
+
+// FormatDuration formats seconds of audio, to the millisecond
+func (inv *Inventory) FormatDuration(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// FormatSampleRates lists the sample rates of the bank
+func (inv *Inventory) FormatSampleRates() string {
+	rates := make([]string, len(inv.SampleRates))
+	for i, rate := range inv.SampleRates {
+		rates[i] = fmt.Sprintf("%d Hz", rate)
+	}
+	return strings.Join(rates, ", ")
+}
+
+// HTML renders the inventory as a README.html written to w
+func (inv *Inventory) HTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, inv)
+}
+
+// htmlTemplate renders the inventory as a README.html
+var htmlTemplate = template.Must(template.New("inventory").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Bank}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; }
+pre { background: #f4f4f4; padding: 1em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Bank}}</h1>
+<p>E-MU Emulator X bank converted by ebl2wav.</p>
+<table>
+<tr><th>Samples</th><td>{{.Samples}} ({{.Mono}} mono, {{.Stereo}} stereo)</td></tr>
+<tr><th>Total duration</th><td>{{.FormatDuration .Duration}}</td></tr>
+<tr><th>Sample rates</th><td>{{.FormatSampleRates}}</td></tr>
+{{- if .Presets}}
+<tr><th>Presets</th><td>{{range $i, $p := .Presets}}{{if $i}}, {{end}}<a href="{{$p}}">{{$p}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- if .Folders}}
+<h2>Folders</h2>
+<p>Samples are grouped by the folders of the bank's SamplePool, which usually follow its presets.</p>
+<table>
+<tr><th>Folder</th><th>Samples</th><th>Duration</th></tr>
+{{- range .Folders}}
+<tr><td>{{.Path}}</td><td>{{.Samples}}</td><td>{{$.FormatDuration .Duration}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Files</h2>
+<pre>{{.Bank}}/
+{{range .Tree}}{{.}}
+{{end}}</pre>
+</body>
+</html>
+`))
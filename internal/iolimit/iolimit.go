@@ -0,0 +1,187 @@
+// Package iolimit throttles the file I/O of conversions, bounding the files open at
+// once and the bytes read and written per second, so large runs over network shares
+// don't saturate the network or trip the protections of NAS devices
+package iolimit
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chunkSize bounds the reads and writes let through at once, so throttled transfers
+// progress steadily instead of in bursts
+const chunkSize = 64 * 1024
+
+// NetworkMaxOpenFiles is the open file limit suggested for inputs and outputs on
+// network shares, when none is set
+const NetworkMaxOpenFiles = 4
+
+// Limiter bounds the files open at once and the throughput of the readers and writers
+// it wraps. A nil Limiter doesn't limit anything.
+type Limiter struct {
+	files chan struct{} // Slots of the open files, nil for no limit
+	rate  int64         // Bytes per second, 0 for no limit
+
+	mu   sync.Mutex
+	next time.Time // When the bytes let through so far are paid for at rate
+}
+
+// NewLimiter returns a limiter allowing maxFiles files open at once and bytesPerSecond
+// of reads and writes together, 0 meaning no limit. It returns nil when nothing is
+// limited.
+func NewLimiter(maxFiles int, bytesPerSecond int64) *Limiter {
+	if maxFiles <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	l := &Limiter{rate: bytesPerSecond}
+	if maxFiles > 0 {
+		l.files = make(chan struct{}, maxFiles)
+	}
+	return l
+}
+
+// Acquire waits until a file can be opened, to be followed by Release once it is
+// closed
+func (l *Limiter) Acquire() {
+	if l != nil && l.files != nil {
+		l.files <- struct{}{}
+	}
+}
+
+// Release frees the slot taken by Acquire
+func (l *Limiter) Release() {
+	if l != nil && l.files != nil {
+		<-l.files
+	}
+}
+
+// wait blocks until n more bytes fit within the throughput limit
+func (l *Limiter) wait(n int) {
+	if l == nil || l.rate <= 0 || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// Reader returns r throttled to the throughput limit
+func (l *Limiter) Reader(r io.Reader) io.Reader {
+	if l == nil || l.rate <= 0 {
+		return r
+	}
+	return &reader{r: r, l: l}
+}
+
+// ReaderAt returns r throttled to the throughput limit
+func (l *Limiter) ReaderAt(r io.ReaderAt) io.ReaderAt {
+	if l == nil || l.rate <= 0 {
+		return r
+	}
+	return &readerAt{r: r, l: l}
+}
+
+// Writer returns w throttled to the throughput limit
+func (l *Limiter) Writer(w io.Writer) io.Writer {
+	if l == nil || l.rate <= 0 {
+		return w
+	}
+	return &writer{w: w, l: l}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.r.Read(p)
+	r.l.wait(n)
+	return n, err
+}
+
+type readerAt struct {
+	r io.ReaderAt
+	l *Limiter
+}
+
+// Close closes the wrapped reader if it is an io.Closer, as streamed EBL files close
+// their source once encoded
+func (r *readerAt) Close() error {
+	if closer, ok := r.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		chunk := p[read:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		n, err := r.r.ReadAt(chunk, off+int64(read))
+		read += n
+		r.l.wait(n)
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+type writer struct {
+	w io.Writer
+	l *Limiter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		w.l.wait(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ParseRate parses a throughput in bytes per second such as "20MB", "512K/s" or
+// "1.5G", using binary units. An empty string is no limit.
+func ParseRate(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	if value == "" {
+		return 0, nil
+	}
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if i := strings.IndexAny(value, "KMG"); i >= 0 && i == len(value)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMG", value[i]) + 1))
+		value = value[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid throughput %q, use a size per second such as 20MB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
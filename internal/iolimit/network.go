@@ -0,0 +1,14 @@
+package iolimit
+
+import "path/filepath"
+
+// IsNetworkPath reports whether path, or the closest of its parents which exists, is
+// on a network share such as an SMB or NFS mount. Paths which can't be checked are
+// reported as local.
+func IsNetworkPath(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return isNetworkPath(abs)
+}
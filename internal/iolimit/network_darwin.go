@@ -0,0 +1,36 @@
+package iolimit
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// networkFilesystems are the filesystem type names of network volumes
+var networkFilesystems = map[string]bool{
+	"smbfs": true, "nfs": true, "afpfs": true, "webdav": true, "cifs": true,
+}
+
+// isNetworkPath asks the filesystem type of path, or of its closest existing parent
+func isNetworkPath(path string) bool {
+	for {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(path, &stat); err == nil {
+			var name []byte
+			for _, c := range stat.Fstypename {
+				if c == 0 {
+					break
+				}
+				name = append(name, byte(c))
+			}
+			return networkFilesystems[string(name)]
+		} else if !os.IsNotExist(err) {
+			return false
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,47 @@
+package iolimit
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// networkFilesystems are the filesystem types of network mounts in /proc/mounts
+var networkFilesystems = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "smbfs": true, "afs": true,
+	"ncpfs": true, "9p": true, "davfs": true, "fuse.sshfs": true, "fuse.rclone": true,
+}
+
+// isNetworkPath finds the mount holding path in /proc/mounts
+func isNetworkPath(path string) bool {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	longest, network := -1, false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		// Spaces in mount points are escaped as \040
+		mountPoint := strings.ReplaceAll(fields[1], `\040`, " ")
+		if !within(path, mountPoint) || len(mountPoint) <= longest {
+			continue
+		}
+		longest, network = len(mountPoint), networkFilesystems[fields[2]]
+	}
+	return network
+}
+
+// within reports whether path is dir or below it
+func within(path, dir string) bool {
+	return path == dir || dir == "/" || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package iolimit
+
+// isNetworkPath reports paths as local, network mounts are only recognized on Linux,
+// macOS and Windows
+func isNetworkPath(path string) bool {
+	return false
+}
@@ -0,0 +1,33 @@
+package iolimit
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// driveRemote is the GetDriveTypeW type of mapped network drives
+const driveRemote = 4
+
+var getDriveType = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDriveTypeW")
+
+// isNetworkPath recognizes UNC paths (\\server\share) and mapped network drives
+func isNetworkPath(path string) bool {
+	if strings.HasPrefix(path, `\\?\UNC\`) {
+		return true
+	}
+	if strings.HasPrefix(path, `\\`) && !strings.HasPrefix(path, `\\?\`) {
+		return true
+	}
+	volume := filepath.VolumeName(strings.TrimPrefix(path, `\\?\`))
+	if volume == "" {
+		return false
+	}
+	root, err := syscall.UTF16PtrFromString(volume + `\`)
+	if err != nil {
+		return false
+	}
+	r, _, _ := getDriveType.Call(uintptr(unsafe.Pointer(root)))
+	return r == driveRemote
+}
@@ -0,0 +1,249 @@
+// Package keymap lays converted samples out on a keyboard for sampler presets, at their
+// root key when known, velocity layers and round robins of a sample sharing its keys
+package keymap
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	FirstNote = 36  // C1, where drum-style mappings traditionally start
+	LastNote  = 127 // Highest MIDI note
+)
+
+// roundRobinPattern matches sample names ending in a round robin index, e.g. "Snare RR2" or "Kick_rr1"
+var roundRobinPattern = regexp.MustCompile(`(?i)^(.*?)[\s_\-]*rr[\s_\-]*(\d+)$`)
+
+// velocityPattern matches a velocity marking, e.g. "Piano C3 v64" or "Snare_vel_100"
+var velocityPattern = regexp.MustCompile(`(?i)(?:^|[\s_\-])v(?:el)?[\s_\-]?(\d{1,3})(?:$|[\s_\-])`)
+
+// dynamicsPattern matches a dynamics marking, e.g. "Violin C3 ff". Single letter
+// markings are left out, p and f mostly being note names or initials.
+var dynamicsPattern = regexp.MustCompile(`(?i)(?:^|[\s_\-])(ppp|pp|mp|mf|ff|fff)(?:$|[\s_\-])`)
+
+// dynamics are the MIDI velocities of the dynamics markings
+var dynamics = map[string]int{"ppp": 16, "pp": 33, "mp": 64, "mf": 80, "ff": 112, "fff": 127}
+
+// layerDirPattern matches the folders added by LayerDir
+var layerDirPattern = regexp.MustCompile(`^(vel_\d{3}|rr\d+)$`)
+
+// Layer returns the velocity and round robin index given by a sample name, 0 when
+// the name has none
+func Layer(name string) (velocity, roundRobin int) {
+	if m := roundRobinPattern.FindStringSubmatch(name); m != nil && m[1] != "" {
+		roundRobin, _ = strconv.Atoi(m[2])
+		name = m[1]
+	}
+	if m := velocityPattern.FindStringSubmatch(name); m != nil {
+		if v, _ := strconv.Atoi(m[1]); v >= 1 && v <= 127 {
+			velocity = v
+		}
+	} else if m := dynamicsPattern.FindStringSubmatch(name); m != nil {
+		velocity = dynamics[strings.ToLower(m[1])]
+	}
+	return velocity, roundRobin
+}
+
+// LayerDir returns the folders grouping a sample by layer, the way sampler auto-mappers
+// expect them: "vel_064" for velocity 64, "rr2" for the second round robin, both nested
+// as "vel_064/rr2", empty for samples whose name gives neither
+func LayerDir(name string) string {
+	velocity, roundRobin := Layer(name)
+	var dirs []string
+	if velocity > 0 {
+		dirs = append(dirs, fmt.Sprintf("vel_%03d", velocity))
+	}
+	if roundRobin > 0 {
+		dirs = append(dirs, fmt.Sprintf("rr%d", roundRobin))
+	}
+	return path.Join(dirs...)
+}
+
+// trimLayerDirs removes the folders added by LayerDir from the end of dir
+func trimLayerDirs(dir string) string {
+	for dir != "." && dir != "/" && layerDirPattern.MatchString(path.Base(dir)) {
+		dir = path.Dir(dir)
+	}
+	return dir
+}
+
+// Sample is a converted sample to lay out on the keyboard
+type Sample struct {
+	Path    string // Slash separated
+	RootKey int    // MIDI unity note, -1 when unknown
+}
+
+// Zone is a range of keys and velocities and the samples it triggers
+type Zone struct {
+	Name    string   // Sample name, without the round robin suffix
+	Root    int      // MIDI root note of the samples
+	LoNote  int      // Lowest key of the zone
+	HiNote  int      // Highest key of the zone
+	LoVel   int      // Lowest velocity of the zone
+	HiVel   int      // Highest velocity of the zone
+	Samples []string // Sample paths, in round robin order
+}
+
+// RoundRobin reports whether the samples of the zone rotate
+func (z Zone) RoundRobin() bool {
+	return len(z.Samples) > 1
+}
+
+// Map lays the samples out on the keyboard. Samples of the same folder, or of its
+// LayerDir folders, whose names only differ by a round robin suffix share a zone.
+//
+// Samples with a known root key are mapped at that key, the keys between the roots of
+// a folder being split halfway between neighbouring roots, the lowest and highest roots
+// spreading to the ends of the keyboard. Samples with no known root key get consecutive
+// keys from FirstNote, in the order they first appear. Either way the velocity layers
+// named by Layer share their key, each layer playing from the velocity above the next
+// softer one up to its own, the loudest up to 127. Map also returns the number of keys
+// left out because they don't fit on the keyboard.
+func Map(samples []Sample) ([]Zone, int) {
+	var zones []*Zone
+	var positions [][]int
+	index := make(map[string]int)
+	for _, s := range samples {
+		stem := strings.TrimSuffix(path.Base(s.Path), path.Ext(s.Path))
+		position := 0
+		if m := roundRobinPattern.FindStringSubmatch(stem); m != nil && m[1] != "" {
+			stem = m[1]
+			position, _ = strconv.Atoi(m[2])
+		}
+		// Zones are scoped per folder so identical names in different folders don't collide,
+		// the layers of a sample sorted into folders by LayerDir sharing its zone
+		id := path.Join(trimLayerDirs(path.Dir(s.Path)), stem)
+
+		i, ok := index[id]
+		if !ok {
+			i = len(zones)
+			index[id] = i
+			zones = append(zones, &Zone{Name: stem, Root: s.RootKey})
+			positions = append(positions, nil)
+		}
+		zones[i].Samples = append(zones[i].Samples, s.Path)
+		positions[i] = append(positions[i], position)
+	}
+
+	// Velocity layers of a key: the zones of a folder sharing a root key, or for samples
+	// with no known root key, sharing a name once the velocity marking is removed
+	var keys []string
+	layers := make(map[string][]*Zone)
+	roots := make(map[string][]int)
+	folders := make(map[*Zone]string)
+	for i, z := range zones {
+		folder := trimLayerDirs(path.Dir(z.Samples[0]))
+		folders[z] = folder
+		key := path.Join(folder, withoutVelocity(z.Name))
+		if z.Root >= 0 {
+			key = folder + "\x00" + strconv.Itoa(z.Root)
+			if len(layers[key]) == 0 {
+				roots[folder] = append(roots[folder], z.Root)
+			}
+		}
+		if len(layers[key]) == 0 {
+			keys = append(keys, key)
+		}
+		layers[key] = append(layers[key], z)
+		sort.Stable(byPosition{z, positions[i]})
+	}
+
+	for _, folderRoots := range roots {
+		sort.Ints(folderRoots)
+	}
+
+	dropped := 0
+	note := FirstNote
+	var mapped []Zone
+	for _, key := range keys {
+		layer := layers[key]
+		loNote, hiNote := note, note
+		if root := layer[0].Root; root >= 0 {
+			loNote, hiNote = span(roots[folders[layer[0]]], root)
+		} else if note > LastNote {
+			dropped++
+			continue
+		} else {
+			note++
+		}
+
+		for _, z := range spreadVelocities(layer) {
+			z.LoNote, z.HiNote = loNote, hiNote
+			if z.Root < 0 {
+				z.Root = loNote
+			}
+			mapped = append(mapped, *z)
+		}
+	}
+	return mapped, dropped
+}
+
+// span returns the keys played by root among the sorted roots of its folder
+func span(roots []int, root int) (lo, hi int) {
+	i := sort.SearchInts(roots, root)
+	lo, hi = 0, LastNote
+	if i > 0 {
+		lo = (roots[i-1]+root)/2 + 1
+	}
+	if i < len(roots)-1 {
+		hi = (root + roots[i+1]) / 2
+	}
+	return lo, hi
+}
+
+// spreadVelocities sets the velocity ranges of the layers of a key, samples naming no
+// velocity counting as the loudest, and returns them from the softest
+func spreadVelocities(layer []*Zone) []*Zone {
+	velocities := make(map[*Zone]int, len(layer))
+	for _, z := range layer {
+		velocity, _ := Layer(z.Name)
+		if velocity == 0 {
+			velocity = 127
+		}
+		velocities[z] = velocity
+	}
+	sort.SliceStable(layer, func(i, j int) bool {
+		return velocities[layer[i]] < velocities[layer[j]]
+	})
+
+	lo := 1
+	for i, z := range layer {
+		if i > 0 && velocities[z] != velocities[layer[i-1]] {
+			lo = velocities[layer[i-1]] + 1
+		}
+		z.LoVel, z.HiVel = lo, velocities[z]
+	}
+	// The loudest layers play up to the highest velocity whatever they are named
+	for i := len(layer) - 1; i >= 0 && velocities[layer[i]] == velocities[layer[len(layer)-1]]; i-- {
+		layer[i].HiVel = 127
+	}
+	return layer
+}
+
+// withoutVelocity removes the velocity or dynamics marking from a sample name
+func withoutVelocity(name string) string {
+	if velocityPattern.MatchString(name) {
+		name = velocityPattern.ReplaceAllString(name, " ")
+	} else {
+		name = dynamicsPattern.ReplaceAllString(name, " ")
+	}
+	return strings.TrimSpace(name)
+}
+
+// byPosition sorts the samples of a zone by their round robin index
+type byPosition struct {
+	z       *Zone
+	indexes []int
+}
+
+func (b byPosition) Len() int           { return len(b.z.Samples) }
+func (b byPosition) Less(i, j int) bool { return b.indexes[i] < b.indexes[j] }
+func (b byPosition) Swap(i, j int) {
+	b.z.Samples[i], b.z.Samples[j] = b.z.Samples[j], b.z.Samples[i]
+	b.indexes[i], b.indexes[j] = b.indexes[j], b.indexes[i]
+}
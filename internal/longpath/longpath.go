@@ -0,0 +1,6 @@
+// Package longpath lets converted libraries be written below deep directories on
+// Windows, where paths are otherwise limited to 260 characters (MAX_PATH)
+package longpath
+
+// Prefix marks Windows paths which aren't subject to the MAX_PATH limit
+const Prefix = `\\?\`
@@ -0,0 +1,26 @@
+//go:build windows
+
+package longpath
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Fix returns the absolute form of path with the \\?\ prefix, so files can be created
+// below it whatever the length of their path. UNC paths (\\server\share) use the
+// \\?\UNC\ form.
+func Fix(path string) string {
+	if strings.HasPrefix(path, Prefix) {
+		return path
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return Prefix + `UNC\` + abs[2:]
+	}
+	return Prefix + abs
+}
@@ -0,0 +1,210 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+)
+
+// Filename is the name of the manifest written at the root of an output directory
+const Filename = "manifest.json"
+
+// SidecarExt is the extension of the checksum files written next to converted files
+const SidecarExt = ".sha256"
+
+// Manifest describes the samples produced by a conversion run
+type Manifest struct {
+	Bank    string   `json:"bank,omitempty"`
+	Samples []Sample `json:"samples"`
+}
+
+// Sample describes a single converted sample
+type Sample struct {
+	Bank          string   `json:"bank,omitempty"`
+	Source        string   `json:"source"`                 // Path of the source EBL file
+	SourceSHA256  string   `json:"sourceSha256,omitempty"` // Hex SHA-256 of the source EBL file
+	Pair          string   `json:"pair,omitempty"`         // Right half's EBL file when merged from a stereo pair
+	PairSHA256    string   `json:"pairSha256,omitempty"`
+	Output        string   `json:"output"`           // Path of the produced audio file, relative to the manifest
+	SHA256        string   `json:"sha256,omitempty"` // Hex SHA-256 of the produced audio file
+	Name          string   `json:"name"`             // Sample name decoded from the EBL header
+	Comment       string   `json:"comment,omitempty"`
+	SampleRate    int      `json:"sampleRate"`
+	Channels      int      `json:"channels"`
+	Frames        int      `json:"frames"`
+	Duration      float64  `json:"duration"`                // Seconds
+	RootKey       *int     `json:"rootKey,omitempty"`       // MIDI note, omitted when unknown
+	DetectedPitch float64  `json:"detectedPitch,omitempty"` // Fundamental frequency in Hz estimated by -detect-pitch, RootKey then giving its nearest note
+	Variant       string   `json:"variant,omitempty"`       // EBL layout variant, e.g. "TOC2+extended"
+	Strategy      string   `json:"strategy,omitempty"`      // Alternate parse strategy which read the file after the standard one failed, e.g. "extra-header"
+	Issues        []string `json:"issues,omitempty"`        // Header inconsistencies found by -verify
+	Warnings      []string `json:"warnings,omitempty"`      // Anomalies which didn't stop the conversion, e.g. an implausible sample rate replaced
+	Anomalies     []string `json:"anomalies,omitempty"`     // Audio anomalies found by -anomalies
+	Preview       string   `json:"preview,omitempty"`       // Path of the short preview written by -previews, relative to the manifest
+	Waveform      string   `json:"waveform,omitempty"`      // Path of the waveform image written by -waveform, relative to the manifest
+	SliceMap      string   `json:"sliceMap,omitempty"`      // Path of the slice map written by -slices, relative to the manifest
+	Category      string   `json:"category,omitempty"`      // Folder the sample was sorted into by -by-category
+}
+
+// editMu serializes read-modify-write cycles of manifests, as banks converted
+// concurrently may share an output directory
+var editMu sync.Mutex
+
+// Edit loads the manifest stored in dir (or starts a new one), applies fn and saves it
+func Edit(dir string, fn func(m *Manifest)) error {
+	editMu.Lock()
+	defer editMu.Unlock()
+
+	m, err := Load(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		m = &Manifest{}
+	}
+
+	fn(m)
+	return m.Save(dir)
+}
+
+// Merge adds samples converted from bank, replacing previous entries with the same output.
+// Samples are kept sorted by output so the manifest doesn't depend on conversion order.
+func (m *Manifest) Merge(bank string, samples []Sample) {
+	if len(m.Samples) == 0 {
+		m.Bank = bank
+	} else if m.Bank != bank {
+		// The directory holds several banks, each sample records its own
+		m.Bank = ""
+	}
+
+	replaced := make(map[string]bool, len(samples))
+	for _, sample := range samples {
+		replaced[sample.Output] = true
+	}
+
+	kept := m.Samples[:0]
+	for _, sample := range m.Samples {
+		if !replaced[sample.Output] {
+			kept = append(kept, sample)
+		}
+	}
+	m.Samples = append(kept, samples...)
+	sort.SliceStable(m.Samples, func(i, j int) bool {
+		return m.Samples[i].Output < m.Samples[j].Output
+	})
+}
+
+// Load reads the manifest stored in dir
+func Load(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, Filename))
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error decoding manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to dir
+func (m *Manifest) Save(dir string) error {
+	data, err := m.marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := atomicfile.WriteFile(filepath.Join(dir, Filename), data); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	return nil
+}
+
+// Encode writes the manifest to w as Save stores it
+func (m *Manifest) Encode(w io.Writer) error {
+	data, err := m.marshal()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	return nil
+}
+
+// marshal returns the indented JSON of the manifest
+func (m *Manifest) marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding manifest: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ReplaceExtension updates outputs ending in oldExt to newExt when the renamed file exists in dir,
+// e.g. after WAV files were transcoded to FLAC
+func (m *Manifest) ReplaceExtension(dir, oldExt, newExt string) {
+	for i, sample := range m.Samples {
+		if !strings.EqualFold(filepath.Ext(sample.Output), oldExt) {
+			continue
+		}
+		renamed := strings.TrimSuffix(sample.Output, filepath.Ext(sample.Output)) + newExt
+		renamedPath := filepath.Join(dir, filepath.FromSlash(renamed))
+		if _, err := os.Stat(renamedPath); err != nil {
+			continue
+		}
+		m.Samples[i].Output = renamed
+
+		// The checksum and its sidecar describe the previous file
+		if sample.SHA256 == "" {
+			continue
+		}
+		m.Samples[i].SHA256, _ = Checksum(renamedPath)
+		oldSidecar := filepath.Join(dir, filepath.FromSlash(sample.Output)) + SidecarExt
+		if _, err := os.Stat(oldSidecar); err == nil && m.Samples[i].SHA256 != "" {
+			os.Remove(oldSidecar)
+			WriteSidecar(renamedPath, m.Samples[i].SHA256)
+		}
+	}
+}
+
+// Checksum returns the hex SHA-256 of the file at path
+func Checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// WriteSidecar writes the checksum of the file at path to path.sha256, in the format
+// read by sha256sum -c
+func WriteSidecar(path, sum string) error {
+	if err := os.WriteFile(path+SidecarExt, []byte(SidecarLine(path, sum)), 0644); err != nil {
+		return fmt.Errorf("error writing checksum file: %w", err)
+	}
+	return nil
+}
+
+// SidecarLine returns the content of the checksum file of the file at path, see WriteSidecar
+func SidecarLine(path, sum string) string {
+	return fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+}
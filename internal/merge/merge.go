@@ -0,0 +1,243 @@
+// Package merge consolidates converted banks into a single library, where samples shared
+// by several banks are stored once and every bank gets presets referencing them
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/dspreset"
+	"github.com/mattetti/e-mu-soundbanks/internal/keymap"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/internal/safepath"
+	"github.com/mattetti/e-mu-soundbanks/internal/sfz"
+)
+
+// SamplesDir is the folder of a library holding the samples of every bank
+const SamplesDir = "Samples"
+
+// Bank is a bank converted on its own, to be merged into a library
+type Bank struct {
+	Name string // Bank name, naming its presets
+	Dir  string // Directory the bank was converted into, holding its manifest
+}
+
+// Result describes a merged library
+type Result struct {
+	Banks   int      // Banks merged
+	Samples int      // Samples of every bank
+	Unique  int      // Distinct samples stored in SamplesDir
+	Saved   int64    // Bytes of the duplicate samples removed
+	Presets []string // SFZ and DecentSampler presets written, relative to the library
+}
+
+// Merger moves the samples of converted banks into a library
+type Merger struct {
+	dir     string
+	debug   bool
+	out     io.Writer // Destination of debug messages, see SetOutput
+	result  Result
+	samples []manifest.Sample
+	shared  map[string]manifest.Sample // Kept sample of each source, by sourceKey
+	used    map[string]bool            // Paths taken in the library, lowercased
+}
+
+// NewMerger creates a merger writing the library into dir
+func NewMerger(dir string, debug bool) *Merger {
+	return &Merger{
+		dir:    dir,
+		debug:  debug,
+		out:    os.Stdout,
+		shared: make(map[string]manifest.Sample),
+		used:   make(map[string]bool),
+	}
+}
+
+// SetOutput sets where debug messages are written, os.Stdout by default
+func (m *Merger) SetOutput(w io.Writer) {
+	m.out = w
+}
+
+// Debug logs a message if debug mode is enabled
+func (m *Merger) Debug(message string) {
+	if m.debug {
+		fmt.Fprintln(m.out, message)
+	}
+}
+
+// Merge moves the samples of banks into the SamplesDir folder of the library, keeping
+// one copy of the samples converted from identical EBL files, and writes an SFZ
+// instrument and a DecentSampler preset per bank at the root of the library, along with
+// a manifest listing the samples of every bank. Banks are merged in order, samples
+// keeping the path and metadata of the first bank they are found in. Banks without
+// a manifest, such as those which failed to convert, are skipped.
+func (m *Merger) Merge(banks []Bank) (*Result, error) {
+	for _, bank := range banks {
+		if err := m.mergeBank(bank); err != nil {
+			return nil, fmt.Errorf("error merging %s: %w", bank.Name, err)
+		}
+	}
+
+	lib := &manifest.Manifest{Samples: m.samples}
+	sort.SliceStable(lib.Samples, func(i, j int) bool {
+		if lib.Samples[i].Bank != lib.Samples[j].Bank {
+			return lib.Samples[i].Bank < lib.Samples[j].Bank
+		}
+		return lib.Samples[i].Output < lib.Samples[j].Output
+	})
+	if err := lib.Save(m.dir); err != nil {
+		return nil, err
+	}
+	return &m.result, nil
+}
+
+// mergeBank moves the samples of a bank into the library and writes its presets
+func (m *Merger) mergeBank(bank Bank) error {
+	bankManifest, err := manifest.Load(bank.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		m.Debug(fmt.Sprintf("No manifest in %s, skipping", bank.Dir))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var outputs []keymap.Sample
+	referenced := make(map[string]bool)
+	for _, sample := range bankManifest.Samples {
+		sample.Bank = bank.Name
+		if err := m.mergeSample(bank.Dir, &sample); err != nil {
+			return err
+		}
+		m.samples = append(m.samples, sample)
+		m.result.Samples++
+
+		// Identical samples of a bank are mapped once
+		if !referenced[sample.Output] {
+			referenced[sample.Output] = true
+			output := keymap.Sample{Path: sample.Output, RootKey: -1}
+			if sample.RootKey != nil {
+				output.RootKey = *sample.RootKey
+			}
+			outputs = append(outputs, output)
+		}
+	}
+	m.result.Banks++
+
+	// Keep the copies of the files which failed to convert, one folder per bank
+	errorDir := filepath.Join(bank.Dir, safepath.ErrorsDir)
+	if _, err := os.Stat(errorDir); err == nil {
+		rel := m.claim(path.Join(safepath.ErrorsDir, bank.Name), "/")
+		dst := filepath.Join(m.dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("error creating error directory: %w", err)
+		}
+		if err := os.Rename(errorDir, dst); err != nil {
+			return fmt.Errorf("error moving saved errors: %w", err)
+		}
+	}
+
+	if len(outputs) == 0 {
+		return nil
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Path < outputs[j].Path })
+
+	// Presets sit at the root of the library, next to the folder of the samples they map
+	name := m.claim(bank.Name, ".sfz", ".dspreset")
+	if err := sfz.NewExporter(m.debug).Write(filepath.Join(m.dir, name+".sfz"), name, outputs); err != nil {
+		return err
+	}
+	if err := dspreset.NewExporter(m.debug).Write(filepath.Join(m.dir, name+".dspreset"), name, outputs); err != nil {
+		return err
+	}
+	m.result.Presets = append(m.result.Presets, name+".sfz", name+".dspreset")
+	return nil
+}
+
+// mergeSample moves a sample converted into bankDir into the library, or removes it when
+// the library already holds the sample of the same source, and points its manifest entry
+// at the library copy
+func (m *Merger) mergeSample(bankDir string, sample *manifest.Sample) error {
+	src := filepath.Join(bankDir, filepath.FromSlash(sample.Output))
+	key := sourceKey(sample)
+	if kept, ok := m.shared[key]; ok && key != "" {
+		info, err := os.Stat(src)
+		if err != nil {
+			return fmt.Errorf("error reading sample: %w", err)
+		}
+		if err := safepath.Remove(src); err != nil {
+			return fmt.Errorf("error removing duplicate sample: %w", err)
+		}
+		os.Remove(src + manifest.SidecarExt)
+		m.result.Saved += info.Size()
+		m.Debug(fmt.Sprintf("%s duplicates %s", sample.Output, kept.Output))
+
+		sample.Output = kept.Output
+		sample.SHA256 = kept.SHA256
+		return nil
+	}
+
+	ext := path.Ext(sample.Output)
+	output := m.claim(path.Join(SamplesDir, strings.TrimSuffix(sample.Output, ext)), ext) + ext
+	dst := filepath.Join(m.dir, filepath.FromSlash(output))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("error creating sample folder: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("error moving sample: %w", err)
+	}
+	if _, err := os.Stat(src + manifest.SidecarExt); err == nil {
+		// The checksum file names the sample, which may have been renamed
+		os.Remove(src + manifest.SidecarExt)
+		if err := manifest.WriteSidecar(dst, sample.SHA256); err != nil {
+			return err
+		}
+	}
+
+	sample.Output = output
+	if key != "" {
+		m.shared[key] = *sample
+	}
+	m.result.Unique++
+	return nil
+}
+
+// claim returns base, or base followed by " (2)", " (3)"... when a file named after it
+// with one of exts is already part of the library, and reserves the names with exts
+func (m *Merger) claim(base string, exts ...string) string {
+	for n := 1; ; n++ {
+		name := base
+		if n > 1 {
+			name = fmt.Sprintf("%s (%d)", base, n)
+		}
+
+		taken := false
+		for _, ext := range exts {
+			taken = taken || m.used[strings.ToLower(name+ext)]
+		}
+		if taken {
+			continue
+		}
+		for _, ext := range exts {
+			m.used[strings.ToLower(name+ext)] = true
+		}
+		return name
+	}
+}
+
+// sourceKey identifies the samples converted from identical EBL files, or is empty when
+// the source checksum is unknown. The extension is part of the key as samples FFmpeg
+// failed to transcode stay WAV files.
+func sourceKey(sample *manifest.Sample) string {
+	if sample.SourceSHA256 == "" {
+		return ""
+	}
+	return sample.SourceSHA256 + "+" + sample.PairSHA256 + strings.ToLower(path.Ext(sample.Output))
+}
@@ -0,0 +1,144 @@
+// Package pitch estimates the fundamental frequency of pitched samples with the YIN
+// algorithm, giving a root key to samples whose name doesn't carry one
+package pitch
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Range of the detected frequencies and parameters of the analysis
+const (
+	minFrequency = 30.0   // About B0
+	maxFrequency = 4200.0 // About C8
+	skipAttack   = 0.02   // Seconds skipped at the start, where transients dominate
+	maxFrames    = 8      // Analysis windows spread over the start of the sample
+	threshold    = 0.15   // YIN aperiodicity threshold, lower values being more periodic
+	minVoiced    = 0.5    // Share of the windows that must agree on a pitch
+)
+
+// Estimate is a detected pitch
+type Estimate struct {
+	Frequency float64 // Fundamental frequency in Hz
+	Note      int     // Nearest MIDI note
+	Cents     int     // Tuning relative to Note, -50..50
+}
+
+// NewEstimate returns the estimate of a frequency
+func NewEstimate(frequency float64) Estimate {
+	midi := 69 + 12*math.Log2(frequency/440)
+	note := int(math.Round(midi))
+	return Estimate{
+		Frequency: frequency,
+		Note:      note,
+		Cents:     int(math.Round(100 * (midi - float64(note)))),
+	}
+}
+
+// Detect reads 16-bit little endian mono PCM and estimates its pitch. ok is false
+// for unpitched audio such as drums and noise, or samples too short to tell.
+func Detect(r io.Reader, sampleRate int) (estimate Estimate, ok bool, err error) {
+	if sampleRate <= 0 {
+		return Estimate{}, false, nil
+	}
+	minLag := int(float64(sampleRate) / maxFrequency)
+	maxLag := int(float64(sampleRate) / minFrequency)
+	window := maxLag
+	skip := int(skipAttack * float64(sampleRate))
+
+	// Read the attack and up to maxFrames windows, each needing maxLag more samples
+	samples, err := readSamples(r, skip+maxFrames*window+maxLag)
+	if err != nil {
+		return Estimate{}, false, err
+	}
+	if len(samples) < skip+window+maxLag {
+		skip = 0
+	}
+	if len(samples) < window+maxLag {
+		return Estimate{}, false, nil
+	}
+
+	var periods []float64
+	frames := 0
+	for start := skip; start+window+maxLag <= len(samples) && frames < maxFrames; start += window {
+		frames++
+		if period, voiced := yin(samples[start:start+window+maxLag], window, minLag, maxLag); voiced {
+			periods = append(periods, period)
+		}
+	}
+	if float64(len(periods)) < minVoiced*float64(frames) {
+		return Estimate{}, false, nil
+	}
+
+	sort.Float64s(periods)
+	return NewEstimate(float64(sampleRate) / periods[len(periods)/2]), true, nil
+}
+
+// yin returns the period in samples of a window of x, x holding maxLag more
+// samples than the window
+func yin(x []float64, window, minLag, maxLag int) (float64, bool) {
+	// Difference function, cumulative mean normalized
+	d := make([]float64, maxLag+1)
+	d[0] = 1
+	var sum float64
+	for lag := 1; lag <= maxLag; lag++ {
+		var diff float64
+		for j := 0; j < window; j++ {
+			delta := x[j] - x[j+lag]
+			diff += delta * delta
+		}
+		sum += diff
+		if sum == 0 {
+			d[lag] = 1
+		} else {
+			d[lag] = diff * float64(lag) / sum
+		}
+	}
+
+	// First dip below the threshold, followed down to its minimum
+	for lag := max(minLag, 2); lag < maxLag; lag++ {
+		if d[lag] >= threshold {
+			continue
+		}
+		for lag+1 < maxLag && d[lag+1] < d[lag] {
+			lag++
+		}
+
+		// Parabolic interpolation around the minimum
+		a, b, c := d[lag-1], d[lag], d[lag+1]
+		period := float64(lag)
+		if denom := a - 2*b + c; denom != 0 {
+			period += (a - c) / (2 * denom)
+		}
+		return period, true
+	}
+	return 0, false
+}
+
+// readSamples reads up to n 16-bit little endian samples
+func readSamples(r io.Reader, n int) ([]float64, error) {
+	br := bufio.NewReader(r)
+	samples := make([]float64, 0, n)
+	var pair [2]byte
+	for len(samples) < n {
+		if _, err := io.ReadFull(br, pair[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading audio: %w", err)
+		}
+		samples = append(samples, float64(int16(binary.LittleEndian.Uint16(pair[:]))))
+	}
+	return samples, nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+// Package playback plays WAV files through the default audio device, using the audio
+// player command of the platform so no audio library needs to be linked in
+package playback
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Player is an audio player command, the file to play being appended to its arguments
+type Player struct {
+	Path string
+	Args []string
+}
+
+// candidates lists the players looked for in PATH, by platform, in order of preference
+var candidates = map[string][][]string{
+	"darwin": {
+		{"afplay"},
+		{"ffplay", "-nodisp", "-autoexit", "-loglevel", "error"},
+	},
+	"windows": {
+		{"ffplay", "-nodisp", "-autoexit", "-loglevel", "error"},
+	},
+	"linux": {
+		{"ffplay", "-nodisp", "-autoexit", "-loglevel", "error"},
+		{"pw-play"},
+		{"paplay"},
+		{"aplay", "-q"},
+	},
+}
+
+// Find returns the player to use. command, when not empty, is the player given by the
+// user, a command line the file is appended to. Otherwise the players of the platform
+// are looked for in PATH, falling back to PowerShell on Windows.
+func Find(command string) (*Player, error) {
+	if command != "" {
+		fields := strings.Fields(command)
+		path, err := exec.LookPath(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("player %s not found: %w", fields[0], err)
+		}
+		return &Player{Path: path, Args: fields[1:]}, nil
+	}
+
+	players, ok := candidates[runtime.GOOS]
+	if !ok {
+		players = candidates["linux"]
+	}
+	for _, player := range players {
+		if path, err := exec.LookPath(player[0]); err == nil {
+			return &Player{Path: path, Args: player[1:]}, nil
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		if path, err := exec.LookPath("powershell"); err == nil {
+			return &Player{Path: path}, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio player found. Please install ffplay (part of ffmpeg), or give a player command with -player")
+}
+
+// Play plays the WAV file at path, returning once it has been played or ctx is done
+func (p *Player) Play(ctx context.Context, path string) error {
+	args := append(append([]string{}, p.Args...), path)
+	if strings.EqualFold(strings.TrimSuffix(filepath.Base(p.Path), filepath.Ext(p.Path)), "powershell") {
+		// System.Media.SoundPlayer plays WAV files without any other dependency
+		quoted := "'" + strings.ReplaceAll(path, "'", "''") + "'"
+		args = []string{"-NoProfile", "-Command", "(New-Object Media.SoundPlayer " + quoted + ").PlaySync()"}
+	}
+
+	cmd := exec.CommandContext(ctx, p.Path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error playing %s with %s: %w", filepath.Base(path), filepath.Base(p.Path), err)
+	}
+	return nil
+}
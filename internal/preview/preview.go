@@ -0,0 +1,214 @@
+// Package preview renders short, low-bitrate previews of converted samples with
+// ffmpeg, for browsable online catalogs that shouldn't ship the full-quality audio
+package preview
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// Dir is the directory previews are written to, relative to the output directory
+const Dir = "previews"
+
+// Preview formats
+const (
+	FormatMP3 = "mp3"
+	FormatOGG = "ogg"
+)
+
+// fadeLength is the length in seconds of the fade out ending previews, and at most
+// half of short samples
+const fadeLength = 0.5
+
+// Generator renders sample previews
+type Generator struct {
+	ffmpegPath string
+	debug      bool
+	out        io.Writer // Destination of debug messages and ffmpeg output, see SetOutput
+	format     string
+	length     float64 // Maximum preview length in seconds
+	maxWorkers int
+}
+
+// NewGenerator creates a generator of previews in format (FormatMP3 or FormatOGG)
+// lasting at most length seconds
+func NewGenerator(debug bool, format string, length float64) (*Generator, error) {
+	if format != FormatMP3 && format != FormatOGG {
+		return nil, fmt.Errorf("unknown preview format %q", format)
+	}
+	if length <= 0 {
+		return nil, fmt.Errorf("preview length must be positive")
+	}
+
+	ffmpegPath, err := flac.FindFFmpeg()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Generator{
+		ffmpegPath: ffmpegPath,
+		debug:      debug,
+		out:        os.Stdout,
+		format:     format,
+		length:     length,
+		maxWorkers: runtime.NumCPU(),
+	}, nil
+}
+
+// SetOutput sets where debug messages and ffmpeg output are written, os.Stdout by default
+func (g *Generator) SetOutput(w io.Writer) {
+	g.out = w
+}
+
+// Render writes the preview of the audio file at input to output. duration is the
+// length of the input in seconds, used to place the fade out of short samples.
+func (g *Generator) Render(input, output string, duration float64) error {
+	length := g.length
+	if duration > 0 && duration < length {
+		length = duration
+	}
+	fade := fadeLength
+	if fade > length/2 {
+		fade = length / 2
+	}
+
+	args := []string{
+		"-i", input,
+		"-t", fmt.Sprintf("%.3f", length),
+		"-af", fmt.Sprintf("afade=t=in:d=0.005,afade=t=out:st=%.3f:d=%.3f", length-fade, fade),
+		"-map_metadata", "-1", // Previews don't need the sample metadata
+		"-fflags", "+bitexact", "-flags:a", "+bitexact", // Leave out the encoder version for reproducible output
+	}
+	switch g.format {
+	case FormatMP3:
+		args = append(args, "-c:a", "libmp3lame", "-b:a", "96k")
+	case FormatOGG:
+		args = append(args, "-c:a", "libvorbis", "-q:a", "2")
+	}
+	args = append(args, "-y", output)
+
+	cmd := exec.Command(g.ffmpegPath, args...)
+	if g.debug {
+		cmd.Stdout = g.out
+		cmd.Stderr = os.Stderr
+		fmt.Fprintf(g.out, "Running: %s\n", cmd.String())
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error rendering preview of %s: %w", filepath.Base(input), err)
+	}
+	return nil
+}
+
+// GenerateDirectory renders a preview of every sample listed in the manifest of dir
+// into dir/previews, mirroring the layout of the converted files, and records the
+// previews in the manifest. Samples already having their preview are skipped.
+func (g *Generator) GenerateDirectory(dir string) (int, error) {
+	m, err := manifest.Load(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	type job struct {
+		index    int
+		input    string
+		output   string
+		preview  string
+		duration float64
+	}
+
+	var jobs []job
+	queued := make(map[string]bool)
+	for i, sample := range m.Samples {
+		preview := path.Join(Dir, strings.TrimSuffix(sample.Output, path.Ext(sample.Output))+"."+g.format)
+		output := filepath.Join(dir, filepath.FromSlash(preview))
+		if queued[preview] {
+			continue
+		}
+		queued[preview] = true
+		if sample.Preview == preview {
+			if _, err := os.Stat(output); err == nil {
+				continue
+			}
+		}
+		jobs = append(jobs, job{i, filepath.Join(dir, filepath.FromSlash(sample.Output)), output, preview, sample.Duration})
+	}
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+
+	queue := make(chan job)
+	rendered := make([]bool, len(m.Samples))
+	var errMu sync.Mutex
+	var errorCount int
+	var lastErr error
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(g.maxWorkers, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				err := os.MkdirAll(filepath.Dir(j.output), 0755)
+				if err == nil {
+					err = g.Render(j.input, j.output, j.duration)
+				}
+				if err != nil {
+					errMu.Lock()
+					errorCount++
+					lastErr = err
+					errMu.Unlock()
+					continue
+				}
+				rendered[j.index] = true
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+
+	// Point the manifest at the previews, matching the samples by output as the
+	// manifest may have been updated meanwhile
+	previews := make(map[string]string)
+	for _, j := range jobs {
+		if rendered[j.index] {
+			previews[m.Samples[j.index].Output] = j.preview
+		}
+	}
+	count := len(previews)
+	editErr := manifest.Edit(dir, func(m *manifest.Manifest) {
+		for i, sample := range m.Samples {
+			if preview, ok := previews[sample.Output]; ok {
+				m.Samples[i].Preview = preview
+			}
+		}
+	})
+	if editErr != nil {
+		return count, editErr
+	}
+
+	if errorCount > 0 {
+		return count, fmt.Errorf("%d previews failed: %w", errorCount, lastErr)
+	}
+	return count, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
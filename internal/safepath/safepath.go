@@ -0,0 +1,98 @@
+// Package safepath keeps conversions from touching their source files: outputs can't
+// be written inside the input tree, where later scans would pick them up, and EBL
+// and EXB files are never replaced or removed
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutputInInput is returned by CheckOutput when the output directory is inside the
+// input directory
+var ErrOutputInInput = errors.New("output directory is inside the input directory")
+
+// ErrSourceFile is returned when a source EBL or EXB file would be replaced or removed
+var ErrSourceFile = errors.New("refusing to modify a source EBL or EXB file")
+
+// ErrorsDir is the folder of the output directory that copies of failed files are
+// saved into, the only place EBL files are written to
+const ErrorsDir = "errors"
+
+// IsSource reports whether path names an EBL or EXB file
+func IsSource(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".ebl" || ext == ".exb"
+}
+
+// CheckOutput returns an error wrapping ErrOutputInInput when output is input or a
+// directory below it, links being resolved. output doesn't have to exist yet.
+func CheckOutput(input, output string) error {
+	in, err := resolve(input)
+	if err != nil {
+		return err
+	}
+	out, err := resolve(output)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(in, out); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is inside %s", ErrOutputInInput, output, input)
+	}
+	return nil
+}
+
+// resolve returns the absolute path of path with the links of its existing part
+// resolved
+func resolve(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var rest []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return filepath.Join(append([]string{abs}, rest...)...), nil
+		}
+		rest = append([]string{filepath.Base(abs)}, rest...)
+		abs = parent
+	}
+}
+
+// Remove removes a converted file, refusing to remove EBL and EXB files
+func Remove(path string) error {
+	if IsSource(path) {
+		return fmt.Errorf("%w: %s", ErrSourceFile, path)
+	}
+	return os.Remove(path)
+}
+
+// FindSource returns the first EBL or EXB file found below dir, outside of its
+// errors folder, or an empty string when dir only holds converted files
+func FindSource(dir string) (string, error) {
+	var source string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && info.Name() == ErrorsDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if IsSource(path) {
+			source = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return source, err
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+)
+
+// Job statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Job represents a conversion requested through the HTTP API
+type Job struct {
+	ID       string                   `json:"id"`
+	Status   string                   `json:"status"`
+	Bank     string                   `json:"bank,omitempty"`
+	Source   string                   `json:"source"` // Uploaded input directory or requested path
+	Flac     bool                     `json:"flac"`
+	Error    string                   `json:"error,omitempty"`
+	Created  time.Time                `json:"created"`
+	Finished *time.Time               `json:"finished,omitempty"`
+	Progress *converter.ProgressEvent `json:"progress,omitempty"` // Files handled so far, while running
+	Stats    *converter.Stats         `json:"stats,omitempty"`
+	Files    []string                 `json:"files,omitempty"` // Output files, relative to the job output directory
+
+	dir       string // Job directory, holding the uploaded inputs and the outputs
+	outputDir string
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+)
+
+// BankInfo describes an EXB bank found in the library
+type BankInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // Relative to the library root, slash separated
+}
+
+// SampleInfo describes a sample of a bank
+type SampleInfo struct {
+	Name       string  `json:"name"`
+	Path       string  `json:"path"` // Relative to the library root, slash separated
+	Comment    string  `json:"comment,omitempty"`
+	SampleRate int     `json:"sampleRate"`
+	Channels   int     `json:"channels"`
+	Duration   float64 `json:"duration"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// resolve converts a slash separated path relative to the library root to a file path,
+// rejecting paths escaping the root
+func (s *Server) resolve(rel string) (string, error) {
+	clean := filepath.FromSlash(strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+rel)), "/"))
+	if clean == "" || clean == "." {
+		return "", fmt.Errorf("path is required")
+	}
+	return filepath.Join(s.options.Root, clean), nil
+}
+
+// handleAPI routes the library browsing endpoints used by the web UI. They are only
+// available when a library root is set, so the server never exposes the directory it
+// happens to be started from.
+//
+//	GET /api/banks                          list EXB banks below the library root
+//	GET /api/samples?bank={path}            list the samples of a bank
+//	GET /api/audio?path={path}[&download=1] decode an EBL file to WAV on the fly
+//	GET /api/download?bank={path}&path=...  download the selected samples as a zip archive
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request, endpoint string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.options.Root == "" {
+		writeError(w, http.StatusForbidden, "no library root, start the server with -root to browse banks")
+		return
+	}
+
+	switch endpoint {
+	case "banks":
+		s.handleBanks(w)
+	case "samples":
+		s.handleSamples(w, r)
+	case "audio":
+		s.handleAudio(w, r)
+	case "download":
+		s.handleDownload(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleBanks lists every .exb file below the library root
+func (s *Server) handleBanks(w http.ResponseWriter) {
+	root := s.options.Root
+	banks := []BankInfo{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.ToLower(filepath.Ext(path)) != ".exb" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		banks = append(banks, BankInfo{
+			Name: strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())),
+			Path: filepath.ToSlash(rel),
+		})
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("error scanning library: %v", err))
+		return
+	}
+
+	sort.Slice(banks, func(i, j int) bool { return banks[i].Path < banks[j].Path })
+	writeJSON(w, http.StatusOK, banks)
+}
+
+// handleSamples lists the samples of a bank: the EBL files its references point to,
+// in the order and folders stored in the EXB file, then the other EBL files of its
+// sample folder, then the references without an EBL file. Banks without references
+// list every EBL file of their sample folder.
+func (s *Server) handleSamples(w http.ResponseWriter, r *http.Request) {
+	bankPath, err := s.resolve(r.URL.Query().Get("bank"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	poolDir, err := exb.FindSamplePool(bankPath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	check, err := exb.CheckPool(bankPath, poolDir, false)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	files := append(append([]string{}, check.Referenced...), check.Orphans...)
+
+	parser := ebl.NewParser(false, false)
+	parser.SetHeadersOnly(true)
+	samples := []SampleInfo{}
+	for _, file := range files {
+		filePath := filepath.Join(poolDir, filepath.FromSlash(file))
+		rel, err := filepath.Rel(s.options.Root, filePath)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		sample := SampleInfo{
+			Name: strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)),
+			Path: filepath.ToSlash(rel),
+		}
+		eblFile, err := parser.ReadFile(filePath, "")
+		if err != nil {
+			sample.Error = err.Error()
+		} else {
+			if name := eblFile.Name(); name != "" {
+				sample.Name = name
+			}
+			sample.Comment = eblFile.HeaderData.CommentStr
+			sample.SampleRate = eblFile.HeaderData.SampleRate
+			sample.Channels = eblFile.Channels()
+			sample.Duration = eblFile.Duration()
+		}
+		samples = append(samples, sample)
+	}
+	for _, ref := range check.Missing {
+		samples = append(samples, SampleInfo{
+			Name:  strings.TrimSuffix(path.Base(ref), path.Ext(ref)),
+			Error: "missing from the sample folder",
+		})
+	}
+
+	writeJSON(w, http.StatusOK, samples)
+}
+
+// handleAudio decodes an EBL file and streams it as WAV, for previews and single downloads
+func (s *Server) handleAudio(w http.ResponseWriter, r *http.Request) {
+	eblPath, err := s.resolve(r.URL.Query().Get("path"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	eblFile, err := ebl.NewParser(false, false).ReadFile(eblPath, "")
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	encoder := wav.NewEncoder(false, false, false, "")
+	var buf bytes.Buffer
+	if err := encoder.WriteWAVTo(&buf, eblFile); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	if r.URL.Query().Get("download") != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", encoder.OutputFilename(eblFile)))
+	}
+	// ServeContent handles range requests, which browsers use to seek in audio elements
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+}
+
+// handleDownload converts the selected samples of a bank into a zip archive
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	paths := query["path"]
+	if len(paths) == 0 {
+		writeError(w, http.StatusBadRequest, "no samples selected")
+		return
+	}
+
+	bank := ""
+	if bankPath := query.Get("bank"); bankPath != "" {
+		bank = strings.TrimSuffix(filepath.Base(bankPath), filepath.Ext(bankPath))
+	}
+	name := bank
+	if name == "" {
+		name = "samples"
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+
+	parser := ebl.NewParser(false, false)
+	encoder := wav.NewEncoder(false, false, false, bank)
+	zw := zip.NewWriter(w)
+	for _, rel := range paths {
+		eblPath, err := s.resolve(rel)
+		if err != nil {
+			continue
+		}
+		eblFile, err := parser.ReadFile(eblPath, "")
+		if err != nil {
+			s.Debug(fmt.Sprintf("Skipping %s: %v", rel, err))
+			continue
+		}
+		out, err := zw.Create(encoder.OutputFilename(eblFile))
+		if err != nil {
+			return
+		}
+		if err := encoder.WriteWAVTo(out, eblFile); err != nil {
+			s.Debug(fmt.Sprintf("Error encoding %s: %v", rel, err))
+			return
+		}
+	}
+	zw.Close()
+}
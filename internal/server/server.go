@@ -0,0 +1,568 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+	"github.com/mattetti/e-mu-soundbanks/pkg/convert"
+)
+
+// maxConvertSize bounds the EBL files converted in memory by POST /convert
+const maxConvertSize = 256 << 20
+
+// maxUploadMemory is the part of a multipart upload kept in memory, the rest is spooled to disk
+const maxUploadMemory = 32 << 20
+
+// expiryInterval is how often finished jobs are checked for expiry
+const expiryInterval = time.Minute
+
+// Options represents the server options
+type Options struct {
+	Debug   bool
+	WorkDir string        // Directory holding uploaded inputs and job outputs
+	Root    string        // Directory path based jobs must point inside, and the web UI browses. Path based jobs are rejected when empty.
+	JobTTL  time.Duration // Finished jobs and their files are removed this long after finishing, kept while the server runs when 0
+}
+
+// Server exposes the converter over HTTP
+type Server struct {
+	options Options
+	queue   chan *Job
+
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	nextID int
+}
+
+// NewServer creates a new server and starts its conversion worker
+func NewServer(options Options) (*Server, error) {
+	if err := os.MkdirAll(options.WorkDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating work directory: %w", err)
+	}
+
+	s := &Server{
+		options: options,
+		queue:   make(chan *Job, 128),
+		jobs:    make(map[string]*Job),
+	}
+	go s.worker()
+	if options.JobTTL > 0 {
+		go s.expireJobs()
+	}
+
+	return s, nil
+}
+
+// Debug logs a message if debug mode is enabled
+func (s *Server) Debug(message string) {
+	if s.options.Debug {
+		fmt.Println(message)
+	}
+}
+
+// ServeHTTP routes API requests
+//
+//	GET  /jobs                    list jobs
+//	POST /jobs                    create a job from a multipart upload or a JSON {"path": ...} body
+//	GET  /jobs/{id}               job status
+//	GET  /jobs/{id}/files/{path}  download a converted file
+//	GET  /jobs/{id}/zip           download every converted file as a zip archive
+//	POST /convert                 convert the EBL file of the request body, answering with the WAV file
+//
+// The web UI is served at / and uses the library endpoints under /api/.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 4)
+	switch {
+	case parts[0] == "" || parts[0] == "index.html":
+		s.handleUI(w, r)
+		return
+	case parts[0] == "api" && len(parts) == 2:
+		s.handleAPI(w, r, parts[1])
+		return
+	case parts[0] == "convert" && len(parts) == 1:
+		s.handleConvert(w, r)
+		return
+	case parts[0] != "jobs":
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleList(w)
+		case http.MethodPost:
+			s.handleCreate(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	job := s.job(parts[1])
+	if job == nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		writeJSON(w, http.StatusOK, job)
+	case len(parts) == 3 && parts[2] == "zip":
+		s.handleZip(w, job)
+	case len(parts) == 4 && parts[2] == "files":
+		s.handleFile(w, r, job, parts[3])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// job returns a snapshot of the job with the given ID, or nil
+func (s *Server) job(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil
+	}
+	snapshot := *job
+	return &snapshot
+}
+
+// handleList writes every known job, oldest first
+func (s *Server) handleList(w http.ResponseWriter) {
+	s.mu.Lock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Created.Before(jobs[j].Created)
+	})
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// createRequest is the JSON body accepted by POST /jobs
+type createRequest struct {
+	Path string `json:"path"` // .ebl file, directory of .ebl files or .exb file
+	Flac bool   `json:"flac"`
+}
+
+// handleCreate creates a job from an upload or a server side path and queues it
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+
+	jobDir := filepath.Join(s.options.WorkDir, id)
+	job := &Job{
+		ID:        id,
+		Status:    StatusQueued,
+		Created:   time.Now(),
+		dir:       jobDir,
+		outputDir: filepath.Join(jobDir, "output"),
+	}
+
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		err = s.prepareUpload(r, job, filepath.Join(jobDir, "input"))
+	} else {
+		err = s.preparePath(r, job)
+	}
+	if err != nil {
+		os.RemoveAll(jobDir)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.jobs[id] = job
+	snapshot := *job
+	s.mu.Unlock()
+
+	s.queue <- job
+	writeJSON(w, http.StatusAccepted, snapshot)
+}
+
+// handleConvert converts the EBL file of the request body in memory, without creating a
+// job or touching the work directory
+func (s *Server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	c, err := convert.New(convert.WithDebug(s.options.Debug))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var out bytes.Buffer
+	sample, err := c.Convert(http.MaxBytesReader(w, r.Body, maxConvertSize), "upload.ebl", &out)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", sample.Name+".wav"))
+	w.Header().Set("Content-Length", strconv.Itoa(out.Len()))
+	w.Write(out.Bytes())
+}
+
+// prepareUpload stores the uploaded .ebl files of a multipart request in inputDir.
+// An uploaded .exb file, or the "bank" form field, names the bank.
+func (s *Server) prepareUpload(r *http.Request, job *Job, inputDir string) error {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		return fmt.Errorf("error parsing upload: %w", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if err := os.MkdirAll(inputDir, 0755); err != nil {
+		return fmt.Errorf("error creating input directory: %w", err)
+	}
+
+	job.Source = inputDir
+	job.Bank = r.FormValue("bank")
+	job.Flac, _ = strconv.ParseBool(r.FormValue("flac"))
+
+	count := 0
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			name := filepath.Base(filepath.FromSlash(header.Filename))
+			switch strings.ToLower(filepath.Ext(name)) {
+			case ".exb":
+				if job.Bank == "" {
+					job.Bank = strings.TrimSuffix(name, filepath.Ext(name))
+				}
+				continue
+			case ".ebl":
+			default:
+				return fmt.Errorf("unsupported file type: %s", name)
+			}
+
+			if err := saveUpload(header, filepath.Join(inputDir, name)); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+
+	if count == 0 {
+		return fmt.Errorf("no .ebl files uploaded")
+	}
+	return nil
+}
+
+// saveUpload copies an uploaded file to path
+func saveUpload(header *multipart.FileHeader, path string) error {
+	in, err := header.Open()
+	if err != nil {
+		return fmt.Errorf("error reading upload: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error saving upload: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("error saving upload: %w", err)
+	}
+	return nil
+}
+
+// preparePath validates the server side path of a JSON job request
+func (s *Server) preparePath(r *http.Request, job *Job) error {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return fmt.Errorf("error decoding request: %w", err)
+	}
+	if req.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	if s.options.Root == "" {
+		return fmt.Errorf("no root, start the server with -root to convert server side paths")
+	}
+
+	// Symbolic links are resolved first, so links inside the root can't point outside of it
+	root, err := filepath.Abs(s.options.Root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid root: %w", err)
+	}
+	source, err := filepath.Abs(req.Path)
+	if err == nil {
+		source, err = filepath.EvalSymlinks(source)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+	if rel, err := filepath.Rel(root, source); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path is outside of the served root")
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("invalid path: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(source))
+	switch {
+	case info.IsDir():
+	case ext == ".exb":
+		job.Bank = strings.TrimSuffix(filepath.Base(req.Path), filepath.Ext(req.Path))
+		if source, err = exb.FindSamplePool(source); err != nil {
+			return err
+		}
+	case ext == ".ebl":
+	default:
+		return fmt.Errorf("path must be an .ebl file, an .exb file or a directory")
+	}
+
+	job.Source = source
+	job.Flac = req.Flac
+	return nil
+}
+
+// worker runs queued jobs one at a time
+func (s *Server) worker() {
+	for job := range s.queue {
+		s.update(job, func(j *Job) { j.Status = StatusRunning })
+		s.Debug(fmt.Sprintf("Job %s: converting %s", job.ID, job.Source))
+
+		stats, files, err := s.run(job)
+
+		s.update(job, func(j *Job) {
+			now := time.Now()
+			j.Finished = &now
+			j.Stats = stats
+			j.Files = files
+			if err != nil {
+				j.Status = StatusFailed
+				j.Error = err.Error()
+			} else {
+				j.Status = StatusDone
+			}
+		})
+	}
+}
+
+// expireJobs removes the jobs finished for longer than the job TTL
+func (s *Server) expireJobs() {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.removeExpired(now)
+	}
+}
+
+// removeExpired removes the jobs finished for longer than the job TTL at now, with
+// their uploads and outputs
+func (s *Server) removeExpired(now time.Time) {
+	var expired []*Job
+	s.mu.Lock()
+	for id, job := range s.jobs {
+		if job.Finished != nil && now.Sub(*job.Finished) >= s.options.JobTTL {
+			expired = append(expired, job)
+			delete(s.jobs, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, job := range expired {
+		s.Debug(fmt.Sprintf("Job %s: expired", job.ID))
+		if err := os.RemoveAll(job.dir); err != nil {
+			s.Debug(fmt.Sprintf("Job %s: error removing files: %v", job.ID, err))
+		}
+	}
+}
+
+// update modifies a job while holding the server lock
+func (s *Server) update(job *Job, fn func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+// run converts the job source and returns the conversion statistics and produced files
+func (s *Server) run(job *Job) (*converter.Stats, []string, error) {
+	if err := os.MkdirAll(job.outputDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	conv := converter.NewConverter(converter.Options{
+		Debug:   s.options.Debug,
+		ExbName: job.Bank,
+		Progress: func(event converter.ProgressEvent) {
+			s.update(job, func(j *Job) { j.Progress = &event })
+		},
+	})
+
+	info, err := os.Stat(job.Source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		_, err = conv.ProcessDirectory(job.Source, job.outputDir)
+	} else if _, err = conv.ConvertFile(job.Source, job.outputDir); err == nil {
+		err = conv.WriteManifest(job.outputDir)
+	}
+	if err != nil {
+		return conv.Stats(), nil, err
+	}
+
+	if job.Flac {
+		flacConverter, err := flac.NewConverter(s.options.Debug)
+		if err != nil {
+			return conv.Stats(), nil, err
+		}
+		err = flacConverter.ConvertDirectory(job.outputDir)
+		editErr := manifest.Edit(job.outputDir, func(m *manifest.Manifest) {
+			m.ReplaceExtension(job.outputDir, ".wav", ".flac")
+		})
+		if err == nil && editErr != nil {
+			err = fmt.Errorf("error updating manifest: %w", editErr)
+		}
+		if err != nil {
+			return conv.Stats(), nil, err
+		}
+	}
+
+	files, err := listFiles(job.outputDir)
+	return conv.Stats(), files, err
+}
+
+// listFiles returns every file below dir as sorted slash separated relative paths
+func listFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing output files: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// handleFile serves a single converted file
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request, job *Job, name string) {
+	if job.Status != StatusDone {
+		writeError(w, http.StatusConflict, "job is "+job.Status)
+		return
+	}
+
+	// path.Clean on a rooted path removes any ".." component
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	filePath := filepath.Join(job.outputDir, filepath.FromSlash(clean))
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(clean)))
+	http.ServeFile(w, r, filePath)
+}
+
+// handleZip streams every converted file of a job as a zip archive
+func (s *Server) handleZip(w http.ResponseWriter, job *Job) {
+	if job.Status != StatusDone {
+		writeError(w, http.StatusConflict, "job is "+job.Status)
+		return
+	}
+
+	name := job.Bank
+	if name == "" {
+		name = "job-" + job.ID
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".zip"))
+
+	zw := zip.NewWriter(w)
+	for _, file := range job.Files {
+		if err := addToZip(zw, filepath.Join(job.outputDir, filepath.FromSlash(file)), file); err != nil {
+			// Headers are already sent, all we can do is stop the archive short
+			s.Debug(fmt.Sprintf("Job %s: error zipping %s: %v", job.ID, file, err))
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		s.Debug(fmt.Sprintf("Job %s: error closing zip: %v", job.ID, err))
+	}
+}
+
+// addToZip copies the file at filePath into the archive under name
+func addToZip(zw *zip.Writer, filePath, name string) error {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/converter"
+	"github.com/mattetti/e-mu-soundbanks/internal/dspreset"
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/exb"
+)
+
+// Library exposes the parser and converter as RPC methods.
+// The argument and reply types below form the RPC schema: fields may be added but
+// existing ones must keep their names and meaning so external tools keep working.
+type Library struct {
+	debug bool
+	out   io.Writer // Destination of converter messages
+}
+
+// NewLibrary creates a new library service writing converter messages to out
+func NewLibrary(debug bool, out io.Writer) *Library {
+	return &Library{
+		debug: debug,
+		out:   out,
+	}
+}
+
+// Sample describes a parsed EBL file
+type Sample struct {
+	Name       string  `json:"name"`
+	Path       string  `json:"path"`
+	Comment    string  `json:"comment,omitempty"`
+	SampleRate int     `json:"sampleRate"`
+	Channels   int     `json:"channels"`
+	Frames     int     `json:"frames"`
+	Duration   float64 `json:"duration"`
+	RootKey    int     `json:"rootKey"` // -1 when unknown
+	Error      string  `json:"error,omitempty"`
+}
+
+// BankArgs are the arguments of ParseBank
+type BankArgs struct {
+	Path string `json:"path"` // Path of the .exb file
+}
+
+// Bank is the reply of ParseBank
+type Bank struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	SamplePool string   `json:"samplePool"`
+	Samples    []Sample `json:"samples"`
+}
+
+// ParseBank parses every sample in the SamplePool of an EXB bank
+func (l *Library) ParseBank(args BankArgs, reply *Bank) error {
+	if strings.ToLower(filepath.Ext(args.Path)) != ".exb" {
+		return fmt.Errorf("path must point to an .exb file")
+	}
+
+	samplePool, err := exb.FindSamplePool(args.Path)
+	if err != nil {
+		return err
+	}
+	samples, err := l.scan(samplePool)
+	if err != nil {
+		return err
+	}
+
+	*reply = Bank{
+		Name:       strings.TrimSuffix(filepath.Base(args.Path), filepath.Ext(args.Path)),
+		Path:       args.Path,
+		SamplePool: samplePool,
+		Samples:    samples,
+	}
+	return nil
+}
+
+// ListArgs are the arguments of ListSamples
+type ListArgs struct {
+	Dir string `json:"dir"` // Directory scanned recursively for .ebl files
+}
+
+// ListSamples parses every EBL file below a directory
+func (l *Library) ListSamples(args ListArgs, reply *[]Sample) error {
+	samples, err := l.scan(args.Dir)
+	if err != nil {
+		return err
+	}
+	*reply = samples
+	return nil
+}
+
+// ConvertArgs are the arguments of ConvertSample
+type ConvertArgs struct {
+	Path      string `json:"path"`      // Path of the .ebl file
+	OutputDir string `json:"outputDir"` // Directory receiving the WAV file
+	Bank      string `json:"bank"`      // Optional bank name prefixed to the output filename
+}
+
+// ConvertReply is the reply of ConvertSample
+type ConvertReply struct {
+	Output string `json:"output"` // Path of the written WAV file
+	Sample Sample `json:"sample"`
+}
+
+// ConvertSample converts a single EBL file to WAV
+func (l *Library) ConvertSample(args ConvertArgs, reply *ConvertReply) error {
+	if err := os.MkdirAll(args.OutputDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	conv := converter.NewConverter(converter.Options{
+		Debug:   l.debug,
+		ExbName: args.Bank,
+		Output:  l.out,
+	})
+	if _, err := conv.ConvertFile(args.Path, args.OutputDir); err != nil {
+		return err
+	}
+
+	converted := conv.Samples()[0]
+	rootKey := -1
+	if converted.RootKey != nil {
+		rootKey = *converted.RootKey
+	}
+	*reply = ConvertReply{
+		Output: converted.Output,
+		Sample: Sample{
+			Name:       converted.Name,
+			Path:       args.Path,
+			Comment:    converted.Comment,
+			SampleRate: converted.SampleRate,
+			Channels:   converted.Channels,
+			Frames:     converted.Frames,
+			Duration:   converted.Duration,
+			RootKey:    rootKey,
+		},
+	}
+	return nil
+}
+
+// ExportArgs are the arguments of ExportPreset
+type ExportArgs struct {
+	Dir  string `json:"dir"`  // Directory of converted samples
+	Name string `json:"name"` // Preset name, defaults to the directory name
+}
+
+// ExportReply is the reply of ExportPreset
+type ExportReply struct {
+	Path string `json:"path"` // Path of the written .dspreset file
+}
+
+// ExportPreset writes a DecentSampler preset for a directory of converted samples
+func (l *Library) ExportPreset(args ExportArgs, reply *ExportReply) error {
+	name := args.Name
+	if name == "" {
+		name = filepath.Base(args.Dir)
+	}
+
+	exporter := dspreset.NewExporter(l.debug)
+	exporter.SetOutput(l.out)
+	presetPath, err := exporter.ExportDirectory(args.Dir, name)
+	if err != nil {
+		return err
+	}
+	reply.Path = presetPath
+	return nil
+}
+
+// scan parses every EBL file below dir, recording parse errors per sample
+func (l *Library) scan(dir string) ([]Sample, error) {
+	parser := ebl.NewParser(l.debug, false)
+	parser.SetOutput(l.out)
+	parser.SetHeadersOnly(true)
+	samples := []Sample{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.ToLower(filepath.Ext(path)) != ".ebl" {
+			return nil
+		}
+
+		eblFile, err := parser.ReadFile(path, "")
+		if err != nil {
+			samples = append(samples, Sample{
+				Name:    strings.TrimSuffix(info.Name(), filepath.Ext(info.Name())),
+				Path:    path,
+				RootKey: -1,
+				Error:   err.Error(),
+			})
+			return nil
+		}
+		samples = append(samples, describe(path, eblFile))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", dir, err)
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Path < samples[j].Path })
+	return samples, nil
+}
+
+// describe converts a parsed EBL file to its RPC representation
+func describe(path string, eblFile *ebl.EBLFile) Sample {
+	return Sample{
+		Name:       eblFile.Name(),
+		Path:       path,
+		Comment:    eblFile.HeaderData.CommentStr,
+		SampleRate: eblFile.HeaderData.SampleRate,
+		Channels:   eblFile.Channels(),
+		Frames:     eblFile.Frames(),
+		Duration:   eblFile.Duration(),
+		RootKey:    eblFile.RootKey,
+	}
+}
@@ -0,0 +1,88 @@
+package sfz
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/keymap"
+)
+
+// Exporter writes SFZ instruments referencing converted samples
+type Exporter struct {
+	debug bool
+	out   io.Writer // Destination of warnings and debug messages, see SetOutput
+}
+
+// NewExporter creates a new SFZ exporter
+func NewExporter(debug bool) *Exporter {
+	return &Exporter{
+		debug: debug,
+		out:   os.Stdout,
+	}
+}
+
+// SetOutput sets where warnings and debug messages are written, os.Stdout by default
+func (e *Exporter) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// Debug logs a message if debug mode is enabled
+func (e *Exporter) Debug(message string) {
+	if e.debug {
+		fmt.Fprintln(e.out, message)
+	}
+}
+
+// Write writes an instrument mapping samples, given as paths relative to the instrument
+// with forward slashes, the way DecentSampler presets map them: at their root key with
+// the key and velocity ranges of keymap.Map, samples only differing by a round robin
+// suffix rotating in a shared zone
+func (e *Exporter) Write(sfzPath, name string, samples []keymap.Sample) error {
+	zones, dropped := keymap.Map(samples)
+	if dropped > 0 {
+		fmt.Fprintf(e.out, "Warning: %d samples don't fit on the keyboard and were left out of %s.sfz\n",
+			dropped, name)
+	}
+
+	// Sample paths may hold spaces, so they come last on each line where players read
+	// them up to the end of the line
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n// Written by ebl2wav\n", name)
+
+	// Single-sample zones share one group, round robin zones each get their own group
+	grouped := false
+	for _, z := range zones {
+		if z.RoundRobin() {
+			continue
+		}
+		if !grouped {
+			b.WriteString("\n<group>\n")
+			grouped = true
+		}
+		fmt.Fprintf(&b, "<region> %s sample=%s\n", region(z), z.Samples[0])
+	}
+
+	for _, z := range zones {
+		if !z.RoundRobin() {
+			continue
+		}
+		e.Debug(fmt.Sprintf("Round robin detected for %s (%d samples)", z.Name, len(z.Samples)))
+		fmt.Fprintf(&b, "\n<group> seq_length=%d\n", len(z.Samples))
+		for j, path := range z.Samples {
+			fmt.Fprintf(&b, "<region> %s seq_position=%d sample=%s\n", region(z), j+1, path)
+		}
+	}
+
+	if err := os.WriteFile(sfzPath, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("error writing SFZ instrument: %w", err)
+	}
+	return nil
+}
+
+// region returns the opcodes giving the keys and velocities of z
+func region(z keymap.Zone) string {
+	return fmt.Sprintf("lokey=%d hikey=%d pitch_keycenter=%d lovel=%d hivel=%d",
+		z.LoNote, z.HiNote, z.Root, z.LoVel, z.HiVel)
+}
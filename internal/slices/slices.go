@@ -0,0 +1,160 @@
+// Package slices cuts loops at the regions marked in their EBL header, writing one
+// file per slice and a slice map giving their position in the loop, so they can be
+// reassembled tempo-synced in DAWs like REX files
+package slices
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+)
+
+// Dir is the directory slices are written to, next to the sliced samples. Each
+// sample gets a folder named after its output file.
+const Dir = "slices"
+
+// MapFilename is the name of the slice map written with the slices of a sample
+const MapFilename = "slices.json"
+
+// Slice is a slice of a loop
+type Slice struct {
+	File     string  `json:"file"`     // Slice file, in the directory of the map
+	Start    int     `json:"start"`    // First frame of the slice in the loop
+	End      int     `json:"end"`      // Frame following the slice
+	Time     float64 `json:"time"`     // Start of the slice in seconds
+	Duration float64 `json:"duration"` // Seconds
+}
+
+// Map describes how the slices of a loop are laid out
+type Map struct {
+	Sample     string  `json:"sample"` // Sample name decoded from the header
+	Source     string  `json:"source"` // Output file of the whole loop, relative to the map
+	SampleRate int     `json:"sampleRate"`
+	Frames     int     `json:"frames"`
+	Duration   float64 `json:"duration"` // Seconds
+	Slices     []Slice `json:"slices"`
+}
+
+// Bounds returns the slices of a sample of frames frames cut at the start and end of
+// each region, in order. Regions overlapping each other cut the sample at each of
+// their bounds.
+func Bounds(regions []ebl.Region, frames int) []ebl.Region {
+	points := []int{0, frames}
+	for _, region := range regions {
+		points = append(points, region.Start, region.End)
+	}
+	sort.Ints(points)
+
+	var bounds []ebl.Region
+	for i := 1; i < len(points); i++ {
+		if points[i] > points[i-1] && points[i-1] >= 0 && points[i] <= frames {
+			bounds = append(bounds, ebl.Region{Start: points[i-1], End: points[i]})
+		}
+	}
+	return bounds
+}
+
+// Write cuts the sample written to outputPath at its regions, encoding the slices
+// with encoder next to a slice map. It returns the path of the map, empty when the
+// sample has no region to cut it at.
+func Write(encoder *wav.Encoder, eblFile *ebl.EBLFile, outputPath string) (string, error) {
+	bounds := Bounds(eblFile.Regions(), eblFile.Frames())
+	if len(bounds) < 2 {
+		return "", nil
+	}
+
+	base := strings.TrimSuffix(filepath.Base(outputPath), filepath.Ext(outputPath))
+	dir := filepath.Join(filepath.Dir(outputPath), Dir, base)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating slice directory: %w", err)
+	}
+
+	rate := float64(eblFile.HeaderData.SampleRate)
+	m := Map{
+		Sample:     eblFile.Name(),
+		Source:     filepath.ToSlash(filepath.Join("..", "..", filepath.Base(outputPath))),
+		SampleRate: eblFile.HeaderData.SampleRate,
+		Frames:     eblFile.Frames(),
+		Duration:   eblFile.Duration(),
+	}
+	for i, bound := range bounds {
+		slice := eblFile.Slice(bound.Start, bound.End)
+		suffix := fmt.Sprintf(" %02d", i+1)
+		slice.HeaderData.FilenameStr = eblFile.Name() + suffix
+		slice.Filename = strings.TrimSuffix(eblFile.Filename, ".ebl") + suffix + ".ebl"
+
+		filename := encoder.OutputFilename(slice)
+		if err := encoder.WriteFile(slice, filepath.Join(dir, filename)); err != nil {
+			return "", fmt.Errorf("error writing slice %d: %w", i+1, err)
+		}
+		m.Slices = append(m.Slices, Slice{
+			File:     filename,
+			Start:    bound.Start,
+			End:      bound.End,
+			Time:     float64(bound.Start) / rate,
+			Duration: float64(bound.End-bound.Start) / rate,
+		})
+	}
+
+	mapPath := filepath.Join(dir, MapFilename)
+	if err := save(mapPath, m); err != nil {
+		return "", err
+	}
+	return mapPath, nil
+}
+
+// save writes a slice map to path
+func save(path string, m Map) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding slice map: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing slice map: %w", err)
+	}
+	return nil
+}
+
+// ReplaceExtension points the slice maps below dir at the files with extension to
+// instead of from, for the files that exist, as when WAV files are encoded to FLAC
+func ReplaceExtension(dir, from, to string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != MapFilename || filepath.Base(filepath.Dir(filepath.Dir(path))) != Dir {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading slice map: %w", err)
+		}
+		var m Map
+		if err := json.Unmarshal(data, &m); err != nil {
+			return fmt.Errorf("error decoding slice map %s: %w", path, err)
+		}
+		replace := func(name string) string {
+			if !strings.EqualFold(filepath.Ext(name), from) {
+				return name
+			}
+			replaced := strings.TrimSuffix(name, filepath.Ext(name)) + to
+			if _, err := os.Stat(filepath.Join(filepath.Dir(path), filepath.FromSlash(replaced))); err != nil {
+				return name
+			}
+			return replaced
+		}
+		m.Source = replace(m.Source)
+		for i := range m.Slices {
+			m.Slices[i].File = replace(m.Slices[i].File)
+		}
+		return save(path, m)
+	})
+}
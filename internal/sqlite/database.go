@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/manifest"
+)
+
+// schema creates the tables of a sample database
+const schema = `
+CREATE TABLE IF NOT EXISTS banks (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	output_dir TEXT NOT NULL,
+	archive TEXT,
+	UNIQUE (name, output_dir)
+);
+CREATE TABLE IF NOT EXISTS samples (
+	id INTEGER PRIMARY KEY,
+	bank_id INTEGER NOT NULL REFERENCES banks (id),
+	name TEXT NOT NULL,
+	comment TEXT,
+	source TEXT NOT NULL,
+	source_sha256 TEXT,
+	pair TEXT,
+	path TEXT NOT NULL,
+	sha256 TEXT,
+	sample_rate INTEGER,
+	channels INTEGER,
+	frames INTEGER,
+	duration REAL,
+	root_key INTEGER,
+	variant TEXT,
+	issues TEXT,
+	converted_at TEXT NOT NULL,
+	UNIQUE (bank_id, path)
+);
+CREATE INDEX IF NOT EXISTS samples_name ON samples (name);
+CREATE INDEX IF NOT EXISTS samples_duration ON samples (duration);
+CREATE INDEX IF NOT EXISTS samples_sample_rate ON samples (sample_rate);
+`
+
+// Database writes conversion results to a SQLite database file using the sqlite3 command
+type Database struct {
+	path        string
+	sqlite3Path string
+	debug       bool
+	out         io.Writer  // Destination of debug messages and sqlite3 output, see SetOutput
+	mu          sync.Mutex // Serializes writes of concurrently converted banks
+}
+
+// NewDatabase creates the database at path if needed
+func NewDatabase(path string, debug bool) (*Database, error) {
+	sqlite3Path, err := exec.LookPath(sqlite3Binary())
+	if err != nil {
+		return nil, fmt.Errorf("sqlite3 not found. Please install sqlite3 to use the database output")
+	}
+
+	d := &Database{
+		path:        path,
+		sqlite3Path: sqlite3Path,
+		debug:       debug,
+		out:         os.Stdout,
+	}
+	if err := d.exec(schema); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetOutput sets where debug messages and sqlite3 output are written, os.Stdout by default
+func (d *Database) SetOutput(w io.Writer) {
+	d.out = w
+}
+
+// Debug logs a message if debug mode is enabled
+func (d *Database) Debug(message string) {
+	if d.debug {
+		fmt.Fprintln(d.out, message)
+	}
+}
+
+// AddManifest records the samples of a manifest. outputDir is where the converted files
+// live, archive the zip they were packaged into if any. Samples without a bank are
+// recorded under name.
+func (d *Database) AddManifest(m *manifest.Manifest, name, outputDir, archive string) error {
+	if absDir, err := filepath.Abs(outputDir); err == nil {
+		outputDir = absDir
+	}
+	if archive != "" {
+		if absArchive, err := filepath.Abs(archive); err == nil {
+			archive = absArchive
+		}
+	}
+	convertedAt := time.Now().UTC().Format(time.RFC3339)
+
+	var sql strings.Builder
+	sql.WriteString("BEGIN;\n")
+	banks := make(map[string]bool)
+	for _, sample := range m.Samples {
+		bank := sample.Bank
+		if bank == "" {
+			bank = m.Bank
+		}
+		if bank == "" {
+			bank = name
+		}
+
+		if !banks[bank] {
+			banks[bank] = true
+			fmt.Fprintf(&sql, "INSERT INTO banks (name, output_dir, archive) VALUES (%s, %s, %s) ON CONFLICT (name, output_dir) DO UPDATE SET archive = excluded.archive;\n",
+				quote(bank), quote(outputDir), nullString(archive))
+		}
+
+		rootKey := "NULL"
+		if sample.RootKey != nil {
+			rootKey = strconv.Itoa(*sample.RootKey)
+		}
+		fmt.Fprintf(&sql, "INSERT OR REPLACE INTO samples (bank_id, name, comment, source, source_sha256, pair, path, sha256, sample_rate, channels, frames, duration, root_key, variant, issues, converted_at) "+
+			"VALUES ((SELECT id FROM banks WHERE name = %s AND output_dir = %s), %s, %s, %s, %s, %s, %s, %s, %d, %d, %d, %s, %s, %s, %s, %s);\n",
+			quote(bank), quote(outputDir),
+			quote(sample.Name), nullString(sample.Comment), quote(sample.Source), nullString(sample.SourceSHA256), nullString(sample.Pair),
+			quote(sample.Output), nullString(sample.SHA256),
+			sample.SampleRate, sample.Channels, sample.Frames, strconv.FormatFloat(sample.Duration, 'f', -1, 64),
+			rootKey, nullString(sample.Variant), nullString(strings.Join(sample.Issues, "\n")), quote(convertedAt))
+	}
+	sql.WriteString("COMMIT;\n")
+
+	return d.exec(sql.String())
+}
+
+// exec runs SQL statements against the database
+func (d *Database) exec(sql string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cmd := exec.Command(d.sqlite3Path, "-bail", "-batch", d.path)
+	cmd.Stdin = strings.NewReader(".timeout 10000\n" + sql)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if d.debug {
+		cmd.Stdout = d.out
+		d.Debug(fmt.Sprintf("Running: %s", cmd.String()))
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error writing database: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sqlite3Binary returns the name of the sqlite3 command
+func sqlite3Binary() string {
+	if runtime.GOOS == "windows" {
+		return "sqlite3.exe"
+	}
+	return "sqlite3"
+}
+
+// quote returns s as a SQL string literal. NUL characters, which can't be passed
+// to sqlite3, are dropped.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// nullString returns s as a SQL string literal, or NULL when empty
+func nullString(s string) string {
+	if s == "" {
+		return "NULL"
+	}
+	return quote(s)
+}
@@ -0,0 +1,188 @@
+// Package testgen synthesizes EBL files covering the layout variants handled by the
+// parser, for tests and benchmarks
+package testgen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"unicode/utf16"
+)
+
+// Options describes a synthetic EBL file
+type Options struct {
+	Name          string
+	Comment       string
+	SampleRate    int    // 44100 by default
+	Frames        int    // Sample frames per channel
+	Stereo        bool   // Write a second channel
+	TOC           int    // Table of contents revision, 2 by default
+	HeaderPadding int    // Bytes of padding following Header 3
+	PaddedHeader4 bool   // Put the Header 4 prefix and size at the end of the padding, needs 8 bytes of HeaderPadding
+	ExtraHeader   int    // Bytes following the padding that the Data field of Header 3 doesn't account for, failing the standard parse
+	DataPadding   int    // Bytes between the header data and the audio
+	Markers       [4]int // V6-V9, file offsets of the first channel or of regions within it
+	Trailer       []byte // Data following the audio, see Chunks
+}
+
+// header3End is the offset of the end of Header 3
+const header3End = 8 + 12 + 78
+
+// Channels returns the 16-bit PCM data of the channels of a file, a sine wave on
+// channel 1 and a quieter sawtooth on channel 2. Channel 2 is nil for mono files.
+func (o Options) Channels() (channel1, channel2 []byte) {
+	channel1 = make([]byte, 2*o.Frames)
+	for i := 0; i < o.Frames; i++ {
+		v := int16(8000 * math.Sin(2*math.Pi*float64(i)/100))
+		binary.LittleEndian.PutUint16(channel1[2*i:], uint16(v))
+	}
+	if !o.Stereo {
+		return channel1, nil
+	}
+
+	channel2 = make([]byte, 2*o.Frames)
+	for i := 0; i < o.Frames; i++ {
+		v := int16((i%200)*40 - 4000)
+		binary.LittleEndian.PutUint16(channel2[2*i:], uint16(v))
+	}
+	return channel1, channel2
+}
+
+// Generate returns the content of an EBL file
+func Generate(o Options) []byte {
+	if o.SampleRate == 0 {
+		o.SampleRate = 44100
+	}
+	if o.TOC == 0 {
+		o.TOC = 2
+	}
+	channel1, channel2 := o.Channels()
+	n := len(channel1)
+
+	// The parser derives the channel sizes and data padding from V2-V5. Mono files
+	// have V2 = V3 and V4 = V5, the padding then shifts V2 and V3.
+	var v2, v3, v4, v5 int
+	if o.Stereo {
+		v2, v3 = 184, 184+n
+		v4, v5 = n+178+o.DataPadding, 2*n+178+o.DataPadding
+	} else {
+		v2 = 180 + o.DataPadding
+		v3 = v2
+		v4 = v3 + n - 2
+		v5 = v4
+	}
+
+	var body bytes.Buffer
+	body.WriteString("E5B0TOC")
+	body.WriteByte(byte('0' + o.TOC))
+	writeUint32BE(&body, 78)
+
+	// Header 3, its Data field giving the offset of Header 4
+	body.WriteString("E5S1")
+	writeUint32BE(&body, 0)
+	writeUint32BE(&body, uint32(header3End+o.HeaderPadding))
+	body.Write([]byte{0, 0})
+	body.Write(utf16String(o.Name))
+
+	// Header 4, its prefix and size ending the padding in the padded variant
+	padding := o.HeaderPadding
+	if o.PaddedHeader4 {
+		padding -= 8
+	}
+	body.Write(make([]byte, padding))
+	body.Write(make([]byte, o.ExtraHeader))
+	body.WriteString("E5S1")
+	writeUint32BE(&body, 0)
+	body.Write(make([]byte, 6))
+
+	// Header data
+	body.Write(utf16String(o.Name))
+	for _, v := range []int{301, v2, v3, v4, v5, o.Markers[0], o.Markers[1], o.Markers[2], o.Markers[3], o.SampleRate, 0, 0} {
+		binary.Write(&body, binary.LittleEndian, uint32(v))
+	}
+	body.Write(utf16String(o.Comment))
+
+	body.Write(make([]byte, o.DataPadding))
+	body.Write(channel1)
+	body.Write(channel2)
+	body.Write(o.Trailer)
+
+	var file bytes.Buffer
+	file.WriteString("FORM")
+	writeUint32BE(&file, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+// WriteFile writes a synthetic EBL file to path
+func WriteFile(path string, o Options) error {
+	return os.WriteFile(path, Generate(o), 0644)
+}
+
+// Chunk is an IFF chunk of a trailer
+type Chunk struct {
+	ID   string
+	Data []byte
+}
+
+// Chunks encodes chunks as a trailer, with big endian sizes and even padding
+func Chunks(chunks ...Chunk) []byte {
+	var b bytes.Buffer
+	for _, chunk := range chunks {
+		b.WriteString(chunk.ID)
+		writeUint32BE(&b, uint32(len(chunk.Data)))
+		b.Write(chunk.Data)
+		if len(chunk.Data)%2 == 1 {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes()
+}
+
+// Case is a named synthetic file
+type Case struct {
+	Name    string
+	Options Options
+}
+
+// Cases returns files covering the layout variants: mono and stereo, header and data
+// padding, Header 4 in the padding, region markers and trailers
+func Cases() []Case {
+	extended := make([]byte, 36)
+	for i := range extended {
+		extended[i] = byte(i * 7)
+	}
+
+	return []Case{
+		{"mono", Options{Name: "Kick", Comment: "Deep kick", Frames: 441}},
+		{"stereo", Options{Name: "Pad C3", Frames: 1000, Stereo: true}},
+		{"mono-48k", Options{Name: "Hat", SampleRate: 48000, Frames: 480}},
+		{"header-padding", Options{Name: "Snare", Frames: 300, Stereo: true, HeaderPadding: 32}},
+		{"padded-header4", Options{Name: "Tom", Frames: 300, HeaderPadding: 24, PaddedHeader4: true}},
+		{"data-padding-mono", Options{Name: "Rim", Frames: 200, DataPadding: 16}},
+		{"data-padding-stereo", Options{Name: "Crash", Frames: 200, Stereo: true, DataPadding: 10}},
+		{"regions", Options{Name: "Loop", Frames: 2000, Stereo: true, Markers: [4]int{184, 184 + 4000, 184 + 400, 184 + 2400}}},
+		{"extended-trailer", Options{Name: "Bass A1", Frames: 500, Trailer: extended}},
+		{"chunk-trailer", Options{Name: "Vox", Frames: 500, Stereo: true, Trailer: Chunks(Chunk{"LOOP", []byte{0, 0, 0, 10, 0, 0, 1, 0}}, Chunk{"NAME", []byte("Vox")})}},
+		{"toc3", Options{Name: "Bell", Frames: 100, TOC: 3}},
+		{"empty-name", Options{Frames: 100}},
+		{"unicode-name", Options{Name: "Café ドラム", Frames: 100}},
+	}
+}
+
+func writeUint32BE(b *bytes.Buffer, v uint32) {
+	binary.Write(b, binary.BigEndian, v)
+}
+
+// utf16String encodes s as 64 bytes of NUL padded UTF-16LE, as in EBL headers
+func utf16String(s string) []byte {
+	b := make([]byte, 64)
+	for i, u := range utf16.Encode([]rune(s)) {
+		if 2*i+1 >= len(b) {
+			break
+		}
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+// Package textnorm normalizes names for comparison and display across systems
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// compositions lists the precomposed characters of the Latin, Greek, Cyrillic and kana
+// blocks, by combining mark, as pairs of base and composed characters
+var compositions = map[rune]string{
+	0x0300: "AÀEÈIÌOÒUÙaàeèiìoòuùÜǛüǜNǸnǹЕЀИЍеѐиѝĒḔēḕŌṐōṑWẀwẁ" +
+		"ÂẦâầĂẰăằÊỀêềÔỒôồƠỜơờƯỪưừYỲyỳ", // grave accent
+	0x0301: "AÁEÉIÍOÓUÚYÝaáeéiíoóuúyýCĆcćLĹlĺNŃnńRŔrŕSŚsśZŹzź" +
+		"ÜǗüǘGǴgǵÅǺåǻÆǼæǽØǾøǿ¨΅ΑΆΕΈΗΉΙΊΟΌΥΎΩΏϊΐαάεέηήιίϋΰ" +
+		"οόυύωώϒϓГЃКЌгѓкќÇḈçḉĒḖēḗÏḮïḯKḰkḱMḾmḿÕṌõṍŌṒōṓPṔpṕ" +
+		"ŨṸũṹWẂwẃÂẤâấĂẮăắÊẾêếÔỐôốƠỚơớƯỨưứ", // acute accent
+	0x0302: "AÂEÊIÎOÔUÛaâeêiîoôuûCĈcĉGĜgĝHĤhĥJĴjĵSŜsŝWŴwŵYŶyŷ" +
+		"ZẐzẑẠẬạậẸỆẹệỌỘọộ", // circumflex accent
+	0x0303: "AÃNÑOÕaãnñoõIĨiĩUŨuũVṼvṽÂẪâẫĂẴăẵEẼeẽÊỄêễÔỖôỗƠỠơỡ" +
+		"ƯỮưữYỸyỹ", // tilde
+	0x0304: "AĀaāEĒeēIĪiīOŌoōUŪuūÜǕüǖÄǞäǟȦǠȧǡÆǢæǣǪǬǫǭÖȪöȫÕȬõȭ" +
+		"ȮȰȯȱYȲyȳИӢиӣУӮуӯGḠgḡḶḸḷḹṚṜṛṝ", // macron
+	0x0306: "AĂaăEĔeĕGĞgğIĬiĭOŎoŏUŬuŭУЎИЙийуўЖӁжӂАӐаӑЕӖеӗȨḜȩḝ" +
+		"ẠẶạặ", // breve
+	0x0307: "CĊcċEĖeėGĠgġIİZŻzżAȦaȧOȮoȯBḂbḃDḊdḋFḞfḟHḢhḣMṀmṁNṄ" +
+		"nṅPṖpṗRṘrṙSṠsṡŚṤśṥŠṦšṧṢṨṣṩTṪtṫWẆwẇXẊxẋYẎyẏſẛ", // dot above
+	0x0308: "AÄEËIÏOÖUÜaäeëiïoöuüyÿYŸΙΪΥΫιϊυϋϒϔЕЁІЇеёіїАӒаӓӘӚ" +
+		"әӛЖӜжӝЗӞзӟИӤиӥОӦоӧӨӪөӫЭӬэӭУӰуӱЧӴчӵЫӸыӹHḦhḧÕṎõṏŪṺ" +
+		"ūṻWẄwẅXẌxẍtẗ", // diaeresis
+	0x0309: "AẢaảÂẨâẩĂẲăẳEẺeẻÊỂêểIỈiỉOỎoỏÔỔôổƠỞơởUỦuủƯỬưửYỶyỷ", // hook above
+	0x030A: "AÅaåUŮuůwẘyẙ",                                     // ring above
+	0x030B: "OŐoőUŰuűУӲуӳ",                                     // double acute accent
+	0x030C: "CČcčDĎdďEĚeěLĽlľNŇnňRŘrřSŠsšTŤtťZŽzžAǍaǎIǏiǐOǑoǒ" +
+		"UǓuǔÜǙüǚGǦgǧKǨkǩƷǮʒǯjǰHȞhȟ", // caron
+	0x030F: "AȀaȁEȄeȅIȈiȉOȌoȍRȐrȑUȔuȕѴѶѵѷ", // double grave accent
+	0x0311: "AȂaȃEȆeȇIȊiȋOȎoȏRȒrȓUȖuȗ",     // inverted breve
+	0x031B: "OƠoơUƯuư",                     // horn
+	0x0323: "BḄbḅDḌdḍHḤhḥKḲkḳLḶlḷMṂmṃNṆnṇRṚrṛSṢsṣTṬtṭVṾvṿWẈwẉ" +
+		"ZẒzẓAẠaạEẸeẹIỊiịOỌoọƠỢơợUỤuụƯỰưựYỴyỵ", // dot below
+	0x0324: "UṲuṳ",                                         // diaeresis below
+	0x0325: "AḀaḁ",                                         // ring below
+	0x0326: "SȘsșTȚtț",                                     // comma below
+	0x0327: "CÇcçGĢgģKĶkķLĻlļNŅnņRŖrŗSŞsşTŢtţEȨeȩDḐdḑHḨhḩ", // cedilla
+	0x0328: "AĄaąEĘeęIĮiįUŲuųOǪoǫ",                         // ogonek
+	0x032D: "DḒdḓEḘeḙLḼlḽNṊnṋTṰtṱUṶuṷ",                     // circumflex accent below
+	0x032E: "HḪhḫ",                                         // breve below
+	0x0330: "EḚeḛIḬiḭUṴuṵ",                                 // tilde below
+	0x0331: "BḆbḇDḎdḏKḴkḵLḺlḻNṈnṉRṞrṟTṮtṯZẔzẕhẖ",           // macron below
+	0x3099: "かがきぎくぐけげこごさざしじすずせぜそぞただちぢつづてでとどはばひびふぶへべほぼうゔゝゞカガキギ" +
+		"クグケゲコゴサザシジスズセゼソゾタダチヂツヅテデトドハバヒビフブヘベホボウヴワヷヰヸヱヹヲヺヽヾ", // voiced sound mark
+	0x309A: "はぱひぴふぷへぺほぽハパヒピフプヘペホポ", // semi-voiced sound mark
+}
+
+// composed maps base and combining mark pairs to their precomposed character, and
+// bases maps precomposed characters back to their base
+var (
+	composed = make(map[[2]rune]rune)
+	bases    = make(map[rune]rune)
+)
+
+func init() {
+	for mark, pairs := range compositions {
+		runes := []rune(pairs)
+		for i := 0; i+1 < len(runes); i += 2 {
+			composed[[2]rune{runes[i], mark}] = runes[i+1]
+			bases[runes[i+1]] = runes[i]
+		}
+	}
+}
+
+// NFC composes base characters followed by combining marks into their
+// precomposed form, as Unicode normalization form C does. Names decoded from
+// decomposed sources (e.g. macOS filenames) then match the ones typed on other systems.
+// Only the characters listed in compositions are composed.
+func NFC(s string) string {
+	var b strings.Builder
+	var prev rune = -1
+	for _, r := range s {
+		if prev >= 0 {
+			if c, ok := composed[[2]rune{prev, r}]; ok {
+				prev = c
+				continue
+			}
+			b.WriteRune(prev)
+		}
+		prev = r
+	}
+	if prev >= 0 {
+		b.WriteRune(prev)
+	}
+	return b.String()
+}
+
+// Fold returns a key under which names differing only in case, accents, spacing or
+// punctuation compare equal, e.g. "Café Strings" and "CAFE_STRINGS"
+func Fold(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range NFC(s) {
+		// Strip accents, repeatedly as in characters carrying two marks
+		for base, ok := bases[r]; ok; base, ok = bases[r] {
+			r = base
+		}
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package wav
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+)
+
+// stereoSample returns a parsed 10 second stereo sample
+func stereoSample(b *testing.B) *ebl.EBLFile {
+	data := testgen.Generate(testgen.Options{Name: "Pad C3", Frames: 441000, Stereo: true})
+	f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), "pad.ebl", int64(len(data)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return f
+}
+
+func BenchmarkWriteInterleaved(b *testing.B) {
+	f := stereoSample(b)
+	w := bufio.NewWriterSize(io.Discard, 64*1024)
+	b.SetBytes(int64(f.Channel1Size + f.Channel2Size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := writeInterleaved(w, f.Channel1Data, f.Channel2Data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteWAVTo(b *testing.B) {
+	for _, stereo := range []bool{false, true} {
+		name := "mono"
+		if stereo {
+			name = "stereo"
+		}
+		data := testgen.Generate(testgen.Options{Name: "Pad C3", Frames: 441000, Stereo: stereo})
+		f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), "pad.ebl", int64(len(data)))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			encoder := NewEncoder(false, false, false, "Bank")
+			b.SetBytes(int64(f.Channel1Size + f.Channel2Size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := encoder.WriteWAVTo(io.Discard, f); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package wav
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Dither modes applied when samples are reduced to 16 bits, e.g. after the gain change
+// of Encoder.SetNormalize
+const (
+	DitherNone   = "none"   // Round to the nearest value
+	DitherTPDF   = "tpdf"   // Add triangular noise of ±1 LSB before rounding
+	DitherShaped = "shaped" // TPDF with the noise shaped towards high frequencies
+)
+
+// DitherModes lists the valid dither modes
+var DitherModes = []string{DitherNone, DitherTPDF, DitherShaped}
+
+// Quantizer reduces high resolution samples to 16 bits, one channel at a time. Rounding
+// alone turns the lost precision into distortion correlated with the signal, audible
+// on quiet samples and fade-outs; dither trades it for a constant noise floor, which
+// noise shaping moves to the frequencies the ear is least sensitive to.
+type Quantizer struct {
+	mode   string
+	rng    *rand.Rand
+	errors [][2]float64 // Last two quantization errors of each channel
+}
+
+// NewQuantizer creates a quantizer for interleaved audio with the given number of channels
+func NewQuantizer(mode string, channels int) *Quantizer {
+	return &Quantizer{
+		mode:   mode,
+		rng:    rand.New(rand.NewSource(1)),
+		errors: make([][2]float64, channels),
+	}
+}
+
+// Quantize returns the 16-bit value of a sample of channel, v being expressed in
+// 16-bit units (full scale at ±32768)
+func (q *Quantizer) Quantize(channel int, v float64) int16 {
+	switch q.mode {
+	case DitherTPDF:
+		v += q.rng.Float64() - q.rng.Float64()
+	case DitherShaped:
+		// Second order error feedback, giving the noise a (1 - z^-1)^2 highpass shape
+		e := &q.errors[channel]
+		v -= 2*e[0] - e[1]
+		d := v + q.rng.Float64() - q.rng.Float64()
+		e[1], e[0] = e[0], math.Round(d)-v
+		v = d
+	}
+	return clamp16(math.Round(v))
+}
+
+// QuantizeFloat converts interleaved samples in -1..1 to 16-bit PCM bytes
+func (q *Quantizer) QuantizeFloat(samples []float64) []byte {
+	out := make([]byte, 2*len(samples))
+	channels := len(q.errors)
+	for i, v := range samples {
+		s := uint16(q.Quantize(i%channels, v*32768))
+		out[2*i] = byte(s)
+		out[2*i+1] = byte(s >> 8)
+	}
+	return out
+}
+
+// Quantize24 converts interleaved 24-bit samples to 16-bit PCM bytes
+func (q *Quantizer) Quantize24(samples []int32) []byte {
+	out := make([]byte, 2*len(samples))
+	channels := len(q.errors)
+	for i, v := range samples {
+		s := uint16(q.Quantize(i%channels, float64(v)/256))
+		out[2*i] = byte(s)
+		out[2*i+1] = byte(s >> 8)
+	}
+	return out
+}
+
+// clamp16 limits a rounded value to the 16-bit range
+func clamp16(v float64) int16 {
+	switch {
+	case v > math.MaxInt16:
+		return math.MaxInt16
+	case v < math.MinInt16:
+		return math.MinInt16
+	}
+	return int16(v)
+}
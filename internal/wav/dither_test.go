@@ -0,0 +1,81 @@
+package wav
+
+import (
+	"math"
+	"testing"
+)
+
+// TestQuantizeTPDF checks that TPDF dither adds noise of at most ±1 LSB with the
+// variance of triangular noise, leaving the average of the signal intact
+func TestQuantizeTPDF(t *testing.T) {
+	const n = 100000
+	const v = 0.25
+
+	if got := NewQuantizer(DitherNone, 1).Quantize(0, v); got != 0 {
+		t.Errorf("rounded %v to %d, expected 0", v, got)
+	}
+
+	q := NewQuantizer(DitherTPDF, 1)
+	var sum, sumSquares float64
+	for i := 0; i < n; i++ {
+		out := q.Quantize(0, v)
+		// ±1 LSB of noise, then rounding
+		if out < -1 || out > 1 {
+			t.Fatalf("quantized %v to %d, expected -1 to 1", v, out)
+		}
+		e := float64(out) - v
+		sum += e
+		sumSquares += e * e
+	}
+
+	// Triangular noise of ±1 LSB has a variance of 1/6, rounding adds 1/12
+	mean := sum / n
+	variance := sumSquares/n - mean*mean
+	if math.Abs(mean) > 0.01 {
+		t.Errorf("mean error %.4f, expected 0", mean)
+	}
+	if math.Abs(variance-0.25) > 0.01 {
+		t.Errorf("error variance %.4f, expected 0.25", variance)
+	}
+}
+
+// TestQuantizeShaped checks that noise shaping moves the quantization noise to high
+// frequencies, while plain TPDF noise is white
+func TestQuantizeShaped(t *testing.T) {
+	const n = 2048
+	const v = 0.3
+
+	noise := func(mode string) (low, high float64) {
+		q := NewQuantizer(mode, 1)
+		e := make([]float64, n)
+		for i := range e {
+			e[i] = float64(q.Quantize(0, v)) - v
+		}
+		// Power of the lowest and highest quarters of the spectrum
+		for k := 1; k < n/2; k++ {
+			var re, im float64
+			for i, x := range e {
+				phase := 2 * math.Pi * float64(k*i%n) / n
+				re += x * math.Cos(phase)
+				im -= x * math.Sin(phase)
+			}
+			switch {
+			case k < n/8:
+				low += re*re + im*im
+			case k >= 3*n/8:
+				high += re*re + im*im
+			}
+		}
+		return low, high
+	}
+
+	low, high := noise(DitherTPDF)
+	if ratio := high / low; ratio < 0.7 || ratio > 1.4 {
+		t.Errorf("TPDF noise is %.2f times stronger in the high quarter of the spectrum, expected about 1", ratio)
+	}
+	low, high = noise(DitherShaped)
+	// A (1 - z^-1)^2 shape gives over 20 dB more noise in the high quarter
+	if ratio := high / low; ratio < 100 {
+		t.Errorf("shaped noise is %.2f times stronger in the high quarter of the spectrum, expected at least 100", ratio)
+	}
+}
@@ -1,43 +1,212 @@
 package wav
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
 	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/iolimit"
+	"github.com/mattetti/e-mu-soundbanks/internal/textnorm"
 )
 
 // Encoder handles encoding EBL audio data to WAV format
 type Encoder struct {
 	debug            bool
+	out              io.Writer // Destination of debug messages, see SetOutput
 	noWrite          bool
 	preserveFilename bool
 	exbName          string // Name of the EXB file, used as a prefix for WAV filenames
+	maxNameLength    int    // Maximum length of WAV filenames in characters, 0 for no limit
+	preserveUnicode  bool   // Keep non-ASCII characters in WAV filenames
+	normalize        bool   // Scale the audio so it peaks at peak, see SetNormalize
+	peak             float64
+	dither           string // Dither mode used when normalized samples are reduced to 16 bits
+	format           string // Output format written by WriteFile, FormatWAV by default
+	limiter          *iolimit.Limiter
 }
 
 // NewEncoder creates a new WAV encoder
 func NewEncoder(debug, noWrite, preserveFilename bool, exbName string) *Encoder {
 	return &Encoder{
 		debug:            debug,
+		out:              os.Stdout,
 		noWrite:          noWrite,
 		preserveFilename: preserveFilename,
 		exbName:          exbName,
+		format:           FormatWAV,
 	}
 }
 
+// SetOutput sets where debug messages are written, os.Stdout by default
+func (e *Encoder) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// SetFormat sets the format (see Formats) of the files written by WriteFile. Raw
+// PCM files are written with a .raw extension and a JSON description next to them.
+func (e *Encoder) SetFormat(format string) {
+	if format == "" {
+		format = FormatWAV
+	}
+	e.format = format
+}
+
+// SetLimiter throttles the files written by WriteFile to the throughput of limiter,
+// nil for no limit
+func (e *Encoder) SetLimiter(limiter *iolimit.Limiter) {
+	e.limiter = limiter
+}
+
+// SetMaxNameLength limits the length of WAV filenames to n characters, extension
+// included. Longer names are truncated and get a hash suffix keeping them unique.
+func (e *Encoder) SetMaxNameLength(n int) {
+	e.maxNameLength = n
+}
+
+// SetPreserveUnicode keeps the non-ASCII characters of sample names in WAV filenames,
+// only replacing the characters invalid on common filesystems
+func (e *Encoder) SetPreserveUnicode(preserve bool) {
+	e.preserveUnicode = preserve
+}
+
+// SetNormalize scales the audio of every sample so it peaks at peak dBFS, e.g. -1.
+// Silent samples are left as is.
+func (e *Encoder) SetNormalize(peak float64) {
+	e.normalize = true
+	e.peak = peak
+}
+
+// SetDither sets the dither mode (see DitherModes) applied when normalized samples are
+// reduced back to 16 bits, DitherNone by default
+func (e *Encoder) SetDither(mode string) {
+	e.dither = mode
+}
+
 // Debug logs a message if debug mode is enabled
 func (e *Encoder) Debug(message string) {
 	if e.debug {
-		fmt.Println(message)
+		fmt.Fprintln(e.out, message)
 	}
 }
 
 // WriteWAV writes the EBL audio data to a WAV file
 func (e *Encoder) WriteWAV(eblFile *ebl.EBLFile, outputDir string) (string, error) {
+	outputFilename := e.OutputFilename(eblFile)
+	if err := e.WriteFile(eblFile, filepath.Join(outputDir, outputFilename)); err != nil {
+		return "", err
+	}
+	return outputFilename, nil
+}
+
+// WriteFile writes the EBL audio data to a file of the encoder format at outputPath
+func (e *Encoder) WriteFile(eblFile *ebl.EBLFile, outputPath string) error {
+	// If we're in no-write mode, just return
+	if e.noWrite {
+		return nil
+	}
+	if e.format == FormatRaw {
+		return e.writeRawFile(eblFile, outputPath)
+	}
+
+	// Write under a temporary name, an interrupted run then leaves no truncated WAV
+	file, err := atomicfile.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	if err := e.WriteWAVTo(e.limiter.Writer(file), eblFile); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Close()
+}
+
+// OutputFilename returns the filename used for the EBL file, with the extension of
+// the encoder format
+func (e *Encoder) OutputFilename(eblFile *ebl.EBLFile) string {
+	baseName, _ := e.baseName(eblFile)
+
+	// Add the EXB prefix if available, preserved names are kept as they are so they
+	// still match the references of the EXB file
+	if e.exbName != "" && !e.preserveFilename {
+		baseName = fmt.Sprintf("%s - %s", e.exbName, baseName)
+	}
+	return truncateFilename(baseName, "."+e.format, e.maxNameLength)
+}
+
+// FolderFilename returns the filename used for the EBL file like OutputFilename, naming
+// the sample after its bank, SamplePool folder and root key: "Bank - Folder - C3 - Sample".
+// folder and the root key are left out when empty or unknown. Preserved names are kept
+// as they are.
+func (e *Encoder) FolderFilename(eblFile *ebl.EBLFile, folder string) string {
+	if e.preserveFilename {
+		return e.OutputFilename(eblFile)
+	}
+
+	baseName, _ := e.baseName(eblFile)
+	parts := []string{e.exbName, e.cleanName(folder)}
+	if eblFile.RootKey >= 0 {
+		parts = append(parts, ebl.NoteName(eblFile.RootKey))
+	}
+	parts = append(parts, baseName)
+
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return truncateFilename(strings.Join(kept, " - "), "."+e.format, e.maxNameLength)
+}
+
+// NameFallback describes the name OutputFilename falls back to when the sample name
+// of the header can't be used, empty when it is used or preserved filenames are kept
+func (e *Encoder) NameFallback(eblFile *ebl.EBLFile) string {
+	_, fallback := e.baseName(eblFile)
+	return fallback
+}
+
+// baseName returns the output filename of a sample without prefix and extension,
+// and a description of the fallback used when it isn't the header's sample name
+func (e *Encoder) baseName(eblFile *ebl.EBLFile) (string, string) {
+	if e.preserveFilename {
+		return strings.TrimSuffix(eblFile.Filename, ".ebl"), ""
+	}
+
+	// Use the decoded UTF-16 filename from header
+	if baseName := e.cleanName(eblFile.HeaderData.FilenameStr); baseName != "" {
+		return baseName, ""
+	}
+	// Fallback to Header3 filename if HeaderData filename is empty
+	if baseName := e.cleanName(eblFile.Header3.Filename); baseName != "" {
+		return baseName, "no usable sample name in header, named after the Header3 filename"
+	}
+	// Ultimate fallback: use the original filename
+	return strings.TrimSuffix(eblFile.Filename, ".ebl"), "no usable sample name in header, named after the EBL file"
+}
+
+// cleanName makes a name usable in filenames, keeping non-ASCII characters with
+// SetPreserveUnicode
+func (e *Encoder) cleanName(name string) string {
+	if e.preserveUnicode {
+		return cleanUnicodeFilename(name)
+	}
+	return cleanFilename(name)
+}
+
+// WriteWAVTo encodes the EBL audio data as a WAV stream to w
+func (e *Encoder) WriteWAVTo(w io.Writer, eblFile *ebl.EBLFile) error {
 	// Constants
 	wavHeaderLength := uint32(16) // Standard PCM header length
 	wavPCMMode := uint16(1)       // PCM format
@@ -56,62 +225,37 @@ func (e *Encoder) WriteWAV(eblFile *ebl.EBLFile, outputDir string) (string, erro
 	byteRate := sampleRate * uint32(numChannels) * uint32(wavBPS) / 8
 	blockAlign := numChannels * wavBPS / 8
 
-	// Prepare audio data
-	var wavData []byte
-	var dataSize uint32
-
-	if numChannels == 1 {
-		// Mono: just use channel 1 data
-		wavData = eblFile.Channel1Data
-		dataSize = uint32(len(wavData))
-	} else {
-		// Stereo: interleave the channels (LRLRLR...)
-		wavData = interleaveChannels(eblFile.Channel1Data, eblFile.Channel2Data)
-		dataSize = uint32(len(wavData))
+	// Mono data is written as is, stereo channels are interleaved while writing
+	dataSize := uint32(eblFile.Channel1Size)
+	if numChannels == 2 {
+		dataSize = uint32(eblFile.Channel1Size / 2 * 4)
 	}
 
-	// Calculate file size
+	// Calculate file size, chunks following an odd-sized data chunk start after a pad byte
 	fileSize := 36 + dataSize // 4 + (8 + 16) + (8 + DataSize)
-
-	// Determine output filename
-	var outputFilename string
-	var baseName string
-
-	if e.preserveFilename {
-		baseName = strings.TrimSuffix(eblFile.Filename, ".ebl")
-	} else {
-		// Use the decoded UTF-16 filename from header
-		baseName = cleanFilename(eblFile.HeaderData.FilenameStr)
-		if baseName == "" {
-			// Fallback to Header3 filename if HeaderData filename is empty
-			baseName = cleanFilename(eblFile.Header3.Filename)
-		}
-		if baseName == "" {
-			// Ultimate fallback: use the original filename
-			baseName = strings.TrimSuffix(eblFile.Filename, ".ebl")
-		}
+	padData := dataSize%2 == 1
+	if padData {
+		fileSize++
 	}
 
-	// Add the EXB prefix if available
-	if e.exbName != "" {
-		outputFilename = fmt.Sprintf("%s - %s.wav", e.exbName, baseName)
-	} else {
-		outputFilename = baseName + ".wav"
+	// Add a smpl chunk when the root key is known so samplers map the sample correctly
+	var smpl *SmplChunk
+	if eblFile.RootKey >= 0 {
+		smpl = newSmplChunk(sampleRate, eblFile.RootKey)
+		fileSize += 8 + smpl.Size
 	}
 
-	outputPath := filepath.Join(outputDir, outputFilename)
-
-	// If we're in no-write mode, just return
-	if e.noWrite {
-		return outputFilename, nil
-	}
+	// Add the sample metadata as a LIST/INFO chunk, shown by editors and sample managers
+	info := newInfoChunk([][2]string{
+		{"INAM", eblFile.Name()},
+		{"ICMT", eblFile.HeaderData.CommentStr},
+		{"IPRD", e.exbName},
+	})
+	fileSize += uint32(len(info))
 
-	// Create the WAV file
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return "", fmt.Errorf("error creating output file: %w", err)
-	}
-	defer file.Close()
+	// Add the regions marked in the EBL header as cue points, picked up by slicing tools
+	cue := newCueChunks(eblFile.Regions())
+	fileSize += uint32(len(cue))
 
 	// Write WAV header
 	header := WAVHeader{
@@ -130,44 +274,331 @@ func (e *Encoder) WriteWAV(eblFile *ebl.EBLFile, outputDir string) (string, erro
 		DataSize:      dataSize,
 	}
 
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	g, err := e.normalizeGain(eblFile)
+	if err != nil {
+		return err
+	}
+
 	// Write header
-	if err := binary.Write(file, binary.LittleEndian, &header); err != nil {
-		return "", fmt.Errorf("error writing WAV header: %w", err)
+	if err := binary.Write(bw, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("error writing WAV header: %w", err)
 	}
 
-	// Write audio data
-	if _, err := file.Write(wavData); err != nil {
-		return "", fmt.Errorf("error writing audio data: %w", err)
+	// Write audio data, scaled a chunk at a time when normalized
+	if eblFile.Streamed() || g != nil {
+		if err := writeStreamed(bw, eblFile, g); err != nil {
+			return fmt.Errorf("error writing audio data: %w", err)
+		}
+	} else if numChannels == 1 {
+		if _, err := bw.Write(eblFile.Channel1Data); err != nil {
+			return fmt.Errorf("error writing audio data: %w", err)
+		}
+	} else if err := writeInterleaved(bw, eblFile.Channel1Data, eblFile.Channel2Data); err != nil {
+		return fmt.Errorf("error writing audio data: %w", err)
 	}
 
-	return outputFilename, nil
+	if padData {
+		if err := bw.WriteByte(0); err != nil {
+			return fmt.Errorf("error writing audio data: %w", err)
+		}
+	}
+
+	// Write sampler chunk
+	if smpl != nil {
+		if err := binary.Write(bw, binary.LittleEndian, smpl); err != nil {
+			return fmt.Errorf("error writing smpl chunk: %w", err)
+		}
+	}
+
+	// Write metadata chunk
+	if len(info) > 0 {
+		if _, err := bw.Write(info); err != nil {
+			return fmt.Errorf("error writing LIST chunk: %w", err)
+		}
+	}
+
+	// Write cue points
+	if len(cue) > 0 {
+		if _, err := bw.Write(cue); err != nil {
+			return fmt.Errorf("error writing cue chunk: %w", err)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing WAV file: %w", err)
+	}
+	return nil
+}
+
+// writerPool holds the buffered writers used by WriteWAVTo
+var writerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriterSize(nil, 64*1024)
+	},
 }
 
-// interleaveChannels interleaves the left and right channel data for stereo WAV
-// EBL format stores channels as LLLL...RRRR... but WAV needs LRLRLR...
-func interleaveChannels(channel1, channel2 []byte) []byte {
+// newSmplChunk creates a loop-less smpl chunk for the given root key
+func newSmplChunk(sampleRate uint32, rootKey int) *SmplChunk {
+	var samplePeriod uint32
+	if sampleRate > 0 {
+		samplePeriod = 1000000000 / sampleRate
+	}
+
+	return &SmplChunk{
+		ID:            [4]byte{'s', 'm', 'p', 'l'},
+		Size:          36,
+		SamplePeriod:  samplePeriod,
+		MIDIUnityNote: uint32(rootKey),
+	}
+}
+
+// newInfoChunk encodes a LIST/INFO chunk, header included, holding the non-empty
+// fields given as ID and value pairs. It returns nil when every field is empty.
+func newInfoChunk(fields [][2]string) []byte {
+	var body bytes.Buffer
+	for _, field := range fields {
+		value := strings.TrimSpace(strings.TrimRight(field[1], "\x00"))
+		if value == "" {
+			continue
+		}
+
+		// Values are NUL terminated and padded to an even size
+		size := len(value) + 1
+		body.WriteString(field[0])
+		body.Write(binary.LittleEndian.AppendUint32(nil, uint32(size)))
+		body.WriteString(value)
+		body.WriteByte(0)
+		if size%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	chunk := binary.LittleEndian.AppendUint32([]byte("LIST"), uint32(4+body.Len()))
+	chunk = append(chunk, "INFO"...)
+	return append(chunk, body.Bytes()...)
+}
+
+// newCueChunks encodes a cue chunk with a cue point at the start of each region,
+// followed by a LIST/adtl chunk giving the regions their length and a label. It
+// returns nil when there are no regions.
+func newCueChunks(regions []ebl.Region) []byte {
+	if len(regions) == 0 {
+		return nil
+	}
+
+	le := binary.LittleEndian
+	cue := le.AppendUint32([]byte("cue "), uint32(4+24*len(regions)))
+	cue = le.AppendUint32(cue, uint32(len(regions)))
+	var adtl []byte
+	for i, region := range regions {
+		id := uint32(i + 1)
+
+		// ID, position, chunk ID, chunk start, block start, sample offset
+		cue = le.AppendUint32(cue, id)
+		cue = le.AppendUint32(cue, uint32(region.Start))
+		cue = append(cue, "data"...)
+		cue = le.AppendUint32(cue, 0)
+		cue = le.AppendUint32(cue, 0)
+		cue = le.AppendUint32(cue, uint32(region.Start))
+
+		// Labeled text chunk with the region length, purpose "rgn " and no language
+		adtl = le.AppendUint32(append(adtl, "ltxt"...), 20)
+		adtl = le.AppendUint32(adtl, id)
+		adtl = le.AppendUint32(adtl, uint32(region.End-region.Start))
+		adtl = append(adtl, "rgn "...)
+		adtl = append(adtl, make([]byte, 8)...)
+
+		label := fmt.Sprintf("Region %d", id)
+		adtl = le.AppendUint32(append(adtl, "labl"...), uint32(4+len(label)+1))
+		adtl = le.AppendUint32(adtl, id)
+		adtl = append(append(adtl, label...), 0)
+		if len(label)%2 == 0 {
+			adtl = append(adtl, 0)
+		}
+	}
+
+	list := le.AppendUint32([]byte("LIST"), uint32(4+len(adtl)))
+	list = append(append(list, "adtl"...), adtl...)
+	return append(cue, list...)
+}
+
+// writeInterleaved writes the left and right channel data for stereo WAV, straight
+// into the buffer of w. EBL format stores channels as LLLL...RRRR... but WAV needs
+// LRLRLR... A shorter right channel is padded with silence.
+func writeInterleaved(w *bufio.Writer, channel1, channel2 []byte) error {
 	// For 16-bit samples, we need to work with 2 bytes at a time
 	numSamples := len(channel1) / 2
-	result := make([]byte, numSamples*4) // 2 channels * 2 bytes per sample
 
-	for i := 0; i < numSamples; i++ {
-		// Left channel (2 bytes)
-		result[i*4] = channel1[i*2]
-		result[i*4+1] = channel1[i*2+1]
+	for i := 0; i < numSamples; {
+		if w.Available() < 4 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		buf := w.AvailableBuffer()
+		n := cap(buf) / 4
+		if n > numSamples-i {
+			n = numSamples - i
+		}
+		buf = buf[:n*4]
+
+		for j := 0; j < n; j, i = j+1, i+1 {
+			// Left channel (2 bytes)
+			buf[j*4] = channel1[i*2]
+			buf[j*4+1] = channel1[i*2+1]
+
+			// Right channel (2 bytes)
+			if i*2+1 < len(channel2) {
+				buf[j*4+2] = channel2[i*2]
+				buf[j*4+3] = channel2[i*2+1]
+			} else {
+				buf[j*4+2] = 0
+				buf[j*4+3] = 0
+			}
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamChunkSize is the size of the channel data read at a time from streamed files
+const streamChunkSize = 32 * 1024
+
+// chunkPool holds the channel buffers used by writeStreamed
+var chunkPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 2*streamChunkSize)
+		return &b
+	},
+}
+
+// writeStreamed writes the audio of a file streamed from its source, interleaving
+// stereo channels a chunk at a time so memory use doesn't grow with the sample length.
+// Samples are scaled by g when not nil.
+func writeStreamed(w *bufio.Writer, f *ebl.EBLFile, g *gain) error {
+	channel1 := f.ChannelReader(1)
+	if f.Channel2Size == 0 && g == nil {
+		_, err := io.CopyN(w, channel1, int64(f.Channel1Size))
+		return err
+	}
+
+	bp := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(bp)
+	left, right := (*bp)[:streamChunkSize], (*bp)[streamChunkSize:]
+
+	if f.Channel2Size == 0 {
+		for remaining := f.Channel1Size; remaining > 0; {
+			n := streamChunkSize
+			if remaining < n {
+				n = remaining
+			}
+			if _, err := io.ReadFull(channel1, left[:n]); err != nil {
+				return err
+			}
+			g.apply(0, left[:n])
+			if _, err := w.Write(left[:n]); err != nil {
+				return err
+			}
+			remaining -= n
+		}
+		return nil
+	}
+	channel2 := f.ChannelReader(2)
+
+	for remaining := f.Channel1Size; remaining > 0; {
+		n := streamChunkSize
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(channel1, left[:n]); err != nil {
+			return err
+		}
 
-		// Right channel (2 bytes)
-		if i*2+1 < len(channel2) {
-			result[i*4+2] = channel2[i*2]
-			result[i*4+3] = channel2[i*2+1]
+		// A shorter right channel runs out early and is padded by writeInterleaved
+		m, err := io.ReadFull(channel2, right[:n])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if g != nil {
+			g.apply(0, left[:n])
+			g.apply(1, right[:m])
+		}
+		if err := writeInterleaved(w, left[:n], right[:m]); err != nil {
+			return err
 		}
+		remaining -= n
 	}
+	return nil
+}
 
-	return result
+// reservedNames lists the device names Windows reserves, with or without extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
 }
 
 // cleanFilename removes invalid characters from a filename (Windows-safe)
 func cleanFilename(filename string) string {
 	// Replace non-alphanumeric characters (except specific ones) with underscores
-	re := regexp.MustCompile(`[^0-9a-zA-Z\.,:%\-_#]+`)
-	return re.ReplaceAllString(filename, "_")
+	re := regexp.MustCompile(`[^0-9a-zA-Z\.,%\-_#]+`)
+	return escapeReservedName(re.ReplaceAllString(filename, "_"))
+}
+
+// cleanUnicodeFilename normalizes a filename to NFC and replaces the characters invalid
+// on Windows, macOS or Linux with underscores, keeping other non-ASCII characters
+func cleanUnicodeFilename(filename string) string {
+	re := regexp.MustCompile(`[<>:"/\\|?*\p{Cc}]+`)
+	filename = re.ReplaceAllString(textnorm.NFC(filename), "_")
+
+	// Windows drops trailing dots and spaces
+	filename = strings.TrimRight(strings.TrimSpace(filename), ". ")
+	return escapeReservedName(filename)
+}
+
+// escapeReservedName appends an underscore to the Windows device names, reserved
+// whatever the extension: "NUL.1" becomes "NUL_.1"
+func escapeReservedName(filename string) string {
+	device, _, _ := strings.Cut(filename, ".")
+	if reservedNames[strings.ToUpper(device)] {
+		return device + "_" + filename[len(device):]
+	}
+	return filename
+}
+
+// truncateFilename returns baseName+ext, truncating baseName when the name is longer
+// than maxLength characters. Truncated names end with "~" and a hash of the full
+// name, so samples sharing a long prefix don't overwrite each other.
+func truncateFilename(baseName, ext string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(baseName+ext) <= maxLength {
+		return baseName + ext
+	}
+
+	sum := sha256.Sum256([]byte(baseName))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+	keep := maxLength - utf8.RuneCountInString(ext) - len(suffix)
+	if keep < 1 {
+		keep = 1
+	}
+	runes := []rune(baseName)
+	if keep > len(runes) {
+		keep = len(runes)
+	}
+	// Windows drops trailing dots and spaces
+	stem := strings.TrimRight(string(runes[:keep]), ". ")
+	return stem + suffix + ext
 }
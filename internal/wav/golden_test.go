@@ -0,0 +1,149 @@
+package wav_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files")
+
+// TestGolden encodes the synthetic variants and compares the WAV chunks and content
+// with testdata/golden
+func TestGolden(t *testing.T) {
+	for _, tc := range testgen.Cases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			data := testgen.Generate(tc.Options)
+			f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), tc.Name+".ebl", int64(len(data)))
+			if err != nil {
+				t.Fatalf("error parsing: %v", err)
+			}
+
+			encoder := wav.NewEncoder(false, false, false, "Bank")
+			var out bytes.Buffer
+			if err := encoder.WriteWAVTo(&out, f); err != nil {
+				t.Fatalf("error encoding: %v", err)
+			}
+
+			got, err := describe(encoder.OutputFilename(f), out.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			compareGolden(t, filepath.Join("testdata", "golden", tc.Name+".golden"), got)
+
+			// Streaming the audio from the source must produce the same file
+			parser := ebl.NewParser(false, false)
+			parser.SetStreamThreshold(1)
+			streamed, err := parser.ReadSource(bytes.NewReader(data), bytes.NewReader(data), tc.Name+".ebl", int64(len(data)))
+			if err != nil {
+				t.Fatalf("error parsing for streaming: %v", err)
+			}
+			if !streamed.Streamed() {
+				t.Fatal("audio wasn't streamed")
+			}
+			var streamedOut bytes.Buffer
+			if err := encoder.WriteWAVTo(&streamedOut, streamed); err != nil {
+				t.Fatalf("error encoding streamed audio: %v", err)
+			}
+			if !bytes.Equal(streamedOut.Bytes(), out.Bytes()) {
+				t.Error("streamed encoding differs")
+			}
+		})
+	}
+}
+
+// TestOddDataPadding checks that the chunks following an odd-sized data chunk start
+// after a pad byte, counted in the RIFF size
+func TestOddDataPadding(t *testing.T) {
+	data := testgen.Generate(testgen.Options{Name: "Odd C3", Frames: 100})
+	f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), "odd.ebl", int64(len(data)))
+	if err != nil {
+		t.Fatalf("error parsing: %v", err)
+	}
+	f.Channel1Data = f.Channel1Data[:len(f.Channel1Data)-1]
+	f.Channel1Size = len(f.Channel1Data)
+	if f.RootKey < 0 {
+		t.Fatal("root key not detected, no smpl chunk to follow the data chunk")
+	}
+
+	var out bytes.Buffer
+	if err := wav.NewEncoder(false, false, false, "").WriteWAVTo(&out, f); err != nil {
+		t.Fatalf("error encoding: %v", err)
+	}
+	got, err := describe("odd.wav", out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "Chunk: data 199 bytes") || !strings.Contains(got, "Chunk: smpl 36 bytes") {
+		t.Errorf("unexpected chunks:\n%s", got)
+	}
+}
+
+// describe returns the filename, chunk layout and checksum of a WAV file as text,
+// checking the RIFF sizes on the way
+func describe(filename string, data []byte) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Filename: %q\n", filename)
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return "", fmt.Errorf("not a WAV file")
+	}
+	if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+		return "", fmt.Errorf("RIFF size %d, file has %d bytes after the header", size, len(data)-8)
+	}
+
+	for pos := 12; pos < len(data); {
+		if pos+8 > len(data) {
+			return "", fmt.Errorf("truncated chunk header at %d", pos)
+		}
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size
+		if end > len(data) {
+			return "", fmt.Errorf("chunk %q overruns the file", id)
+		}
+		body := data[pos+8 : end]
+		switch id {
+		case "data":
+			fmt.Fprintf(&b, "Chunk: data %d bytes sha256:%x\n", size, sha256.Sum256(body))
+		case "LIST":
+			fmt.Fprintf(&b, "Chunk: LIST %d bytes %q\n", size, body)
+		default:
+			fmt.Fprintf(&b, "Chunk: %s %d bytes %x\n", id, size, body)
+		}
+		pos = end + size%2
+	}
+	fmt.Fprintf(&b, "File: %d bytes sha256:%x\n", len(data), sha256.Sum256(data))
+	return b.String(), nil
+}
+
+// compareGolden compares got with the content of a golden file, rewriting it with -update
+func compareGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading golden file, run go test -update to create it: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from the golden file:\n--- got\n%s--- want\n%s", path, got, want)
+	}
+}
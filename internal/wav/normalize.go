@@ -0,0 +1,89 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// ParsePeak parses a normalization peak level in dBFS, e.g. "-1". Levels above 0 dBFS
+// would clip.
+func ParsePeak(s string) (float64, error) {
+	peak, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(peak) || math.IsInf(peak, 0) || peak > 0 {
+		return 0, fmt.Errorf("invalid peak level %q, expected dBFS at most 0, e.g. -1", s)
+	}
+	return peak, nil
+}
+
+// gain scales 16-bit PCM by a constant factor, the results being quantized back to
+// 16 bits with the dither mode of the encoder
+type gain struct {
+	factor float64
+	q      *Quantizer
+}
+
+// apply scales the little endian 16-bit samples of a channel in place
+func (g *gain) apply(channel int, pcm []byte) {
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := float64(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		binary.LittleEndian.PutUint16(pcm[i:], uint16(g.q.Quantize(channel, v*g.factor)))
+	}
+}
+
+// normalizeGain returns the gain bringing the peak of the file to the normalization
+// level of the encoder, nil without normalization or when the audio is silent or
+// already peaks at that level
+func (e *Encoder) normalizeGain(f *ebl.EBLFile) (*gain, error) {
+	if !e.normalize {
+		return nil, nil
+	}
+
+	peak := 0
+	for channel := 1; channel <= f.Channels(); channel++ {
+		channelPeak, err := peakOf(f.ChannelReader(channel))
+		if err != nil {
+			return nil, fmt.Errorf("error reading audio data: %w", err)
+		}
+		if channelPeak > peak {
+			peak = channelPeak
+		}
+	}
+	if peak == 0 {
+		return nil, nil
+	}
+
+	target := math.Round(math.MaxInt16 * math.Pow(10, e.peak/20))
+	if int(target) == peak {
+		return nil, nil
+	}
+	return &gain{factor: target / float64(peak), q: NewQuantizer(e.dither, f.Channels())}, nil
+}
+
+// peakOf returns the largest absolute value of the 16-bit samples read from r
+func peakOf(r io.Reader) (int, error) {
+	buf := make([]byte, streamChunkSize)
+	peak := 0
+	for {
+		n, err := io.ReadFull(r, buf)
+		for i := 0; i+1 < n; i += 2 {
+			v := int(int16(binary.LittleEndian.Uint16(buf[i:])))
+			if v < 0 {
+				v = -v
+			}
+			if v > peak {
+				peak = v
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return peak, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
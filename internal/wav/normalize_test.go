@@ -0,0 +1,107 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+)
+
+// TestNormalize checks that normalized samples peak at the requested level, in memory
+// and streamed from their file, and that the sawtooth of the right channel is scaled
+// by the same gain as the left channel
+func TestNormalize(t *testing.T) {
+	options := testgen.Options{Name: "Pad C3", Frames: 3000, Stereo: true}
+	data := testgen.Generate(options)
+	target := int(math.Round(math.MaxInt16 * math.Pow(10, -6.0/20)))
+
+	for _, threshold := range []int64{0, 1} {
+		parser := ebl.NewParser(false, false)
+		parser.SetStreamThreshold(threshold)
+		f, err := parser.ReadSource(bytes.NewReader(data), bytes.NewReader(data), "pad.ebl", int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encoder := NewEncoder(false, false, false, "")
+		encoder.SetNormalize(-6)
+		var out bytes.Buffer
+		if err := encoder.WriteRawTo(&out, f); err != nil {
+			t.Fatal(err)
+		}
+
+		var left, right []int
+		pcm := out.Bytes()
+		for i := 0; i+3 < len(pcm); i += 4 {
+			left = append(left, int(int16(binary.LittleEndian.Uint16(pcm[i:]))))
+			right = append(right, int(int16(binary.LittleEndian.Uint16(pcm[i+2:]))))
+		}
+		if len(left) != options.Frames {
+			t.Fatalf("streamed %v: got %d frames, expected %d", f.Streamed(), len(left), options.Frames)
+		}
+		if peak := peakOfValues(left); peak != target {
+			t.Errorf("streamed %v: left channel peaks at %d, expected %d", f.Streamed(), peak, target)
+		}
+
+		channel1, channel2 := options.Channels()
+		gain := float64(target) / float64(peakOfValues(samples(channel1)))
+		for i, v := range samples(channel2) {
+			if want := int(math.Round(float64(v) * gain)); right[i] != want {
+				t.Fatalf("streamed %v: right sample %d is %d, expected %d", f.Streamed(), i, right[i], want)
+			}
+		}
+	}
+}
+
+// TestNormalizeMono checks that the WAV data of a normalized mono sample peaks at the
+// requested level, and that silent samples are left as is
+func TestNormalizeMono(t *testing.T) {
+	encoder := NewEncoder(false, false, false, "")
+	encoder.SetNormalize(0)
+	data := testgen.Generate(testgen.Options{Name: "Kick", Frames: 500})
+	for _, silent := range []bool{false, true} {
+		f, err := ebl.NewParser(false, false).Read(bytes.NewReader(data), "kick.ebl", int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := math.MaxInt16
+		if silent {
+			f.Channel1Data = make([]byte, f.Channel1Size)
+			want = 0
+		}
+
+		var out bytes.Buffer
+		if err := encoder.WriteWAVTo(&out, f); err != nil {
+			t.Fatal(err)
+		}
+		if peak := peakOfValues(samples(out.Bytes()[44 : 44+f.Channel1Size])); peak != want {
+			t.Errorf("silent %v: peaks at %d, expected %d", silent, peak, want)
+		}
+	}
+}
+
+// samples decodes 16-bit PCM
+func samples(pcm []byte) []int {
+	values := make([]int, len(pcm)/2)
+	for i := range values {
+		values[i] = int(int16(binary.LittleEndian.Uint16(pcm[2*i:])))
+	}
+	return values
+}
+
+// peakOfValues returns the largest absolute value of samples
+func peakOfValues(values []int) int {
+	peak := 0
+	for _, v := range values {
+		if v < 0 {
+			v = -v
+		}
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
@@ -0,0 +1,121 @@
+package wav
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+)
+
+// Output formats written by the encoder
+const (
+	FormatWAV = "wav" // RIFF WAVE files
+	FormatRaw = "raw" // Headerless PCM, described by a companion JSON file
+)
+
+// Formats lists the valid output formats
+var Formats = []string{FormatWAV, FormatRaw}
+
+// RawInfoExt is the extension of the JSON files describing raw PCM files, replacing
+// the .raw extension
+const RawInfoExt = ".json"
+
+// RawInfo describes the layout of a raw PCM file, for engines reading it without a
+// header
+type RawInfo struct {
+	Name          string `json:"name"`
+	Comment       string `json:"comment,omitempty"`
+	SampleRate    int    `json:"sampleRate"`
+	Channels      int    `json:"channels"`
+	BitsPerSample int    `json:"bitsPerSample"`
+	Encoding      string `json:"encoding"`    // Always signed integer
+	ByteOrder     string `json:"byteOrder"`   // Always little endian
+	Interleaved   bool   `json:"interleaved"` // Stereo frames are stored LRLR...
+	Frames        int    `json:"frames"`
+	RootKey       *int   `json:"rootKey,omitempty"` // MIDI note, absent when unknown
+}
+
+// NewRawInfo describes the raw PCM data written for the EBL file
+func NewRawInfo(eblFile *ebl.EBLFile) RawInfo {
+	info := RawInfo{
+		Name:          eblFile.Name(),
+		Comment:       eblFile.HeaderData.CommentStr,
+		SampleRate:    eblFile.HeaderData.SampleRate,
+		Channels:      eblFile.Channels(),
+		BitsPerSample: 16,
+		Encoding:      "signed-integer",
+		ByteOrder:     "little-endian",
+		Interleaved:   eblFile.Channels() == 2,
+		Frames:        eblFile.Frames(),
+	}
+	if eblFile.RootKey >= 0 {
+		rootKey := eblFile.RootKey
+		info.RootKey = &rootKey
+	}
+	return info
+}
+
+// RawInfoPath returns the path of the JSON file describing the raw PCM file at path
+func RawInfoPath(path string) string {
+	return strings.TrimSuffix(path, "."+FormatRaw) + RawInfoExt
+}
+
+// WriteRawTo writes the EBL audio data to w as headerless 16-bit little endian PCM,
+// stereo channels interleaved
+func (e *Encoder) WriteRawTo(w io.Writer, eblFile *ebl.EBLFile) error {
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	defer func() {
+		bw.Reset(nil)
+		writerPool.Put(bw)
+	}()
+
+	g, err := e.normalizeGain(eblFile)
+	if err != nil {
+		return err
+	}
+	if eblFile.Streamed() || g != nil {
+		err = writeStreamed(bw, eblFile, g)
+	} else if eblFile.Channel2Size == 0 {
+		_, err = bw.Write(eblFile.Channel1Data)
+	} else {
+		err = writeInterleaved(bw, eblFile.Channel1Data, eblFile.Channel2Data)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing audio data: %w", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing raw file: %w", err)
+	}
+	return nil
+}
+
+// writeRawFile writes the EBL audio data as raw PCM to outputPath, and its
+// description next to it
+func (e *Encoder) writeRawFile(eblFile *ebl.EBLFile, outputPath string) error {
+	file, err := atomicfile.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	if err := e.WriteRawTo(e.limiter.Writer(file), eblFile); err != nil {
+		file.Abort()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(NewRawInfo(eblFile), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding raw file description: %w", err)
+	}
+	if err := atomicfile.WriteFile(RawInfoPath(outputPath), append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing raw file description: %w", err)
+	}
+	return nil
+}
@@ -21,3 +21,18 @@ type WAVHeader struct {
 	DataID   [4]byte // "data"
 	DataSize uint32  // NumSamples * NumChannels * BitsPerSample/8
 }
+
+// SmplChunk represents a sampler chunk without loops
+type SmplChunk struct {
+	ID                [4]byte // "smpl"
+	Size              uint32  // 36 + NumSampleLoops * 24
+	Manufacturer      uint32  // MMA manufacturer code, 0 for none
+	Product           uint32  // Manufacturer specific product code
+	SamplePeriod      uint32  // Nanoseconds per sample, 1e9 / SampleRate
+	MIDIUnityNote     uint32  // MIDI note played back at the original pitch
+	MIDIPitchFraction uint32  // Fraction of a semitone above the unity note (0x80000000 = 50 cents)
+	SMPTEFormat       uint32  // 0 for no SMPTE offset
+	SMPTEOffset       uint32
+	NumSampleLoops    uint32
+	SamplerData       uint32 // Bytes of additional sampler data
+}
@@ -0,0 +1,199 @@
+// Package waveform renders waveform images of 16-bit PCM audio as PNG or SVG, as
+// shown by sample library shops and browsers
+package waveform
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Image formats
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Options sets the size and colors of rendered images
+type Options struct {
+	Width      int
+	Height     int
+	Foreground color.NRGBA
+	Background color.NRGBA // Transparent when its alpha is 0
+}
+
+// DefaultOptions returns the options used when none are given: 800x200 pixels,
+// blue on white
+func DefaultOptions() Options {
+	return Options{
+		Width:      800,
+		Height:     200,
+		Foreground: color.NRGBA{0x2b, 0x6c, 0xb0, 0xff},
+		Background: color.NRGBA{0xff, 0xff, 0xff, 0xff},
+	}
+}
+
+// Peaks holds the lowest and highest sample value of each column of an image, per
+// channel, scaled to -1..1
+type Peaks struct {
+	Min [][]float64
+	Max [][]float64
+}
+
+// Compute reads the 16-bit little endian PCM data of each channel, frames samples
+// long, and returns its peaks over width columns
+func Compute(width, frames int, channels ...io.Reader) (*Peaks, error) {
+	if width <= 0 {
+		return nil, fmt.Errorf("width must be positive")
+	}
+
+	p := &Peaks{
+		Min: make([][]float64, len(channels)),
+		Max: make([][]float64, len(channels)),
+	}
+	for c, r := range channels {
+		lo := make([]float64, width)
+		hi := make([]float64, width)
+		br := bufio.NewReader(r)
+		var sample [2]byte
+		for i := 0; i < frames; i++ {
+			if _, err := io.ReadFull(br, sample[:]); err != nil {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					break // A short channel ends in silence
+				}
+				return nil, fmt.Errorf("error reading channel %d: %w", c+1, err)
+			}
+			v := float64(int16(binary.LittleEndian.Uint16(sample[:]))) / 32768
+			col := int(int64(i) * int64(width) / int64(frames))
+			if v < lo[col] {
+				lo[col] = v
+			}
+			if v > hi[col] {
+				hi[col] = v
+			}
+		}
+		p.Min[c], p.Max[c] = lo, hi
+	}
+	return p, nil
+}
+
+// lane returns the vertical extent of the pixels of a column of channel c, each
+// channel drawn in its own horizontal lane
+func (p *Peaks) lane(c, col int, o Options) (top, bottom int) {
+	laneHeight := o.Height / len(p.Min)
+	mid := c*laneHeight + laneHeight/2
+	half := float64(laneHeight) / 2
+
+	top = mid - int(p.Max[c][col]*half)
+	bottom = mid - int(p.Min[c][col]*half)
+	if top < c*laneHeight {
+		top = c * laneHeight
+	}
+	if bottom >= (c+1)*laneHeight {
+		bottom = (c+1)*laneHeight - 1
+	}
+	return top, bottom
+}
+
+// WritePNG draws the peaks as a PNG image
+func (p *Peaks) WritePNG(w io.Writer, o Options) error {
+	img := image.NewNRGBA(image.Rect(0, 0, o.Width, o.Height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = o.Background.R, o.Background.G, o.Background.B, o.Background.A
+	}
+
+	for c := range p.Min {
+		for x := 0; x < o.Width && x < len(p.Min[c]); x++ {
+			top, bottom := p.lane(c, x, o)
+			for y := top; y <= bottom; y++ {
+				img.SetNRGBA(x, y, o.Foreground)
+			}
+		}
+	}
+
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("error encoding PNG: %w", err)
+	}
+	return nil
+}
+
+// WriteSVG draws the peaks as an SVG image, one vertical stroke per column
+func (p *Peaks) WriteSVG(w io.Writer, o Options) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		o.Width, o.Height, o.Width, o.Height)
+	if o.Background.A > 0 {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", FormatColor(o.Background))
+	}
+
+	fmt.Fprintf(bw, `<path stroke="%s" stroke-width="1" d="`, FormatColor(o.Foreground))
+	for c := range p.Min {
+		for x := 0; x < o.Width && x < len(p.Min[c]); x++ {
+			top, bottom := p.lane(c, x, o)
+			fmt.Fprintf(bw, "M%d.5 %dV%d", x, top, bottom+1)
+		}
+	}
+	bw.WriteString("\"/>\n</svg>\n")
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error writing SVG: %w", err)
+	}
+	return nil
+}
+
+// Write draws the peaks in format (FormatPNG or FormatSVG)
+func (p *Peaks) Write(w io.Writer, format string, o Options) error {
+	switch format {
+	case FormatPNG:
+		return p.WritePNG(w, o)
+	case FormatSVG:
+		return p.WriteSVG(w, o)
+	}
+	return fmt.Errorf("unknown waveform format %q", format)
+}
+
+// ParseColor parses a #rrggbb or #rrggbbaa color, or "transparent"
+func ParseColor(s string) (color.NRGBA, error) {
+	if strings.EqualFold(s, "transparent") || strings.EqualFold(s, "none") {
+		return color.NRGBA{}, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb or #rrggbbaa", s)
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// FormatColor returns a color as #rrggbb, or #rrggbbaa when not opaque
+func FormatColor(c color.NRGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+// ParseSize parses a WIDTHxHEIGHT size such as 800x200
+func ParseSize(s string) (width, height int, err error) {
+	ws, hs, ok := strings.Cut(strings.ToLower(s), "x")
+	if ok {
+		width, err = strconv.Atoi(ws)
+	}
+	if ok && err == nil {
+		height, err = strconv.Atoi(hs)
+	}
+	if !ok || err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q, expected WIDTHxHEIGHT", s)
+	}
+	return width, height, nil
+}
@@ -0,0 +1,378 @@
+// Package convert converts E-MU EBL samples to WAV, FLAC or raw PCM files.
+//
+// It exposes the conversion pipeline used by ebl2wav to other Go programs:
+//
+//	c, err := convert.New(convert.WithFormat(convert.FormatFLAC), convert.WithWorkers(4))
+//	if err != nil {
+//		return err
+//	}
+//	results, err := c.ConvertDirectory("Bank/SamplePool", "out")
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/ebl"
+	"github.com/mattetti/e-mu-soundbanks/internal/flac"
+	"github.com/mattetti/e-mu-soundbanks/internal/wav"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// Converter converts EBL files using the options it was created with.
+// It is safe for concurrent use.
+type Converter struct {
+	debug    bool
+	workers  int
+	format   Format
+	namer    Namer
+	sink     sink.Sink
+	flac     *flac.Converter
+	progress func(event ProgressEvent)
+}
+
+// Sample describes a decoded EBL sample
+type Sample struct {
+	Source     string  // Path of the EBL file
+	Name       string  // Sample name decoded from the header
+	Comment    string  // Comment decoded from the header
+	SampleRate int     // Hz
+	Channels   int     // 1 for mono, 2 for stereo
+	Frames     int     // Sample frames per channel
+	Duration   float64 // Seconds
+	RootKey    int     // MIDI unity note, -1 when unknown
+	Variant    string  // EBL layout variant, e.g. "TOC2+extended"
+	Strategy   string  // Parse strategy which read the file, "standard" unless an alternate one recovered it
+}
+
+// Result is the outcome of converting a single EBL file
+type Result struct {
+	Sample
+	Output string // Name of the written audio file in the sink, empty on failure
+	Size   int64  // Size of the written audio file in bytes
+	Err    error  // Parsing or encoding error, nil on success
+}
+
+// ProgressEvent reports how far ConvertFiles or ConvertDirectory got
+type ProgressEvent struct {
+	Result                // File just converted, or failed when Err is set
+	Done    int           // Files handled so far
+	Total   int           // Files to handle
+	Failed  int           // Files which failed to convert so far
+	Elapsed time.Duration // Time since the conversion started
+}
+
+// tracker counts the files handled by a conversion and reports them to the progress
+// function of the Converter
+type tracker struct {
+	mu       sync.Mutex
+	progress func(event ProgressEvent)
+	start    time.Time
+	done     int
+	total    int
+	failed   int
+}
+
+// newTracker returns a tracker of total files, nil without progress function
+func (c *Converter) newTracker(total int) *tracker {
+	if c.progress == nil {
+		return nil
+	}
+	return &tracker{progress: c.progress, start: time.Now(), total: total}
+}
+
+// add reports a handled file
+func (t *tracker) add(result Result) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done++
+	if result.Err != nil {
+		t.failed++
+	}
+	t.progress(ProgressEvent{
+		Result:  result,
+		Done:    t.done,
+		Total:   t.total,
+		Failed:  t.failed,
+		Elapsed: time.Since(t.start),
+	})
+}
+
+// New creates a Converter configured by opts
+func New(opts ...Option) (*Converter, error) {
+	c := &Converter{
+		workers: runtime.NumCPU(),
+		format:  FormatWAV,
+		sink:    sink.NewDir(""),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	switch c.format {
+	case FormatWAV, FormatRaw:
+	case FormatFLAC:
+		flacConverter, err := flac.NewConverter(c.debug)
+		if err != nil {
+			return nil, fmt.Errorf("error initializing FLAC converter: %w", err)
+		}
+		c.flac = flacConverter
+	default:
+		return nil, fmt.Errorf("unsupported format: %q", c.format)
+	}
+
+	return c, nil
+}
+
+// Debug logs a message if debug mode is enabled
+func (c *Converter) Debug(message string) {
+	if c.debug {
+		fmt.Println(message)
+	}
+}
+
+// ConvertFile converts a single EBL file into outputDir, a directory of the sink.
+// Failures are reported in Result.Err.
+func (c *Converter) ConvertFile(inputFile, outputDir string) Result {
+	parser := ebl.NewParser(c.debug, false)
+	eblFile, err := parser.ReadFile(inputFile, "")
+	if err != nil {
+		return Result{Sample: Sample{Source: inputFile, RootKey: -1}, Err: err}
+	}
+
+	result := Result{Sample: newSample(eblFile)}
+
+	encoder := wav.NewEncoder(c.debug, false, false, "")
+	name := strings.TrimSuffix(encoder.OutputFilename(eblFile), ".wav")
+	if c.namer != nil {
+		name = c.namer(result.Sample)
+	}
+	outputPath := path.Join(filepath.ToSlash(outputDir), name+"."+string(c.format))
+
+	w, err := c.sink.Create(outputPath)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	counter := &countingWriter{w: w}
+
+	err = c.encode(counter, encoder, eblFile)
+	if aborter, ok := w.(sink.Aborter); ok && err != nil {
+		aborter.Abort()
+	} else if closeErr := w.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error closing output file: %w", closeErr)
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if c.format == FormatRaw {
+		if err := c.writeRawInfo(wav.RawInfoPath(outputPath), eblFile); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	result.Output = outputPath
+	result.Size = counter.n
+	c.Debug(fmt.Sprintf("Converted %s to %s", inputFile, outputPath))
+
+	return result
+}
+
+// Convert converts the EBL data read from r and writes the audio to w in the configured
+// format, without touching the filesystem or the sink, e.g. to answer a request of a web
+// service. name identifies the source in the returned Sample and errors. The sink,
+// namer and workers options don't apply, and with FormatRaw only the PCM data is
+// written, the Sample describing it.
+func (c *Converter) Convert(r io.Reader, name string, w io.Writer) (Sample, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Sample{Source: name, RootKey: -1}, fmt.Errorf("error reading %s: %w", name, err)
+	}
+
+	parser := ebl.NewParser(c.debug, false)
+	// The data is given as source too, so files failing the standard parse are retried
+	eblFile, err := parser.ReadSource(bytes.NewReader(data), bytes.NewReader(data), name, int64(len(data)))
+	if err != nil {
+		return Sample{Source: name, RootKey: -1}, err
+	}
+	defer eblFile.Release()
+
+	sample := newSample(eblFile)
+	encoder := wav.NewEncoder(c.debug, false, false, "")
+	if err := c.encode(w, encoder, eblFile); err != nil {
+		return sample, err
+	}
+	return sample, nil
+}
+
+// Bytes converts the content of an EBL file to WAV in memory, returning the WAV file
+func Bytes(data []byte) ([]byte, error) {
+	c, err := New()
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if _, err := c.Convert(bytes.NewReader(data), "sample.ebl", &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// encode writes the audio of eblFile to w in the configured format
+func (c *Converter) encode(w io.Writer, encoder *wav.Encoder, eblFile *ebl.EBLFile) error {
+	switch c.format {
+	case FormatFLAC:
+		// Stream the WAV encoding through ffmpeg
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(encoder.WriteWAVTo(pw, eblFile))
+		}()
+		err := c.flac.Encode(w, pr, flac.Tags{
+			Title:   eblFile.Name(),
+			Comment: eblFile.HeaderData.CommentStr,
+			Encoder: flac.DefaultEncoder,
+		})
+		pr.Close()
+		return err
+	case FormatRaw:
+		return encoder.WriteRawTo(w, eblFile)
+	default:
+		return encoder.WriteWAVTo(w, eblFile)
+	}
+}
+
+// writeRawInfo writes the JSON description of a raw PCM file to the sink
+func (c *Converter) writeRawInfo(name string, eblFile *ebl.EBLFile) error {
+	data, err := json.MarshalIndent(wav.NewRawInfo(eblFile), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding raw file description: %w", err)
+	}
+	w, err := c.sink.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		if aborter, ok := w.(sink.Aborter); ok {
+			aborter.Abort()
+		} else {
+			w.Close()
+		}
+		return fmt.Errorf("error writing raw file description: %w", err)
+	}
+	return w.Close()
+}
+
+// ConvertFiles converts inputFiles into outputDir using the configured number of workers.
+// Results are returned in the order of inputFiles.
+func (c *Converter) ConvertFiles(inputFiles []string, outputDir string) []Result {
+	return c.convertFiles(inputFiles, outputDir, c.newTracker(len(inputFiles)))
+}
+
+// convertFiles converts inputFiles like ConvertFiles, reporting them to progress
+func (c *Converter) convertFiles(inputFiles []string, outputDir string, progress *tracker) []Result {
+	results := make([]Result, len(inputFiles))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < c.workers && w < len(inputFiles); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.ConvertFile(inputFiles[i], outputDir)
+				progress.add(results[i])
+			}
+		}()
+	}
+
+	for i := range inputFiles {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// ConvertDirectory converts every EBL file found in inputDir and its subdirectories,
+// mirroring the directory structure in outputDir. Results are sorted by source path.
+func (c *Converter) ConvertDirectory(inputDir, outputDir string) ([]Result, error) {
+	groups := make(map[string][]string)
+	total := 0
+	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".ebl" {
+			dir := filepath.Dir(path)
+			groups[dir] = append(groups[dir], path)
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning directory: %w", err)
+	}
+
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	progress := c.newTracker(total)
+	var results []Result
+	for _, dir := range dirs {
+		relPath, err := filepath.Rel(inputDir, dir)
+		if err != nil {
+			return nil, fmt.Errorf("error calculating relative path: %w", err)
+		}
+		results = append(results, c.convertFiles(groups[dir], filepath.Join(outputDir, relPath), progress)...)
+	}
+
+	return results, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// newSample describes a parsed EBL file
+func newSample(eblFile *ebl.EBLFile) Sample {
+	return Sample{
+		Source:     eblFile.Path,
+		Name:       eblFile.Name(),
+		Comment:    eblFile.HeaderData.CommentStr,
+		SampleRate: eblFile.HeaderData.SampleRate,
+		Channels:   eblFile.Channels(),
+		Frames:     eblFile.Frames(),
+		Duration:   eblFile.Duration(),
+		RootKey:    eblFile.RootKey,
+		Variant:    eblFile.Version.String(),
+		Strategy:   string(eblFile.Strategy),
+	}
+}
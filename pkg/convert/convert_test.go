@@ -0,0 +1,87 @@
+package convert_test
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/testgen"
+	"github.com/mattetti/e-mu-soundbanks/pkg/convert"
+	"github.com/mattetti/e-mu-soundbanks/pkg/sink"
+)
+
+// errDiskFull is returned by the writers of failingSink
+var errDiskFull = errors.New("disk full")
+
+// failingSink wraps a sink whose writers fail once limit bytes were written
+type failingSink struct {
+	sink.Sink
+	limit int
+}
+
+func (s *failingSink) Create(name string) (io.WriteCloser, error) {
+	w, err := s.Sink.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &failingWriter{WriteCloser: w, left: s.limit}, nil
+}
+
+// failingWriter passes writes through until it runs out of space
+type failingWriter struct {
+	io.WriteCloser
+	left int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		n, _ := w.WriteCloser.Write(p[:w.left])
+		w.left = 0
+		return n, errDiskFull
+	}
+	w.left -= len(p)
+	return w.WriteCloser.Write(p)
+}
+
+// Abort aborts the wrapped writer, which is closed as is when it can't abort
+func (w *failingWriter) Abort() error {
+	if aborter, ok := w.WriteCloser.(sink.Aborter); ok {
+		return aborter.Abort()
+	}
+	return w.WriteCloser.Close()
+}
+
+// TestConvertFileAbort checks that a file whose encoding fails is discarded by the
+// sink rather than stored truncated
+func TestConvertFileAbort(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "Kick.ebl")
+	if err := testgen.WriteFile(input, testgen.Options{Name: "Kick", Frames: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	memory := sink.NewMemory()
+	c, err := convert.New(convert.WithSink(&failingSink{Sink: memory, limit: 100}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := c.ConvertFile(input, "out")
+	if !errors.Is(result.Err, errDiskFull) {
+		t.Fatalf("got error %v, want %v", result.Err, errDiskFull)
+	}
+	if files := memory.Files(); len(files) != 0 {
+		t.Errorf("failed file was stored: %v", files)
+	}
+
+	// The same file converts once the sink has room
+	c, err = convert.New(convert.WithSink(memory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := c.ConvertFile(input, "out"); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if files := memory.Files(); len(files) != 1 || files[0] != "out/Kick.wav" {
+		t.Errorf("got files %v, want [out/Kick.wav]", files)
+	}
+}
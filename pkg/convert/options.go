@@ -0,0 +1,65 @@
+package convert
+
+import "github.com/mattetti/e-mu-soundbanks/pkg/sink"
+
+// Format is the audio format written by a Converter
+type Format string
+
+const (
+	FormatWAV  Format = "wav"
+	FormatFLAC Format = "flac" // Requires ffmpeg
+	FormatRaw  Format = "raw"  // Headerless 16-bit PCM, described by a .json file next to it
+)
+
+// Namer returns the output filename, without extension, for a decoded sample
+type Namer func(sample Sample) string
+
+// Option configures a Converter
+type Option func(c *Converter)
+
+// WithDebug enables debug logging to stdout
+func WithDebug(debug bool) Option {
+	return func(c *Converter) {
+		c.debug = debug
+	}
+}
+
+// WithWorkers sets the number of files converted concurrently, defaults to the number of CPUs
+func WithWorkers(workers int) Option {
+	return func(c *Converter) {
+		if workers > 0 {
+			c.workers = workers
+		}
+	}
+}
+
+// WithFormat sets the output audio format, defaults to FormatWAV
+func WithFormat(format Format) Option {
+	return func(c *Converter) {
+		c.format = format
+	}
+}
+
+// WithNamer sets the function naming output files, defaults to the sample name
+// decoded from the EBL header
+func WithNamer(namer Namer) Option {
+	return func(c *Converter) {
+		c.namer = namer
+	}
+}
+
+// WithProgress sets a function called each time ConvertFiles or ConvertDirectory is done
+// with a file. Calls don't overlap, but come from the worker goroutines.
+func WithProgress(progress func(event ProgressEvent)) Option {
+	return func(c *Converter) {
+		c.progress = progress
+	}
+}
+
+// WithSink sets where audio files are written, defaults to the local filesystem.
+// Output directories passed to the Converter are then relative to the sink root.
+func WithSink(s sink.Sink) Option {
+	return func(c *Converter) {
+		c.sink = s
+	}
+}
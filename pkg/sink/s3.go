@@ -0,0 +1,335 @@
+package sink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 reads and writes files of an S3 compatible bucket: Amazon S3, Google Cloud
+// Storage (through its XML API with HMAC keys), MinIO... Requests are signed with
+// AWS Signature Version 4.
+type S3 struct {
+	Endpoint     string // e.g. "https://s3.us-east-1.amazonaws.com"
+	Region       string // e.g. "us-east-1", "auto" for GCS
+	Bucket       string
+	Prefix       string // Key prefix prepended to file names
+	AccessKey    string
+	SecretKey    string
+	SessionToken string // Optional temporary credentials token
+	Client       *http.Client
+}
+
+// NewS3 creates a sink uploading to an Amazon S3 bucket below prefix. Credentials
+// and region are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN and AWS_REGION (defaults to us-east-1). AWS_ENDPOINT_URL
+// points the client at another S3 compatible service.
+func NewS3(bucket, prefix string) *S3 {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	return &S3{
+		Endpoint:     endpoint,
+		Region:       region,
+		Bucket:       bucket,
+		Prefix:       prefix,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// NewGCS creates a sink uploading to a Google Cloud Storage bucket below prefix,
+// using the HMAC key read from GCS_ACCESS_KEY_ID and GCS_SECRET_ACCESS_KEY
+func NewGCS(bucket, prefix string) *S3 {
+	return &S3{
+		Endpoint:  "https://storage.googleapis.com",
+		Region:    "auto",
+		Bucket:    bucket,
+		Prefix:    prefix,
+		AccessKey: os.Getenv("GCS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("GCS_SECRET_ACCESS_KEY"),
+	}
+}
+
+// Create returns a writer uploading the named object when closed
+func (s *S3) Create(name string) (io.WriteCloser, error) {
+	return &s3Object{s3: s, key: path.Join(s.Prefix, name)}, nil
+}
+
+// Object describes an object stored in a bucket
+type Object struct {
+	Key  string
+	Size int64
+}
+
+// ParseURL creates a client for an s3://bucket/key or gs://bucket/key URL, using the
+// credentials of NewS3 or NewGCS. The key is returned separately, Prefix is left empty.
+func ParseURL(rawURL string) (*S3, string, error) {
+	var s *S3
+	var rest string
+	switch {
+	case strings.HasPrefix(rawURL, "s3://"):
+		rest = strings.TrimPrefix(rawURL, "s3://")
+		s = NewS3("", "")
+	case strings.HasPrefix(rawURL, "gs://"):
+		rest = strings.TrimPrefix(rawURL, "gs://")
+		s = NewGCS("", "")
+	default:
+		return nil, "", fmt.Errorf("unsupported object storage URL: %s", rawURL)
+	}
+
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, "", fmt.Errorf("missing bucket name in %s", rawURL)
+	}
+	s.Bucket = bucket
+	return s, key, nil
+}
+
+// IsURL reports whether p is an object storage URL understood by ParseURL
+func IsURL(p string) bool {
+	return strings.HasPrefix(p, "s3://") || strings.HasPrefix(p, "gs://")
+}
+
+// List returns every object whose key starts with prefix, sorted by key
+func (s *S3) List(prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+
+		var result struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key  string
+				Size int64
+			}
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding bucket listing: %w", err)
+		}
+
+		for _, content := range result.Contents {
+			objects = append(objects, Object{Key: content.Key, Size: content.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+// Open returns a reader streaming the content of the object stored at key
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", key, err)
+	}
+	return resp.Body, nil
+}
+
+// put uploads an object
+func (s *S3) put(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, nil, data)
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %w", key, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for the object stored at key, or for the bucket itself
+// when key is empty. Responses with an error status are returned as errors.
+func (s *S3) do(method, key string, query map[string]string, body []byte) (*http.Response, error) {
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("missing object storage credentials")
+	}
+
+	requestURL := strings.TrimSuffix(s.Endpoint, "/") + "/" + uriEncode(s.Bucket, true)
+	if key != "" {
+		requestURL += "/" + uriEncode(key, false)
+	}
+
+	// Signature Version 4 expects the query sorted and encoded its own way
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, 0, len(names))
+	for _, name := range names {
+		params = append(params, uriEncode(name, true)+"="+uriEncode(query[name], true))
+	}
+	if len(params) > 0 {
+		requestURL += "?" + strings.Join(params, "&")
+	}
+
+	req, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType(key))
+	}
+	s.sign(req, body, time.Now().UTC())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req
+func (s *S3) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	// Canonical headers, sorted by lowercase name
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(req.Header.Get(name)))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+	// net/http sends Host from req.Host, not from the header map
+	req.Header.Del("Host")
+}
+
+// s3Object buffers an object until it is closed
+type s3Object struct {
+	bytes.Buffer
+	s3  *S3
+	key string
+}
+
+func (o *s3Object) Close() error {
+	return o.s3.put(o.key, o.Bytes())
+}
+
+// Abort discards the object, which is never uploaded
+func (o *s3Object) Abort() error {
+	o.Reset()
+	return nil
+}
+
+// uriEncode percent-encodes s as required by Signature Version 4,
+// leaving slashes as is unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// contentType returns the MIME type stored with an object
+func contentType(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".wav":
+		return "audio/wav"
+	case ".flac":
+		return "audio/flac"
+	case ".json":
+		return "application/json"
+	case ".zip":
+		return "application/zip"
+	}
+	return "application/octet-stream"
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,116 @@
+// Package sink abstracts where converted audio files are written to: a local
+// directory, memory, a zip archive or S3 compatible object storage.
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/atomicfile"
+)
+
+// Sink is a destination for converted files. Names are slash separated paths
+// relative to the sink root. Implementations are safe for concurrent use.
+type Sink interface {
+	// Create returns a writer for the named file. The file is complete once the
+	// writer is closed successfully.
+	Create(name string) (io.WriteCloser, error)
+}
+
+// Aborter is implemented by the writers of sinks which can discard a file whose
+// writing failed, rather than keeping it truncated when closed. The writers of every
+// sink of this package implement it.
+type Aborter interface {
+	Abort() error
+}
+
+// Dir writes files below a local directory
+type Dir struct {
+	root string
+}
+
+// NewDir creates a sink writing below root. Directories are created as needed.
+func NewDir(root string) *Dir {
+	return &Dir{root: root}
+}
+
+// Create creates the named file, replacing an existing one
+func (d *Dir) Create(name string) (io.WriteCloser, error) {
+	filePath := filepath.Join(d.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	// Written under a temporary name until closed, so failed and interrupted writes
+	// leave no truncated file
+	file, err := atomicfile.Create(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %w", err)
+	}
+	return file, nil
+}
+
+// Memory keeps files in memory, e.g. to serve them without touching the disk
+type Memory struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemory creates an empty in-memory sink
+func NewMemory() *Memory {
+	return &Memory{files: make(map[string][]byte)}
+}
+
+// Create returns a writer storing the named file when closed
+func (m *Memory) Create(name string) (io.WriteCloser, error) {
+	return &memoryFile{memory: m, name: path.Clean(name)}, nil
+}
+
+// Files returns the names of the stored files, sorted
+func (m *Memory) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// File returns the content of the named file
+func (m *Memory) File(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[path.Clean(name)]
+	return data, ok
+}
+
+// memoryFile buffers a file until it is closed
+type memoryFile struct {
+	bytes.Buffer
+	memory *Memory
+	name   string
+}
+
+func (f *memoryFile) Close() error {
+	f.memory.mu.Lock()
+	defer f.memory.mu.Unlock()
+
+	f.memory.files[f.name] = f.Bytes()
+	return nil
+}
+
+// Abort discards the file, which is never stored
+func (f *memoryFile) Abort() error {
+	f.Reset()
+	return nil
+}
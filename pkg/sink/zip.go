@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/mattetti/e-mu-soundbanks/internal/archive"
+)
+
+// Zip writes files into a zip archive. Close must be called once every file has
+// been written to finish the archive.
+type Zip struct {
+	mu sync.Mutex
+	zw *zip.Writer
+}
+
+// NewZip creates a sink writing a zip archive to w
+func NewZip(w io.Writer) *Zip {
+	return &Zip{zw: zip.NewWriter(w)}
+}
+
+// Create returns a writer adding the named file to the archive when closed.
+// Files are buffered so concurrent conversions don't interleave their entries.
+func (z *Zip) Create(name string) (io.WriteCloser, error) {
+	return &zipFile{zip: z, name: path.Clean(name)}, nil
+}
+
+// Close writes the zip central directory
+func (z *Zip) Close() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if err := z.zw.Close(); err != nil {
+		return fmt.Errorf("error writing zip file: %w", err)
+	}
+	return nil
+}
+
+// zipFile buffers an archive entry until it is closed
+type zipFile struct {
+	bytes.Buffer
+	zip  *Zip
+	name string
+}
+
+func (f *zipFile) Close() error {
+	f.zip.mu.Lock()
+	defer f.zip.mu.Unlock()
+
+	header := &zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: archive.ModTime()}
+	// FLAC is already compressed, deflating it only costs time
+	if strings.ToLower(path.Ext(f.name)) == ".flac" {
+		header.Method = zip.Store
+	}
+
+	w, err := f.zip.zw.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("error adding %s to zip: %w", f.name, err)
+	}
+	if _, err := w.Write(f.Bytes()); err != nil {
+		return fmt.Errorf("error adding %s to zip: %w", f.name, err)
+	}
+	return nil
+}
+
+// Abort discards the entry, which is never added to the archive
+func (f *zipFile) Abort() error {
+	f.Reset()
+	return nil
+}